@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	"gopkg.in/gin-gonic/gin.v1"
+
+	"github.com/Bnei-Baruch/archive-backend/search"
+)
+
+// Reloads grammar variables (and grammar index when enabled) without server restart.
+func ReloadVariablesHandler(c *gin.Context) {
+	value, ok := c.Get("VARIABLES_RELOADER")
+	if !ok {
+		NewBadRequestError(errors.New("Variables reload is not supported.")).Abort(c)
+		return
+	}
+	reloader := value.(*search.VariablesReloader)
+	if err := reloader.Reload(); err != nil {
+		NewInternalError(err).Abort(c)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "ok",
+		"variables":   len(reloader.Variables()),
+		"reloaded_at": reloader.ReloadedAt(),
+	})
+}
@@ -0,0 +1,416 @@
+package api
+
+import (
+	"container/list"
+	"crypto/md5"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/volatiletech/sqlboiler/v4/queries/qm"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/cache"
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+	"github.com/Bnei-Baruch/archive-backend/feeds"
+	"github.com/Bnei-Baruch/archive-backend/mdb"
+	mdbmodels "github.com/Bnei-Baruch/archive-backend/mdb/models"
+	"github.com/Bnei-Baruch/archive-backend/search"
+	"github.com/Bnei-Baruch/archive-backend/utils"
+)
+
+const (
+	SEARCH_FEED_SIZE               = 30
+	SEARCH_FEED_DESCRIPTION_LENGTH = 300
+)
+
+// Section of the unit page in the site by unit content type, lessons page otherwise.
+var SEARCH_FEED_UNIT_SECTIONS = map[string]string{
+	consts.CT_VIDEO_PROGRAM_CHAPTER: "programs/cu",
+	consts.CT_CLIP:                  "programs/cu",
+	consts.CT_ARTICLE:               "publications/articles/cu",
+	consts.CT_PUBLICATION:           "publications/articles/cu",
+	consts.CT_EVENT_PART:            "events/cu",
+	consts.CT_FRIENDS_GATHERING:     "events/cu",
+	consts.CT_MEAL:                  "events/cu",
+	consts.CT_SONG:                  "music/cu",
+}
+
+// Section of the collection page in the site by collection content type, programs page otherwise.
+var SEARCH_FEED_COLLECTION_SECTIONS = map[string]string{
+	consts.CT_LESSONS_SERIES: "lessons/series/c",
+	consts.CT_CONGRESS:       "events/c",
+	consts.CT_HOLIDAY:        "events/c",
+	consts.CT_PICNIC:         "events/c",
+	consts.CT_UNITY_DAY:      "events/c",
+}
+
+// Rendered search feeds by normalized query, refreshed after feeds.search-cache-ttl.
+var searchFeedsCache = newSearchFeedCache()
+
+type searchFeedCacheEntry struct {
+	key     string
+	content string
+	expires time.Time
+}
+
+// Least recently used feeds cache.
+type searchFeedCache struct {
+	entries map[string]*list.Element
+	order   *list.List
+	mux     sync.Mutex
+}
+
+func newSearchFeedCache() *searchFeedCache {
+	return &searchFeedCache{
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (fc *searchFeedCache) Get(key string, now time.Time) (string, bool) {
+	fc.mux.Lock()
+	defer fc.mux.Unlock()
+	element, ok := fc.entries[key]
+	if !ok {
+		return "", false
+	}
+	entry := element.Value.(*searchFeedCacheEntry)
+	if now.After(entry.expires) {
+		fc.order.Remove(element)
+		delete(fc.entries, key)
+		return "", false
+	}
+	fc.order.MoveToFront(element)
+	return entry.content, true
+}
+
+func (fc *searchFeedCache) Set(key string, content string, expires time.Time, limit int) {
+	fc.mux.Lock()
+	defer fc.mux.Unlock()
+	if element, ok := fc.entries[key]; ok {
+		fc.order.Remove(element)
+	}
+	fc.entries[key] = fc.order.PushFront(&searchFeedCacheEntry{key: key, content: content, expires: expires})
+	for fc.order.Len() > limit {
+		last := fc.order.Back()
+		fc.order.Remove(last)
+		delete(fc.entries, last.Value.(*searchFeedCacheEntry).key)
+	}
+}
+
+// Parses the feed query from q and the filter params, e.g., ?q=arvut&content_type=LESSON_PART,CLIP&tag=xyz.
+func searchFeedQuery(c *gin.Context) search.Query {
+	query := search.ParseQuery(c.Query("q"))
+	for _, filter := range consts.ALL_FILTERS {
+		for _, value := range c.QueryArray(filter) {
+			for _, v := range strings.Split(value, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					name := filter
+					if filter == consts.FILTER_AUTHOR {
+						name = consts.FILTER_SOURCE
+					}
+					query.Filters[name] = append(query.Filters[name], v)
+				}
+			}
+		}
+	}
+	return query
+}
+
+// Feeds of the same language, terms (case and spaces insensitive) and filters (order insensitive) are cached together.
+func searchFeedCacheKey(lang string, query search.Query) string {
+	exactTerms := append([]string(nil), query.ExactTerms...)
+	sort.Strings(exactTerms)
+	parts := []string{lang, strings.Join(strings.Fields(strings.ToLower(query.Term)), " "), strings.ToLower(strings.Join(exactTerms, "|"))}
+	filters := make([]string, 0, len(query.Filters))
+	for name, values := range query.Filters {
+		sorted := append([]string(nil), values...)
+		sort.Strings(sorted)
+		filters = append(filters, fmt.Sprintf("%s:%s", name, strings.Join(sorted, ",")))
+	}
+	sort.Strings(filters)
+	return strings.Join(append(parts, filters...), "\n")
+}
+
+// /feeds/search/:DLANG?q=...&content_type=...
+// Latest search results as RSS, newer to older.
+func FeedSearch(c *gin.Context) {
+	var config feedConfig
+	(&config).getConfig(c)
+
+	query := searchFeedQuery(c)
+	if len(query.Term) == 0 && len(query.ExactTerms) == 0 {
+		NewBadRequestError(errors.New("Can't search with no terms.")).Abort(c)
+		return
+	}
+	query.LanguageOrder = []string{config.Lang}
+
+	key := searchFeedCacheKey(config.Lang, query)
+	if content, ok := searchFeedsCache.Get(key, time.Now()); ok {
+		c.Header("Content-Type", "application/rss+xml; charset=utf-8")
+		c.String(http.StatusOK, content)
+		return
+	}
+
+	esManager := c.MustGet("ES_MANAGER").(*search.ESManager)
+	db := c.MustGet("MDB_DB").(*sql.DB)
+	cacheM := c.MustGet("CACHE").(cache.CacheManager)
+	tc := c.MustGet("TOKENS_CACHE").(*search.TokensCache)
+	variables := c.MustGet("VARIABLES").(search.VariablesV2)
+
+	esc, err := esManager.GetClient()
+	if err != nil {
+		NewBadRequestError(errors.Wrap(err, "Failed to connect to ElasticSearch.")).Abort(c)
+		return
+	}
+
+	se := search.NewESEngine(esc, db, cacheM, tc, variables, consts.ES_SEARCH_RESULT_TYPES)
+	se.Transliterator = c.MustGet("TRANSLITERATOR").(*search.Transliterator)
+
+	// Same preference for all feed readers, the result is cached anyway.
+	preference := fmt.Sprintf("%x", md5.Sum([]byte(key)))
+	res, err := se.DoSearch(
+		c.Request.Context(),
+		query,
+		consts.SORT_BY_NEWER_TO_OLDER,
+		0,
+		SEARCH_FEED_SIZE,
+		preference,
+		false,
+		true,
+		false,
+		false,
+		SearchDeadlines(),
+		nil,
+	)
+	if err != nil {
+		NewInternalError(err).Abort(c)
+		return
+	}
+
+	items, err := searchHitsToFeedItems(res.SearchResult.Hits.Hits, config.Lang)
+	if err != nil {
+		NewInternalError(err).Abort(c)
+		return
+	}
+	if err := setSearchFeedEnclosures(db, items, config.Lang); err != nil {
+		// Items are still valid without enclosures.
+		log.Errorf("FeedSearch - failed loading enclosures: %+v", err)
+	}
+
+	feed := &feeds.Feed{
+		Title:       fmt.Sprintf("Kabbalah Media Search: %s", c.Query("q")),
+		Link:        getHref(c.Request.URL.RequestURI(), c),
+		Description: fmt.Sprintf("Latest results for \"%s\" from Kabbalahmedia Archive", c.Query("q")),
+		Language:    config.Lang,
+		Updated:     time.Now(),
+		Copyright:   copyright,
+	}
+	feed.Items = make([]*feeds.Item, len(items))
+	for i := range items {
+		feed.Items[i] = items[i].Item
+	}
+	content, err := feed.RssFeed().ToXML()
+	if err != nil {
+		NewInternalError(err).Abort(c)
+		return
+	}
+
+	// Don't cache partial feeds.
+	if len(res.Degraded) == 0 {
+		viper.SetDefault("feeds.search-cache-ttl", 10*time.Minute)
+		viper.SetDefault("feeds.search-cache-size", 1000)
+		searchFeedsCache.Set(key, content, time.Now().Add(viper.GetDuration("feeds.search-cache-ttl")), viper.GetInt("feeds.search-cache-size"))
+	}
+	c.Header("Content-Type", "application/rss+xml; charset=utf-8")
+	c.String(http.StatusOK, content)
+}
+
+// Feed item and the unit it represents, if any, for loading of enclosures.
+type searchFeedItem struct {
+	Item    *feeds.Item
+	UnitUID string
+}
+
+func searchHitsToFeedItems(hits []*elastic.SearchHit, lang string) ([]searchFeedItem, error) {
+	items := []searchFeedItem{}
+	for _, hit := range hits {
+		if hit.Type == consts.SEARCH_RESULT_TWEETS_MANY {
+			// Tweets are moved by DoSearch from innerHits to Source, see NativizeTweetsHitForClient.
+			if hit.Source == nil {
+				continue
+			}
+			tweetHits := []*elastic.SearchHit{}
+			if err := json.Unmarshal(*hit.Source, &tweetHits); err != nil {
+				return nil, errors.Wrap(err, "searchHitsToFeedItems - unmarshal tweets")
+			}
+			for _, tweetHit := range tweetHits {
+				item, err := searchHitToFeedItem(tweetHit, lang)
+				if err != nil {
+					return nil, err
+				}
+				if item != nil {
+					items = append(items, *item)
+				}
+			}
+			continue
+		}
+		item, err := searchHitToFeedItem(hit, lang)
+		if err != nil {
+			return nil, err
+		}
+		if item != nil {
+			items = append(items, *item)
+		}
+	}
+	// Grammar and tweets results are not sorted with the main results.
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Item.Created.After(items[j].Item.Created)
+	})
+	return items, nil
+}
+
+// Returns nil for hits not represented in feeds, e.g., landing pages.
+func searchHitToFeedItem(hit *elastic.SearchHit, lang string) (*searchFeedItem, error) {
+	if hit.Source == nil {
+		return nil, nil
+	}
+	var result es.Result
+	if err := json.Unmarshal(*hit.Source, &result); err != nil {
+		return nil, errors.Wrapf(err, "searchHitToFeedItem - unmarshal hit %s", hit.Id)
+	}
+	if result.MDB_UID == "" {
+		return nil, nil
+	}
+
+	item := &searchFeedItem{Item: &feeds.Item{Title: result.Title}}
+	section := ""
+	switch result.ResultType {
+	case consts.ES_RESULT_TYPE_UNITS:
+		section = "lessons/cu"
+		if contentTypes, err := es.KeyValuesToValues(consts.FILTER_CONTENT_TYPE, result.FilterValues); err == nil && len(contentTypes) > 0 {
+			if s, ok := SEARCH_FEED_UNIT_SECTIONS[contentTypes[0]]; ok {
+				section = s
+			}
+		}
+		item.UnitUID = result.MDB_UID
+	case consts.ES_RESULT_TYPE_COLLECTIONS:
+		section = "programs/c"
+		if contentTypes, err := es.KeyValuesToValues(consts.FILTER_COLLECTIONS_CONTENT_TYPE, result.FilterValues); err == nil && len(contentTypes) > 0 {
+			if s, ok := SEARCH_FEED_COLLECTION_SECTIONS[contentTypes[0]]; ok {
+				section = s
+			}
+		}
+	case consts.ES_RESULT_TYPE_SOURCES:
+		section = "sources"
+	case consts.ES_RESULT_TYPE_BLOG_POSTS:
+		// MDB_UID is blog id and wordpress id, see BlogIndex.indexPost.
+		parts := strings.Split(result.MDB_UID, "-")
+		if len(parts) != 2 {
+			return nil, nil
+		}
+		blogID, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, nil
+		}
+		blog, ok := mdb.BLOGS_REGISTRY.ByID[blogID]
+		if !ok {
+			return nil, nil
+		}
+		item.Item.Link = fmt.Sprintf("%s/?p=%s", blog.URL, parts[1])
+	case consts.ES_RESULT_TYPE_TWEETS:
+		// MDB_UID is the twitter id, see TweeterIndex.indexTweet.
+		item.Item.Link = fmt.Sprintf("https://twitter.com/i/web/status/%s", result.MDB_UID)
+		item.Item.Title = truncateFeedText(result.Content, 80)
+	default:
+		return nil, nil
+	}
+	if section != "" {
+		item.Item.Link = fmt.Sprintf("https://kabbalahmedia.info/%s/%s/%s", lang, section, result.MDB_UID)
+	}
+	item.Item.Guid = item.Item.Link
+
+	description := result.Description
+	if description == "" {
+		description = truncateFeedText(result.Content, SEARCH_FEED_DESCRIPTION_LENGTH)
+	}
+	item.Item.Description = &feeds.Description{Text: description}
+	if result.EffectiveDate != nil {
+		item.Item.Created = result.EffectiveDate.Time
+	}
+	return item, nil
+}
+
+// Sets the audio (preferred) or video file of the units in the feed language as enclosure.
+func setSearchFeedEnclosures(db *sql.DB, items []searchFeedItem, lang string) error {
+	uids := []string{}
+	for _, item := range items {
+		if item.UnitUID != "" {
+			uids = append(uids, item.UnitUID)
+		}
+	}
+	if len(uids) == 0 {
+		return nil
+	}
+	units, err := mdbmodels.ContentUnits(
+		qm.Select("id", "uid"),
+		qm.WhereIn("uid in ?", utils.ConvertArgsString(uids)...),
+	).All(db)
+	if err != nil {
+		return errors.Wrap(err, "Load content units from DB")
+	}
+	ids := make([]int64, len(units))
+	uidToID := make(map[string]int64, len(units))
+	for i, unit := range units {
+		ids[i] = unit.ID
+		uidToID[unit.UID] = unit.ID
+	}
+	mediaTypes := []string{consts.MEDIA_MP3a, consts.MEDIA_MP3b, consts.MEDIA_MP4}
+	filesMap, err := loadCUFiles(db, ids, mediaTypes, []string{lang})
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if id, ok := uidToID[item.UnitUID]; ok {
+			if file := searchFeedEnclosureFile(filesMap[id]); file != nil {
+				url := fmt.Sprintf("%s%s", consts.CDN, file.UID)
+				item.Item.Enclosure = &feeds.Enclosure{Url: url, Length: file.Size, Type: file.MimeType.String}
+			}
+		}
+	}
+	return nil
+}
+
+func searchFeedEnclosureFile(files []*mdbmodels.File) *mdbmodels.File {
+	var video *mdbmodels.File
+	for _, file := range files {
+		if file.MimeType.String == consts.MEDIA_MP4 {
+			if video == nil {
+				video = file
+			}
+		} else {
+			return file
+		}
+	}
+	return video
+}
+
+func truncateFeedText(text string, length int) string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= length {
+		return string(runes)
+	}
+	return string(runes[:length]) + "..."
+}
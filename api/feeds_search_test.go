@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+	"github.com/Bnei-Baruch/archive-backend/search"
+	"github.com/Bnei-Baruch/archive-backend/utils"
+)
+
+type SearchFeedSuite struct {
+	suite.Suite
+}
+
+func TestSearchFeed(t *testing.T) {
+	suite.Run(t, new(SearchFeedSuite))
+}
+
+func (suite *SearchFeedSuite) hit(result es.Result) *elastic.SearchHit {
+	b, err := json.Marshal(result)
+	suite.Require().Nil(err)
+	source := json.RawMessage(b)
+	return &elastic.SearchHit{Id: result.MDB_UID, Type: "result", Source: &source}
+}
+
+func (suite *SearchFeedSuite) TestCacheKey() {
+	r := suite.Require()
+	a := search.Query{Term: "Arvut  Lesson", Filters: map[string][]string{consts.FILTER_CONTENT_TYPE: {"LESSON_PART", "CLIP"}}}
+	b := search.Query{Term: "arvut lesson", Filters: map[string][]string{consts.FILTER_CONTENT_TYPE: {"CLIP", "LESSON_PART"}}}
+	r.Equal(searchFeedCacheKey(consts.LANG_ENGLISH, a), searchFeedCacheKey(consts.LANG_ENGLISH, b))
+	r.NotEqual(searchFeedCacheKey(consts.LANG_ENGLISH, a), searchFeedCacheKey(consts.LANG_HEBREW, b))
+	b.Filters[consts.FILTER_TAG] = []string{"xyz"}
+	r.NotEqual(searchFeedCacheKey(consts.LANG_ENGLISH, a), searchFeedCacheKey(consts.LANG_ENGLISH, b))
+}
+
+func (suite *SearchFeedSuite) TestCache() {
+	r := suite.Require()
+	cache := newSearchFeedCache()
+	now := time.Now()
+	cache.Set("a", "feed a", now.Add(time.Minute), 2)
+	cache.Set("b", "feed b", now.Add(time.Minute), 2)
+	content, ok := cache.Get("a", now)
+	r.True(ok)
+	r.Equal("feed a", content)
+	// Least recently used is evicted.
+	cache.Set("c", "feed c", now.Add(time.Minute), 2)
+	_, ok = cache.Get("b", now)
+	r.False(ok)
+	_, ok = cache.Get("a", now.Add(2*time.Minute))
+	r.False(ok)
+	_, ok = cache.Get("c", now)
+	r.True(ok)
+}
+
+func (suite *SearchFeedSuite) TestHitsToFeedItems() {
+	r := suite.Require()
+	older := &utils.Date{Time: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	newer := &utils.Date{Time: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	hits := []*elastic.SearchHit{
+		suite.hit(es.Result{
+			ResultType:    consts.ES_RESULT_TYPE_UNITS,
+			MDB_UID:       "u1",
+			FilterValues:  []string{es.KeyValue(consts.FILTER_CONTENT_TYPE, consts.CT_VIDEO_PROGRAM_CHAPTER)},
+			Title:         "Program",
+			Content:       "Program content",
+			EffectiveDate: older,
+		}),
+		suite.hit(es.Result{
+			ResultType:    consts.ES_RESULT_TYPE_COLLECTIONS,
+			MDB_UID:       "c1",
+			FilterValues:  []string{es.KeyValue(consts.FILTER_COLLECTIONS_CONTENT_TYPE, consts.CT_CONGRESS)},
+			Title:         "Congress",
+			Description:   "Congress description",
+			EffectiveDate: newer,
+		}),
+		// Landing pages are not part of the feed.
+		{Id: "landing", Type: consts.GRAMMAR_TYPE_LANDING_PAGE},
+	}
+	tweet := suite.hit(es.Result{ResultType: consts.ES_RESULT_TYPE_TWEETS, MDB_UID: "123", Content: "Tweet", EffectiveDate: older})
+	// Tweets hit as returned by DoSearch.
+	tweets, err := (&search.ESEngine{}).CombineResultsToSingleHit(map[string]*elastic.SearchResult{
+		consts.LANG_ENGLISH: {Hits: &elastic.SearchHits{Hits: []*elastic.SearchHit{tweet}}},
+	}, consts.SEARCH_RESULT_TWEETS_MANY)
+	r.Nil(err)
+	tweetsHit := tweets[consts.LANG_ENGLISH].Hits.Hits[0]
+	r.Nil((&search.ESEngine{}).NativizeTweetsHitForClient(tweetsHit, consts.SEARCH_RESULT_TWEETS_MANY))
+	hits = append(hits, tweetsHit)
+
+	items, err := searchHitsToFeedItems(hits, consts.LANG_ENGLISH)
+	r.Nil(err)
+	r.Len(items, 3)
+	r.Equal("https://kabbalahmedia.info/en/events/c/c1", items[0].Item.Link)
+	r.Equal("Congress description", items[0].Item.Description.Text)
+	r.Empty(items[0].UnitUID)
+	r.Equal("https://kabbalahmedia.info/en/programs/cu/u1", items[1].Item.Link)
+	r.Equal("Program content", items[1].Item.Description.Text)
+	r.Equal("u1", items[1].UnitUID)
+	r.Equal("https://twitter.com/i/web/status/123", items[2].Item.Link)
+}
@@ -27,6 +27,7 @@ import (
 
 	"github.com/Bnei-Baruch/archive-backend/cache"
 	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
 	"github.com/Bnei-Baruch/archive-backend/mdb"
 	mdbmodels "github.com/Bnei-Baruch/archive-backend/mdb/models"
 	"github.com/Bnei-Baruch/archive-backend/search"
@@ -706,6 +707,156 @@ func SearchStatsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 
+// Returns content similar to the given content unit ("more like this").
+// The first content language in which the unit is indexed is used.
+func ContentUnitRelatedHandler(c *gin.Context) {
+	var r RelatedContentRequest
+	if c.Bind(&r) != nil {
+		return
+	}
+
+	resultTypes := consts.ES_SEARCH_RESULT_TYPES
+	if len(r.ResultTypes) > 0 {
+		resultTypes = []string{}
+		for _, rts := range r.ResultTypes {
+			for _, rt := range strings.Split(rts, ",") {
+				if !utils.StringInSlice(rt, consts.ES_ALL_RESULT_TYPES) {
+					NewBadRequestError(errors.Errorf("Unknown result type: %s", rt)).Abort(c)
+					return
+				}
+				resultTypes = append(resultTypes, rt)
+			}
+		}
+	}
+
+	size := consts.API_DEFAULT_PAGE_SIZE
+	if r.PageSize > 0 {
+		size = utils.Min(r.PageSize, consts.API_MAX_PAGE_SIZE)
+	}
+
+	preference := fmt.Sprintf("%x", md5.Sum([]byte(c.ClientIP())))
+
+	esManager := c.MustGet("ES_MANAGER").(*search.ESManager)
+	db := c.MustGet("MDB_DB").(*sql.DB)
+	cacheM := c.MustGet("CACHE").(cache.CacheManager)
+	tc := c.MustGet("TOKENS_CACHE").(*search.TokensCache)
+	variables := c.MustGet("VARIABLES").(search.VariablesV2)
+
+	esc, err := esManager.GetClient()
+	if err != nil {
+		NewBadRequestError(errors.Wrap(err, "Failed to connect to ElasticSearch.")).Abort(c)
+		return
+	}
+
+	se := search.NewESEngine(esc, db, cacheM, tc, variables, resultTypes)
+
+	uid := c.Param("uid")
+	for _, language := range BaseRequestToContentLanguages(r.BaseRequest) {
+		res, err := se.RelatedContent(c.Request.Context(), uid, language, resultTypes, size, preference)
+		if err != nil {
+			NewInternalError(err).Abort(c)
+			return
+		}
+		if res != nil {
+			c.JSON(http.StatusOK, res)
+			return
+		}
+	}
+	NewNotFoundError().Abort(c)
+}
+
+// Searches inside the transcript of the content unit.
+func ContentUnitTranscriptSearchHandler(c *gin.Context) {
+	db := c.MustGet("MDB_DB").(*sql.DB)
+	uid := c.Param("uid")
+	exists, err := mdbmodels.ContentUnits(SECURE_PUBLISHED_MOD, qm.Where("uid = ?", uid)).Exists(db)
+	if err != nil {
+		NewInternalError(err).Abort(c)
+		return
+	}
+	if !exists {
+		NewNotFoundError().Abort(c)
+		return
+	}
+	handleTranscriptSearch(c, uid, es.UnitTranscriptFile)
+}
+
+// Searches inside the text of the source.
+func SourceTranscriptSearchHandler(c *gin.Context) {
+	handleTranscriptSearch(c, c.Param("uid"), es.SourceTranscriptFile)
+}
+
+// Searches the query in the transcript of the first content language the transcript exists in.
+// Converted transcripts are cached by file UID.
+func handleTranscriptSearch(c *gin.Context, uid string, transcriptFile func(db *sql.DB, uid string, language string) (string, error)) {
+	var r TranscriptSearchRequest
+	if c.Bind(&r) != nil {
+		return
+	}
+
+	query := search.ParseQuery(r.Query)
+	if len(query.Term) == 0 && len(query.ExactTerms) == 0 {
+		NewBadRequestError(errors.New("Can't search with no terms.")).Abort(c)
+		return
+	}
+
+	esManager := c.MustGet("ES_MANAGER").(*search.ESManager)
+	db := c.MustGet("MDB_DB").(*sql.DB)
+	cacheM := c.MustGet("CACHE").(cache.CacheManager)
+	tc := c.MustGet("TOKENS_CACHE").(*search.TokensCache)
+	variables := c.MustGet("VARIABLES").(search.VariablesV2)
+
+	for _, language := range BaseRequestToContentLanguages(r.BaseRequest) {
+		fileUID, err := transcriptFile(db, uid, language)
+		if err != nil {
+			NewInternalError(err).Abort(c)
+			return
+		}
+		if fileUID == "" {
+			continue
+		}
+		text, ok := cacheM.Transcripts().Get(fileUID)
+		if !ok {
+			if text, err = es.TranscriptText(fileUID); err != nil {
+				NewInternalError(err).Abort(c)
+				return
+			}
+			cacheM.Transcripts().Set(fileUID, text)
+		}
+		if text == "" {
+			continue
+		}
+
+		esc, err := esManager.GetClient()
+		if err != nil {
+			NewBadRequestError(errors.Wrap(err, "Failed to connect to ElasticSearch.")).Abort(c)
+			return
+		}
+		se := search.NewESEngine(esc, db, cacheM, tc, variables, consts.ES_SEARCH_RESULT_TYPES)
+		res, err := se.SearchTranscript(c.Request.Context(), text, query, language)
+		if err != nil {
+			NewInternalError(err).Abort(c)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+		return
+	}
+	NewNotFoundError().Abort(c)
+}
+
+// Search stages deadlines from config, stages without configured deadline are bounded by the request only.
+func SearchDeadlines() search.SearchDeadlines {
+	return search.SearchDeadlines{
+		Grammars:     viper.GetDuration("elasticsearch.timeout-for-grammars"),
+		Intents:      viper.GetDuration("elasticsearch.timeout-for-intents"),
+		MainQuery:    viper.GetDuration("elasticsearch.timeout-for-main-query"),
+		Highlights:   viper.GetDuration("elasticsearch.timeout-for-highlight"),
+		TypoSuggest:  viper.GetDuration("elasticsearch.timeout-for-typo-suggest"),
+		Tweets:       viper.GetDuration("elasticsearch.timeout-for-tweets"),
+		LessonSeries: viper.GetDuration("elasticsearch.timeout-for-lesson-series"),
+	}
+}
+
 func SearchHandler(c *gin.Context) {
 	log.Debugf("Language: %s", c.Query("language"))
 	log.Infof("Query: [%s]", c.Query("q"))
@@ -720,6 +871,14 @@ func SearchHandler(c *gin.Context) {
 		return
 	}
 
+	if collapse := c.Query("collapse"); collapse != "" {
+		if collapse != consts.SEARCH_COLLAPSE_COLLECTION {
+			NewBadRequestError(errors.Errorf("Unknown collapse value: %s", collapse)).Abort(c)
+			return
+		}
+		query.Collapse = collapse
+	}
+
 	var err error
 
 	pageNoVal := 1
@@ -745,6 +904,16 @@ func SearchHandler(c *gin.Context) {
 
 	from := (pageNoVal - 1) * size
 
+	// Cursor mode is used when cursor param is given (empty for the first page), page_no is ignored.
+	var cursor *search.SearchCursor
+	if cursorVal, ok := c.GetQuery("cursor"); ok {
+		cursor, err = search.DecodeSearchCursor(cursorVal)
+		if err != nil {
+			NewBadRequestError(errors.Wrap(err, "Illegal cursor")).Abort(c)
+			return
+		}
+	}
+
 	sortByVal := consts.SORT_BY_RELEVANCE
 	sortBy := c.Query("sort_by")
 	if _, ok := consts.SORT_BY_VALUES[sortBy]; ok {
@@ -774,49 +943,16 @@ func SearchHandler(c *gin.Context) {
 	}
 
 	se := search.NewESEngine(esc, db, cacheM /*, grammars*/, tc, variables, consts.ES_SEARCH_RESULT_TYPES)
+	se.BestBets = c.MustGet("BEST_BETS").(*search.BestBets)
+	se.TypoDictionaries = c.MustGet("TYPO_DICTIONARIES").(*search.TypoDictionaries)
+	se.Transliterator = c.MustGet("TRANSLITERATOR").(*search.Transliterator)
+	se.Glossary = c.MustGet("GLOSSARY").(*search.Glossary)
 
-	// Detect input language
-	detectQuery := strings.Join(append(query.ExactTerms, query.Term), " ")
-	log.Debugf("Detect language input: (%s, %s, %s)", detectQuery, c.Query("language"), c.Request.Header.Get("Accept-Language"))
-	query.LanguageOrder = utils.DetectLanguage(detectQuery, c.Query("language"), c.Request.Header.Get("Accept-Language"), nil)
-	for k, v := range query.Filters {
-		if k == consts.FILTER_MEDIA_LANGUAGE {
-			addLang := true
-			for _, flang := range v {
-				for _, ilang := range query.LanguageOrder {
-					if flang == ilang {
-						// language already exist
-						addLang = false
-						break
-					}
-				}
-				if addLang {
-					query.LanguageOrder = append(query.LanguageOrder, flang)
-				}
-			}
-			break
-		}
-	}
-
-	//  Quick workround to allow Spanish support when the interface language is Spanish (AS-99).
-	if c.Query("language") == consts.LANG_SPANISH {
-		for i, lang := range query.LanguageOrder {
-			if lang == consts.LANG_SPANISH {
-				query.LanguageOrder = append(query.LanguageOrder[:i], query.LanguageOrder[i+1:]...)
-				break
-			}
-		}
-		query.LanguageOrder = append([]string{consts.LANG_SPANISH}, query.LanguageOrder...)
-	}
-
-	checkTypo := viper.GetBool("elasticsearch.check-typo") &&
-		//  temp. disable typo suggestion for other interface languages than english, russian and hebrew
-		(c.Query("language") == consts.LANG_ENGLISH || c.Query("language") == consts.LANG_RUSSIAN || c.Query("language") == consts.LANG_HEBREW)
-
-	timeoutForHighlight := viper.GetDuration("elasticsearch.timeout-for-highlight")
+	query.LanguageOrder = SearchLanguageOrder(query, c.Query("language"), c.Request.Header.Get("Accept-Language"))
+	checkTypo := SearchCheckTypo(se, query, c.Query("language"))
 
 	res, err := se.DoSearch(
-		context.TODO(),
+		c.Request.Context(),
 		query,
 		sortByVal,
 		from,
@@ -826,7 +962,8 @@ func SearchHandler(c *gin.Context) {
 		true,
 		true,
 		true,
-		timeoutForHighlight,
+		SearchDeadlines(),
+		cursor,
 	)
 
 	if query.Deb {
@@ -839,22 +976,66 @@ func SearchHandler(c *gin.Context) {
 	}
 
 	if err == nil {
-		for _, hit := range res.SearchResult.Hits.Hits {
-			if hit.Type == consts.SEARCH_RESULT_TWEETS_MANY {
-				// Move Tweets from innerHits to Source, to make client more consistent (work with source only).
-				// Should be done after the logging to avoid errors with source field
-				err = se.NativizeTweetsHitForClient(hit, consts.SEARCH_RESULT_TWEETS_MANY)
+		PrepareSearchResultForClient(res)
+		c.JSON(http.StatusOK, res)
+	} else {
+		NewInternalError(err).Abort(c)
+	}
+}
+
+// Languages to search |query| in, detected from the query, interface |language| and Accept-Language header.
+func SearchLanguageOrder(query search.Query, language string, acceptLanguage string) []string {
+	detectQuery := strings.Join(append(query.ExactTerms, query.Term), " ")
+	log.Debugf("Detect language input: (%s, %s, %s)", detectQuery, language, acceptLanguage)
+	languageOrder := utils.DetectLanguage(detectQuery, language, acceptLanguage, nil)
+	for k, v := range query.Filters {
+		if k == consts.FILTER_MEDIA_LANGUAGE {
+			addLang := true
+			for _, flang := range v {
+				for _, ilang := range languageOrder {
+					if flang == ilang {
+						// language already exist
+						addLang = false
+						break
+					}
+				}
+				if addLang {
+					languageOrder = append(languageOrder, flang)
+				}
 			}
-			//  Temp. workround until client could handle null values in Highlight fields (WIP by David)
-			//	TBD check if already fixed in client
-			if hit.Highlight == nil {
-				hit.Highlight = elastic.SearchHitHighlight{}
+			break
+		}
+	}
+
+	//  Quick workround to allow Spanish support when the interface language is Spanish (AS-99).
+	if language == consts.LANG_SPANISH {
+		for i, lang := range languageOrder {
+			if lang == consts.LANG_SPANISH {
+				languageOrder = append(languageOrder[:i], languageOrder[i+1:]...)
+				break
 			}
 		}
+		languageOrder = append([]string{consts.LANG_SPANISH}, languageOrder...)
+	}
+	return languageOrder
+}
 
-		c.JSON(http.StatusOK, res)
-	} else {
-		NewInternalError(err).Abort(c)
+func SearchCheckTypo(se *search.ESEngine, query search.Query, language string) bool {
+	return viper.GetBool("elasticsearch.check-typo") &&
+		// Local typo dictionaries support any language, Elastic suggester only english, russian and hebrew interface languages.
+		((len(query.LanguageOrder) > 0 && se.TypoDictionaries.Has(query.LanguageOrder[0])) ||
+			language == consts.LANG_ENGLISH || language == consts.LANG_RUSSIAN || language == consts.LANG_HEBREW)
+}
+
+// Search result hits as expected by client.
+// Tweets hits are already moved from innerHits to Source by DoSearch.
+func PrepareSearchResultForClient(res *search.QueryResult) {
+	for _, hit := range res.SearchResult.Hits.Hits {
+		//  Temp. workround until client could handle null values in Highlight fields (WIP by David)
+		//	TBD check if already fixed in client
+		if hit.Highlight == nil {
+			hit.Highlight = elastic.SearchHitHighlight{}
+		}
 	}
 }
 
@@ -4435,9 +4616,11 @@ func EvalQueryHandler(c *gin.Context) {
 
 	db := c.MustGet("MDB_DB").(*sql.DB)
 	r.EvalQuery.Expectations = []search.Expectation{}
+	r.EvalQuery.Grades = []int{}
 	for _, es := range r.ExpectationStrings {
-		parsed := search.ParseExpectation(es, db)
+		parsed, grade := search.ParseGradedExpectation(es, db)
 		r.EvalQuery.Expectations = append(r.EvalQuery.Expectations, parsed)
+		r.EvalQuery.Grades = append(r.EvalQuery.Grades, grade)
 	}
 
 	resp := EvalQueryResponse{EvalResult: search.EvaluateQuery(r.EvalQuery, r.serverUrl, false /*skipExpectations*/)}
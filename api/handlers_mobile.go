@@ -1,7 +1,6 @@
 package api
 
 import (
-	"context"
 	"crypto/md5"
 	"database/sql"
 	"encoding/json"
@@ -606,13 +605,16 @@ func MobileSearchHandler(c *gin.Context) {
 	// The logic up to this point is the same as the regular search handle
 
 	se := search.NewESEngine(esc, db, cacheM, tc, variables, consts.ES_MOBILE_SEARCH_RESULT_TYPES)
+	se.BestBets = c.MustGet("BEST_BETS").(*search.BestBets)
+	se.Transliterator = c.MustGet("TRANSLITERATOR").(*search.Transliterator)
+	se.Glossary = c.MustGet("GLOSSARY").(*search.Glossary)
 
 	checkTypo := false // Currently not supported in mobile
 	searchTweets := c.Query("search_tweets") == "true"
 	searchLessonSeries := c.Query("search_lesson_series") == "true"
 
 	res, err := se.DoSearch(
-		context.TODO(),
+		c.Request.Context(),
 		query,
 		sortByVal,
 		from,
@@ -622,7 +624,8 @@ func MobileSearchHandler(c *gin.Context) {
 		searchTweets,
 		searchLessonSeries,
 		false, // Highlights are not currently supported in mobile
-		time.Duration(0),
+		SearchDeadlines(),
+		nil,
 	)
 
 	if err == nil {
@@ -650,7 +653,7 @@ func MobileSearchHandler(c *gin.Context) {
 			if result.EffectiveDate != nil {
 				date = &result.EffectiveDate.Time
 			}
-			if hit.Type == "result" {
+			if hit.Type == consts.ES_RESULTS_DOC_TYPE {
 				switch result.ResultType {
 				case consts.ES_RESULT_TYPE_UNITS:
 					var image *string
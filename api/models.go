@@ -414,6 +414,17 @@ type SimpleModeResponse struct {
 	Others  []*ContentUnit `json:"others"`
 }
 
+type RelatedContentRequest struct {
+	BaseRequest
+	PageSize    int      `json:"page_size" form:"page_size" binding:"omitempty,min=1"`
+	ResultTypes []string `json:"result_types" form:"result_types" binding:"omitempty"`
+}
+
+type TranscriptSearchRequest struct {
+	BaseRequest
+	Query string `json:"q" form:"q" binding:"required"`
+}
+
 type EvalQueryRequest struct {
 	serverUrl          string           `json:"server_url"`
 	EvalQuery          search.EvalQuery `json:"eval_query"`
@@ -23,10 +23,13 @@ func SetupRoutes(router *gin.Engine) {
 
 	router.GET("/content_units", ContentUnitsHandler)
 	router.GET("/content_units/:uid", ContentUnitHandler)
+	router.GET("/content_units/:uid/related", ContentUnitRelatedHandler)
+	router.GET("/content_units/:uid/search", ContentUnitTranscriptSearchHandler)
 	router.GET("/lessons", LessonsHandler)
 	router.POST("/lessons", LessonsHandler)
 	router.GET("/events", EventsHandler)
 	router.GET("/sources", SourcesHierarchyHandler)
+	router.GET("/sources/:uid/search", SourceTranscriptSearchHandler)
 	router.GET("/tags", TagsHierarchyHandler)
 	router.GET("/tags/dashboard", TagDashboardHandler)
 	router.GET("/publishers", PublishersHandler)
@@ -65,6 +68,7 @@ func SetupRoutes(router *gin.Engine) {
 		headAndGet(feeds, "/podcast/:DLANG/:DF", FeedPodcast)
 		headAndGet(feeds, "/podcast.rss/:DLANG/:DF", FeedPodcast)
 		headAndGet(feeds, "/morning_lesson", FeedMorningLesson)
+		headAndGet(feeds, "/search/:DLANG", FeedSearch)
 
 		collections := feeds.Group("/collections/:DLANG")
 		{
@@ -115,6 +119,11 @@ func SetupRoutes(router *gin.Engine) {
 		pRouter.GET("/mutex", pprofHandler(pprof.Handler("mutex").ServeHTTP))
 		pRouter.GET("/threadcreate", pprofHandler(pprof.Handler("threadcreate").ServeHTTP))
 	}
+
+	if pass := viper.GetString("server.admin-pass"); pass != "" {
+		adminRouter := router.Group("admin", gin.BasicAuth(gin.Accounts{"admin": pass}))
+		adminRouter.POST("/reload_variables", ReloadVariablesHandler)
+	}
 }
 
 func pprofHandler(h http.HandlerFunc) gin.HandlerFunc {
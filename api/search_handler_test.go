@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/cache"
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+	"github.com/Bnei-Baruch/archive-backend/search"
+	"github.com/Bnei-Baruch/archive-backend/utils"
+)
+
+// Cache manager of searches not using search stats.
+type noStatsCache struct {
+	cache.CacheManager
+}
+
+// Runs search handlers against the embedded backend.
+type SearchHandlerSuite struct {
+	suite.Suite
+	esManager *search.ESManager
+	router    *gin.Engine
+}
+
+func TestSearchHandler(t *testing.T) {
+	suite.Run(t, new(SearchHandlerSuite))
+}
+
+func (suite *SearchHandlerSuite) SetupSuite() {
+	r := suite.Require()
+	viper.Set("elasticsearch.backend", consts.ES_BACKEND_EMBEDDED)
+	defer viper.Set("elasticsearch.backend", "")
+	suite.esManager = search.MakeESManager("")
+	esc, err := suite.esManager.GetClient()
+	r.Nil(err)
+
+	// Query languages are detected, all languages are searched.
+	for _, lang := range consts.ALL_KNOWN_LANGS {
+		mappings, err := ioutil.ReadFile(fmt.Sprintf("../data/es/mappings/results/results-%s.json", lang))
+		r.Nil(err)
+		index := es.IndexName("prod", consts.ES_RESULTS_INDEX, lang, "test")
+		_, err = esc.CreateIndex(index).Body(string(mappings)).Do(context.TODO())
+		r.Nil(err)
+		_, err = esc.Alias().Add(index, es.IndexNameForServing("prod", consts.ES_RESULTS_INDEX, lang)).Do(context.TODO())
+		r.Nil(err)
+		grammarMappings, err := ioutil.ReadFile(fmt.Sprintf("../data/es/mappings/grammars/grammars-%s.json", lang))
+		r.Nil(err)
+		_, err = esc.CreateIndex(search.GrammarIndexName(lang, "")).Body(string(grammarMappings)).Do(context.TODO())
+		r.Nil(err)
+	}
+	indexName := es.IndexName("prod", consts.ES_RESULTS_INDEX, consts.LANG_ENGLISH, "test")
+
+	results := []es.Result{
+		{
+			ResultType:   consts.ES_RESULT_TYPE_UNITS,
+			MDB_UID:      "unit1",
+			TypedUids:    []string{es.KeyValue(consts.ES_UID_TYPE_CONTENT_UNIT, "unit1")},
+			FilterValues: []string{es.KeyValue(consts.FILTER_MEDIA_LANGUAGE, consts.LANG_ENGLISH)},
+			Title:        "Lesson about the inner light",
+			FullTitle:    "Lesson about the inner light",
+		},
+		{
+			ResultType:   consts.ES_RESULT_TYPE_TWEETS,
+			MDB_UID:      "tweet1",
+			TypedUids:    []string{es.KeyValue(consts.ES_UID_TYPE_TWEET, "tweet1")},
+			FilterValues: []string{es.KeyValue(consts.FILTER_MEDIA_LANGUAGE, consts.LANG_ENGLISH)},
+			Content:      "The inner light is revealed in unity.",
+		},
+	}
+	bulk := esc.Bulk()
+	for _, result := range results {
+		bulk.Add(elastic.NewBulkIndexRequest().Index(indexName).Type("result").Id(result.MDB_UID).Doc(result))
+	}
+	res, err := bulk.Do(context.TODO())
+	r.Nil(err)
+	r.False(res.Errors)
+	_, err = esc.Refresh(indexName).Do(context.TODO())
+	r.Nil(err)
+
+	gin.SetMode(gin.TestMode)
+	suite.router = gin.New()
+	suite.router.Use(utils.DataStoresMiddleware(utils.DataStores{
+		DB:               (*sql.DB)(nil),
+		ESManager:        suite.esManager,
+		Cache:            noStatsCache{},
+		TokensCache:      (*search.TokensCache)(nil),
+		Variables:        search.VariablesV2{},
+		BestBets:         (*search.BestBets)(nil),
+		TypoDictionaries: (*search.TypoDictionaries)(nil),
+		Transliterator:   (*search.Transliterator)(nil),
+		Glossary:         (*search.Glossary)(nil),
+	}), utils.ErrorHandlingMiddleware())
+	suite.router.GET("/search", SearchHandler)
+}
+
+func (suite *SearchHandlerSuite) TearDownSuite() {
+	suite.esManager.Stop()
+}
+
+func (suite *SearchHandlerSuite) TestTweets() {
+	r := suite.Require()
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/search?q=inner+light&language=en", nil)
+	r.Nil(err)
+	suite.router.ServeHTTP(w, req)
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+
+	res := search.QueryResult{}
+	r.Nil(json.Unmarshal(w.Body.Bytes(), &res))
+	tweets := 0
+	for _, hit := range res.SearchResult.Hits.Hits {
+		if hit.Type != consts.SEARCH_RESULT_TWEETS_MANY {
+			continue
+		}
+		tweets++
+		// Client gets tweets in source.
+		r.Nil(hit.InnerHits)
+		tweetHits := []*elastic.SearchHit{}
+		r.Nil(json.Unmarshal(*hit.Source, &tweetHits))
+		r.Len(tweetHits, 1)
+		r.Equal("tweet1", tweetHits[0].Id)
+	}
+	r.Equal(1, tweets)
+}
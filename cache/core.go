@@ -23,6 +23,7 @@ type CacheManager interface {
 	SourcesStats() SourcesStatsCache
 	AuthorsStats() AuthorsStatsCache
 	TagsStats() TagsStatsCache
+	Transcripts() TranscriptsCache
 	Close()
 	Refresh()
 }
@@ -32,6 +33,7 @@ type CacheManagerImpl struct {
 	sources          SourcesStatsCache
 	authors          AuthorsStatsCache
 	tags             TagsStatsCache
+	transcripts      TranscriptsCache
 	ticker           *time.Ticker
 	ticks            int64
 	refreshIntervals map[string]int64
@@ -42,6 +44,7 @@ func NewCacheManagerImpl(mdb *sql.DB, refreshIntervals map[string]time.Duration)
 	cm := new(CacheManagerImpl)
 	cm.sources = NewSourcesStatsCacheImpl(mdb)
 	cm.tags = NewTagsStatsCacheImpl(mdb)
+	cm.transcripts = NewTranscriptsCacheImpl(TRANSCRIPTS_CACHE_SIZE)
 	cm.authors = NewAuthorsStatsCacheImpl(mdb)
 	cm.providers = []Provider{cm.sources, cm.tags, cm.authors}
 
@@ -92,6 +95,10 @@ func (cm *CacheManagerImpl) SearchStats() SearchStatsCache {
 	return cm.search
 }
 
+func (cm *CacheManagerImpl) Transcripts() TranscriptsCache {
+	return cm.transcripts
+}
+
 func (cm *CacheManagerImpl) Refresh() {
 	for _, p := range cm.providers {
 		log.Infof("Refreshing %s", p)
@@ -27,6 +27,8 @@ type SearchStatsCache interface {
 	IsSourceWithEnoughUnits(uid string, count int, cts ...string) bool
 	IsTagHasSingleUnit(uid string, cts ...string) bool
 	IsSourceHasSingleUnit(uid string, cts ...string) bool
+	IsPersonWithEnoughUnits(uid string, count int) bool
+	IsCollectionWithEnoughUnits(uid string, count int) bool
 
 	// |location| can be of: "Moscow" or "Russia|Moscow" or "Russia" or "" (empty for year constrain only)
 	// |year| is 4 digit year string, e.g., "1998", "2010" or "" (empty for location constrain only)
@@ -55,6 +57,8 @@ type SearchStatsCacheImpl struct {
 	programsByCollectionAndPosition map[string]string
 	recentUnitsOfCollections        map[string]string
 	unitsThatAreArticles            map[string]bool
+	personsUnits                    map[string]int
+	collectionsUnits                map[string]int
 }
 
 func NewSearchStatsCacheImpl(mdb *sql.DB, sources, tags ClassByTypeStats) SearchStatsCache {
@@ -113,6 +117,14 @@ func (ssc *SearchStatsCacheImpl) IsSourceHasSingleUnit(uid string, cts ...string
 	return ssc.isClassWithUnits("sources", uid, &one, &one, cts...)
 }
 
+func (ssc *SearchStatsCacheImpl) IsPersonWithEnoughUnits(uid string, count int) bool {
+	return ssc.personsUnits[uid] >= count
+}
+
+func (ssc *SearchStatsCacheImpl) IsCollectionWithEnoughUnits(uid string, count int) bool {
+	return ssc.collectionsUnits[uid] >= count
+}
+
 func (ssc *SearchStatsCacheImpl) GetSourceByPositionAndParent(parent string, position string, sourceTypeIds []int64) *string {
 	if len(sourceTypeIds) == 0 {
 		sourceTypeIds = consts.ALL_SRC_TYPES
@@ -228,6 +240,25 @@ func (ssc *SearchStatsCacheImpl) Refresh() error {
 	if err != nil {
 		return errors.Wrap(err, "Load units that are articles.")
 	}
+	ssc.personsUnits, err = ssc.loadUnitsCount(`select p.uid, count(distinct cu.id)
+	from persons p
+	join content_units_persons cup on p.id = cup.person_id
+	join content_units cu on cup.content_unit_id = cu.id
+	where cu.secure = 0 and cu.published = true
+	group by p.uid`)
+	if err != nil {
+		return errors.Wrap(err, "Load persons units count.")
+	}
+	ssc.collectionsUnits, err = ssc.loadUnitsCount(`select c.uid, count(distinct cu.id)
+	from collections c
+	join collections_content_units ccu on c.id = ccu.collection_id
+	join content_units cu on ccu.content_unit_id = cu.id
+	where c.secure = 0 and c.published = true
+	and cu.secure = 0 and cu.published = true
+	group by c.uid`)
+	if err != nil {
+		return errors.Wrap(err, "Load collections units count.")
+	}
 	return nil
 }
 
@@ -436,3 +467,23 @@ func (ssc *SearchStatsCacheImpl) loadUnitsThatAreArticles() (map[string]bool, er
 	}
 	return ret, nil
 }
+
+// Loads published units count by uid, query should select uid and count.
+func (ssc *SearchStatsCacheImpl) loadUnitsCount(query string) (map[string]int, error) {
+	rows, err := queries.Raw(query).Query(ssc.mdb)
+	if err != nil {
+		return nil, errors.Wrap(err, "queries.Raw")
+	}
+	defer rows.Close()
+	ret := map[string]int{}
+	for rows.Next() {
+		var uid string
+		var count int
+		err = rows.Scan(&uid, &count)
+		if err != nil {
+			return nil, errors.Wrap(err, "rows.Scan")
+		}
+		ret[uid] = count
+	}
+	return ret, nil
+}
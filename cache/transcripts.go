@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Number of converted transcripts kept in memory.
+const TRANSCRIPTS_CACHE_SIZE = 200
+
+// LRU cache of transcripts text (converted from docx) by file UID.
+// Files content does not change for the same UID, so entries are not refreshed.
+type TranscriptsCache interface {
+	Get(fileUID string) (string, bool)
+	Set(fileUID string, text string)
+}
+
+type transcriptsCacheEntry struct {
+	fileUID string
+	text    string
+}
+
+type TranscriptsCacheImpl struct {
+	entries map[string]*list.Element
+	order   *list.List
+	mux     sync.Mutex
+	limit   int
+}
+
+func NewTranscriptsCacheImpl(size int) TranscriptsCache {
+	return &TranscriptsCacheImpl{
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		limit:   size,
+	}
+}
+
+func (c *TranscriptsCacheImpl) Get(fileUID string) (string, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if element, ok := c.entries[fileUID]; ok {
+		c.order.MoveToFront(element)
+		return element.Value.(*transcriptsCacheEntry).text, true
+	}
+	return "", false
+}
+
+func (c *TranscriptsCacheImpl) Set(fileUID string, text string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if element, ok := c.entries[fileUID]; ok {
+		element.Value.(*transcriptsCacheEntry).text = text
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[fileUID] = c.order.PushFront(&transcriptsCacheEntry{fileUID: fileUID, text: text})
+	for c.order.Len() > c.limit {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*transcriptsCacheEntry).fileUID)
+	}
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"encoding/csv"
 	"fmt"
 	"io/ioutil"
@@ -13,8 +14,10 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"gopkg.in/olivere/elastic.v6"
 
 	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
 	"github.com/Bnei-Baruch/archive-backend/search"
 	"github.com/Bnei-Baruch/archive-backend/utils"
 )
@@ -43,6 +46,12 @@ var testTypoSuggestCmd = &cobra.Command{
 	Run:   testTypoSuggestFn,
 }
 
+var buildTypoDictionariesCmd = &cobra.Command{
+	Use:   "build_typo_dictionaries",
+	Short: "Build local typo dictionaries from indexed titles and variables.",
+	Run:   buildTypoDictionariesFn,
+}
+
 var evalSetPath string
 var serverUrl string
 var baseServerUrl string
@@ -58,6 +67,11 @@ var typosPath string
 var language string
 var htmlFileToInject string
 var elasticUrl string
+var typoDictionariesPath string
+var typoDictionariesLangs string
+var inProcess bool
+var inProcessIndexDate string
+var inProcessGrammarIndexDate string
 
 func init() {
 	evalCmd.PersistentFlags().StringVar(&evalSetPath, "eval_set", "", "Path to csv eval set.")
@@ -66,30 +80,29 @@ func init() {
 	evalCmd.MarkFlagRequired("report")
 	evalCmd.PersistentFlags().StringVar(&flatReportPath, "flat_report", "", "Path to csv report file per expectation.")
 	evalCmd.MarkFlagRequired("flat_report")
-	evalCmd.PersistentFlags().StringVar(&serverUrl, "server", "", "URL of experimental archive backend to evaluate.")
-	evalCmd.MarkFlagRequired("server")
-	evalCmd.PersistentFlags().StringVar(&baseServerUrl, "base_server", "", "URL of base archive backend to evaluate.")
-	evalCmd.MarkFlagRequired("base_server")
+	evalCmd.PersistentFlags().StringVar(&serverUrl, "server", "", "URL of experimental archive backend to evaluate, required unless --in_process.")
+	evalCmd.PersistentFlags().StringVar(&baseServerUrl, "base_server", "", "URL of base archive backend to evaluate, required unless --in_process.")
+	addInProcessFlags(evalCmd)
 	RootCmd.AddCommand(evalCmd)
 
 	evalDiffCmd.PersistentFlags().StringVar(&evalSetPath, "eval_set", "", "Path to csv eval set.")
 	evalDiffCmd.MarkFlagRequired("eval_set")
 	evalDiffCmd.PersistentFlags().StringVar(&evalDiffHtml, "eval_diff_html", "", "Path to html with eval diff results.")
 	evalDiffCmd.MarkFlagRequired("eval_diff_html")
-	evalDiffCmd.PersistentFlags().StringVar(&serverUrl, "server", "", "URL of experimental archive backend to evaluate.")
-	evalDiffCmd.MarkFlagRequired("server")
-	evalDiffCmd.PersistentFlags().StringVar(&baseServerUrl, "base_server", "", "URL of base archive backend to evaluate.")
-	evalDiffCmd.MarkFlagRequired("base_server")
+	evalDiffCmd.PersistentFlags().StringVar(&serverUrl, "server", "", "URL of experimental archive backend to evaluate, required unless --in_process.")
+	evalDiffCmd.PersistentFlags().StringVar(&baseServerUrl, "base_server", "", "URL of base archive backend to evaluate, --server if not set with --in_process.")
 	evalDiffCmd.PersistentFlags().IntVar(&top, "top", 0, "Limit query set size.")
+	addInProcessFlags(evalDiffCmd)
 	RootCmd.AddCommand(evalDiffCmd)
 
-	vsGoldenHtmlCmd.PersistentFlags().StringVar(&flatReportsPaths, "flat_reports", "", "Paths to csv report file per expectation, separated by comma.")
-	vsGoldenHtmlCmd.MarkPersistentFlagRequired("flat_reports")
+	vsGoldenHtmlCmd.PersistentFlags().StringVar(&flatReportsPaths, "flat_reports", "", "Paths to csv report file per expectation, separated by comma. Required unless --in_process.")
+	vsGoldenHtmlCmd.PersistentFlags().StringVar(&evalSetPath, "eval_set", "", "Paths to csv eval sets evaluated with --in_process instead of flat_reports, separated by comma.")
 	vsGoldenHtmlCmd.PersistentFlags().StringVar(&goldenFlatReportPaths, "golden_flat_reports", "", "Paths to csv golden report file per expectation, separated by comma.")
 	vsGoldenHtmlCmd.MarkPersistentFlagRequired("golden_flat_reports")
 	vsGoldenHtmlCmd.PersistentFlags().StringVar(&vsGoldenHtml, "vs_golden_html", "", "Path to html output of comparison vs golden.")
 	vsGoldenHtmlCmd.MarkPersistentFlagRequired("vs_golden_html")
 	vsGoldenHtmlCmd.PersistentFlags().StringVar(&htmlFileToInject, "html_to_inject", "", "Optional HTML file to put his content at the buttom of the output HTML.")
+	addInProcessFlags(vsGoldenHtmlCmd)
 	RootCmd.AddCommand(vsGoldenHtmlCmd)
 
 	testTypoSuggestCmd.PersistentFlags().StringVar(&evalSetPath, "eval_set", "", "Path to csv eval set.")
@@ -98,9 +111,32 @@ func init() {
 	testTypoSuggestCmd.MarkFlagRequired("typos_path")
 	testTypoSuggestCmd.PersistentFlags().StringVar(&language, "lang", "", "Index language.")
 	testTypoSuggestCmd.MarkFlagRequired("lang")
-  testTypoSuggestCmd.PersistentFlags().StringVar(&elasticUrl, "elastic", "", "URL of Elastic.")
-  testTypoSuggestCmd.MarkFlagRequired("elastic")
+	testTypoSuggestCmd.PersistentFlags().StringVar(&elasticUrl, "elastic", "", "URL of Elastic, required unless local typo dictionaries are used.")
+	testTypoSuggestCmd.PersistentFlags().StringVar(&typoDictionariesPath, "dictionaries", "", "Path to local typo dictionaries folder, Elastic suggester is used if not set.")
 	RootCmd.AddCommand(testTypoSuggestCmd)
+
+	buildTypoDictionariesCmd.PersistentFlags().StringVar(&elasticUrl, "elastic", "", "URL of Elastic.")
+	buildTypoDictionariesCmd.MarkFlagRequired("elastic")
+	buildTypoDictionariesCmd.PersistentFlags().StringVar(&typoDictionariesPath, "dictionaries", "", "Output folder, data/search/typo_dictionaries if not set.")
+	buildTypoDictionariesCmd.PersistentFlags().StringVar(&typoDictionariesLangs, "langs", "", "Comma separated languages, all known languages if not set.")
+	RootCmd.AddCommand(buildTypoDictionariesCmd)
+}
+
+func addInProcessFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVar(&inProcess, "in_process", false, "Evaluate experimental search in process instead of --server.")
+	cmd.PersistentFlags().StringVar(&inProcessIndexDate, "index_date", "", "Results index date to evaluate in process, alias if not set.")
+	cmd.PersistentFlags().StringVar(&inProcessGrammarIndexDate, "grammar_index_date", "", "Grammar index date to evaluate in process, alias if not set.")
+}
+
+// Experimental searcher, in process or --server.
+func expSearcher() search.EvalSearcher {
+	if inProcess {
+		return makeInProcessSearcher()
+	}
+	if serverUrl == "" {
+		log.Fatal("Either --server or --in_process should be set.")
+	}
+	return search.ServerEvalSearcher(serverUrl)
 }
 
 func roundD(val float64) int {
@@ -114,7 +150,7 @@ func float64ToPercent(val float64) string {
 	return fmt.Sprintf("%.2f%%", float64(roundD(val*10000))/float64(100))
 }
 
-func runExpVsBase(evalSet []search.EvalQuery, baseUrl string, expUrl string) (
+func runExpVsBase(evalSet []search.EvalQuery, baseUrl string, exp search.EvalSearcher) (
 	search.EvalResults, map[int][]search.Loss, search.EvalResults, map[int][]search.Loss, error) {
 	var wg sync.WaitGroup
 	wg.Add(2)
@@ -132,7 +168,7 @@ func runExpVsBase(evalSet []search.EvalQuery, baseUrl string, expUrl string) (
 	var expErr error
 	go func() {
 		defer wg.Done()
-		expResults, expLosses, expErr = search.Eval(evalSet, expUrl)
+		expResults, expLosses, expErr = search.EvalWithSearcher(evalSet, exp)
 	}()
 	wg.Wait()
 	if baseErr != nil {
@@ -160,6 +196,21 @@ func printResults(results search.EvalResults) {
 	}
 }
 
+func printIRMetrics(evalSet []search.EvalQuery, results search.EvalResults) {
+	metrics := search.FlatRecordsIRMetrics(search.ResultsByExpectation(evalSet, results)[1:])
+	for _, language := range utils.StringMapOrderedKeys(metrics) {
+		byBucket := metrics[language]
+		for _, bucket := range utils.StringMapOrderedKeys(byBucket) {
+			m := byBucket[bucket]
+			if bucket == "" {
+				bucket = "All"
+			}
+			log.Infof("%s %-15s Queries: %4d %s: %s", language, bucket, m.Queries,
+				strings.Join(search.IR_METRICS_NAMES, "/"), strings.Join(m.Strings(), "/"))
+		}
+	}
+}
+
 func printLosses(results search.EvalResults, losses map[int][]search.Loss) {
 	log.Infof("Found %d loss types.", len(losses))
 	var lKeys []int
@@ -204,7 +255,15 @@ func evalDiffFn(cmd *cobra.Command, args []string) {
 		panic("eval_diff_html must be set.")
 	}
 
-	diffs, err := search.EvalQuerySetDiff(evalSet, baseServerUrl, serverUrl, -1 /*diffsLimit*/)
+	base := baseServerUrl
+	if base == "" && inProcess {
+		// In process search is compared with the running server.
+		base = serverUrl
+	}
+	if base == "" {
+		log.Fatal("base_server must be set, or server with --in_process.")
+	}
+	diffs, err := search.EvalQuerySetDiffWithSearchers(evalSet, search.ServerEvalSearcher(base), expSearcher(), -1 /*diffsLimit*/)
 	utils.Must(err)
 	// Generate eval diff html report.
 	html, err := search.EvalResultsDiffsHtml(diffs)
@@ -214,16 +273,24 @@ func evalDiffFn(cmd *cobra.Command, args []string) {
 
 func evalFn(cmd *cobra.Command, args []string) {
 	log.Infof("Evaluating eval set at %s.", evalSetPath)
+	if baseServerUrl == "" && !inProcess {
+		log.Fatal("base_server must be set unless --in_process.")
+	}
 	evalSet, err := search.InitAndReadEvalSet(evalSetPath)
 	utils.Must(err)
+	exp := expSearcher()
 	if baseServerUrl != "" {
-		baseResults, baseLosses, expResults, expLosses, err := runExpVsBase(evalSet, baseServerUrl, serverUrl)
+		baseResults, baseLosses, expResults, expLosses, err := runExpVsBase(evalSet, baseServerUrl, exp)
 		utils.Must(err)
 		log.Infof("Base:")
 		printResults(baseResults)
 		log.Infof("Exp:")
 		printResults(expResults)
 		log.Infof("Base:")
+		printIRMetrics(evalSet, baseResults)
+		log.Infof("Exp:")
+		printIRMetrics(evalSet, expResults)
+		log.Infof("Base:")
 		printLosses(baseResults, baseLosses)
 		log.Infof("Exp:")
 		printLosses(expResults, expLosses)
@@ -272,9 +339,10 @@ func evalFn(cmd *cobra.Command, args []string) {
 		search.WriteResults(reportPath, evalSet, expResults)
 		search.WriteResultsByExpectation(flatReportPath, evalSet, expResults)
 	} else {
-		results, losses, err := search.Eval(evalSet, serverUrl)
+		results, losses, err := search.EvalWithSearcher(evalSet, exp)
 		utils.Must(err)
 		printResults(results)
+		printIRMetrics(evalSet, results)
 		printLosses(results, losses)
 		if len(reportPath) == 0 {
 			log.Warn("Cannot write results: reportPath is not set!", reportPath)
@@ -295,7 +363,18 @@ func evalFn(cmd *cobra.Command, args []string) {
 
 func vsGoldenHtmlFn(cmd *cobra.Command, args []string) {
 	allRecords := [][]string{}
+	if inProcess {
+		if evalSetPath == "" {
+			log.Fatal("eval_set must be set with --in_process.")
+		}
+		allRecords = evalFlatRecords(strings.Split(evalSetPath, ","), expSearcher())
+	} else if flatReportsPaths == "" {
+		log.Fatal("Either --flat_reports or --in_process should be set.")
+	}
 	for _, path := range strings.Split(flatReportsPaths, ",") {
+		if path == "" {
+			continue
+		}
 		log.Infof("Opening: %s", path)
 		reader, err := os.Open(path)
 		r := csv.NewReader(bufio.NewReader(reader))
@@ -326,11 +405,40 @@ func vsGoldenHtmlFn(cmd *cobra.Command, args []string) {
 	}
 }
 
+// Evaluates eval sets, returns records as read from flat reports (without headers).
+func evalFlatRecords(evalSetPaths []string, searcher search.EvalSearcher) [][]string {
+	allRecords := [][]string{}
+	for _, path := range evalSetPaths {
+		log.Infof("Evaluating: %s", path)
+		evalSet, err := search.InitAndReadEvalSet(path)
+		utils.Must(err)
+		results, _, err := search.EvalWithSearcher(evalSet, searcher)
+		utils.Must(err)
+		allRecords = append(allRecords, search.ResultsByExpectation(evalSet, results)[1:]...)
+	}
+	return allRecords
+}
+
 func testTypoSuggestFn(cmd *cobra.Command, args []string) {
-	esManager := search.MakeESManager(elasticUrl)
-	esc, err := esManager.GetClient()
-	utils.Must(err)
+	if elasticUrl == "" && typoDictionariesPath == "" {
+		log.Fatal("Either --elastic or --dictionaries should be set.")
+	}
+	var esc *elastic.Client
+	if elasticUrl != "" {
+		esManager := search.MakeESManager(elasticUrl)
+		var err error
+		esc, err = esManager.GetClient()
+		utils.Must(err)
+	}
 	engine := search.NewESEngine(esc, nil, nil, nil, nil, nil)
+	if typoDictionariesPath != "" {
+		typoDictionaries, err := search.LoadTypoDictionaries(typoDictionariesPath)
+		utils.Must(err)
+		if !typoDictionaries.Has(language) {
+			log.Fatalf("No typo dictionary for %s in %s.", language, typoDictionariesPath)
+		}
+		engine.TypoDictionaries = typoDictionaries
+	}
 
 	evalSet, err := search.InitAndReadEvalSet(evalSetPath)
 	utils.Must(err)
@@ -401,6 +509,32 @@ func testTypoSuggestFn(cmd *cobra.Command, args []string) {
 	)
 }
 
+func buildTypoDictionariesFn(cmd *cobra.Command, args []string) {
+	es.InitEnv()
+	esManager := search.MakeESManager(elasticUrl)
+	esc, err := esManager.GetClient()
+	utils.Must(err)
+	defer esManager.Stop()
+
+	langs := consts.ALL_KNOWN_LANGS[:]
+	if typoDictionariesLangs != "" {
+		langs = strings.Split(typoDictionariesLangs, ",")
+	}
+	if typoDictionariesPath == "" {
+		typoDictionariesPath = es.DataFolder("search", "typo_dictionaries")
+	}
+
+	variables, err := search.MakeVariablesV2(es.DataFolder("search", "variables"))
+	utils.Must(err)
+	vocabularies, err := search.BuildTypoVocabularies(context.TODO(), esc, variables, langs)
+	utils.Must(err)
+	for _, lang := range langs {
+		log.Infof("Typo dictionary %s: %d words.", lang, len(vocabularies[lang]))
+	}
+	utils.Must(search.MakeTypoDictionaries(vocabularies).Save(typoDictionariesPath))
+	log.Infof("Typo dictionaries saved to %s.", typoDictionariesPath)
+}
+
 func checkConstantTerms(request string, response string) bool {
 	if len(request) <= 0 || len(response) <= 0 {
 		return true
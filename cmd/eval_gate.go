@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/Bnei-Baruch/archive-backend/search"
+)
+
+// Exit codes of eval gate, 0 when passed.
+const (
+	EVAL_GATE_EXIT_FAILED = 1
+	EVAL_GATE_EXIT_ERROR  = 2
+)
+
+var evalGateCmd = &cobra.Command{
+	Use:   "gate",
+	Short: "Evaluates vs golden reports, exits with non zero code on regression.",
+	Long: fmt.Sprintf(`Evaluates eval sets (or reads --flat_reports) and compares to golden flat reports per language and bucket.
+Writes JSON summary of failed groups and regressed expectations to --output (stdout if not set).
+With --in_process and --index_date gates a new index before switching aliases.
+Exit code: 0 - passed, %d - regression beyond tolerance, %d - evaluation error.`, EVAL_GATE_EXIT_FAILED, EVAL_GATE_EXIT_ERROR),
+	Run: evalGateFn,
+}
+
+var goldenDir string
+var evalGateThresholdsPath string
+var evalGateOutput string
+var evalGateTolerance search.EvalGateTolerance
+
+var goldenFlatReportRe = regexp.MustCompile(`^eval_([a-z]{2})_.*\.flat\.report$`)
+
+func init() {
+	evalGateCmd.Flags().StringVar(&goldenDir, "golden_dir", "data/search/golden", "Folder with golden eval_<lang>_*.flat.report files.")
+	evalGateCmd.Flags().StringVar(&flatReportsPaths, "flat_reports", "", "Paths to csv report file per expectation to gate instead of evaluating, separated by comma.")
+	evalGateCmd.Flags().StringVar(&evalGateThresholdsPath, "thresholds", "", "Path to json with tolerances per language or language/bucket, see search.EvalGateThresholds.")
+	evalGateCmd.Flags().Float64Var(&evalGateTolerance.MaxGoodDrop, "max_good_drop", 1.0, "Default tolerated drop of weighted Good percentage.")
+	evalGateCmd.Flags().Float64Var(&evalGateTolerance.MaxNDCGDrop, "max_ndcg_drop", 1.0, "Default tolerated drop of nDCG@10 (x100).")
+	evalGateCmd.Flags().StringVar(&evalGateOutput, "output", "", "Path to json summary output.")
+	evalCmd.AddCommand(evalGateCmd)
+}
+
+func evalGateFn(cmd *cobra.Command, args []string) {
+	summary, err := runEvalGate()
+	if err != nil {
+		log.Errorf("Eval gate: %+v", err)
+		os.Exit(EVAL_GATE_EXIT_ERROR)
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		log.Errorf("Eval gate: %+v", err)
+		os.Exit(EVAL_GATE_EXIT_ERROR)
+	}
+	if evalGateOutput == "" {
+		fmt.Println(string(data))
+	} else if err := ioutil.WriteFile(evalGateOutput, data, 0644); err != nil {
+		log.Errorf("Eval gate: %+v", err)
+		os.Exit(EVAL_GATE_EXIT_ERROR)
+	}
+	for _, group := range summary.Groups {
+		log.Infof("%s %-15s Queries: %4d Good: %6.2f%% (golden %6.2f%%) nDCG@10: %6.2f (golden %6.2f) Passed: %t",
+			group.Language, group.Bucket, group.Queries, group.Good, group.GoldenGood, group.NDCG, group.GoldenNDCG, group.Passed)
+	}
+	if !summary.Passed {
+		log.Errorf("Eval gate failed: %d groups regressed, %d expectations regressed.", len(summary.Failed), len(summary.Regressions))
+		os.Exit(EVAL_GATE_EXIT_FAILED)
+	}
+	log.Infof("Eval gate passed, %d expectations regressed within tolerance.", len(summary.Regressions))
+}
+
+func runEvalGate() (search.EvalGateSummary, error) {
+	thresholds, err := search.ReadEvalGateThresholds(evalGateThresholdsPath, evalGateTolerance)
+	if err != nil {
+		return search.EvalGateSummary{}, err
+	}
+	goldenPaths, err := filepath.Glob(filepath.Join(goldenDir, "eval_*.flat.report"))
+	if err != nil {
+		return search.EvalGateSummary{}, errors.Wrapf(err, "Golden reports in %s", goldenDir)
+	}
+	if len(goldenPaths) == 0 {
+		return search.EvalGateSummary{}, errors.New(fmt.Sprintf("No golden reports in %s.", goldenDir))
+	}
+	goldenRecords := [][]string{}
+	languages := []string{}
+	for _, path := range goldenPaths {
+		if match := goldenFlatReportRe.FindStringSubmatch(filepath.Base(path)); match != nil {
+			languages = append(languages, match[1])
+		}
+		records, err := readFlatReport(path)
+		if err != nil {
+			return search.EvalGateSummary{}, err
+		}
+		goldenRecords = append(goldenRecords, records...)
+	}
+
+	records := [][]string{}
+	if flatReportsPaths != "" {
+		for _, path := range strings.Split(flatReportsPaths, ",") {
+			flatRecords, err := readFlatReport(path)
+			if err != nil {
+				return search.EvalGateSummary{}, err
+			}
+			records = append(records, flatRecords...)
+		}
+	} else {
+		evalSetPaths := []string{}
+		if evalSetPath != "" {
+			evalSetPaths = strings.Split(evalSetPath, ",")
+		} else {
+			// Recall sets of golden languages, e.g.: data/search/he.recall.csv for data/search/golden.
+			for _, language := range languages {
+				evalSetPaths = append(evalSetPaths, filepath.Join(filepath.Dir(goldenDir), fmt.Sprintf("%s.recall.csv", language)))
+			}
+		}
+		searcher := expSearcher()
+		for _, path := range evalSetPaths {
+			log.Infof("Evaluating: %s", path)
+			evalSet, err := search.InitAndReadEvalSet(path)
+			if err != nil {
+				return search.EvalGateSummary{}, errors.Wrapf(err, "Read eval set %s", path)
+			}
+			results, _, err := search.EvalWithSearcher(evalSet, searcher)
+			if err != nil {
+				return search.EvalGateSummary{}, errors.Wrapf(err, "Evaluate %s", path)
+			}
+			records = append(records, search.ResultsByExpectation(evalSet, results)[1:]...)
+		}
+		if flatReportPath != "" {
+			if err := search.WriteToCsv(flatReportPath, append([][]string{search.FLAT_REPORT_HEADERS}, records...)); err != nil {
+				return search.EvalGateSummary{}, errors.Wrapf(err, "Write flat report %s", flatReportPath)
+			}
+		}
+	}
+	return search.EvalGate(records, goldenRecords, thresholds)
+}
+
+// Flat report records without headers.
+func readFlatReport(path string) ([][]string, error) {
+	log.Infof("Opening: %s", path)
+	reader, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Open flat report %s", path)
+	}
+	defer reader.Close()
+	records, err := csv.NewReader(bufio.NewReader(reader)).ReadAll()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Read flat report %s", path)
+	}
+	if len(records) == 0 {
+		return records, nil
+	}
+	return records[1:], nil
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+
+	"github.com/Bnei-Baruch/archive-backend/api"
+	"github.com/Bnei-Baruch/archive-backend/common"
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/search"
+)
+
+// Searches evaluated queries with ESEngine in this process, same as SearchHandler of the server
+// for /search?q=...&language=...&page_no=1&page_size=...&sort_by=relevance&deb=true.
+type inProcessSearcher struct {
+	preference string
+}
+
+func makeInProcessSearcher() search.EvalSearcher {
+	if inProcessIndexDate != "" {
+		viper.Set("elasticsearch.index-date", inProcessIndexDate)
+	}
+	if inProcessGrammarIndexDate != "" {
+		viper.Set("elasticsearch.grammar-index-date", inProcessGrammarIndexDate)
+	}
+	common.Init()
+	// Same preference as for evaluation of a server running locally.
+	return &inProcessSearcher{preference: fmt.Sprintf("%x", md5.Sum([]byte("127.0.0.1")))}
+}
+
+func (s *inProcessSearcher) String() string {
+	return fmt.Sprintf("in process (index: %s, grammar index: %s)",
+		viper.GetString("elasticsearch.index-date"), viper.GetString("elasticsearch.grammar-index-date"))
+}
+
+func (s *inProcessSearcher) Search(q search.EvalQuery, limit int) (search.QueryResult, error) {
+	queryResult := search.QueryResult{}
+	query := search.ParseQuery(q.Query)
+	query.Deb = true
+	if len(query.Term) == 0 && len(query.ExactTerms) == 0 {
+		return queryResult, errors.New("Can't search with no terms.")
+	}
+	esc, err := common.ESC.GetClient()
+	if err != nil {
+		return queryResult, errors.Wrap(err, "Failed to connect to ElasticSearch.")
+	}
+	se := search.NewESEngine(esc, common.DB, common.CACHE, common.TOKENS_CACHE, common.VARIABLES_RELOADER.Variables(), consts.ES_SEARCH_RESULT_TYPES)
+	se.BestBets = common.BEST_BETS
+	se.TypoDictionaries = common.TYPO_DICTS
+	se.Transliterator = common.TRANSLITERATOR
+	se.Glossary = common.GLOSSARY
+
+	query.LanguageOrder = api.SearchLanguageOrder(query, q.Language, "")
+	checkTypo := api.SearchCheckTypo(se, query, q.Language)
+	res, err := se.DoSearch(context.TODO(), query, consts.SORT_BY_RELEVANCE, 0, limit, s.preference,
+		checkTypo, true, true, true, api.SearchDeadlines(), nil)
+	if err != nil {
+		return queryResult, err
+	}
+	api.PrepareSearchResultForClient(res)
+	// Results are evaluated as decoded from server response.
+	data, err := json.Marshal(res)
+	if err != nil {
+		return queryResult, errors.Wrapf(err, "Marshal result of [%s]", q.Query)
+	}
+	if err := json.Unmarshal(data, &queryResult); err != nil {
+		return queryResult, errors.Wrapf(err, "Unmarshal result of [%s]", q.Query)
+	}
+	return queryResult, nil
+}
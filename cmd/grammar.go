@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/Bnei-Baruch/archive-backend/common"
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+	"github.com/Bnei-Baruch/archive-backend/search"
+	"github.com/Bnei-Baruch/archive-backend/utils"
+)
+
+var grammarCmd = &cobra.Command{
+	Use:   "grammar",
+	Short: "Grammar tools.",
+}
+
+var grammarLintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Lint grammars and verify their # expect: annotations.",
+	Run:   grammarLintFn,
+}
+
+var grammarStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Report how many percolator docs grammar rules expand into, per intent and language.",
+	Run:   grammarStatsFn,
+}
+
+var grammarsDir string
+var grammarLintStrict bool
+
+func init() {
+	grammarLintCmd.PersistentFlags().StringVar(&grammarsDir, "grammars", "", "Grammars folder, data/search/grammars if not set.")
+	grammarLintCmd.PersistentFlags().BoolVar(&grammarLintStrict, "strict", false, "Fail on warnings, not only on errors.")
+	grammarCmd.AddCommand(grammarLintCmd)
+	grammarStatsCmd.PersistentFlags().StringVar(&grammarsDir, "grammars", "", "Grammars folder, data/search/grammars if not set.")
+	grammarCmd.AddCommand(grammarStatsCmd)
+	RootCmd.AddCommand(grammarCmd)
+}
+
+// Lints without MDB and Elastic: variables are loaded from files and the glossary only,
+// rules of intents matched by cached MDB data are not verified.
+func grammarLintFn(cmd *cobra.Command, args []string) {
+	es.InitEnv()
+	if grammarsDir == "" {
+		grammarsDir = es.DataFolder("search", "grammars")
+	}
+
+	variables, err := search.MakeFileVariablesV2(es.DataFolder("search", "variables"))
+	utils.Must(err)
+	glossary, err := search.MakeGlossary(es.DataFolder("search", "glossary"))
+	utils.Must(err)
+	search.AddGlossaryVariable(variables, glossary)
+
+	lines, expectations, err := search.ReadGrammarLinesV2(grammarsDir)
+	utils.Must(err)
+	log.Infof("Linting %d rules.", len(lines))
+	issues := search.LintGrammars(lines, variables, nil, false)
+
+	// Expectations are verified against a test grammar index of the embedded backend.
+	grammars, err := search.MakeGrammarsV2(grammarsDir)
+	utils.Must(err)
+	backend, err := es.MakeBackend(consts.ES_BACKEND_EMBEDDED, "")
+	utils.Must(err)
+	esc, err := backend.NewClient()
+	utils.Must(err)
+	// Serve the test index, see GrammarIndexNameForServing.
+	viper.Set("elasticsearch.grammar-index-date", "")
+	utils.Must(search.IndexGrammars(esc, "", grammars, variables, nil))
+	engine := search.NewESEngine(esc, nil, nil, nil, variables, nil)
+	log.Infof("Verifying %d expectations.", len(expectations))
+	expectationIssues, err := engine.VerifyGrammarExpectations(context.TODO(), expectations)
+	utils.Must(err)
+	issues = append(issues, expectationIssues...)
+	esc.Stop()
+	backend.Stop()
+
+	errorsCount := 0
+	for _, issue := range issues {
+		fmt.Println(issue.String())
+		if issue.Severity == search.GRAMMAR_LINT_ERROR {
+			errorsCount++
+		}
+	}
+	fmt.Printf("%d rules, %d expectations: %d errors, %d warnings.\n",
+		len(lines), len(expectations), errorsCount, len(issues)-errorsCount)
+	if errorsCount > 0 || (grammarLintStrict && len(issues) > 0) {
+		os.Exit(1)
+	}
+}
+
+func grammarStatsFn(cmd *cobra.Command, args []string) {
+	common.Init()
+	defer common.Shutdown()
+	if grammarsDir == "" {
+		grammarsDir = es.DataFolder("search", "grammars")
+	}
+	grammars, err := search.MakeGrammarsV2(grammarsDir)
+	utils.Must(err)
+	limits := search.GrammarExpansionLimitsFromConfig()
+	expansions := search.AnalyzeGrammarExpansion(grammars, common.VARIABLES, common.CACHE, limits)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LANG\tINTENT\tVARIABLES\tRULES\tCOMBINATIONS\tDOCS\tINDEXED\tPHRASES\tNOTE")
+	totals := make(map[string]map[string]int)
+	for _, e := range expansions {
+		notes := []string(nil)
+		if e.YearRange {
+			notes = append(notes, fmt.Sprintf("$Year range %d-%d", e.YearFrom, e.YearTo))
+		}
+		if e.Capped() {
+			notes = append(notes, fmt.Sprintf("capped at %d", limits.MaxDocs))
+		} else if limits.WarnDocs > 0 && e.Docs > limits.WarnDocs {
+			notes = append(notes, fmt.Sprintf("over %d", limits.WarnDocs))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\n", e.Language, e.Intent, strings.Join(e.Variables, " "),
+			e.Rules, e.Combinations, e.Docs, e.Indexed, e.Phrases, strings.Join(notes, ", "))
+		if _, ok := totals[e.Intent]; !ok {
+			totals[e.Intent] = make(map[string]int)
+		}
+		totals[e.Intent][e.Language] += e.Indexed
+	}
+	w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INTENT\tLANG\tINDEXED")
+	total := 0
+	for _, intent := range utils.StringMapOrderedKeys(totals) {
+		for _, lang := range utils.StringMapOrderedKeys(totals[intent]) {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", intent, lang, totals[intent][lang])
+			total += totals[intent][lang]
+		}
+	}
+	w.Flush()
+	fmt.Printf("%d docs for rules with variables.\n", total)
+}
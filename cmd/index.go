@@ -11,6 +11,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"gopkg.in/olivere/elastic.v6"
 
 	"github.com/Bnei-Baruch/archive-backend/common"
 	"github.com/Bnei-Baruch/archive-backend/consts"
@@ -75,6 +76,7 @@ var simulateUpdateCmd = &cobra.Command{
 
 var indexDate string
 var updateAlias bool
+var incremental bool
 
 func init() {
 	RootCmd.AddCommand(indexCmd)
@@ -83,6 +85,7 @@ func init() {
 	RootCmd.AddCommand(indexGrammarsCmd)
 	indexGrammarsCmd.PersistentFlags().StringVar(&indexDate, "index_date", "", "Index date to be used for new index.")
 	indexGrammarsCmd.PersistentFlags().BoolVar(&updateAlias, "update_alias", true, "If set to false will not update alias.")
+	indexGrammarsCmd.PersistentFlags().BoolVar(&incremental, "incremental", false, "Update only changed rules of the current index (or of index_date if set), alias is not switched.")
 	RootCmd.AddCommand(prepareDocsCmd)
 	deleteIndexCmd.PersistentFlags().StringVar(&indexDate, "index_date", "", "Index date to be deleted.")
 	deleteIndexCmd.MarkFlagRequired("index_date")
@@ -111,6 +114,11 @@ func indexGrammarsFn(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	if incremental {
+		indexGrammarsIncremental(esc, clock)
+		return
+	}
+
 	date := getDateAlias()
 
 	if indexDate != "" {
@@ -130,12 +138,7 @@ func indexGrammarsFn(cmd *cobra.Command, args []string) {
 	}
 
 	log.Infof("Client loaded.")
-	variables, err := search.MakeVariablesV2(es.DataFolder("search", "variables"))
-	utils.Must(err)
-	log.Infof("Variables loaded.")
-	grammars, err := search.MakeGrammarsV2(es.DataFolder("search", "grammars"))
-	utils.Must(err)
-	log.Infof("Grammars loaded.")
+	grammars, variables := loadGrammarsAndVariables()
 
 	err = search.IndexGrammars(esc, date, grammars, variables, common.CACHE)
 	if err != nil {
@@ -153,6 +156,31 @@ func indexGrammarsFn(cmd *cobra.Command, args []string) {
 	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
 }
 
+func loadGrammarsAndVariables() (search.GrammarsV2, search.VariablesV2) {
+	variables, err := search.MakeVariablesV2(es.DataFolder("search", "variables"))
+	utils.Must(err)
+	glossary, err := search.MakeGlossary(es.DataFolder("search", "glossary"))
+	utils.Must(err)
+	search.AddGlossaryVariable(variables, glossary)
+	utils.Must(search.AddDBVariables(variables, common.DB, common.CACHE))
+	log.Infof("Variables loaded.")
+	grammars, err := search.MakeGrammarsV2(es.DataFolder("search", "grammars"))
+	utils.Must(err)
+	log.Infof("Grammars loaded.")
+	return grammars, variables
+}
+
+// Updates index_date grammar index, or the aliased one when not set, in place.
+func indexGrammarsIncremental(esc *elastic.Client, clock time.Time) {
+	grammars, variables := loadGrammarsAndVariables()
+	if err := search.IndexGrammarsIncremental(esc, indexDate, grammars, variables, common.CACHE); err != nil {
+		log.Error(errors.Wrap(err, "Failed incremental grammar update."))
+	} else {
+		log.Info("Grammar index updated.")
+	}
+	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
+}
+
 func indexFn(cmd *cobra.Command, args []string) {
 	clock := common.Init()
 	defer common.Shutdown()
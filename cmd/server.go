@@ -1,6 +1,13 @@
 package cmd
 
 import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	log "github.com/Sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -21,9 +28,11 @@ var serverCmd = &cobra.Command{
 }
 
 var bindAddress string
+var updateGrammarIndex bool
 
 func init() {
 	serverCmd.PersistentFlags().StringVar(&bindAddress, "bind_address", "", "Bind address for server.")
+	serverCmd.PersistentFlags().BoolVar(&updateGrammarIndex, "update_grammar_index", false, "Update grammar index incrementally when variables or grammar files change, set for a single server replica only.")
 	viper.BindPFlag("server.bind-address", serverCmd.PersistentFlags().Lookup("bind_address"))
 	RootCmd.AddCommand(serverCmd)
 }
@@ -32,6 +41,8 @@ func serverFn(cmd *cobra.Command, args []string) {
 	log.Infof("Starting Archive backend server version %s", version.Version)
 	common.Init()
 	defer common.Shutdown()
+	common.StartVariablesReloader(updateGrammarIndex)
+	common.InitTokensCache()
 
 	// Setup Rollbar
 	rollbar.Token = viper.GetString("server.rollbar-token")
@@ -42,7 +53,19 @@ func serverFn(cmd *cobra.Command, args []string) {
 	gin.SetMode(viper.GetString("server.mode"))
 	middleware := []gin.HandlerFunc{
 		utils.LoggerMiddleware(),
-		utils.DataStoresMiddleware(common.DB, common.ESC, common.CACHE /*common.GRAMMARS,*/, common.TOKENS_CACHE, common.CMS, common.VARIABLES),
+		utils.DataStoresMiddleware(utils.DataStores{
+			DB:        common.DB,
+			ESManager: common.ESC,
+			Cache:     common.CACHE,
+			//Grammars: common.GRAMMARS,
+			TokensCache:      common.TOKENS_CACHE,
+			CMS:              common.CMS,
+			Variables:        common.VARIABLES_RELOADER,
+			BestBets:         common.BEST_BETS,
+			TypoDictionaries: common.TYPO_DICTS,
+			Transliterator:   common.TRANSLITERATOR,
+			Glossary:         common.GLOSSARY,
+		}),
 		utils.ErrorHandlingMiddleware(),
 	}
 
@@ -60,13 +83,44 @@ func serverFn(cmd *cobra.Command, args []string) {
 	router.Use(middleware...)
 	api.SetupRoutes(router)
 
+	bind := viper.GetString("server.bind-address")
+	if bind == "" {
+		// As gin's Run without address.
+		if port := os.Getenv("PORT"); port != "" {
+			bind = ":" + port
+		} else {
+			bind = ":8080"
+		}
+	}
+	srv := &http.Server{Addr: bind, Handler: router}
+
+	// Graceful shutdown on kill, in flight requests are served before closing data stores
+	// (deferred common.Shutdown), e.g., to save tokens cache snapshot.
+	viper.SetDefault("server.shutdown-timeout", 30*time.Second)
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan bool)
+	go func() {
+		sig := <-signalChan
+		log.Infof("Received %s, shutting down", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("server.shutdown-timeout"))
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Errorf("Server shutdown: %s", err.Error())
+		}
+		close(stopped)
+	}()
+
 	log.Infoln("Running application")
 	if cmd != nil {
-		router.Run(viper.GetString("server.bind-address"))
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			log.Errorf("Server: %+v", err)
+			return
+		}
+		<-stopped
 	}
 
-	// This would be reasonable once we'll have graceful shutdown implemented
-	// if len(rollbar.Token) > 0 {
-	// 	rollbar.Wait()
-	// }
+	if len(rollbar.Token) > 0 {
+		rollbar.Wait()
+	}
 }
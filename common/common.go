@@ -6,6 +6,7 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	_ "github.com/lib/pq"
+	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 	"github.com/volatiletech/sqlboiler/v4/boil"
 
@@ -19,15 +20,22 @@ import (
 )
 
 var (
-	DB     *sql.DB
-	ESC    *search.ESManager
-	CACHE  cache.CacheManager
+	DB    *sql.DB
+	ESC   *search.ESManager
+	CACHE cache.CacheManager
 	//GRAMMARS     search.Grammars
-	VARIABLES    search.VariablesV2
-	TOKENS_CACHE *search.TokensCache
-	CMS          *api.CMSParams
+	VARIABLES      search.VariablesV2
+	TOKENS_CACHE   *search.TokensCache
+	BEST_BETS      *search.BestBets
+	TYPO_DICTS     *search.TypoDictionaries
+	TRANSLITERATOR *search.Transliterator
+	GLOSSARY       *search.Glossary
+	CMS            *api.CMSParams
 )
 
+// Reloads VARIABLES in the running server, see search.VariablesReloader.
+var VARIABLES_RELOADER *search.VariablesReloader
+
 func Init() time.Time {
 	return InitWithDefault(nil, nil)
 }
@@ -76,7 +84,7 @@ func InitWithDefault(defaultDb *sql.DB, defaultCache *cache.CacheManager) time.T
 
 	esc, err := ESC.GetClient()
 	if esc != nil && err == nil {
-		esversion, err := esc.ElasticsearchVersion(url)
+		esversion, err := esc.ElasticsearchVersion(ESC.Url())
 		utils.Must(err)
 		log.Infof("Elasticsearch version %s", esversion)
 	}
@@ -85,9 +93,26 @@ func InitWithDefault(defaultDb *sql.DB, defaultCache *cache.CacheManager) time.T
 
 	TOKENS_CACHE = search.MakeTokensCache(consts.TOKEN_CACHE_SIZE)
 
-	// Moving to Grammars V2 that are indexed and searched.
-	VARIABLES, err = search.MakeVariablesV2(es.DataFolder("search", "variables"))
-	//utils.Must(err)
+	GLOSSARY, err = search.MakeGlossary(es.DataFolder("search", "glossary"))
+	if err != nil {
+		log.Errorf("Failed loading glossary: %+v", err)
+	}
+	viper.SetDefault("elasticsearch.refresh-best-bets", time.Minute)
+	BEST_BETS, err = search.MakeBestBets(es.DataFolder("search", "best_bets"), viper.GetDuration("elasticsearch.refresh-best-bets"))
+	if err != nil {
+		log.Errorf("Failed loading best bets: %+v", err)
+	}
+	// Local typo dictionaries replace the Elastic suggester, see: build_typo_dictionaries command.
+	if viper.GetBool("elasticsearch.typo-dictionaries") {
+		TYPO_DICTS, err = search.LoadTypoDictionaries(es.DataFolder("search", "typo_dictionaries"))
+		if err != nil {
+			log.Errorf("Failed loading typo dictionaries: %+v", err)
+		}
+	}
+	TRANSLITERATOR, err = search.MakeTransliterator(es.DataFolder("search", "transliteration"))
+	if err != nil {
+		log.Errorf("Failed loading transliteration terms: %+v", err)
+	}
 	//GRAMMARS, err = search.MakeGrammars(viper.GetString("elasticsearch.grammars"), esc, TOKENS_CACHE, VARIABLES)
 	//utils.Must(err)
 	if defaultCache == nil {
@@ -99,12 +124,80 @@ func InitWithDefault(defaultDb *sql.DB, defaultCache *cache.CacheManager) time.T
 	} else {
 		CACHE = *defaultCache
 	}
+	// Moving to Grammars V2 that are indexed and searched.
+	// Variables depend on search stats for content thresholds.
+	VARIABLES_RELOADER = search.NewVariablesReloader(es.DataFolder("search", "variables"), DB, CACHE, GLOSSARY)
+	if err := VARIABLES_RELOADER.Reload(); err != nil {
+		log.Errorf("Failed loading variables: %+v", err)
+	}
+	VARIABLES = VARIABLES_RELOADER.Variables()
 
 	return clock
 }
 
+// Starts periodic reload of VARIABLES in the running server.
+// With updateGrammarIndex the served grammar index is also updated when variables or grammar files change,
+// it should be set for a single server only, as each server would write same updates to the index.
+func StartVariablesReloader(updateGrammarIndex bool) {
+	if updateGrammarIndex {
+		grammarsDir := es.DataFolder("search", "grammars")
+		VARIABLES_RELOADER.Watch(grammarsDir)
+		// Grammar index is updated on changes only, it is indexed with startup variables by index_grammars.
+		VARIABLES_RELOADER.OnReload(func(variables search.VariablesV2) error {
+			return updateServedGrammarIndex(grammarsDir, variables)
+		})
+	}
+	viper.SetDefault("elasticsearch.refresh-variables", viper.GetDuration("cache.refresh-search-stats"))
+	viper.SetDefault("elasticsearch.watch-variables", 10*time.Second)
+	VARIABLES_RELOADER.Start(viper.GetDuration("elasticsearch.refresh-variables"), viper.GetDuration("elasticsearch.watch-variables"))
+}
+
 func Shutdown() {
 	utils.Must(DB.Close())
 	ESC.Stop()
+	VARIABLES_RELOADER.Close()
+	TOKENS_CACHE.Close()
 	CACHE.Close()
+	BEST_BETS.Close()
+}
+
+// Updates served grammar index with reloaded grammars and variables, see search.IndexGrammarsIncremental.
+func updateServedGrammarIndex(grammarsDir string, variables search.VariablesV2) error {
+	grammars, err := search.MakeGrammarsV2(grammarsDir)
+	if err != nil {
+		return err
+	}
+	esc, err := ESC.GetClient()
+	if err != nil {
+		return errors.Wrap(err, "Failed to connect to ElasticSearch.")
+	}
+	return search.IndexGrammarsIncremental(esc, "", grammars, variables, CACHE)
+}
+
+// Loads tokens cache snapshot, persists it periodically and on Shutdown, and warms up the cache
+// with frequent queries in background. Called by the server only, other commands do not share the snapshot.
+func InitTokensCache() {
+	viper.SetDefault("cache.tokens-snapshot-max-age", 24*time.Hour)
+	viper.SetDefault("cache.tokens-snapshot-interval", 10*time.Minute)
+	if snapshot := viper.GetString("cache.tokens-snapshot"); snapshot != "" {
+		if _, err := TOKENS_CACHE.LoadSnapshot(snapshot, viper.GetDuration("cache.tokens-snapshot-max-age")); err != nil {
+			log.Errorf("Failed loading tokens cache snapshot: %+v", err)
+		}
+		TOKENS_CACHE.Persist(snapshot, viper.GetDuration("cache.tokens-snapshot-interval"))
+	}
+	if warmUp := viper.GetString("cache.tokens-warm-up"); warmUp != "" {
+		// Without elastic client only languages of local analyzers are warmed up.
+		esc, err := ESC.GetClient()
+		if err != nil {
+			log.Warnf("Warming up tokens cache without elastic client: %+v", err)
+		}
+		go func() {
+			clock := time.Now()
+			count, err := TOKENS_CACHE.WarmUp(warmUp, esc)
+			if err != nil {
+				log.Errorf("Failed warming up tokens cache: %+v", err)
+			}
+			log.Infof("Tokens cache warmed up with %d queries in %s.", count, time.Now().Sub(clock).String())
+		}()
+	}
 }
@@ -439,6 +439,20 @@ const (
 	CONTENT_TYPE_INTENTS_BOOST                      = 8.0 // For priority between several filter intent types
 	SCORE_INCREMENT_FOR_SEARCH_WITHOUT_TERM_RESULTS = 200.0
 	MAX_GRAMMAR_INTENTS_FOR_FILTER_SEARCH           = 4
+	// Max number of already returned hits kept in search cursor to avoid duplications between pages.
+	SEARCH_CURSOR_MAX_SEEN = 200
+	// Boosts for related content sharing sources or tags with the content unit.
+	RELATED_SHARED_SOURCE_BOOST = 3.0
+	RELATED_SHARED_TAG_BOOST    = 1.5
+	// Max number of words and of text length (UTF-16 code units) analyzed in a single request when searching in transcript.
+	TRANSCRIPT_ANALYZE_WORDS_BATCH = 500
+	TRANSCRIPT_ANALYZE_TEXT_BATCH  = 10000
+	// Min. published units for tags, persons and collections loaded from DB as grammar variable values.
+	GRAMMAR_VARIABLE_MIN_TAG_UNITS        = 10
+	GRAMMAR_VARIABLE_MIN_PERSON_UNITS     = 10
+	GRAMMAR_VARIABLE_MIN_COLLECTION_UNITS = 3
+	// Max number of percolator docs indexed or deleted in a single bulk request.
+	GRAMMAR_BULK_BATCH_SIZE = 1000
 )
 
 const (
@@ -466,6 +480,9 @@ const (
 	FILTER_MEDIA_LANGUAGE           = "media_language"
 	FILTER_ORIGINAL_LANGUAGE        = "original_language"
 	FILTER_PERSON                   = "person"
+	FILTER_MEDIA_TYPE               = "media_type"
+	FILTER_MIN_DURATION             = "min_duration" // In minutes.
+	FILTER_MAX_DURATION             = "max_duration" // In minutes.
 
 	// Used to name facets aggregation.
 	AGG_FILTER_DATES         = "dates"
@@ -474,6 +491,11 @@ const (
 	DATE_FILTER_LAST_7_DAYS  = "LAST_7_DAYS"
 	DATE_FILTER_LAST_30_DAYS = "LAST_30_DAYS"
 
+	AGG_FILTER_DURATIONS         = "durations"
+	DURATION_FILTER_UNDER_20_MIN = "UNDER_20_MIN"
+	DURATION_FILTER_20_TO_60_MIN = "20_TO_60_MIN"
+	DURATION_FILTER_OVER_60_MIN  = "OVER_60_MIN"
+
 	FILTER_COLLECTION = "collection" //  Internally used by grammar. Not available in frontend.
 )
 
@@ -487,11 +509,39 @@ var ALL_FILTERS = []string{
 	FILTER_MEDIA_LANGUAGE,
 	FILTER_ORIGINAL_LANGUAGE,
 	FILTER_PERSON,
+	FILTER_MEDIA_TYPE,
+	FILTER_MIN_DURATION,
+	FILTER_MAX_DURATION,
 }
 
+// Media types of files, see FILTER_MEDIA_TYPE.
+const (
+	MEDIA_TYPE_AUDIO = "audio"
+	MEDIA_TYPE_VIDEO = "video"
+	MEDIA_TYPE_TEXT  = "text"
+)
+
+var ALL_MEDIA_TYPES = []string{MEDIA_TYPE_AUDIO, MEDIA_TYPE_VIDEO, MEDIA_TYPE_TEXT}
+
 // ElasticSearch 'es'
 const ES_RESULTS_INDEX = "results"
 
+// Document types of results and grammars indexes (ES 6). Hits of typeless backends are reported with these types too.
+const (
+	ES_RESULTS_DOC_TYPE  = "result"
+	ES_GRAMMARS_DOC_TYPE = "grammars"
+)
+
+// Search backends, see elasticsearch.backend config.
+const (
+	ES_BACKEND_ELASTICSEARCH = "elasticsearch"
+	// Typeless Elasticsearch 7+ and OpenSearch.
+	ES_BACKEND_ELASTICSEARCH7 = "elasticsearch7"
+	ES_BACKEND_OPENSEARCH     = "opensearch"
+	// In memory, for development and tests with no external service.
+	ES_BACKEND_EMBEDDED = "embedded"
+)
+
 // Result type
 const ES_RESULT_TYPE = "result_type"
 const ES_RESULT_TYPE_UNITS = "units"
@@ -506,6 +556,12 @@ const SEARCH_RESULT_TWEETS_MANY = "tweets_many"
 const SEARCH_RESULT_LESSONS_SERIES_BY_SOURCE = "lessons_series_by_source"
 const SEARCH_RESULT_LESSONS_SERIES_BY_TAG = "lessons_series_by_tag"
 
+// Result of many content units of the same collection in one hit (collapse mode)
+const SEARCH_RESULT_UNITS_BY_COLLECTION = "units_by_collection"
+
+// Search results collapse modes
+const SEARCH_COLLAPSE_COLLECTION = "collection"
+
 // Additional result types for mobile client
 const SEARCH_RESULT_PROGRAMS_BY_SOURCE = "programs_by_source"
 const SEARCH_RESULT_PROGRAMS_BY_TAG = "programs_by_tag"
@@ -652,13 +708,18 @@ const (
 	GRAMMAR_TYPE_FILTER_WITHOUT_TERM = "filter_without_term"
 	GRAMMAR_TYPE_LANDING_PAGE        = "landing-page"
 	GRAMMAR_TYPE_CLASSIFICATION      = "classification"
+	GRAMMAR_TYPE_DEFINITION          = "definition"
 
 	GRAMMAR_INTENT_FILTER_BY_CONTENT_TYPE         = "by_content_type"
 	GRAMMAR_INTENT_FILTER_BY_SOURCE               = "by_source"
 	GRAMMAR_INTENT_FILTER_BY_PROGRAM              = "by_program"
 	GRAMMAR_INTENT_FILTER_BY_PROGRAM_WITHOUT_TERM = "by_program_without_term"
+	GRAMMAR_INTENT_FILTER_BY_TAG                  = "by_tag"
+	GRAMMAR_INTENT_FILTER_BY_PERSON               = "by_person"
+	GRAMMAR_INTENT_FILTER_BY_COLLECTION           = "by_collection"
 	GRAMMAR_INTENT_SOURCE_POSITION_WITHOUT_TERM   = "source_position_without_term"
 	GRAMMAR_INTENT_PROGRAM_POSITION_WITHOUT_TERM  = "program_position_without_term"
+	GRAMMAR_INTENT_DEFINITION                     = "definition"
 
 	GRAMMAR_LP_SINGLE_COLLECTION = "grammar_landing_page_single_collection_from_sql"
 	GRAMMAR_GENERATED_CU_HIT     = "grammar_generated_content_unit_hit"
@@ -792,6 +853,18 @@ var GRAMMAR_INTENTS_TO_FILTER_VALUES = map[string]map[string][]string{
 	GRAMMAR_INTENT_FILTER_BY_PROGRAM_WITHOUT_TERM: map[string][]string{
 		FILTER_CONTENT_TYPE: []string{CT_VIDEO_PROGRAM_CHAPTER, CT_VIDEO_PROGRAM},
 	},
+
+	GRAMMAR_INTENT_FILTER_BY_TAG: nil,
+
+	GRAMMAR_INTENT_FILTER_BY_PERSON: nil,
+
+	GRAMMAR_INTENT_FILTER_BY_COLLECTION: map[string][]string{
+		FILTER_CONTENT_TYPE: []string{CT_EVENT_PART, CT_CONGRESS, CT_LESSON_PART, CT_MEAL, CT_FRIENDS_GATHERING},
+	},
+
+	// Definitions
+
+	GRAMMAR_INTENT_DEFINITION: nil,
 }
 
 const (
@@ -808,6 +881,13 @@ const (
 	VAR_DIVISION_TYPE       = "$DivisionType"
 	VAR_PROGRAM             = "$Program"
 	VAR_RESTRICTED          = "$Restricted" // Search terms that privent triggering grammar engine.
+	VAR_GLOSSARY            = "$Glossary"   // Glossary terms, see: data/search/glossary.
+	VAR_TAG                 = "$Tag"        // Topics, loaded from DB.
+	VAR_PERSON              = "$Person"     // Persons, loaded from DB.
+	VAR_COLLECTION          = "$Collection" // Congresses, loaded from DB.
+
+	// Value of $Year in grammar rules matched by years range, the year is taken from the query.
+	VAR_YEAR_RANGE_PLACEHOLDER = "0000"
 
 	// $ContentType variable values
 
@@ -887,6 +967,9 @@ var VARIABLE_TO_FILTER = map[string]string{
 	VAR_SOURCE:              "source",
 	VAR_POSITION:            "position",
 	VAR_PROGRAM:             "program",
+	VAR_TAG:                 FILTER_TAG,
+	VAR_PERSON:              FILTER_PERSON,
+	VAR_COLLECTION:          FILTER_COLLECTION,
 }
 
 // Latency log
@@ -899,6 +982,7 @@ const (
 	LAT_DOSEARCH_ADDINTENTS_SECONDROUNDDO       = "DoSearch.AddIntents.SecondRoundDo"
 	LAT_DOSEARCH_MULTISEARCHTWEETSDO            = "DoSearch.MultisearchTweetsDo"
 	LAT_DOSEARCH_TYPOSUGGESTDO                  = "DoSearch.TypoSuggestDo"
+	LAT_DOSEARCH_MULTISEARCHBATCHDO             = "DoSearch.MultisearchBatchDo"
 	LAT_GETSUGGESTIONS                          = "GetSuggestions"
 	LAT_SUGGEST_SUGGESTIONS                     = "GetSuggestions.SuggestSuggestions"
 	LAT_GETSUGGESTIONS_MULTISEARCHDO            = "GetSuggestions.MultisearchDo"
@@ -906,6 +990,8 @@ const (
 	LAT_DOSEARCH_GRAMMARS_MULTISEARCHFILTERDO   = "DoSearch.SearchGrammars.MultisearchFilterDo"
 	LAT_DOSEARCH_GRAMMARS_RESULTSTOINTENTS      = "DoSearch.SearchGrammars.ResultsToIntents"
 	LAT_GET_SOURCE_COUNTS                       = "GetSourceCounts"
+	LAT_RELATED_CONTENT                         = "RelatedContent"
+	LAT_SEARCH_TRANSCRIPT                       = "SearchTranscript"
 )
 
 const (
@@ -944,6 +1030,9 @@ const (
 )
 const PERSON_BNEI_BARUCH_UID = "qIiJaey9"
 
+// Parent tag of the holidays (e.g., Pesach, Sukkot), its child tags are the $Holidays grammar variable values.
+const TAG_HOLIDAYS_UID = "1nyptSIo"
+
 var ES_SUGGEST_SOURCES_WEIGHT = map[string]float64{
 	SRC_NONE_ELSE_BESIDE_HIM:   200,
 	SRC_PEACE_ARCTICLE:         120,
@@ -0,0 +1,89 @@
+package es
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es/embedded"
+)
+
+// Search backend used by the indexer and the search engine, both talk to it with an elastic client.
+// Only Elasticsearch is abstracted, the indexer still reads from MDB (Postgres), so indexer
+// tests require the test database also with the embedded backend.
+type Backend interface {
+	// Url of the backend REST API.
+	Url() string
+	NewClient(options ...elastic.ClientOptionFunc) (*elastic.Client, error)
+	Stop()
+}
+
+// Returns the backend by name, empty name is Elasticsearch at url.
+func MakeBackend(name string, url string) (Backend, error) {
+	switch name {
+	case "", consts.ES_BACKEND_ELASTICSEARCH:
+		return &elasticsearchBackend{url: url}, nil
+	case consts.ES_BACKEND_ELASTICSEARCH7, consts.ES_BACKEND_OPENSEARCH:
+		return &typelessBackend{url: url}, nil
+	case consts.ES_BACKEND_EMBEDDED:
+		server := embedded.NewServer()
+		if err := server.Start(); err != nil {
+			return nil, errors.Wrap(err, "Start embedded backend.")
+		}
+		return &embeddedBackend{server: server}, nil
+	}
+	return nil, errors.Errorf("Unknown search backend: %s.", name)
+}
+
+type elasticsearchBackend struct {
+	url string
+}
+
+func (b *elasticsearchBackend) Url() string {
+	return b.url
+}
+
+func (b *elasticsearchBackend) NewClient(options ...elastic.ClientOptionFunc) (*elastic.Client, error) {
+	return elastic.NewClient(append([]elastic.ClientOptionFunc{elastic.SetURL(b.url), elastic.SetSniff(false)}, options...)...)
+}
+
+func (b *elasticsearchBackend) Stop() {}
+
+// Elasticsearch 7+ or OpenSearch, requests of the (ES 6) elastic client are made typeless in transport.
+type typelessBackend struct {
+	url string
+}
+
+func (b *typelessBackend) Url() string {
+	return b.url
+}
+
+func (b *typelessBackend) NewClient(options ...elastic.ClientOptionFunc) (*elastic.Client, error) {
+	httpClient := &http.Client{Transport: &typelessTransport{next: http.DefaultTransport}}
+	return elastic.NewClient(append([]elastic.ClientOptionFunc{
+		elastic.SetURL(b.url),
+		elastic.SetSniff(false),
+		elastic.SetHttpClient(httpClient),
+	}, options...)...)
+}
+
+func (b *typelessBackend) Stop() {}
+
+// In memory backend, data is lost on Stop.
+type embeddedBackend struct {
+	server *embedded.Server
+}
+
+func (b *embeddedBackend) Url() string {
+	return b.server.URL()
+}
+
+func (b *embeddedBackend) NewClient(options ...elastic.ClientOptionFunc) (*elastic.Client, error) {
+	return elastic.NewClient(append([]elastic.ClientOptionFunc{elastic.SetURL(b.server.URL()), elastic.SetSniff(false)}, options...)...)
+}
+
+func (b *embeddedBackend) Stop() {
+	b.server.Close()
+}
@@ -342,6 +342,11 @@ func (index *ContentUnitsIndex) prepareIndexUnit(cu *mdbmodels.ContentUnit, inde
 					}
 					unit.EffectiveDate = &utils.Date{Time: val}
 				}
+				if duration, ok := props["duration"]; ok {
+					if val, ok := duration.(float64); ok && val > 0 {
+						unit.Duration = int64(val)
+					}
+				}
 			}
 
 			if val, ok := indexData.Sources[cu.UID]; ok {
@@ -359,6 +364,9 @@ func (index *ContentUnitsIndex) prepareIndexUnit(cu *mdbmodels.ContentUnit, inde
 			if val, ok := indexData.MediaLanguages[cu.UID]; ok {
 				unit.FilterValues = append(unit.FilterValues, KeyValues(consts.FILTER_MEDIA_LANGUAGE, val)...)
 			}
+			if val, ok := indexData.MediaTypes[cu.UID]; ok {
+				unit.FilterValues = append(unit.FilterValues, KeyValues(consts.FILTER_MEDIA_TYPE, val)...)
+			}
 			if byLang, ok := indexData.Transcripts[cu.UID]; ok {
 				if val, ok := byLang[i18n.Language]; ok {
 					var err error
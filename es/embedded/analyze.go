@@ -0,0 +1,88 @@
+package embedded
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Token as returned by _analyze, offsets are in UTF-16 code units as in Elastic.
+type token struct {
+	Token       string `json:"token"`
+	StartOffset int    `json:"start_offset"`
+	EndOffset   int    `json:"end_offset"`
+	Type        string `json:"type"`
+	Position    int    `json:"position"`
+}
+
+// Single analyzer for all languages: splits to letters and digits runs, lower cases
+// and removes diacritics (niqqud). No stemming, synonyms or stop words.
+func analyze(text string) []token {
+	tokens := []token{}
+	var b strings.Builder
+	start := 0
+	offset := 0
+	flush := func() {
+		if b.Len() > 0 {
+			tokens = append(tokens, token{
+				Token:       b.String(),
+				StartOffset: start,
+				EndOffset:   offset,
+				Type:        "<ALPHANUM>",
+				Position:    len(tokens),
+			})
+			b.Reset()
+		}
+	}
+	for _, r := range text {
+		size := utf16.RuneLen(r)
+		if size < 0 {
+			size = 1
+		}
+		if unicode.Is(unicode.Mn, r) {
+			offset += size
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if b.Len() == 0 {
+				start = offset
+			}
+			b.WriteRune(unicode.ToLower(r))
+		} else {
+			flush()
+		}
+		offset += size
+	}
+	flush()
+	return tokens
+}
+
+func terms(text string) []string {
+	tokens := analyze(text)
+	ret := make([]string, len(tokens))
+	for i, t := range tokens {
+		ret[i] = t.Token
+	}
+	return ret
+}
+
+// Wraps the tokens of text found in highlightTerms with the tags.
+func highlight(text string, highlightTerms map[string]bool, preTag string, postTag string) (string, bool) {
+	units := utf16.Encode([]rune(text))
+	var b strings.Builder
+	last := 0
+	found := false
+	for _, t := range analyze(text) {
+		if !highlightTerms[t.Token] {
+			continue
+		}
+		found = true
+		b.WriteString(string(utf16.Decode(units[last:t.StartOffset])))
+		b.WriteString(preTag)
+		b.WriteString(string(utf16.Decode(units[t.StartOffset:t.EndOffset])))
+		b.WriteString(postTag)
+		last = t.EndOffset
+	}
+	b.WriteString(string(utf16.Decode(units[last:])))
+	return b.String(), found
+}
@@ -0,0 +1,172 @@
+package embedded
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+type document struct {
+	index   string
+	typ     string
+	id      string
+	seq     int64
+	source  map[string]interface{}
+	raw     json.RawMessage
+	mapping *mapping
+}
+
+// Values of the field path in the source, arrays are flattened.
+// Multi-fields (e.g. title.language, mdb_uid.keyword) resolve to their parent field.
+func (d *document) values(field string) []interface{} {
+	switch field {
+	case "_id":
+		return []interface{}{d.id}
+	case "_type":
+		return []interface{}{d.typ}
+	case "_index":
+		return []interface{}{d.index}
+	}
+	path := strings.Split(field, ".")
+	for len(path) > 0 {
+		if ret := lookup(d.source, path); len(ret) > 0 {
+			return ret
+		}
+		path = path[:len(path)-1]
+	}
+	return nil
+}
+
+func lookup(v interface{}, path []string) []interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		ret := []interface{}{}
+		for _, e := range t {
+			ret = append(ret, lookup(e, path)...)
+		}
+		return ret
+	case map[string]interface{}:
+		if len(path) == 0 {
+			return []interface{}{t}
+		}
+		return lookup(t[path[0]], path[1:])
+	case nil:
+		return nil
+	}
+	if len(path) > 0 {
+		return nil
+	}
+	return []interface{}{v}
+}
+
+// String values of the field, "*" stands for all string values in the document.
+func (d *document) texts(field string) []string {
+	var values []interface{}
+	if field == "*" {
+		values = lookupAll(d.source)
+	} else {
+		values = d.values(field)
+	}
+	ret := []string{}
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+func lookupAll(v interface{}) []interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		ret := []interface{}{}
+		for _, e := range t {
+			ret = append(ret, lookupAll(e)...)
+		}
+		return ret
+	case map[string]interface{}:
+		ret := []interface{}{}
+		for _, e := range t {
+			ret = append(ret, lookupAll(e)...)
+		}
+		return ret
+	}
+	return []interface{}{v}
+}
+
+type completionField struct {
+	// Context name to the source path holding its values.
+	contexts map[string]string
+}
+
+// Field types of an index, parsed from the mappings given on index creation.
+type mapping struct {
+	types       map[string]string
+	completions map[string]completionField
+}
+
+func newMapping() *mapping {
+	return &mapping{types: map[string]string{}, completions: map[string]completionField{}}
+}
+
+// Adds the mappings, either typed (ES 6) or typeless: {"mappings": {"result": {"properties": ...}}}.
+func (m *mapping) add(mappings map[string]interface{}) {
+	if props, ok := mappings["properties"].(map[string]interface{}); ok {
+		m.addProperties("", props)
+		return
+	}
+	for _, typeMapping := range mappings {
+		if tm, ok := typeMapping.(map[string]interface{}); ok {
+			if props, ok := tm["properties"].(map[string]interface{}); ok {
+				m.addProperties("", props)
+			}
+		}
+	}
+}
+
+func (m *mapping) addProperties(prefix string, props map[string]interface{}) {
+	for name, p := range props {
+		pm, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		field := prefix + name
+		if t, ok := pm["type"].(string); ok {
+			m.types[field] = t
+			if t == "completion" {
+				m.addCompletion(field, pm)
+			}
+		}
+		if sub, ok := pm["properties"].(map[string]interface{}); ok {
+			m.addProperties(field+".", sub)
+		}
+		if fields, ok := pm["fields"].(map[string]interface{}); ok {
+			m.addProperties(field+".", fields)
+		}
+	}
+}
+
+func (m *mapping) addCompletion(field string, pm map[string]interface{}) {
+	c := completionField{contexts: map[string]string{}}
+	for _, ctx := range asSlice(pm["contexts"]) {
+		if cm, ok := ctx.(map[string]interface{}); ok {
+			c.contexts[asString(cm["name"])] = asString(cm["path"])
+		}
+	}
+	m.completions[field] = c
+}
+
+func (m *mapping) fieldType(field string) string {
+	if m == nil {
+		return ""
+	}
+	return m.types[field]
+}
+
+// Whether the field is analyzed, unknown fields are dynamically mapped as text.
+func (m *mapping) isText(field string) bool {
+	switch m.fieldType(field) {
+	case "", "text":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,1056 @@
+package embedded
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Compiled query of the supported subset of the query DSL.
+type query interface {
+	// Returns the score and whether the document matches.
+	eval(d *document) (float64, bool)
+	// Adds the terms the query looks for in field, for highlighting.
+	highlightTerms(field string, ret map[string]bool)
+}
+
+type parseError struct {
+	reason string
+}
+
+func (e *parseError) Error() string {
+	return e.reason
+}
+
+func parseErrorf(format string, args ...interface{}) error {
+	return &parseError{reason: fmt.Sprintf(format, args...)}
+}
+
+func parseQuery(raw interface{}) (query, error) {
+	m, ok := raw.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return nil, parseErrorf("query malformed, expected a single query object, got: %+v", raw)
+	}
+	for name, body := range m {
+		switch name {
+		case "match_all":
+			return &matchAllQuery{boost: boostOf(body)}, nil
+		case "match_none":
+			return matchNoneQuery{}, nil
+		case "more_like_this":
+			// Not supported, never matches.
+			return matchNoneQuery{}, nil
+		case "bool":
+			return parseBoolQuery(body)
+		case "constant_score":
+			return parseConstantScoreQuery(body)
+		case "dis_max":
+			return parseDisMaxQuery(body)
+		case "function_score":
+			return parseFunctionScoreQuery(body)
+		case "nested":
+			b, _ := body.(map[string]interface{})
+			return parseQuery(b["query"])
+		case "term", "prefix", "wildcard":
+			return parseTermQuery(name, body)
+		case "terms":
+			return parseTermsQuery(body)
+		case "ids":
+			b, _ := body.(map[string]interface{})
+			return &termsQuery{field: "_id", values: asSlice(b["values"]), boost: boostOf(body)}, nil
+		case "exists":
+			b, _ := body.(map[string]interface{})
+			return &existsQuery{field: asString(b["field"])}, nil
+		case "range":
+			return parseRangeQuery(body)
+		case "match", "match_phrase", "match_phrase_prefix":
+			return parseMatchQuery(name, body)
+		case "multi_match":
+			return parseMultiMatchQuery(body)
+		case "simple_query_string", "query_string":
+			return parseQueryStringQuery(body)
+		case "percolate":
+			return parsePercolateQuery(body)
+		case "span_near":
+			return parseSpanNearQuery(body)
+		case "span_term", "span_multi":
+			clause, err := parseSpanClause(m)
+			if err != nil {
+				return nil, err
+			}
+			return &tokenQuery{clause: clause, boost: 1}, nil
+		case "fuzzy":
+			clause, err := parseMultiTermClause(m)
+			if err != nil {
+				return nil, err
+			}
+			return &tokenQuery{clause: clause, boost: 1}, nil
+		default:
+			return nil, parseErrorf("no [query] registered for [%s]", name)
+		}
+	}
+	return nil, nil
+}
+
+// Parses a single query or an array of queries.
+func parseQueries(raw interface{}) ([]query, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	ret := []query{}
+	for _, r := range asSlice(raw) {
+		q, err := parseQuery(r)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, q)
+	}
+	return ret, nil
+}
+
+type matchAllQuery struct {
+	boost float64
+}
+
+func (q *matchAllQuery) eval(d *document) (float64, bool) { return q.boost, true }
+
+func (q *matchAllQuery) highlightTerms(field string, ret map[string]bool) {}
+
+type matchNoneQuery struct{}
+
+func (matchNoneQuery) eval(d *document) (float64, bool) { return 0, false }
+
+func (matchNoneQuery) highlightTerms(field string, ret map[string]bool) {}
+
+type boolQuery struct {
+	must               []query
+	filter             []query
+	should             []query
+	mustNot            []query
+	minimumShouldMatch int
+	boost              float64
+}
+
+func parseBoolQuery(body interface{}) (query, error) {
+	b, _ := body.(map[string]interface{})
+	q := &boolQuery{boost: boostOf(body)}
+	var err error
+	if q.must, err = parseQueries(b["must"]); err != nil {
+		return nil, err
+	}
+	if q.filter, err = parseQueries(b["filter"]); err != nil {
+		return nil, err
+	}
+	if q.should, err = parseQueries(b["should"]); err != nil {
+		return nil, err
+	}
+	if q.mustNot, err = parseQueries(b["must_not"]); err != nil {
+		return nil, err
+	}
+	if len(q.should) > 0 && len(q.must) == 0 && len(q.filter) == 0 {
+		q.minimumShouldMatch = 1
+	}
+	if msm, ok := b["minimum_should_match"]; ok {
+		s := strings.TrimSpace(asString(msm))
+		if strings.HasSuffix(s, "%") {
+			if p, err := strconv.Atoi(strings.TrimSuffix(s, "%")); err == nil {
+				q.minimumShouldMatch = len(q.should) * p / 100
+			}
+		} else if n, err := strconv.Atoi(s); err == nil {
+			if n < 0 {
+				n += len(q.should)
+			}
+			q.minimumShouldMatch = n
+		}
+	}
+	return q, nil
+}
+
+func (q *boolQuery) eval(d *document) (float64, bool) {
+	score := 0.0
+	for _, c := range q.must {
+		s, ok := c.eval(d)
+		if !ok {
+			return 0, false
+		}
+		score += s
+	}
+	for _, c := range q.filter {
+		if _, ok := c.eval(d); !ok {
+			return 0, false
+		}
+	}
+	for _, c := range q.mustNot {
+		if _, ok := c.eval(d); ok {
+			return 0, false
+		}
+	}
+	matched := 0
+	for _, c := range q.should {
+		if s, ok := c.eval(d); ok {
+			matched++
+			score += s
+		}
+	}
+	if matched < q.minimumShouldMatch {
+		return 0, false
+	}
+	return score * q.boost, true
+}
+
+func (q *boolQuery) highlightTerms(field string, ret map[string]bool) {
+	for _, qs := range [][]query{q.must, q.filter, q.should} {
+		for _, c := range qs {
+			c.highlightTerms(field, ret)
+		}
+	}
+}
+
+type constantScoreQuery struct {
+	filter query
+	boost  float64
+}
+
+func parseConstantScoreQuery(body interface{}) (query, error) {
+	b, _ := body.(map[string]interface{})
+	filter, err := parseQuery(b["filter"])
+	if err != nil {
+		return nil, err
+	}
+	return &constantScoreQuery{filter: filter, boost: boostOf(body)}, nil
+}
+
+func (q *constantScoreQuery) eval(d *document) (float64, bool) {
+	if _, ok := q.filter.eval(d); !ok {
+		return 0, false
+	}
+	return q.boost, true
+}
+
+func (q *constantScoreQuery) highlightTerms(field string, ret map[string]bool) {
+	q.filter.highlightTerms(field, ret)
+}
+
+type disMaxQuery struct {
+	queries    []query
+	tieBreaker float64
+	boost      float64
+}
+
+func parseDisMaxQuery(body interface{}) (query, error) {
+	b, _ := body.(map[string]interface{})
+	queries, err := parseQueries(b["queries"])
+	if err != nil {
+		return nil, err
+	}
+	return &disMaxQuery{queries: queries, tieBreaker: asFloat(b["tie_breaker"], 0), boost: boostOf(body)}, nil
+}
+
+func (q *disMaxQuery) eval(d *document) (float64, bool) {
+	max, sum := 0.0, 0.0
+	matched := false
+	for _, c := range q.queries {
+		if s, ok := c.eval(d); ok {
+			matched = true
+			sum += s
+			max = math.Max(max, s)
+		}
+	}
+	if !matched {
+		return 0, false
+	}
+	return (max + q.tieBreaker*(sum-max)) * q.boost, true
+}
+
+func (q *disMaxQuery) highlightTerms(field string, ret map[string]bool) {
+	for _, c := range q.queries {
+		c.highlightTerms(field, ret)
+	}
+}
+
+type scoreFunction struct {
+	filter query
+	weight float64
+}
+
+// Only weight functions are applied, decay and other functions are ignored.
+type functionScoreQuery struct {
+	query     query
+	functions []scoreFunction
+	scoreMode string
+	boostMode string
+	boost     float64
+}
+
+func parseFunctionScoreQuery(body interface{}) (query, error) {
+	b, _ := body.(map[string]interface{})
+	q := &functionScoreQuery{
+		query:     &matchAllQuery{boost: 1},
+		scoreMode: asString(b["score_mode"]),
+		boostMode: asString(b["boost_mode"]),
+		boost:     boostOf(body),
+	}
+	if b["query"] != nil {
+		var err error
+		if q.query, err = parseQuery(b["query"]); err != nil {
+			return nil, err
+		}
+	}
+	if w, ok := b["weight"]; ok {
+		q.functions = append(q.functions, scoreFunction{weight: asFloat(w, 1)})
+	}
+	for _, f := range asSlice(b["functions"]) {
+		fm, _ := f.(map[string]interface{})
+		sf := scoreFunction{weight: asFloat(fm["weight"], 1)}
+		if fm["filter"] != nil {
+			var err error
+			if sf.filter, err = parseQuery(fm["filter"]); err != nil {
+				return nil, err
+			}
+		}
+		q.functions = append(q.functions, sf)
+	}
+	return q, nil
+}
+
+func (q *functionScoreQuery) eval(d *document) (float64, bool) {
+	score, ok := q.query.eval(d)
+	if !ok {
+		return 0, false
+	}
+	factor := 1.0
+	applied := false
+	for _, f := range q.functions {
+		if f.filter != nil {
+			if _, ok := f.filter.eval(d); !ok {
+				continue
+			}
+		}
+		if !applied {
+			factor = f.weight
+			applied = true
+			continue
+		}
+		switch q.scoreMode {
+		case "sum", "avg":
+			factor += f.weight
+		case "max":
+			factor = math.Max(factor, f.weight)
+		case "min":
+			factor = math.Min(factor, f.weight)
+		case "first":
+		default:
+			factor *= f.weight
+		}
+	}
+	switch q.boostMode {
+	case "replace":
+		score = factor
+	case "sum":
+		score += factor
+	case "max":
+		score = math.Max(score, factor)
+	case "min":
+		score = math.Min(score, factor)
+	default:
+		score *= factor
+	}
+	return score * q.boost, true
+}
+
+func (q *functionScoreQuery) highlightTerms(field string, ret map[string]bool) {
+	q.query.highlightTerms(field, ret)
+}
+
+// Term, prefix or wildcard (trailing * only) query.
+type termQuery struct {
+	field  string
+	value  interface{}
+	prefix bool
+	boost  float64
+}
+
+func parseTermQuery(name string, body interface{}) (query, error) {
+	field, value, boost, err := fieldAndValue(body, "value")
+	if err != nil {
+		return nil, err
+	}
+	q := &termQuery{field: field, value: value, boost: boost}
+	switch name {
+	case "prefix":
+		q.prefix = true
+	case "wildcard":
+		s := asString(value)
+		if strings.ContainsAny(strings.TrimSuffix(s, "*"), "*?") {
+			return nil, parseErrorf("wildcard [%s] not supported", s)
+		}
+		q.value = strings.TrimSuffix(s, "*")
+		q.prefix = true
+	}
+	return q, nil
+}
+
+func (q *termQuery) eval(d *document) (float64, bool) {
+	if termMatches(d, q.field, q.value, q.prefix) {
+		return q.boost, true
+	}
+	return 0, false
+}
+
+func (q *termQuery) highlightTerms(field string, ret map[string]bool) {
+	if fieldMatches(q.field, field) {
+		ret[strings.ToLower(asString(q.value))] = true
+	}
+}
+
+type termsQuery struct {
+	field  string
+	values []interface{}
+	boost  float64
+}
+
+func parseTermsQuery(body interface{}) (query, error) {
+	b, _ := body.(map[string]interface{})
+	q := &termsQuery{boost: boostOf(body)}
+	for k, v := range b {
+		if k == "boost" || k == "_name" {
+			continue
+		}
+		q.field = k
+		q.values = asSlice(v)
+	}
+	if q.field == "" {
+		return nil, parseErrorf("terms query requires a field")
+	}
+	return q, nil
+}
+
+func (q *termsQuery) eval(d *document) (float64, bool) {
+	for _, v := range q.values {
+		if termMatches(d, q.field, v, false) {
+			return q.boost, true
+		}
+	}
+	return 0, false
+}
+
+func (q *termsQuery) highlightTerms(field string, ret map[string]bool) {
+	if fieldMatches(q.field, field) {
+		for _, v := range q.values {
+			ret[strings.ToLower(asString(v))] = true
+		}
+	}
+}
+
+type existsQuery struct {
+	field string
+}
+
+func (q *existsQuery) eval(d *document) (float64, bool) {
+	return 1, len(d.values(q.field)) > 0
+}
+
+func (q *existsQuery) highlightTerms(field string, ret map[string]bool) {}
+
+type rangeQuery struct {
+	field  string
+	bounds map[string]interface{}
+	boost  float64
+}
+
+func parseRangeQuery(body interface{}) (query, error) {
+	b, _ := body.(map[string]interface{})
+	for field, v := range b {
+		bounds, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, parseErrorf("range query malformed for field [%s]", field)
+		}
+		q := &rangeQuery{field: field, bounds: map[string]interface{}{}, boost: boostOf(v)}
+		for _, op := range []string{"gt", "gte", "lt", "lte", "from", "to"} {
+			if bound, ok := bounds[op]; ok && bound != nil {
+				q.bounds[op] = resolveDateMath(bound)
+			}
+		}
+		if from, ok := q.bounds["from"]; ok {
+			delete(q.bounds, "from")
+			q.bounds[map[bool]string{true: "gte", false: "gt"}[asBool(bounds["include_lower"], true)]] = from
+		}
+		if to, ok := q.bounds["to"]; ok {
+			delete(q.bounds, "to")
+			q.bounds[map[bool]string{true: "lte", false: "lt"}[asBool(bounds["include_upper"], true)]] = to
+		}
+		return q, nil
+	}
+	return nil, parseErrorf("range query requires a field")
+}
+
+func (q *rangeQuery) eval(d *document) (float64, bool) {
+	for _, v := range d.values(q.field) {
+		matched := true
+		for op, bound := range q.bounds {
+			c := compareValues(v, bound)
+			switch op {
+			case "gt":
+				matched = matched && c > 0
+			case "gte":
+				matched = matched && c >= 0
+			case "lt":
+				matched = matched && c < 0
+			case "lte":
+				matched = matched && c <= 0
+			}
+		}
+		if matched {
+			return q.boost, true
+		}
+	}
+	return 0, false
+}
+
+func (q *rangeQuery) highlightTerms(field string, ret map[string]bool) {}
+
+// Replaces "now" (with optional rounding, e.g. now/d) by the current date.
+func resolveDateMath(v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok || !strings.HasPrefix(s, "now") {
+		return v
+	}
+	return time.Now().UTC().Format("2006-01-02")
+}
+
+// Match on the analyzed text of the fields, phrase queries require consecutive tokens (up to slop).
+type matchQuery struct {
+	fields []string
+	boosts []float64
+	terms  []string
+	and    bool
+	phrase bool
+	slop   int
+	boost  float64
+}
+
+func parseMatchQuery(name string, body interface{}) (query, error) {
+	field, value, boost, err := fieldAndValue(body, "query")
+	if err != nil {
+		return nil, err
+	}
+	q := &matchQuery{fields: []string{field}, boosts: []float64{1}, terms: terms(asString(value)), boost: boost}
+	q.phrase = name != "match"
+	if opts, ok := body.(map[string]interface{})[field].(map[string]interface{}); ok {
+		q.and = strings.EqualFold(asString(opts["operator"]), "and")
+		q.slop = int(asFloat(opts["slop"], 0))
+	}
+	return q, nil
+}
+
+func parseMultiMatchQuery(body interface{}) (query, error) {
+	b, _ := body.(map[string]interface{})
+	q := &matchQuery{terms: terms(asString(b["query"])), boost: boostOf(body)}
+	q.and = strings.EqualFold(asString(b["operator"]), "and")
+	t := asString(b["type"])
+	q.phrase = t == "phrase" || t == "phrase_prefix"
+	q.slop = int(asFloat(b["slop"], 0))
+	for _, f := range asSlice(b["fields"]) {
+		field, boost := fieldWithBoost(asString(f))
+		q.fields = append(q.fields, field)
+		q.boosts = append(q.boosts, boost)
+	}
+	if len(q.fields) == 0 {
+		q.fields, q.boosts = []string{"*"}, []float64{1}
+	}
+	return q, nil
+}
+
+func (q *matchQuery) eval(d *document) (float64, bool) {
+	if len(q.terms) == 0 {
+		return 0, false
+	}
+	best := 0.0
+	matched := false
+	for i, field := range q.fields {
+		for _, text := range d.texts(field) {
+			docTerms := terms(text)
+			var s float64
+			var ok bool
+			if q.phrase {
+				s, ok = phraseScore(docTerms, q.terms, q.slop)
+			} else {
+				s, ok = termsScore(docTerms, q.terms, q.and)
+			}
+			if ok {
+				matched = true
+				best = math.Max(best, s*q.boosts[i])
+			}
+		}
+	}
+	return best * q.boost, matched
+}
+
+func (q *matchQuery) highlightTerms(field string, ret map[string]bool) {
+	for _, f := range q.fields {
+		if f == "*" || fieldMatches(f, field) {
+			for _, t := range q.terms {
+				ret[t] = true
+			}
+		}
+	}
+}
+
+func termsScore(docTerms []string, queryTerms []string, and bool) (float64, bool) {
+	set := make(map[string]int, len(docTerms))
+	for _, t := range docTerms {
+		set[t]++
+	}
+	score := 0.0
+	matched := 0
+	for _, t := range queryTerms {
+		if n := set[t]; n > 0 {
+			matched++
+			score += 1 + math.Log(float64(n))
+		}
+	}
+	if matched == 0 || (and && matched < len(queryTerms)) {
+		return 0, false
+	}
+	// Prefer shorter fields as Elastic's length normalization does.
+	return score / math.Sqrt(float64(len(docTerms))), true
+}
+
+func phraseScore(docTerms []string, queryTerms []string, slop int) (float64, bool) {
+	for start := range docTerms {
+		if docTerms[start] != queryTerms[0] {
+			continue
+		}
+		pos, gaps := start, 0
+		ok := true
+		for _, t := range queryTerms[1:] {
+			next := -1
+			for p := pos + 1; p < len(docTerms) && p-pos-1+gaps <= slop; p++ {
+				if docTerms[p] == t {
+					next = p
+					break
+				}
+			}
+			if next < 0 {
+				ok = false
+				break
+			}
+			gaps += next - pos - 1
+			pos = next
+		}
+		if ok {
+			return float64(len(queryTerms)) / math.Sqrt(float64(len(docTerms))) / float64(1+gaps), true
+		}
+	}
+	return 0, false
+}
+
+func parseQueryStringQuery(body interface{}) (query, error) {
+	b, _ := body.(map[string]interface{})
+	fields := []string{}
+	boosts := []float64{}
+	for _, f := range asSlice(b["fields"]) {
+		field, boost := fieldWithBoost(asString(f))
+		fields = append(fields, field)
+		boosts = append(boosts, boost)
+	}
+	if df := asString(b["default_field"]); df != "" && len(fields) == 0 {
+		fields, boosts = []string{df}, []float64{1}
+	}
+	if len(fields) == 0 {
+		fields, boosts = []string{"*"}, []float64{1}
+	}
+	p := &queryStringParser{
+		tokens:       tokenizeQueryString(asString(b["query"])),
+		fields:       fields,
+		boosts:       boosts,
+		defaultIsAnd: strings.EqualFold(asString(b["default_operator"]), "and"),
+	}
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if q == nil {
+		return matchNoneQuery{}, nil
+	}
+	return &functionScoreQuery{query: q, boost: boostOf(body)}, nil
+}
+
+// Parser of query_string and simple_query_string syntax: phrases, groups, AND, OR, NOT, -, + and trailing *.
+type queryStringParser struct {
+	tokens       []string
+	pos          int
+	fields       []string
+	boosts       []float64
+	defaultIsAnd bool
+}
+
+func tokenizeQueryString(s string) []string {
+	ret := []string{}
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n':
+			i++
+		case r == '(' || r == ')':
+			ret = append(ret, string(r))
+			i++
+		case r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != '"' {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j > len(runes) {
+				j = len(runes)
+			}
+			ret = append(ret, strings.Replace(string(runes[i:j]), "\\\"", "\"", -1)+"\"")
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !strings.ContainsRune(" \t\n()\"", runes[j]) {
+				j++
+			}
+			ret = append(ret, string(runes[i:j]))
+			i = j
+		}
+	}
+	return ret
+}
+
+func (p *queryStringParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *queryStringParser) parseOr() (query, error) {
+	clauses := []query{}
+	for {
+		q, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if q != nil {
+			clauses = append(clauses, q)
+		}
+		if p.peek() == "OR" || p.peek() == "||" {
+			p.pos++
+			continue
+		}
+		break
+	}
+	switch len(clauses) {
+	case 0:
+		return nil, nil
+	case 1:
+		return clauses[0], nil
+	}
+	return &boolQuery{should: clauses, minimumShouldMatch: 1, boost: 1}, nil
+}
+
+func (p *queryStringParser) parseAnd() (query, error) {
+	must, should, mustNot := []query{}, []query{}, []query{}
+	explicitAnd := false
+	for {
+		t := p.peek()
+		if t == "" || t == ")" || t == "OR" || t == "||" {
+			break
+		}
+		if t == "AND" || t == "&&" {
+			explicitAnd = true
+			p.pos++
+			continue
+		}
+		negate := false
+		if t == "NOT" || t == "!" {
+			negate = true
+			p.pos++
+		}
+		q, prefix, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if q == nil {
+			continue
+		}
+		switch {
+		case negate || prefix == '-':
+			mustNot = append(mustNot, q)
+		case prefix == '+' || p.defaultIsAnd:
+			must = append(must, q)
+		default:
+			should = append(should, q)
+		}
+	}
+	if explicitAnd {
+		must = append(must, should...)
+		should = nil
+	}
+	if len(must)+len(should)+len(mustNot) == 0 {
+		return nil, nil
+	}
+	if len(must) == 1 && len(should) == 0 && len(mustNot) == 0 {
+		return must[0], nil
+	}
+	if len(should) == 1 && len(must) == 0 && len(mustNot) == 0 {
+		return should[0], nil
+	}
+	q := &boolQuery{must: must, should: should, mustNot: mustNot, boost: 1}
+	if len(must) == 0 && len(should) > 0 {
+		q.minimumShouldMatch = 1
+	}
+	if len(must) == 0 && len(should) == 0 {
+		q.must = []query{&matchAllQuery{boost: 1}}
+	}
+	return q, nil
+}
+
+func (p *queryStringParser) parseUnary() (query, rune, error) {
+	t := p.peek()
+	p.pos++
+	var prefix rune
+	if len(t) > 1 && (t[0] == '-' || t[0] == '+') {
+		prefix = rune(t[0])
+		t = t[1:]
+	}
+	if t == "(" {
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, prefix, err
+		}
+		if p.peek() == ")" {
+			p.pos++
+		}
+		return q, prefix, nil
+	}
+	fields, boosts := p.fields, p.boosts
+	if i := strings.Index(t, ":"); i > 0 && !strings.HasPrefix(t, "\"") {
+		fields, boosts = []string{t[:i]}, []float64{1}
+		t = t[i+1:]
+	}
+	if strings.HasPrefix(t, "\"") {
+		return &matchQuery{fields: fields, boosts: boosts, terms: terms(strings.Trim(t, "\"")), phrase: true, boost: 1}, prefix, nil
+	}
+	if strings.HasSuffix(t, "*") {
+		ts := terms(t)
+		if len(ts) == 0 {
+			return nil, prefix, nil
+		}
+		clauses := []query{}
+		for _, f := range fields {
+			clauses = append(clauses, &tokenPrefixQuery{field: f, prefix: ts[len(ts)-1]})
+		}
+		return &disMaxQuery{queries: clauses, boost: 1}, prefix, nil
+	}
+	ts := terms(t)
+	if len(ts) == 0 {
+		return nil, prefix, nil
+	}
+	return &matchQuery{fields: fields, boosts: boosts, terms: ts, and: true, phrase: len(ts) > 1, boost: 1}, prefix, nil
+}
+
+// Matches documents having a token with the prefix in field.
+type tokenPrefixQuery struct {
+	field  string
+	prefix string
+}
+
+func (q *tokenPrefixQuery) eval(d *document) (float64, bool) {
+	for _, text := range d.texts(q.field) {
+		for _, t := range terms(text) {
+			if strings.HasPrefix(t, q.prefix) {
+				return 1, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func (q *tokenPrefixQuery) highlightTerms(field string, ret map[string]bool) {}
+
+// Evaluates the queries stored in the percolator field against the given documents.
+type percolateQuery struct {
+	field     string
+	documents []map[string]interface{}
+}
+
+func parsePercolateQuery(body interface{}) (query, error) {
+	b, _ := body.(map[string]interface{})
+	q := &percolateQuery{field: asString(b["field"])}
+	if doc, ok := b["document"].(map[string]interface{}); ok {
+		q.documents = append(q.documents, doc)
+	}
+	for _, d := range asSlice(b["documents"]) {
+		if doc, ok := d.(map[string]interface{}); ok {
+			q.documents = append(q.documents, doc)
+		}
+	}
+	if q.field == "" || len(q.documents) == 0 {
+		return nil, parseErrorf("percolate query requires field and document")
+	}
+	return q, nil
+}
+
+// Returns the stored query of the percolator document.
+func (q *percolateQuery) storedQuery(d *document) query {
+	raw, ok := d.source[q.field]
+	if !ok {
+		return nil
+	}
+	stored, err := parseQuery(raw)
+	if err != nil {
+		return nil
+	}
+	return stored
+}
+
+func (q *percolateQuery) eval(d *document) (float64, bool) {
+	stored := q.storedQuery(d)
+	if stored == nil {
+		return 0, false
+	}
+	best := 0.0
+	matched := false
+	for _, source := range q.documents {
+		if s, ok := stored.eval(&document{source: source, mapping: d.mapping}); ok {
+			matched = true
+			best = math.Max(best, s)
+		}
+	}
+	return best, matched
+}
+
+func (q *percolateQuery) highlightTerms(field string, ret map[string]bool) {}
+
+func termMatches(d *document, field string, value interface{}, prefix bool) bool {
+	v := asString(value)
+	tokenized := d.mapping.isText(field)
+	for _, dv := range d.values(field) {
+		s := asString(dv)
+		if s == v || (prefix && strings.HasPrefix(s, v)) {
+			return true
+		}
+		if tokenized {
+			for _, t := range terms(s) {
+				if t == v || (prefix && strings.HasPrefix(t, v)) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Whether the query field covers the highlighted field, e.g. title.language covers title.
+func fieldMatches(queryField string, field string) bool {
+	return queryField == field || strings.HasPrefix(queryField, field+".") || strings.HasPrefix(field, queryField+".")
+}
+
+// Returns the single field, its value (either plain or under valueKey) and boost.
+func fieldAndValue(body interface{}, valueKey string) (string, interface{}, float64, error) {
+	b, _ := body.(map[string]interface{})
+	for k, v := range b {
+		if k == "boost" || k == "_name" {
+			continue
+		}
+		if opts, ok := v.(map[string]interface{}); ok {
+			return k, opts[valueKey], boostOf(opts), nil
+		}
+		return k, v, boostOf(body), nil
+	}
+	return "", nil, 0, parseErrorf("query requires a field")
+}
+
+func fieldWithBoost(s string) (string, float64) {
+	if i := strings.Index(s, "^"); i > 0 {
+		if b, err := strconv.ParseFloat(s[i+1:], 64); err == nil {
+			return s[:i], b
+		}
+		return s[:i], 1
+	}
+	return s, 1
+}
+
+func boostOf(body interface{}) float64 {
+	if b, ok := body.(map[string]interface{}); ok {
+		return asFloat(b["boost"], 1)
+	}
+	return 1
+}
+
+func asSlice(v interface{}) []interface{} {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return t
+	}
+	return []interface{}{v}
+}
+
+func asString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case json.Number:
+		return t.String()
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func asFloat(v interface{}, def float64) float64 {
+	switch t := v.(type) {
+	case float64:
+		return t
+	case string:
+		if f, err := strconv.ParseFloat(t, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
+
+func asBool(v interface{}, def bool) bool {
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	return def
+}
+
+// Compares numbers numerically and anything else as strings (ISO dates compare correctly).
+func compareValues(a interface{}, b interface{}) int {
+	fa, aok := a.(float64)
+	fb, bok := b.(float64)
+	if !aok {
+		if f, err := strconv.ParseFloat(asString(a), 64); err == nil && bok {
+			fa, aok = f, true
+		}
+	}
+	if !bok {
+		if f, err := strconv.ParseFloat(asString(b), 64); err == nil && aok {
+			fb, bok = f, true
+		}
+	}
+	if aok && bok {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(asString(a), asString(b))
+}
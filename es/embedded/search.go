@@ -0,0 +1,700 @@
+package embedded
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type searchBody struct {
+	Query        interface{}            `json:"query"`
+	PostFilter   interface{}            `json:"post_filter"`
+	From         *int                   `json:"from"`
+	Size         *int                   `json:"size"`
+	Sort         interface{}            `json:"sort"`
+	SearchAfter  []interface{}          `json:"search_after"`
+	Source       interface{}            `json:"_source"`
+	Highlight    map[string]interface{} `json:"highlight"`
+	Suggest      map[string]interface{} `json:"suggest"`
+	Aggs         map[string]interface{} `json:"aggs"`
+	Aggregations map[string]interface{} `json:"aggregations"`
+	MinScore     *float64               `json:"min_score"`
+}
+
+type sortField struct {
+	field string
+	desc  bool
+}
+
+type hit struct {
+	doc        *document
+	score      float64
+	sortValues []interface{}
+}
+
+func parseSort(raw interface{}) ([]sortField, error) {
+	ret := []sortField{}
+	for _, s := range asSlice(raw) {
+		switch t := s.(type) {
+		case string:
+			ret = append(ret, sortField{field: t, desc: t == "_score"})
+		case map[string]interface{}:
+			for field, opts := range t {
+				sf := sortField{field: field, desc: field == "_score"}
+				order := ""
+				if o, ok := opts.(string); ok {
+					order = o
+				} else if om, ok := opts.(map[string]interface{}); ok {
+					order = asString(om["order"])
+				}
+				if order != "" {
+					sf.desc = strings.EqualFold(order, "desc")
+				}
+				ret = append(ret, sf)
+			}
+		default:
+			return nil, parseErrorf("malformed sort: %+v", s)
+		}
+	}
+	if len(ret) == 0 {
+		ret = append(ret, sortField{field: "_score", desc: true})
+	}
+	return ret, nil
+}
+
+func (h *hit) sortValue(f sortField) interface{} {
+	if f.field == "_score" {
+		return h.score
+	}
+	values := h.doc.values(f.field)
+	if len(values) == 0 {
+		return nil
+	}
+	// Multi valued fields sort by min for asc and max for desc as in Elastic.
+	ret := values[0]
+	for _, v := range values[1:] {
+		if c := compareValues(v, ret); (f.desc && c > 0) || (!f.desc && c < 0) {
+			ret = v
+		}
+	}
+	return ret
+}
+
+// Compares sort tuples according to the sort directions, missing values are last.
+func compareSortValues(sortFields []sortField, a []interface{}, b []interface{}) int {
+	for i, f := range sortFields {
+		if i >= len(a) || i >= len(b) {
+			break
+		}
+		switch {
+		case a[i] == nil && b[i] == nil:
+			continue
+		case a[i] == nil:
+			return 1
+		case b[i] == nil:
+			return -1
+		}
+		c := compareValues(a[i], b[i])
+		if f.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// Runs the search on the indices and returns the response body.
+func (s *Server) search(names string, ignoreUnavailable bool, body []byte) (map[string]interface{}, []*hit, error) {
+	var req searchBody
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, nil, badRequest(errors.Wrap(err, "Failed to parse search body"))
+		}
+	}
+	var q query = &matchAllQuery{boost: 1}
+	if req.Query != nil {
+		var err error
+		if q, err = parseQuery(req.Query); err != nil {
+			return nil, nil, err
+		}
+	}
+	var postFilter query
+	if req.PostFilter != nil {
+		var err error
+		if postFilter, err = parseQuery(req.PostFilter); err != nil {
+			return nil, nil, err
+		}
+	}
+	sortFields, err := parseSort(req.Sort)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	indices, err := s.resolve(names, ignoreUnavailable)
+	if err != nil {
+		return nil, nil, err
+	}
+	matched := []*hit{}
+	for _, i := range indices {
+		if i.closed {
+			return nil, nil, &elasticError{status: http.StatusBadRequest, typ: "index_closed_exception", reason: "closed", index: i.name}
+		}
+		for _, d := range i.sortedDocs() {
+			if score, ok := q.eval(d); ok {
+				if req.MinScore != nil && score < *req.MinScore {
+					continue
+				}
+				matched = append(matched, &hit{doc: d, score: score})
+			}
+		}
+	}
+
+	ret := map[string]interface{}{
+		"took":      1,
+		"timed_out": false,
+		"_shards":   map[string]interface{}{"total": len(indices), "successful": len(indices), "skipped": 0, "failed": 0},
+	}
+	aggs := req.Aggregations
+	if aggs == nil {
+		aggs = req.Aggs
+	}
+	if len(aggs) > 0 {
+		aggregations, err := aggregate(aggs, matched)
+		if err != nil {
+			return nil, nil, err
+		}
+		ret["aggregations"] = aggregations
+	}
+	if postFilter != nil {
+		filtered := []*hit{}
+		for _, h := range matched {
+			if _, ok := postFilter.eval(h.doc); ok {
+				filtered = append(filtered, h)
+			}
+		}
+		matched = filtered
+	}
+
+	for _, h := range matched {
+		for _, f := range sortFields {
+			h.sortValues = append(h.sortValues, h.sortValue(f))
+		}
+	}
+	sort.SliceStable(matched, func(a, b int) bool {
+		return compareSortValues(sortFields, matched[a].sortValues, matched[b].sortValues) < 0
+	})
+	total := len(matched)
+	if req.SearchAfter != nil {
+		after := []*hit{}
+		for _, h := range matched {
+			if compareSortValues(sortFields, h.sortValues, req.SearchAfter) > 0 {
+				after = append(after, h)
+			}
+		}
+		matched = after
+	}
+
+	maxScore := 0.0
+	for _, h := range matched {
+		if h.score > maxScore {
+			maxScore = h.score
+		}
+	}
+	from, size := 0, 10
+	if req.From != nil {
+		from = *req.From
+	}
+	if req.Size != nil {
+		size = *req.Size
+	}
+	page := []*hit{}
+	if from < len(matched) {
+		page = matched[from:]
+		if size < len(page) {
+			page = page[:size]
+		}
+	}
+	hits := []interface{}{}
+	for _, h := range page {
+		hits = append(hits, s.hitBody(h, q, &req, req.Sort != nil || req.SearchAfter != nil))
+	}
+	ret["hits"] = map[string]interface{}{"total": total, "max_score": maxScore, "hits": hits}
+
+	if len(req.Suggest) > 0 {
+		suggest, err := suggest(req.Suggest, indices)
+		if err != nil {
+			return nil, nil, err
+		}
+		ret["suggest"] = suggest
+	}
+	return ret, matched, nil
+}
+
+func (s *Server) hitBody(h *hit, q query, req *searchBody, withSort bool) map[string]interface{} {
+	ret := map[string]interface{}{
+		"_index": h.doc.index,
+		"_type":  h.doc.typ,
+		"_id":    h.doc.id,
+		"_score": h.score,
+	}
+	if source, ok := filterSource(h.doc, req.Source); ok {
+		ret["_source"] = source
+	}
+	if withSort {
+		ret["sort"] = h.sortValues
+	}
+	if len(req.Highlight) > 0 {
+		if highlights := highlightHit(h.doc, q, req.Highlight); len(highlights) > 0 {
+			ret["highlight"] = highlights
+		}
+	}
+	return ret
+}
+
+// Applies the _source fetch context: false, a list of includes or {"includes": [], "excludes": []}.
+func filterSource(d *document, fetch interface{}) (interface{}, bool) {
+	var includes, excludes []interface{}
+	switch t := fetch.(type) {
+	case nil:
+		return d.raw, true
+	case bool:
+		if !t {
+			return nil, false
+		}
+		return d.raw, true
+	case string:
+		includes = []interface{}{t}
+	case []interface{}:
+		includes = t
+	case map[string]interface{}:
+		includes = asSlice(t["includes"])
+		excludes = asSlice(t["excludes"])
+	}
+	if len(includes) == 0 && len(excludes) == 0 {
+		return d.raw, true
+	}
+	return filterMap(d.source, "", includes, excludes), true
+}
+
+func filterMap(source map[string]interface{}, prefix string, includes []interface{}, excludes []interface{}) map[string]interface{} {
+	ret := map[string]interface{}{}
+	for k, v := range source {
+		field := prefix + k
+		if pathMatches(field, excludes, false) {
+			continue
+		}
+		if len(includes) == 0 || pathMatches(field, includes, false) {
+			ret[k] = v
+			continue
+		}
+		if sub, ok := v.(map[string]interface{}); ok && pathMatches(field, includes, true) {
+			ret[k] = filterMap(sub, field+".", includes, excludes)
+		}
+	}
+	return ret
+}
+
+// Whether the field is covered by one of the patterns or, with parent, is a parent of one of them.
+func pathMatches(field string, patterns []interface{}, parent bool) bool {
+	for _, p := range patterns {
+		pattern := asString(p)
+		if parent {
+			if strings.HasPrefix(pattern, field+".") {
+				return true
+			}
+			continue
+		}
+		if pattern == field || strings.HasPrefix(field, pattern+".") || pattern == "*" ||
+			(strings.HasSuffix(pattern, "*") && strings.HasPrefix(field, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// Highlights whole field values, the percolated document is highlighted for percolate queries.
+func highlightHit(d *document, q query, req map[string]interface{}) map[string]interface{} {
+	preTag, postTag := "<em>", "</em>"
+	if tags := asSlice(req["pre_tags"]); len(tags) > 0 {
+		preTag = asString(tags[0])
+	}
+	if tags := asSlice(req["post_tags"]); len(tags) > 0 {
+		postTag = asString(tags[0])
+	}
+	fields := map[string]interface{}{}
+	switch t := req["fields"].(type) {
+	case map[string]interface{}:
+		fields = t
+	case []interface{}:
+		for _, f := range t {
+			if fm, ok := f.(map[string]interface{}); ok {
+				for k, v := range fm {
+					fields[k] = v
+				}
+			}
+		}
+	}
+	docs := []*document{d}
+	if p, ok := unwrapPercolate(q); ok {
+		q = p.storedQuery(d)
+		if q == nil {
+			return nil
+		}
+		docs = []*document{}
+		for _, source := range p.documents {
+			docs = append(docs, &document{source: source, mapping: d.mapping})
+		}
+	}
+	ret := map[string]interface{}{}
+	for field, opts := range fields {
+		fieldPre, fieldPost := preTag, postTag
+		if om, ok := opts.(map[string]interface{}); ok {
+			if tags := asSlice(om["pre_tags"]); len(tags) > 0 {
+				fieldPre = asString(tags[0])
+			}
+			if tags := asSlice(om["post_tags"]); len(tags) > 0 {
+				fieldPost = asString(tags[0])
+			}
+		}
+		highlightTerms := map[string]bool{}
+		q.highlightTerms(field, highlightTerms)
+		if len(highlightTerms) == 0 {
+			continue
+		}
+		fragments := []string{}
+		for _, doc := range docs {
+			for _, text := range doc.texts(field) {
+				if fragment, found := highlight(text, highlightTerms, fieldPre, fieldPost); found {
+					fragments = append(fragments, fragment)
+				}
+			}
+		}
+		if len(fragments) > 0 {
+			ret[field] = fragments
+		}
+	}
+	return ret
+}
+
+func unwrapPercolate(q query) (*percolateQuery, bool) {
+	switch t := q.(type) {
+	case *percolateQuery:
+		return t, true
+	case *boolQuery:
+		for _, qs := range [][]query{t.must, t.filter, t.should} {
+			for _, c := range qs {
+				if p, ok := unwrapPercolate(c); ok {
+					return p, true
+				}
+			}
+		}
+	case *functionScoreQuery:
+		return unwrapPercolate(t.query)
+	case *constantScoreQuery:
+		return unwrapPercolate(t.filter)
+	}
+	return nil, false
+}
+
+// Supports filters aggregation, other aggregations return no buckets.
+func aggregate(aggs map[string]interface{}, hits []*hit) (map[string]interface{}, error) {
+	ret := map[string]interface{}{}
+	for name, raw := range aggs {
+		agg, _ := raw.(map[string]interface{})
+		filtersAgg, ok := agg["filters"].(map[string]interface{})
+		if !ok {
+			ret[name] = map[string]interface{}{"buckets": []interface{}{}}
+			continue
+		}
+		switch filters := filtersAgg["filters"].(type) {
+		case map[string]interface{}:
+			buckets := map[string]interface{}{}
+			for key, f := range filters {
+				count, err := countMatching(f, hits)
+				if err != nil {
+					return nil, err
+				}
+				buckets[key] = map[string]interface{}{"doc_count": count}
+			}
+			ret[name] = map[string]interface{}{"buckets": buckets}
+		case []interface{}:
+			buckets := []interface{}{}
+			for _, f := range filters {
+				count, err := countMatching(f, hits)
+				if err != nil {
+					return nil, err
+				}
+				buckets = append(buckets, map[string]interface{}{"doc_count": count})
+			}
+			ret[name] = map[string]interface{}{"buckets": buckets}
+		default:
+			return nil, parseErrorf("filters aggregation [%s] malformed", name)
+		}
+	}
+	return ret, nil
+}
+
+func countMatching(raw interface{}, hits []*hit) (int, error) {
+	q, err := parseQuery(raw)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, h := range hits {
+		if _, ok := q.eval(h.doc); ok {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type completionOption struct {
+	text   string
+	weight float64
+	doc    *document
+}
+
+// Completion suggester by prefix of the inputs, term and phrase suggesters return no options.
+func suggest(suggesters map[string]interface{}, indices []*index) (map[string]interface{}, error) {
+	ret := map[string]interface{}{}
+	globalText := asString(suggesters["text"])
+	for name, raw := range suggesters {
+		sm, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		text := globalText
+		if t, ok := sm["text"]; ok {
+			text = asString(t)
+		}
+		if p, ok := sm["prefix"]; ok {
+			text = asString(p)
+		}
+		entry := map[string]interface{}{"text": text, "offset": 0, "length": len([]rune(text)), "options": []interface{}{}}
+		if completion, ok := sm["completion"].(map[string]interface{}); ok {
+			entry["options"] = completionOptions(text, completion, indices)
+		}
+		ret[name] = []interface{}{entry}
+	}
+	return ret, nil
+}
+
+func completionOptions(prefix string, completion map[string]interface{}, indices []*index) []interface{} {
+	field := asString(completion["field"])
+	size := int(asFloat(completion["size"], 5))
+	contexts, _ := completion["contexts"].(map[string]interface{})
+	normalizedPrefix := strings.Join(terms(prefix), " ")
+	options := []completionOption{}
+	for _, i := range indices {
+		cf, ok := i.mapping.completions[field]
+		for _, d := range i.sortedDocs() {
+			if ok && !contextsMatch(d, cf, contexts) {
+				continue
+			}
+			for _, v := range d.values(field) {
+				input, weight := completionInputs(v)
+				for _, in := range input {
+					if strings.HasPrefix(strings.Join(terms(in), " "), normalizedPrefix) {
+						options = append(options, completionOption{text: in, weight: weight, doc: d})
+						break
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(options, func(a, b int) bool { return options[a].weight > options[b].weight })
+	if len(options) > size {
+		options = options[:size]
+	}
+	ret := []interface{}{}
+	for _, o := range options {
+		ret = append(ret, map[string]interface{}{
+			"text":    o.text,
+			"_index":  o.doc.index,
+			"_type":   o.doc.typ,
+			"_id":     o.doc.id,
+			"_score":  o.weight,
+			"_source": o.doc.raw,
+		})
+	}
+	return ret
+}
+
+// Inputs and weight of a completion field value, either a string, a list or {"input": ..., "weight": ...}.
+func completionInputs(v interface{}) ([]string, float64) {
+	inputs := []string{}
+	weight := 1.0
+	switch t := v.(type) {
+	case string:
+		inputs = append(inputs, t)
+	case map[string]interface{}:
+		for _, in := range asSlice(t["input"]) {
+			inputs = append(inputs, asString(in))
+		}
+		weight = asFloat(t["weight"], 1)
+	}
+	return inputs, weight
+}
+
+// Context values are either plain values or {"context": value}.
+func contextsMatch(d *document, cf completionField, contexts map[string]interface{}) bool {
+	for name, raw := range contexts {
+		path, ok := cf.contexts[name]
+		if !ok {
+			continue
+		}
+		wanted := map[string]bool{}
+		for _, c := range asSlice(raw) {
+			if cm, ok := c.(map[string]interface{}); ok {
+				wanted[asString(cm["context"])] = true
+			} else {
+				wanted[asString(c)] = true
+			}
+		}
+		found := false
+		for _, v := range d.values(path) {
+			if wanted[asString(v)] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) searchRequest(names string, body []byte, scroll string) (int, interface{}, error) {
+	ret, matched, err := s.search(names, false, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	if scroll != "" {
+		ret["_scroll_id"] = s.newScroll(matched, body)
+	}
+	return http.StatusOK, ret, nil
+}
+
+// Hits of a scroll not returned yet.
+type scrollContext struct {
+	size      int
+	total     int
+	remaining []map[string]interface{}
+}
+
+func (s *Server) newScroll(matched []*hit, body []byte) string {
+	var req searchBody
+	json.Unmarshal(body, &req)
+	var q query = &matchAllQuery{boost: 1}
+	if req.Query != nil {
+		q, _ = parseQuery(req.Query)
+	}
+	sc := &scrollContext{size: 10, total: len(matched)}
+	if req.Size != nil {
+		sc.size = *req.Size
+	}
+	if sc.size < len(matched) {
+		for _, h := range matched[sc.size:] {
+			sc.remaining = append(sc.remaining, s.hitBody(h, q, &req, req.Sort != nil))
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.seq++
+	id := fmt.Sprintf("scroll%d", s.seq)
+	s.scrolls[id] = sc
+	return id
+}
+
+func (s *Server) scroll(body []byte) (int, interface{}, error) {
+	var req struct {
+		ScrollId string `json:"scroll_id"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0, nil, badRequest(err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sc, ok := s.scrolls[req.ScrollId]
+	if !ok {
+		return 0, nil, &elasticError{status: http.StatusNotFound, typ: "search_context_missing_exception", reason: fmt.Sprintf("No search context found for id [%s]", req.ScrollId)}
+	}
+	hits := sc.remaining
+	if sc.size < len(hits) {
+		hits = hits[:sc.size]
+	}
+	sc.remaining = sc.remaining[len(hits):]
+	return http.StatusOK, map[string]interface{}{
+		"_scroll_id": req.ScrollId,
+		"took":       1,
+		"timed_out":  false,
+		"hits":       map[string]interface{}{"total": sc.total, "hits": hits},
+	}, nil
+}
+
+func (s *Server) clearScroll(body []byte) (int, interface{}, error) {
+	var req struct {
+		ScrollId interface{} `json:"scroll_id"`
+	}
+	json.Unmarshal(body, &req)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	freed := 0
+	for _, id := range asSlice(req.ScrollId) {
+		if _, ok := s.scrolls[asString(id)]; ok {
+			delete(s.scrolls, asString(id))
+			freed++
+		}
+	}
+	return http.StatusOK, map[string]interface{}{"succeeded": true, "num_freed": freed}, nil
+}
+
+// Each request fails separately as in Elastic, with the error in its response.
+func (s *Server) multiSearch(defaultIndexName string, body []byte) (int, interface{}, error) {
+	lines := []string{}
+	for _, l := range strings.Split(string(body), "\n") {
+		if strings.TrimSpace(l) != "" {
+			lines = append(lines, l)
+		}
+	}
+	if len(lines)%2 != 0 {
+		return 0, nil, badRequest(errors.New("Multi search body should have header and body lines"))
+	}
+	responses := []interface{}{}
+	for l := 0; l < len(lines); l += 2 {
+		var header struct {
+			Index             interface{} `json:"index"`
+			Indices           []string    `json:"indices"`
+			IgnoreUnavailable bool        `json:"ignore_unavailable"`
+		}
+		if err := json.Unmarshal([]byte(lines[l]), &header); err != nil {
+			return 0, nil, badRequest(errors.Wrap(err, "Failed to parse multi search header"))
+		}
+		names := header.Indices
+		for _, n := range asSlice(header.Index) {
+			names = append(names, asString(n))
+		}
+		indexNames := strings.Join(names, ",")
+		if indexNames == "" {
+			indexNames = defaultIndexName
+		}
+		ret, _, err := s.search(indexNames, header.IgnoreUnavailable, []byte(lines[l+1]))
+		if err != nil {
+			e := badRequest(err)
+			responses = append(responses, e.body())
+			continue
+		}
+		ret["status"] = http.StatusOK
+		responses = append(responses, ret)
+	}
+	return http.StatusOK, map[string]interface{}{"took": 1, "responses": responses}, nil
+}
@@ -0,0 +1,730 @@
+// Package embedded implements an in-memory server speaking the subset of the
+// Elasticsearch 6 REST API used by the indexer and the search engine, so that
+// they can run with no external Elasticsearch, e.g. for development and tests.
+//
+// Analysis is the same for all languages (lower case letters and digits runs),
+// scoring is a simple term frequency with length normalization.
+package embedded
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+const VERSION = "6.8.0"
+
+type index struct {
+	name     string
+	docs     map[string]*document
+	mapping  *mapping
+	settings map[string]interface{}
+	closed   bool
+}
+
+func (i *index) sortedDocs() []*document {
+	ret := make([]*document, 0, len(i.docs))
+	for _, d := range i.docs {
+		ret = append(ret, d)
+	}
+	sort.Slice(ret, func(a, b int) bool { return ret[a].seq < ret[b].seq })
+	return ret
+}
+
+type Server struct {
+	mutex   sync.RWMutex
+	indices map[string]*index
+	// Alias to set of index names.
+	aliases map[string]map[string]bool
+	scrolls map[string]*scrollContext
+	seq     int64
+
+	listener net.Listener
+	server   *http.Server
+}
+
+func NewServer() *Server {
+	return &Server{
+		indices: map[string]*index{},
+		aliases: map[string]map[string]bool{},
+		scrolls: map[string]*scrollContext{},
+	}
+}
+
+// Starts serving on a local random port.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return errors.Wrap(err, "Embedded elastic - Listen")
+	}
+	s.listener = listener
+	s.server = &http.Server{Handler: s}
+	go s.server.Serve(listener)
+	return nil
+}
+
+func (s *Server) URL() string {
+	if s.listener == nil {
+		return ""
+	}
+	return fmt.Sprintf("http://%s", s.listener.Addr().String())
+}
+
+func (s *Server) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+type elasticError struct {
+	status int
+	typ    string
+	reason string
+	index  string
+}
+
+func (e *elasticError) Error() string {
+	return fmt.Sprintf("%s: %s", e.typ, e.reason)
+}
+
+func (e *elasticError) body() map[string]interface{} {
+	cause := map[string]interface{}{"type": e.typ, "reason": e.reason}
+	if e.index != "" {
+		cause["index"] = e.index
+	}
+	details := map[string]interface{}{"root_cause": []interface{}{cause}}
+	for k, v := range cause {
+		details[k] = v
+	}
+	return map[string]interface{}{"error": details, "status": e.status}
+}
+
+func indexNotFound(name string) *elasticError {
+	return &elasticError{status: http.StatusNotFound, typ: "index_not_found_exception", reason: "no such index", index: name}
+}
+
+func badRequest(err error) *elasticError {
+	if e, ok := err.(*elasticError); ok {
+		return e
+	}
+	typ := "illegal_argument_exception"
+	if _, ok := err.(*parseError); ok {
+		typ = "parsing_exception"
+	}
+	return &elasticError{status: http.StatusBadRequest, typ: typ, reason: err.Error()}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	if body != nil {
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	e := badRequest(err)
+	writeJSON(w, e.status, e.body())
+}
+
+func acknowledged() map[string]interface{} {
+	return map[string]interface{}{"acknowledged": true}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	parts := []string{}
+	for _, p := range strings.Split(strings.Trim(r.URL.Path, "/"), "/") {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	status, ret, err := s.route(r, parts, body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if r.Method == http.MethodHead {
+		writeJSON(w, status, nil)
+		return
+	}
+	writeJSON(w, status, ret)
+}
+
+func (s *Server) route(r *http.Request, parts []string, body []byte) (int, interface{}, error) {
+	method := r.Method
+	endpoint := ""
+	for _, p := range parts {
+		if strings.HasPrefix(p, "_") {
+			endpoint = p
+			break
+		}
+	}
+	first := ""
+	if len(parts) > 0 {
+		first = parts[0]
+	}
+	switch {
+	case len(parts) == 0:
+		return http.StatusOK, map[string]interface{}{
+			"name":         "embedded",
+			"cluster_name": "embedded",
+			"version":      map[string]interface{}{"number": VERSION},
+			"tagline":      "You Know, for Search",
+		}, nil
+	case first == "_cluster":
+		return http.StatusOK, map[string]interface{}{"cluster_name": "embedded", "status": "green", "timed_out": false}, nil
+	case first == "_aliases" && method == http.MethodPost:
+		return s.updateAliases(body)
+	case first == "_aliases" || endpoint == "_alias" || endpoint == "_aliases":
+		return s.getAliases(parts)
+	case first == "_bulk" || endpoint == "_bulk":
+		return s.bulk(defaultIndex(parts), body)
+	case first == "_msearch" || endpoint == "_msearch":
+		return s.multiSearch(defaultIndex(parts), body)
+	case first == "_search" && len(parts) > 1 && parts[1] == "scroll":
+		if method == http.MethodDelete {
+			return s.clearScroll(body)
+		}
+		return s.scroll(body)
+	case first == "_search" || endpoint == "_search":
+		return s.searchRequest(defaultIndex(parts), body, r.URL.Query().Get("scroll"))
+	case first == "_analyze" || endpoint == "_analyze":
+		return s.analyze(body)
+	case endpoint == "_refresh" || endpoint == "_flush" || endpoint == "_forcemerge":
+		return http.StatusOK, map[string]interface{}{"_shards": map[string]interface{}{"total": 1, "successful": 1, "failed": 0}}, nil
+	case endpoint == "_delete_by_query":
+		return s.deleteByQuery(first, body)
+	case endpoint == "_open" || endpoint == "_close":
+		return s.openClose(first, endpoint == "_open")
+	case endpoint == "_settings":
+		return s.putSettings(first, body)
+	case endpoint == "_mapping" || endpoint == "_mappings":
+		return s.putMapping(first, body)
+	case endpoint != "":
+		return 0, nil, &elasticError{status: http.StatusBadRequest, typ: "illegal_argument_exception", reason: fmt.Sprintf("endpoint [%s] not supported", endpoint)}
+	case len(parts) == 1:
+		switch method {
+		case http.MethodHead:
+			return s.indexExists(first)
+		case http.MethodPut:
+			return s.createIndex(first, body)
+		case http.MethodDelete:
+			return s.deleteIndex(first)
+		}
+	case len(parts) == 2 && method == http.MethodPost:
+		return s.indexDocument(first, parts[1], "", body)
+	case len(parts) == 3:
+		switch method {
+		case http.MethodPut, http.MethodPost:
+			return s.indexDocument(first, parts[1], parts[2], body)
+		case http.MethodGet, http.MethodHead:
+			return s.getDocument(first, parts[1], parts[2])
+		case http.MethodDelete:
+			return s.deleteDocument(first, parts[1], parts[2])
+		}
+	}
+	return 0, nil, &elasticError{status: http.StatusMethodNotAllowed, typ: "illegal_argument_exception", reason: fmt.Sprintf("%s %s not supported", method, r.URL.Path)}
+}
+
+func defaultIndex(parts []string) string {
+	if len(parts) > 0 && !strings.HasPrefix(parts[0], "_") {
+		return parts[0]
+	}
+	return ""
+}
+
+// Resolves comma separated names, aliases and wildcards to existing indices.
+// Should be called with the mutex held.
+func (s *Server) resolve(names string, ignoreUnavailable bool) ([]*index, error) {
+	seen := map[string]bool{}
+	ret := []*index{}
+	addIndex := func(i *index) {
+		if !seen[i.name] {
+			seen[i.name] = true
+			ret = append(ret, i)
+		}
+	}
+	if names == "" || names == "_all" || names == "*" {
+		for _, name := range s.sortedIndexNames() {
+			addIndex(s.indices[name])
+		}
+		return ret, nil
+	}
+	for _, name := range strings.Split(names, ",") {
+		if strings.Contains(name, "*") {
+			for _, indexName := range s.sortedIndexNames() {
+				if matched, _ := path.Match(name, indexName); matched {
+					addIndex(s.indices[indexName])
+				}
+			}
+			continue
+		}
+		if i, ok := s.indices[name]; ok {
+			addIndex(i)
+			continue
+		}
+		if aliased, ok := s.aliases[name]; ok {
+			for indexName := range aliased {
+				if i, ok := s.indices[indexName]; ok {
+					addIndex(i)
+				}
+			}
+			continue
+		}
+		if !ignoreUnavailable {
+			return nil, indexNotFound(name)
+		}
+	}
+	return ret, nil
+}
+
+func (s *Server) sortedIndexNames() []string {
+	names := make([]string, 0, len(s.indices))
+	for name := range s.indices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) indexExists(name string) (int, interface{}, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if _, err := s.resolve(name, false); err != nil {
+		return http.StatusNotFound, nil, nil
+	}
+	return http.StatusOK, nil, nil
+}
+
+func (s *Server) createIndex(name string, body []byte) (int, interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.indices[name]; ok {
+		return 0, nil, &elasticError{status: http.StatusBadRequest, typ: "resource_already_exists_exception", reason: fmt.Sprintf("index [%s] already exists", name), index: name}
+	}
+	i := &index{name: name, docs: map[string]*document{}, mapping: newMapping(), settings: map[string]interface{}{}}
+	if len(body) > 0 {
+		var req struct {
+			Mappings map[string]interface{} `json:"mappings"`
+			Settings map[string]interface{} `json:"settings"`
+			Aliases  map[string]interface{} `json:"aliases"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return 0, nil, badRequest(errors.Wrap(err, "Failed to parse index body"))
+		}
+		i.mapping.add(req.Mappings)
+		if req.Settings != nil {
+			i.settings = req.Settings
+		}
+		for alias := range req.Aliases {
+			s.addAlias(alias, name)
+		}
+	}
+	s.indices[name] = i
+	return http.StatusOK, map[string]interface{}{"acknowledged": true, "shards_acknowledged": true, "index": name}, nil
+}
+
+func (s *Server) deleteIndex(names string) (int, interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	indices, err := s.resolve(names, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, i := range indices {
+		delete(s.indices, i.name)
+		for alias, aliased := range s.aliases {
+			delete(aliased, i.name)
+			if len(aliased) == 0 {
+				delete(s.aliases, alias)
+			}
+		}
+	}
+	return http.StatusOK, acknowledged(), nil
+}
+
+func (s *Server) openClose(names string, open bool) (int, interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	indices, err := s.resolve(names, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, i := range indices {
+		i.closed = !open
+	}
+	return http.StatusOK, acknowledged(), nil
+}
+
+// Settings are kept but have no effect, analysis is fixed.
+func (s *Server) putSettings(names string, body []byte) (int, interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	indices, err := s.resolve(names, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	var settings map[string]interface{}
+	if err := json.Unmarshal(body, &settings); err != nil {
+		return 0, nil, badRequest(errors.Wrap(err, "Failed to parse settings"))
+	}
+	for _, i := range indices {
+		for k, v := range settings {
+			i.settings[k] = v
+		}
+	}
+	return http.StatusOK, acknowledged(), nil
+}
+
+func (s *Server) putMapping(names string, body []byte) (int, interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	indices, err := s.resolve(names, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(body, &m); err != nil {
+		return 0, nil, badRequest(errors.Wrap(err, "Failed to parse mapping"))
+	}
+	for _, i := range indices {
+		i.mapping.add(m)
+	}
+	return http.StatusOK, acknowledged(), nil
+}
+
+// Should be called with the mutex held.
+func (s *Server) addAlias(alias string, indexName string) {
+	if _, ok := s.aliases[alias]; !ok {
+		s.aliases[alias] = map[string]bool{}
+	}
+	s.aliases[alias][indexName] = true
+}
+
+func (s *Server) updateAliases(body []byte) (int, interface{}, error) {
+	var req struct {
+		Actions []map[string]struct {
+			Index   string   `json:"index"`
+			Indices []string `json:"indices"`
+			Alias   string   `json:"alias"`
+			Aliases []string `json:"aliases"`
+		} `json:"actions"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0, nil, badRequest(errors.Wrap(err, "Failed to parse aliases actions"))
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, action := range req.Actions {
+		for op, a := range action {
+			indexNames := a.Indices
+			if a.Index != "" {
+				indexNames = append(indexNames, a.Index)
+			}
+			aliases := a.Aliases
+			if a.Alias != "" {
+				aliases = append(aliases, a.Alias)
+			}
+			for _, indexName := range indexNames {
+				if _, ok := s.indices[indexName]; !ok {
+					return 0, nil, indexNotFound(indexName)
+				}
+				for _, alias := range aliases {
+					switch op {
+					case "add":
+						s.addAlias(alias, indexName)
+					case "remove":
+						if aliased, ok := s.aliases[alias]; ok {
+							delete(aliased, indexName)
+							if len(aliased) == 0 {
+								delete(s.aliases, alias)
+							}
+						}
+					default:
+						return 0, nil, badRequest(errors.Errorf("Unsupported alias action [%s]", op))
+					}
+				}
+			}
+		}
+	}
+	return http.StatusOK, acknowledged(), nil
+}
+
+// Returns {index: {"aliases": {alias: {}}}} for all indices, or indices matching the path.
+func (s *Server) getAliases(parts []string) (int, interface{}, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	names := defaultIndex(parts)
+	indices, err := s.resolve(names, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	filter := ""
+	if len(parts) > 0 && parts[len(parts)-1] != "_alias" && parts[len(parts)-1] != "_aliases" {
+		filter = parts[len(parts)-1]
+	}
+	ret := map[string]interface{}{}
+	for _, i := range indices {
+		aliases := map[string]interface{}{}
+		for alias, aliased := range s.aliases {
+			if aliased[i.name] && (filter == "" || filter == alias) {
+				aliases[alias] = map[string]interface{}{}
+			}
+		}
+		if filter == "" || len(aliases) > 0 {
+			ret[i.name] = map[string]interface{}{"aliases": aliases}
+		}
+	}
+	return http.StatusOK, ret, nil
+}
+
+// Should be called with the mutex held, creates the index if missing.
+func (s *Server) put(indexName string, typ string, id string, source []byte) (string, bool, error) {
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(source, &parsed); err != nil {
+		return "", false, &elasticError{status: http.StatusBadRequest, typ: "mapper_parsing_exception", reason: fmt.Sprintf("failed to parse: %s", err.Error()), index: indexName}
+	}
+	i, ok := s.indices[indexName]
+	if !ok {
+		if aliased, ok := s.aliases[indexName]; ok && len(aliased) == 1 {
+			for name := range aliased {
+				i = s.indices[name]
+			}
+		} else {
+			i = &index{name: indexName, docs: map[string]*document{}, mapping: newMapping(), settings: map[string]interface{}{}}
+			s.indices[indexName] = i
+		}
+	}
+	s.seq++
+	if id == "" {
+		id = fmt.Sprintf("embedded%d", s.seq)
+	}
+	_, existed := i.docs[id]
+	i.docs[id] = &document{index: i.name, typ: typ, id: id, seq: s.seq, source: parsed, raw: json.RawMessage(source), mapping: i.mapping}
+	return id, !existed, nil
+}
+
+func writeResult(indexName string, typ string, id string, created bool) map[string]interface{} {
+	result := "updated"
+	if created {
+		result = "created"
+	}
+	return map[string]interface{}{
+		"_index":   indexName,
+		"_type":    typ,
+		"_id":      id,
+		"_version": 1,
+		"result":   result,
+		"_shards":  map[string]interface{}{"total": 1, "successful": 1, "failed": 0},
+	}
+}
+
+func (s *Server) indexDocument(indexName string, typ string, id string, body []byte) (int, interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	id, created, err := s.put(indexName, typ, id, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	return status, writeResult(indexName, typ, id, created), nil
+}
+
+func (s *Server) getDocument(indexName string, typ string, id string) (int, interface{}, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	indices, err := s.resolve(indexName, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, i := range indices {
+		if d, ok := i.docs[id]; ok {
+			return http.StatusOK, map[string]interface{}{"_index": i.name, "_type": d.typ, "_id": id, "_version": 1, "found": true, "_source": d.raw}, nil
+		}
+	}
+	return http.StatusNotFound, map[string]interface{}{"_index": indexName, "_type": typ, "_id": id, "found": false}, nil
+}
+
+func (s *Server) deleteDocument(indexName string, typ string, id string) (int, interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	indices, err := s.resolve(indexName, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, i := range indices {
+		if _, ok := i.docs[id]; ok {
+			delete(i.docs, id)
+			return http.StatusOK, map[string]interface{}{"_index": i.name, "_type": typ, "_id": id, "result": "deleted"}, nil
+		}
+	}
+	return http.StatusNotFound, map[string]interface{}{"_index": indexName, "_type": typ, "_id": id, "result": "not_found"}, nil
+}
+
+func (s *Server) bulk(defaultIndexName string, body []byte) (int, interface{}, error) {
+	lines := strings.Split(string(body), "\n")
+	items := []interface{}{}
+	hasErrors := false
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for l := 0; l < len(lines); l++ {
+		if strings.TrimSpace(lines[l]) == "" {
+			continue
+		}
+		var action map[string]struct {
+			Index string `json:"_index"`
+			Type  string `json:"_type"`
+			Id    string `json:"_id"`
+		}
+		if err := json.Unmarshal([]byte(lines[l]), &action); err != nil {
+			return 0, nil, badRequest(errors.Wrapf(err, "Malformed action/metadata line [%d]", l+1))
+		}
+		for op, meta := range action {
+			indexName := meta.Index
+			if indexName == "" {
+				indexName = defaultIndexName
+			}
+			item := map[string]interface{}{"_index": indexName, "_type": meta.Type, "_id": meta.Id}
+			var err error
+			switch op {
+			case "index", "create":
+				l++
+				if l >= len(lines) {
+					return 0, nil, badRequest(errors.Errorf("Missing source for action line [%d]", l))
+				}
+				var created bool
+				if meta.Id, created, err = s.put(indexName, meta.Type, meta.Id, []byte(lines[l])); err == nil {
+					item = writeResult(indexName, meta.Type, meta.Id, created)
+					item["status"] = map[bool]int{true: http.StatusCreated, false: http.StatusOK}[created]
+				}
+			case "update":
+				l++
+				if l >= len(lines) {
+					return 0, nil, badRequest(errors.Errorf("Missing source for action line [%d]", l))
+				}
+				err = s.update(indexName, meta.Type, meta.Id, []byte(lines[l]))
+				item["status"] = http.StatusOK
+				item["result"] = "updated"
+			case "delete":
+				found := false
+				if indices, rerr := s.resolve(indexName, true); rerr == nil {
+					for _, i := range indices {
+						if _, ok := i.docs[meta.Id]; ok {
+							delete(i.docs, meta.Id)
+							found = true
+						}
+					}
+				}
+				item["status"] = map[bool]int{true: http.StatusOK, false: http.StatusNotFound}[found]
+				item["result"] = map[bool]string{true: "deleted", false: "not_found"}[found]
+			default:
+				return 0, nil, badRequest(errors.Errorf("Unsupported bulk action [%s]", op))
+			}
+			if err != nil {
+				hasErrors = true
+				e := badRequest(err)
+				item["status"] = e.status
+				item["error"] = e.body()["error"]
+			}
+			items = append(items, map[string]interface{}{op: item})
+		}
+	}
+	return http.StatusOK, map[string]interface{}{"took": 1, "errors": hasErrors, "items": items}, nil
+}
+
+// Partial update merging "doc" into the existing source. Should be called with the mutex held.
+func (s *Server) update(indexName string, typ string, id string, body []byte) error {
+	var req struct {
+		Doc         map[string]interface{} `json:"doc"`
+		DocAsUpsert bool                   `json:"doc_as_upsert"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return badRequest(errors.Wrap(err, "Failed to parse update"))
+	}
+	source := map[string]interface{}{}
+	if i, ok := s.indices[indexName]; ok {
+		if d, ok := i.docs[id]; ok {
+			source = d.source
+		} else if !req.DocAsUpsert {
+			return &elasticError{status: http.StatusNotFound, typ: "document_missing_exception", reason: fmt.Sprintf("[%s][%s]: document missing", typ, id), index: indexName}
+		}
+	}
+	for k, v := range req.Doc {
+		source[k] = v
+	}
+	raw, err := json.Marshal(source)
+	if err != nil {
+		return badRequest(err)
+	}
+	_, _, err = s.put(indexName, typ, id, raw)
+	return err
+}
+
+func (s *Server) deleteByQuery(names string, body []byte) (int, interface{}, error) {
+	var req struct {
+		Query interface{} `json:"query"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0, nil, badRequest(err)
+	}
+	q, err := parseQuery(req.Query)
+	if err != nil {
+		return 0, nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	indices, err := s.resolve(names, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	deleted := 0
+	for _, i := range indices {
+		for id, d := range i.docs {
+			if _, ok := q.eval(d); ok {
+				delete(i.docs, id)
+				deleted++
+			}
+		}
+	}
+	return http.StatusOK, map[string]interface{}{"took": 1, "deleted": deleted, "total": deleted, "failures": []interface{}{}}, nil
+}
+
+func (s *Server) analyze(body []byte) (int, interface{}, error) {
+	var req struct {
+		Text interface{} `json:"text"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0, nil, badRequest(err)
+	}
+	tokens := []token{}
+	offset := 0
+	for _, text := range asSlice(req.Text) {
+		str := asString(text)
+		for _, t := range analyze(str) {
+			t.StartOffset += offset
+			t.EndOffset += offset
+			t.Position = len(tokens)
+			tokens = append(tokens, t)
+		}
+		offset += len(utf16.Encode([]rune(str))) + 1
+	}
+	return http.StatusOK, map[string]interface{}{"tokens": tokens}, nil
+}
@@ -0,0 +1,274 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/olivere/elastic.v6"
+)
+
+type ServerSuite struct {
+	suite.Suite
+	server *Server
+	esc    *elastic.Client
+	ctx    context.Context
+}
+
+func TestServer(t *testing.T) {
+	suite.Run(t, new(ServerSuite))
+}
+
+const testMappings = `{
+	"mappings": {
+		"result": {
+			"properties": {
+				"mdb_uid": {"type": "keyword"},
+				"result_type": {"type": "keyword"},
+				"effective_date": {"type": "date", "format": "strict_date"},
+				"title": {"type": "text", "fields": {"language": {"type": "text"}}},
+				"content": {"type": "text"},
+				"title_suggest": {
+					"type": "completion",
+					"contexts": [{"name": "result_type", "type": "category", "path": "result_type"}]
+				}
+			}
+		}
+	}
+}`
+
+type testDoc struct {
+	MdbUid        string      `json:"mdb_uid"`
+	ResultType    string      `json:"result_type"`
+	EffectiveDate string      `json:"effective_date"`
+	Title         string      `json:"title"`
+	Content       string      `json:"content"`
+	TitleSuggest  interface{} `json:"title_suggest"`
+}
+
+var testDocs = []testDoc{
+	{"u1", "units", "2020-01-01", "Introduction to Kabbalah", "The wisdom of Kabbalah explains the purpose of creation.", map[string]interface{}{"input": []string{"Introduction to Kabbalah"}, "weight": 10}},
+	{"u2", "units", "2021-05-10", "Lesson on Shamati", "Article about the inner light and the screen.", map[string]interface{}{"input": []string{"Lesson on Shamati"}, "weight": 5}},
+	{"s1", "sources", "2019-03-03", "Inner Light", "Inner light surrounding light.", map[string]interface{}{"input": []string{"Inner Light"}, "weight": 20}},
+}
+
+func (suite *ServerSuite) SetupTest() {
+	r := suite.Require()
+	suite.server = NewServer()
+	r.Nil(suite.server.Start())
+	var err error
+	suite.esc, err = elastic.NewClient(elastic.SetURL(suite.server.URL()), elastic.SetSniff(false))
+	r.Nil(err)
+	suite.ctx = context.Background()
+
+	res, err := suite.esc.CreateIndex("test_results_en_1").BodyString(testMappings).Do(suite.ctx)
+	r.Nil(err)
+	r.True(res.Acknowledged)
+	aliasRes, err := suite.esc.Alias().Add("test_results_en_1", "test_results_en").Do(suite.ctx)
+	r.Nil(err)
+	r.True(aliasRes.Acknowledged)
+
+	bulk := suite.esc.Bulk()
+	for _, d := range testDocs {
+		bulk.Add(elastic.NewBulkIndexRequest().Index("test_results_en").Type("result").Id(d.MdbUid).Doc(d))
+	}
+	bulkRes, err := bulk.Do(suite.ctx)
+	r.Nil(err)
+	r.False(bulkRes.Errors)
+	_, err = suite.esc.Refresh("test_results_en").Do(suite.ctx)
+	r.Nil(err)
+}
+
+func (suite *ServerSuite) TearDownTest() {
+	suite.esc.Stop()
+	suite.Require().Nil(suite.server.Close())
+}
+
+func hitIds(res *elastic.SearchResult) []string {
+	ret := []string{}
+	for _, h := range res.Hits.Hits {
+		ret = append(ret, h.Id)
+	}
+	return ret
+}
+
+func (suite *ServerSuite) TestIndexManagement() {
+	r := suite.Require()
+	exists, err := suite.esc.IndexExists("test_results_en").Do(suite.ctx)
+	r.Nil(err)
+	r.True(exists)
+	exists, err = suite.esc.IndexExists("missing").Do(suite.ctx)
+	r.Nil(err)
+	r.False(exists)
+
+	aliases, err := suite.esc.Aliases().Do(suite.ctx)
+	r.Nil(err)
+	r.Equal([]string{"test_results_en_1"}, aliases.IndicesByAlias("test_results_en"))
+
+	_, err = suite.esc.CreateIndex("test_results_en_1").Do(suite.ctx)
+	r.NotNil(err)
+	r.True(elastic.IsStatusCode(err, 400))
+
+	res, err := suite.esc.DeleteIndex("test_results_en_1").Do(suite.ctx)
+	r.Nil(err)
+	r.True(res.Acknowledged)
+	exists, err = suite.esc.IndexExists("test_results_en").Do(suite.ctx)
+	r.Nil(err)
+	r.False(exists)
+}
+
+func (suite *ServerSuite) TestSearch() {
+	r := suite.Require()
+	query := elastic.NewBoolQuery().
+		Must(elastic.NewMultiMatchQuery("inner light", "title.language^2", "content")).
+		Filter(elastic.NewTermsQuery("result_type", "units", "sources"))
+	res, err := suite.esc.Search("test_results_en").Query(query).Do(suite.ctx)
+	r.Nil(err)
+	r.Equal(int64(2), res.Hits.TotalHits)
+	// Title match is boosted.
+	r.Equal([]string{"s1", "u2"}, hitIds(res))
+
+	res, err = suite.esc.Search("test_results_en").
+		Query(elastic.NewBoolQuery().MustNot(elastic.NewTermQuery("mdb_uid", "u2"))).
+		SortBy(elastic.NewFieldSort("effective_date").Desc()).
+		Do(suite.ctx)
+	r.Nil(err)
+	r.Equal([]string{"u1", "s1"}, hitIds(res))
+
+	res, err = suite.esc.Search("test_results_en").
+		Query(elastic.NewRangeQuery("effective_date").Gte("2020-01-01")).
+		SortBy(elastic.NewFieldSort("effective_date").Asc()).
+		SearchAfter("2020-01-01").
+		Do(suite.ctx)
+	r.Nil(err)
+	r.Equal([]string{"u2"}, hitIds(res))
+
+	res, err = suite.esc.Search("test_results_en").
+		Query(elastic.NewMatchPhraseQuery("content", "the inner light")).
+		Highlight(elastic.NewHighlight().Field("content")).
+		Do(suite.ctx)
+	r.Nil(err)
+	r.Equal([]string{"u2"}, hitIds(res))
+	r.Equal([]string{"Article about <em>the</em> <em>inner</em> <em>light</em> and <em>the</em> screen."}, res.Hits.Hits[0].Highlight["content"])
+
+	res, err = suite.esc.Search("test_results_en").
+		Query(elastic.NewSimpleQueryStringQuery("\"wisdom of\" -lesson").Field("content")).
+		Do(suite.ctx)
+	r.Nil(err)
+	r.Equal([]string{"u1"}, hitIds(res))
+
+	_, err = suite.esc.Search("missing").Do(suite.ctx)
+	r.True(elastic.IsNotFound(err))
+}
+
+func (suite *ServerSuite) TestMultiSearch() {
+	r := suite.Require()
+	res, err := suite.esc.MultiSearch().Add(
+		elastic.NewSearchRequest().Index("test_results_en").SearchSource(elastic.NewSearchSource().Query(elastic.NewIdsQuery().Ids("u1"))),
+		elastic.NewSearchRequest().Index("missing"),
+		elastic.NewSearchRequest().Index("test_results_en").SearchSource(elastic.NewSearchSource().Query(elastic.NewTermQuery("mdb_uid", "none"))),
+	).Do(suite.ctx)
+	r.Nil(err)
+	r.Len(res.Responses, 3)
+	r.Equal([]string{"u1"}, hitIds(res.Responses[0]))
+	r.NotNil(res.Responses[1].Error)
+	r.Equal("index_not_found_exception", res.Responses[1].Error.Type)
+	r.Nil(res.Responses[2].Error)
+	r.Empty(res.Responses[2].Hits.Hits)
+}
+
+func (suite *ServerSuite) TestSuggestAndAggregations() {
+	r := suite.Require()
+	suggester := elastic.NewCompletionSuggester("title_suggest").
+		Field("title_suggest").
+		Prefix("in").
+		ContextQuery(elastic.NewSuggesterCategoryQuery("result_type", "units"))
+	res, err := suite.esc.Search("test_results_en").
+		Size(0).
+		Suggester(suggester).
+		Aggregation("types", elastic.NewFiltersAggregation().
+			FilterWithName("units", elastic.NewTermQuery("result_type", "units")).
+			FilterWithName("sources", elastic.NewTermQuery("result_type", "sources"))).
+		Do(suite.ctx)
+	r.Nil(err)
+	r.Empty(res.Hits.Hits)
+	options := res.Suggest["title_suggest"][0].Options
+	r.Len(options, 1)
+	r.Equal("u1", options[0].Id)
+
+	agg, ok := res.Aggregations.Filters("types")
+	r.True(ok)
+	r.Equal(int64(2), agg.NamedBuckets["units"].DocCount)
+	r.Equal(int64(1), agg.NamedBuckets["sources"].DocCount)
+}
+
+func (suite *ServerSuite) TestPercolate() {
+	r := suite.Require()
+	_, err := suite.esc.CreateIndex("test_grammars").BodyString(`{
+		"mappings": {"result": {"properties": {"query": {"type": "percolator"}, "search_text": {"type": "text"}}}}
+	}`).Do(suite.ctx)
+	r.Nil(err)
+	rule := elastic.NewQueryStringQuery("(\"lessons about\") OR (\"talks on\")").Field("search_text")
+	source, err := json.Marshal(map[string]interface{}{"query": mustSource(rule)})
+	r.Nil(err)
+	_, err = suite.esc.Index().Index("test_grammars").Type("result").Id("rule").BodyString(string(source)).Do(suite.ctx)
+	r.Nil(err)
+
+	res, err := suite.esc.Search("test_grammars").
+		Query(elastic.NewPercolatorQuery().Field("query").Document(map[string]string{"search_text": "lessons about light"})).
+		Highlight(elastic.NewHighlight().Field("search_text").PreTags("$").PostTags("$")).
+		Do(suite.ctx)
+	r.Nil(err)
+	r.Equal([]string{"rule"}, hitIds(res))
+	r.Equal([]string{"$lessons$ $about$ light"}, res.Hits.Hits[0].Highlight["search_text"])
+
+	res, err = suite.esc.Search("test_grammars").
+		Query(elastic.NewPercolatorQuery().Field("query").Document(map[string]string{"search_text": "about lessons"})).
+		Do(suite.ctx)
+	r.Nil(err)
+	r.Empty(res.Hits.Hits)
+}
+
+func mustSource(q elastic.Query) interface{} {
+	src, err := q.Source()
+	if err != nil {
+		panic(err)
+	}
+	return src
+}
+
+func (suite *ServerSuite) TestScroll() {
+	r := suite.Require()
+	scroll := suite.esc.Scroll("test_results_en").Size(2)
+	ids := []string{}
+	for {
+		res, err := scroll.Do(suite.ctx)
+		if err == io.EOF {
+			break
+		}
+		r.Nil(err)
+		ids = append(ids, hitIds(res)...)
+	}
+	r.ElementsMatch([]string{"u1", "u2", "s1"}, ids)
+	r.Nil(scroll.Clear(suite.ctx))
+}
+
+func (suite *ServerSuite) TestAnalyze() {
+	r := suite.Require()
+	res, err := suite.esc.PerformRequest(suite.ctx, elastic.PerformRequestOptions{
+		Method: "GET",
+		Path:   "/test_results_en/_analyze",
+		Body:   map[string]string{"text": "Ма́ймонид, Zohar", "analyzer": "russian_synonym"},
+	})
+	r.Nil(err)
+	tokens := struct {
+		Tokens []token `json:"tokens"`
+	}{}
+	r.Nil(json.Unmarshal(res.Body, &tokens))
+	r.Equal([]token{
+		{Token: "маймонид", StartOffset: 0, EndOffset: 9, Type: "<ALPHANUM>", Position: 0},
+		{Token: "zohar", StartOffset: 11, EndOffset: 16, Type: "<ALPHANUM>", Position: 1},
+	}, tokens.Tokens)
+}
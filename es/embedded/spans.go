@@ -0,0 +1,251 @@
+package embedded
+
+import (
+	"math"
+	"strings"
+)
+
+// Single token matcher of span_term, span_multi and fuzzy queries.
+type spanClause struct {
+	field   string
+	value   string
+	matches func(token string) bool
+}
+
+func parseSpanClause(raw interface{}) (*spanClause, error) {
+	m, ok := raw.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return nil, parseErrorf("span clause malformed: %+v", raw)
+	}
+	for name, body := range m {
+		switch name {
+		case "span_term":
+			field, value, _, err := fieldAndValue(body, "value")
+			if err != nil {
+				return nil, err
+			}
+			v := strings.ToLower(asString(value))
+			return &spanClause{field: field, value: v, matches: func(t string) bool { return t == v }}, nil
+		case "span_multi":
+			b, _ := body.(map[string]interface{})
+			return parseMultiTermClause(b["match"])
+		default:
+			return nil, parseErrorf("span clause [%s] not supported", name)
+		}
+	}
+	return nil, nil
+}
+
+// Fuzzy, prefix or term query as a single token matcher.
+func parseMultiTermClause(raw interface{}) (*spanClause, error) {
+	m, ok := raw.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return nil, parseErrorf("span_multi match malformed: %+v", raw)
+	}
+	for name, body := range m {
+		field, value, _, err := fieldAndValue(body, "value")
+		if err != nil {
+			return nil, err
+		}
+		ts := terms(asString(value))
+		if len(ts) == 0 {
+			return &spanClause{field: field, matches: func(t string) bool { return false }}, nil
+		}
+		v := strings.Join(ts, "")
+		switch name {
+		case "term":
+			return &spanClause{field: field, value: v, matches: func(t string) bool { return t == v }}, nil
+		case "prefix":
+			return &spanClause{field: field, value: v, matches: func(t string) bool { return strings.HasPrefix(t, v) }}, nil
+		case "fuzzy":
+			fuzziness := autoFuzziness(v)
+			if opts, ok := body.(map[string]interface{})[field].(map[string]interface{}); ok {
+				if f := asString(opts["fuzziness"]); f != "" && !strings.EqualFold(f, "auto") {
+					fuzziness = int(asFloat(opts["fuzziness"], float64(fuzziness)))
+				}
+			}
+			return &spanClause{field: field, value: v, matches: func(t string) bool { return editDistance(t, v, fuzziness) <= fuzziness }}, nil
+		default:
+			return nil, parseErrorf("multi term query [%s] not supported", name)
+		}
+	}
+	return nil, nil
+}
+
+func autoFuzziness(term string) int {
+	switch n := len([]rune(term)); {
+	case n <= 2:
+		return 0
+	case n <= 5:
+		return 1
+	}
+	return 2
+}
+
+// Damerau-Levenshtein (optimal string alignment) distance, stops early above max.
+func editDistance(a string, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > max || -d > max {
+		return max + 1
+	}
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = minInt(cur[j], prev2[j-2]+1)
+			}
+			rowMin = minInt(rowMin, cur[j])
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Single token query (fuzzy as top level query).
+type tokenQuery struct {
+	clause *spanClause
+	boost  float64
+}
+
+func (q *tokenQuery) eval(d *document) (float64, bool) {
+	for _, text := range d.texts(q.clause.field) {
+		for _, t := range terms(text) {
+			if q.clause.matches(t) {
+				return q.boost, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func (q *tokenQuery) highlightTerms(field string, ret map[string]bool) {
+	if fieldMatches(q.clause.field, field) && q.clause.value != "" {
+		ret[q.clause.value] = true
+	}
+}
+
+type spanNearQuery struct {
+	clauses []*spanClause
+	slop    int
+	inOrder bool
+	boost   float64
+}
+
+func parseSpanNearQuery(body interface{}) (query, error) {
+	b, _ := body.(map[string]interface{})
+	q := &spanNearQuery{slop: int(asFloat(b["slop"], 0)), inOrder: asBool(b["in_order"], true), boost: boostOf(body)}
+	for _, c := range asSlice(b["clauses"]) {
+		clause, err := parseSpanClause(c)
+		if err != nil {
+			return nil, err
+		}
+		if len(q.clauses) > 0 && clause.field != q.clauses[0].field {
+			return nil, parseErrorf("span_near clauses must have same field")
+		}
+		q.clauses = append(q.clauses, clause)
+	}
+	if len(q.clauses) == 0 {
+		return nil, parseErrorf("span_near must include at least one clause")
+	}
+	return q, nil
+}
+
+func (q *spanNearQuery) eval(d *document) (float64, bool) {
+	best := 0.0
+	matched := false
+	for _, text := range d.texts(q.clauses[0].field) {
+		docTerms := terms(text)
+		positions := make([][]int, len(q.clauses))
+		for i, c := range q.clauses {
+			for p, t := range docTerms {
+				if c.matches(t) {
+					positions[i] = append(positions[i], p)
+				}
+			}
+			if len(positions[i]) == 0 {
+				positions = nil
+				break
+			}
+		}
+		if positions == nil {
+			continue
+		}
+		if gaps, ok := q.minGaps(positions, 0, -1, -1, map[int]bool{}); ok {
+			matched = true
+			best = math.Max(best, float64(len(q.clauses))/math.Sqrt(float64(len(docTerms)))/float64(1+gaps))
+		}
+	}
+	return best * q.boost, matched
+}
+
+// Smallest number of tokens between the clauses, choosing a position for each clause.
+func (q *spanNearQuery) minGaps(positions [][]int, i int, first int, last int, used map[int]bool) (int, bool) {
+	if i == len(positions) {
+		span := last - first + 1
+		if !q.inOrder {
+			min, max := -1, -1
+			for p := range used {
+				if min < 0 || p < min {
+					min = p
+				}
+				if p > max {
+					max = p
+				}
+			}
+			span = max - min + 1
+		}
+		gaps := span - len(positions)
+		return gaps, gaps <= q.slop
+	}
+	best, found := 0, false
+	for _, p := range positions[i] {
+		if used[p] || (q.inOrder && p <= last) {
+			continue
+		}
+		if first < 0 {
+			first = p
+		}
+		used[p] = true
+		if gaps, ok := q.minGaps(positions, i+1, first, p, used); ok && (!found || gaps < best) {
+			best, found = gaps, true
+		}
+		delete(used, p)
+		if i == 0 {
+			first = -1
+		}
+	}
+	return best, found
+}
+
+func (q *spanNearQuery) highlightTerms(field string, ret map[string]bool) {
+	if !fieldMatches(q.clauses[0].field, field) {
+		return
+	}
+	for _, c := range q.clauses {
+		if c.value != "" {
+			ret[c.value] = true
+		}
+	}
+}
@@ -3,6 +3,7 @@ package es
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
@@ -19,6 +20,7 @@ type IndexData struct {
 	// Persons      map[string][]string
 	// Translations map[string][][]string
 	MediaLanguages map[string][]string
+	MediaTypes     map[string][]string
 	Transcripts    map[string]map[string][]string
 }
 
@@ -61,6 +63,11 @@ func (indexData *IndexData) load(sqlScope string) error {
 		return err
 	}
 
+	indexData.MediaTypes, err = indexData.loadMediaTypes(sqlScope)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -241,6 +248,24 @@ func (indexData *IndexData) loadMediaLanguages(sqlScope string) (map[string][]st
 	return indexData.rowsToUIDToValues(rows)
 }
 
+func (indexData *IndexData) loadMediaTypes(sqlScope string) (map[string][]string, error) {
+	rows, err := queries.Raw(fmt.Sprintf(`SELECT cu.uid, array_agg(DISTINCT f.type)
+		FROM files f
+			INNER JOIN content_units AS cu ON f.content_unit_id = cu.id
+		WHERE f.secure = 0  and f.published = true
+		AND f.type IN ('%s')
+		AND f.content_unit_id IS NOT NULL
+		AND %s
+		GROUP BY cu.uid`, strings.Join(consts.ALL_MEDIA_TYPES, "', '"), sqlScope)).Query(indexData.DB)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Load media types")
+	}
+	defer rows.Close()
+
+	return indexData.rowsToUIDToValues(rows)
+}
+
 func (indexData *IndexData) rowsToUIDToValues(rows *sql.Rows) (map[string][]string, error) {
 	m := make(map[string][]string)
 
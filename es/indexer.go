@@ -2,14 +2,11 @@ package es
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -290,17 +287,22 @@ func UpdateSynonyms(esc *elastic.Client, indexNameByLang IndexNameByLang) error
 		if err != nil {
 			return errors.New(fmt.Sprintf("Failed marshding %+v.", body))
 		}
-		//  Using standard HTTP put call instead of esc.IndexPutSettings(indexName).BodyJson(body).Do(context.TODO())
+		//  Using raw PUT request instead of esc.IndexPutSettings(indexName).BodyJson(body).Do(context.TODO())
 		//	 due to the fact that this version of elastic hides error when synonyms are not updated properly.
 		if runtime.GOOS == "windows" {
 			indexName = url.QueryEscape(indexName)
 		}
-		url := fmt.Sprintf("%s/%s/_settings", viper.GetString("elasticsearch.url"), indexName)
-		log.Infof("Sending to %s: %s", url, string(bodyStr))
-		contents, err := putRequest(url, bytes.NewBuffer(bodyStr))
+		path := fmt.Sprintf("/%s/_settings", indexName)
+		log.Infof("Sending to %s: %s", path, string(bodyStr))
+		res, err := esc.PerformRequest(context.TODO(), elastic.PerformRequestOptions{
+			Method: "PUT",
+			Path:   path,
+			Body:   string(bodyStr),
+		})
 		if err != nil {
 			return errors.Wrapf(err, "IndexPutSettings: %s with keywords: \n%s\n", indexName, strings.Join(keywords, "\n"))
 		}
+		contents := res.Body
 		settingsRes := new(elastic.IndicesPutSettingsResponse)
 		if err := json.Unmarshal(contents, settingsRes); err != nil {
 			return errors.New(fmt.Sprintf("Error decoding ret"))
@@ -312,28 +314,6 @@ func UpdateSynonyms(esc *elastic.Client, indexNameByLang IndexNameByLang) error
 	return nil
 }
 
-func putRequest(url string, data io.Reader) ([]byte, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest(http.MethodPut, url, data)
-	req.Header.Set("Content-Type", "application/json")
-	if err != nil {
-		log.Fatal(err)
-	}
-	response, err := client.Do(req)
-	if err != nil {
-		return nil, errors.Wrapf(err, "While calling PUT request %s", url)
-	}
-	defer response.Body.Close()
-	contents, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		return nil, errors.Wrapf(err, "While reading PUT response for %s", url)
-	}
-	if response.StatusCode != 200 {
-		return nil, errors.New(fmt.Sprintf("Error, received: %s", string(contents)))
-	}
-	return contents, nil
-}
-
 func (indexer *Indexer) ReindexAll(esc *elastic.Client) error {
 	log.Info("Indexer - Re-Indexing everything")
 	if err := indexer.CreateIndexes(); err != nil {
@@ -6,6 +6,9 @@
 # features are supported for some languages but not others. Also specific
 # languages need specific treatment such as transliteration for cyrillic other
 # specific tokenization for CJK.
+# Mappings are generated for Elasticsearch 6 with a document type, for typeless
+# backends (Elasticsearch 7+, OpenSearch) the type level is removed when the
+# index is created, see es.TypelessMappings.
 
 # Mapping generated here requires the following Elasticsearch plugins:
 #   https://www.elastic.co/guide/en/elasticsearch/guide/current/hunspell.html
@@ -520,6 +523,10 @@ RESULTS_TEMPLATE = {
                     "type": "date",
                     "format": "strict_date",
                 },
+                # Duration in seconds.
+                "duration": {
+                    "type": "integer",
+                },
             }
         }
     }
@@ -647,6 +654,15 @@ GRAMMARS_TEMPLATE = {
                 "query": {
                     "type": "percolator"
                 },
+                # Intent and variables set the rule was generated from, e.g., "by_program:$Program|$Text".
+                # Used for incremental grammar index updates.
+                "set_key": {
+                    "type": "keyword"
+                },
+                # Hash of all rules generated for set_key, changes when rules or variable values change.
+                "set_hash": {
+                    "type": "keyword"
+                },
                 # Text query from user. Assigned only in query time. Must be defined in index for percolator functionality.
                 "search_text": {
                     "type": "text",
@@ -672,6 +688,13 @@ GRAMMARS_TEMPLATE = {
                         "values": {
                             "type": "keyword",
                         },
+                        # Years range of rules matching $Year by range query, values of $Year are then "0000".
+                        "year_from": {
+                            "type": "integer",
+                        },
+                        "year_to": {
+                            "type": "integer",
+                        },
                         # Grammar rule: [congress $Year $ConventionLocation] or [$Year $ConventionLocation congress]
                         "rules": {
                             "type": "text",
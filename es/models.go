@@ -34,6 +34,8 @@ type Result struct {
 	Content     string `json:"content,omitempty"`
 
 	EffectiveDate *utils.Date `json:"effective_date,omitempty"`
+	// Duration in seconds, of content units.
+	Duration int64 `json:"duration,omitempty"`
 
 	// Suggest field for autocomplete.
 	TitleSuggest SuggestField `json:"title_suggest"`
@@ -305,18 +305,31 @@ func (index *SourcesIndex) getDocxPath(uid string, lang string) (string, error)
 }
 
 func (index *SourcesIndex) fetchDocx(cuUid string, lang string) (string, error) {
+	return fetchSourceDocx(index.db, index.assetsService, cuUid, lang)
+}
+
+func fetchSourceDocx(db *sql.DB, assetsService integration.AssetsService, cuUid string, lang string) (string, error) {
+	fileUID, err := sourceDocxFile(db, cuUid, lang)
+	if err != nil || fileUID == "" {
+		return "", err
+	}
+	return assetsService.Doc2Text(fileUID)
+}
+
+// Returns the UID of the docx file of the source in the given language, empty if missing.
+func sourceDocxFile(db *sql.DB, cuUid string, lang string) (string, error) {
 	queryMask := `select f.uid from files f
 	join content_units cu ON cu.id = f.content_unit_id
 	where cu.published IS TRUE and cu.secure = %d and f.secure = %d and f.published IS TRUE and f.removed_at IS NULL
 	and f.name like '%%.doc%%'
-	and cu.uid = '%s' AND language = '%s'`
+	and cu.uid = %s AND language = %s`
 	query := fmt.Sprintf(queryMask,
 		consts.SEC_PUBLIC,
 		consts.SEC_PUBLIC,
-		cuUid,
-		lang)
+		pq.QuoteLiteral(cuUid),
+		pq.QuoteLiteral(lang))
 	var fileUID string
-	err := queries.Raw(query).QueryRow(index.db).Scan(&fileUID)
+	err := queries.Raw(query).QueryRow(db).Scan(&fileUID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// Missing source. Do not count this as error.
@@ -324,7 +337,7 @@ func (index *SourcesIndex) fetchDocx(cuUid string, lang string) (string, error)
 		}
 		return "", err
 	}
-	return index.assetsService.Doc2Text(fileUID)
+	return fileUID, nil
 }
 
 func (index *SourcesIndex) indexSource(mdbSource *mdbmodels.Source, parents []string, parentIds []int64, authorsByLanguage map[string][]string) *IndexErrors {
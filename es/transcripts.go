@@ -0,0 +1,51 @@
+package es
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/integration"
+)
+
+// Returns the UID of the transcript file of the content unit in the given language,
+// the same file that is indexed as the content of the unit.
+// Returns empty string when the unit has no transcript in this language.
+func UnitTranscriptFile(db *sql.DB, cuUID string, language string) (string, error) {
+	indexData := &IndexData{DB: db}
+	// Published public units only, as in search results.
+	transcripts, err := indexData.loadTranscripts(fmt.Sprintf("cu.uid = %s AND cu.secure = %d AND cu.published IS TRUE AND f.removed_at IS NULL",
+		pq.QuoteLiteral(cuUID), consts.SEC_PUBLIC))
+	if err != nil {
+		return "", errors.Wrap(err, "UnitTranscriptFile")
+	}
+	if byLang, ok := transcripts[cuUID]; ok {
+		if val, ok := byLang[language]; ok {
+			return val[0], nil
+		}
+	}
+	return "", nil
+}
+
+// Returns the UID of the docx file of the source in the given language, the same
+// file that is indexed as the content of the source.
+// Returns empty string when the source has no text in this language.
+func SourceTranscriptFile(db *sql.DB, sourceUID string, language string) (string, error) {
+	fileUID, err := sourceDocxFile(db, sourceUID, language)
+	if err != nil {
+		return "", errors.Wrap(err, "SourceTranscriptFile")
+	}
+	return fileUID, nil
+}
+
+// Converts the transcript file to text, as done when indexing.
+func TranscriptText(fileUID string) (string, error) {
+	text, err := integration.NewAssetsService(unzipUrl).Doc2Text(fileUID)
+	if err != nil {
+		return "", errors.Wrapf(err, "TranscriptText - Error parsing docx: %s", fileUID)
+	}
+	return text, nil
+}
@@ -0,0 +1,263 @@
+package es
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+)
+
+// Rewrites requests of the ES 6 elastic client to typeless Elasticsearch 7+ / OpenSearch API:
+//   - Document type is removed from paths, bulk and multi search metadata and create index mappings.
+//   - Search responses are asked to report total hits as a number, as ES 6 does.
+//   - Search hits (_doc type on ES 7, no type on ES 8 and OpenSearch) get the ES 6 document type of their index.
+type typelessTransport struct {
+	next http.RoundTripper
+}
+
+func (t *typelessTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	segments = typelessPath(segments)
+	r.URL.Path = "/" + strings.Join(segments, "/")
+	r.URL.RawPath = ""
+
+	last := segments[len(segments)-1]
+	isSearch := last == "_search" || last == "_msearch" || (len(segments) > 1 && segments[len(segments)-2] == "_search" && last == "scroll")
+	if isSearch {
+		values := r.URL.Query()
+		values.Set("rest_total_hits_as_int", "true")
+		r.URL.RawQuery = values.Encode()
+	}
+
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "typelessTransport - Read body.")
+		}
+		switch {
+		case last == "_bulk":
+			body, err = typelessNdjson(body, true)
+		case last == "_msearch":
+			body, err = typelessNdjson(body, false)
+		case last == "_search":
+			body, err = rewriteJson(body, removeLikeTypes)
+		case len(segments) == 1 && r.Method == http.MethodPut:
+			body, err = rewriteJson(body, TypelessMappings)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "typelessTransport - Rewrite body of %s.", r.URL.Path)
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.GetBody = func() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(body)), nil }
+	}
+	res, err := t.next.RoundTrip(r)
+	if err != nil || !isSearch || res.Body == nil {
+		return res, err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "typelessTransport - Read response body.")
+	}
+	if res.StatusCode == http.StatusOK {
+		if body, err = rewriteJson(body, typedHits); err != nil {
+			return nil, errors.Wrapf(err, "typelessTransport - Rewrite response of %s.", r.URL.Path)
+		}
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	res.ContentLength = int64(len(body))
+	res.Header.Del("Content-Length")
+	return res, nil
+}
+
+// ES 6 document type of index: grammars indexes (prod_grammars_<lang>[_<date>]) or results indexes.
+func indexDocType(index string) string {
+	if strings.Contains(index, fmt.Sprintf("_%s_", consts.ES_GRAMMARS_DOC_TYPE)) {
+		return consts.ES_GRAMMARS_DOC_TYPE
+	}
+	return consts.ES_RESULTS_DOC_TYPE
+}
+
+// Sets document type of hits of search, scroll and multi search responses, including inner hits.
+func typedHits(m map[string]interface{}) map[string]interface{} {
+	for _, response := range asItems(m["responses"]) {
+		typedHits(response)
+	}
+	hits, ok := m["hits"].(map[string]interface{})
+	if !ok {
+		return m
+	}
+	for _, hit := range asItems(hits["hits"]) {
+		if docType, ok := hit["_type"].(string); !ok || docType == "_doc" {
+			index, _ := hit["_index"].(string)
+			hit["_type"] = indexDocType(index)
+		}
+		if innerHits, ok := hit["inner_hits"].(map[string]interface{}); ok {
+			for _, inner := range innerHits {
+				if innerMap, ok := inner.(map[string]interface{}); ok {
+					typedHits(innerMap)
+				}
+			}
+		}
+	}
+	return m
+}
+
+// Removes document type from path segments:
+// index/type/id => index/_doc/id, index/type/id/_update => index/_update/id,
+// index/type/_search => index/_search, index/_mapping/type => index/_mapping.
+func typelessPath(segments []string) []string {
+	if len(segments) < 2 || strings.HasPrefix(segments[0], "_") {
+		return segments
+	}
+	if segments[1] == "_mapping" && len(segments) == 3 {
+		return segments[:2]
+	}
+	if strings.HasPrefix(segments[1], "_") {
+		return segments
+	}
+	index := segments[0]
+	switch {
+	case len(segments) == 2:
+		return []string{index, "_doc"}
+	case strings.HasPrefix(segments[2], "_"):
+		return append([]string{index}, segments[2:]...)
+	case len(segments) == 4 && (segments[3] == "_update" || segments[3] == "_create"):
+		return []string{index, segments[3], segments[2]}
+	}
+	return append([]string{index, "_doc"}, segments[2:]...)
+}
+
+// Removes type from action (bulk) or header (multi search) lines.
+// Bulk sources follow index, create and update actions, each multi search header is followed by a body.
+func typelessNdjson(body []byte, bulk bool) ([]byte, error) {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	expectMeta := true
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if !expectMeta {
+			if !bulk {
+				rewritten, err := rewriteJson(line, removeLikeTypes)
+				if err != nil {
+					return nil, err
+				}
+				line = rewritten
+			}
+			out.Write(line)
+			out.WriteByte('\n')
+			expectMeta = true
+			continue
+		}
+		var meta map[string]interface{}
+		if err := json.Unmarshal(line, &meta); err != nil {
+			return nil, errors.Wrapf(err, "Unmarshal metadata line: %s", line)
+		}
+		expectMeta = false
+		if bulk {
+			for action, value := range meta {
+				if m, ok := value.(map[string]interface{}); ok {
+					delete(m, "_type")
+				}
+				expectMeta = action == "delete"
+			}
+		} else {
+			delete(meta, "type")
+		}
+		rewritten, err := json.Marshal(meta)
+		if err != nil {
+			return nil, errors.Wrap(err, "Marshal metadata line")
+		}
+		out.Write(rewritten)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "Scan ndjson")
+	}
+	return out.Bytes(), nil
+}
+
+func rewriteJson(body []byte, rewrite func(map[string]interface{}) map[string]interface{}) ([]byte, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return body, nil
+	}
+	var m map[string]interface{}
+	// Keep numbers as is, e.g., long sort values for search_after.
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&m); err != nil {
+		return nil, errors.Wrap(err, "json.Unmarshal")
+	}
+	return json.Marshal(rewrite(m))
+}
+
+// Unwraps mappings of a single document type: {"mappings": {"result": {"properties": ...}}} => {"mappings": {"properties": ...}}.
+// Create index body of Elasticsearch 7+ and OpenSearch, no change for typeless mappings.
+func TypelessMappings(body map[string]interface{}) map[string]interface{} {
+	mappings, ok := body["mappings"].(map[string]interface{})
+	if !ok || len(mappings) != 1 {
+		return body
+	}
+	for name, value := range mappings {
+		typeMapping, ok := value.(map[string]interface{})
+		if !ok || strings.HasPrefix(name, "_") || name == "properties" || name == "dynamic" || name == "dynamic_templates" {
+			return body
+		}
+		body["mappings"] = typeMapping
+	}
+	return body
+}
+
+// More like this items reference documents with index and id only.
+func removeLikeTypes(m map[string]interface{}) map[string]interface{} {
+	for key, value := range m {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if key == "more_like_this" {
+				for _, items := range []string{"like", "unlike"} {
+					for _, item := range asItems(v[items]) {
+						delete(item, "_type")
+					}
+				}
+			}
+			removeLikeTypes(v)
+		case []interface{}:
+			for _, e := range v {
+				if em, ok := e.(map[string]interface{}); ok {
+					removeLikeTypes(em)
+				}
+			}
+		}
+	}
+	return m
+}
+
+func asItems(v interface{}) []map[string]interface{} {
+	ret := []map[string]interface{}{}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		ret = append(ret, t)
+	case []interface{}:
+		for _, e := range t {
+			if m, ok := e.(map[string]interface{}); ok {
+				ret = append(ret, m)
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,176 @@
+package es_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+)
+
+// Responses recorded from Elasticsearch 7.10, looked up by method, path and query.
+var typelessRecordedResponses = map[string]string{
+	"PUT /prod_results_en_1": `{"acknowledged":true,"shards_acknowledged":true,"index":"prod_results_en_1"}`,
+	"POST /_bulk": `{"took":30,"errors":false,"items":[` +
+		`{"index":{"_index":"prod_results_en_1","_type":"_doc","_id":"u1","_version":1,"result":"created","_shards":{"total":2,"successful":1,"failed":0},"_seq_no":0,"_primary_term":1,"status":201}},` +
+		`{"delete":{"_index":"prod_results_en_1","_type":"_doc","_id":"u2","_version":2,"result":"deleted","_shards":{"total":2,"successful":1,"failed":0},"_seq_no":1,"_primary_term":1,"status":200}}]}`,
+	"GET /prod_results_en_1/_doc/u1": `{"_index":"prod_results_en_1","_type":"_doc","_id":"u1","_version":1,"_seq_no":0,"_primary_term":1,"found":true,"_source":{"mdb_uid":"u1","title":"Inner light"}}`,
+	"POST /prod_results_en/_search?rest_total_hits_as_int=true": `{"took":2,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},` +
+		`"hits":{"total":1,"max_score":0.2876821,"hits":[{"_index":"prod_results_en_1","_type":"_doc","_id":"u1","_score":0.2876821,"_source":{"mdb_uid":"u1","title":"Inner light"}}]}}`,
+	// OpenSearch, hits with no type.
+	"POST /prod_results_he/_search?rest_total_hits_as_int=true": `{"took":2,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},` +
+		`"hits":{"total":1,"max_score":null,"hits":[{"_index":"prod_results_he_1","_id":"u3","_score":null,"_source":{"mdb_uid":"u3"},"sort":[1617235200000123456,"u3"],` +
+		`"inner_hits":{"units":{"hits":{"total":1,"max_score":1.0,"hits":[{"_index":"prod_results_he_1","_id":"u4","_score":1.0,"_source":{"mdb_uid":"u4"}}]}}}}]}}`,
+	"POST /prod_grammars_he/_search?rest_total_hits_as_int=true": `{"took":2,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},` +
+		`"hits":{"total":1,"max_score":1.0,"hits":[{"_index":"prod_grammars_he_1","_type":"_doc","_id":"g1","_score":1.0,"_source":{"intent":"by_content_type"}}]}}`,
+	"GET /_msearch?rest_total_hits_as_int=true": `{"took":3,"responses":[` +
+		`{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},"hits":{"total":0,"max_score":null,"hits":[]},"status":200},` +
+		`{"error":{"root_cause":[{"type":"index_not_found_exception","reason":"no such index [prod_grammars_en]","index":"prod_grammars_en"}],"type":"index_not_found_exception","reason":"no such index [prod_grammars_en]","index":"prod_grammars_en"},"status":404}]}`,
+}
+
+type typelessRequest struct {
+	key  string
+	body string
+}
+
+type TypelessBackendSuite struct {
+	suite.Suite
+	server   *httptest.Server
+	requests []typelessRequest
+	backend  es.Backend
+	esc      *elastic.Client
+	ctx      context.Context
+}
+
+func TestTypelessBackend(t *testing.T) {
+	suite.Run(t, new(TypelessBackendSuite))
+}
+
+func (suite *TypelessBackendSuite) SetupTest() {
+	r := suite.Require()
+	suite.requests = nil
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		key := fmt.Sprintf("%s %s", r.Method, r.URL.Path)
+		if r.URL.RawQuery != "" {
+			key += fmt.Sprintf("?%s", r.URL.RawQuery)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		suite.requests = append(suite.requests, typelessRequest{key: key, body: string(body)})
+		w.Header().Set("Content-Type", "application/json")
+		if val, ok := typelessRecordedResponses[key]; ok {
+			io.WriteString(w, val)
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, fmt.Sprintf(`{"error":{"type":"illegal_argument_exception","reason":"not recorded: %s"},"status":400}`, key))
+		}
+	}
+	suite.server = httptest.NewServer(http.HandlerFunc(handler))
+	var err error
+	suite.backend, err = es.MakeBackend(consts.ES_BACKEND_ELASTICSEARCH7, suite.server.URL)
+	r.Nil(err)
+	suite.esc, err = suite.backend.NewClient(elastic.SetHealthcheck(false))
+	r.Nil(err)
+	suite.ctx = context.Background()
+}
+
+func (suite *TypelessBackendSuite) TearDownTest() {
+	suite.esc.Stop()
+	suite.backend.Stop()
+	suite.server.Close()
+}
+
+func (suite *TypelessBackendSuite) lastRequest() typelessRequest {
+	suite.Require().NotEmpty(suite.requests)
+	return suite.requests[len(suite.requests)-1]
+}
+
+func (suite *TypelessBackendSuite) TestCreateIndex() {
+	r := suite.Require()
+	mappings, err := ioutil.ReadFile("../data/es/mappings/results/results-en.json")
+	r.Nil(err)
+	res, err := suite.esc.CreateIndex("prod_results_en_1").Body(string(mappings)).Do(suite.ctx)
+	r.Nil(err)
+	r.True(res.Acknowledged)
+
+	var body map[string]map[string]interface{}
+	r.Nil(json.Unmarshal([]byte(suite.lastRequest().body), &body))
+	r.Contains(body["mappings"], "properties")
+	r.NotContains(body["mappings"], "result")
+	r.Contains(body, "settings")
+}
+
+func (suite *TypelessBackendSuite) TestBulkAndGet() {
+	r := suite.Require()
+	res, err := suite.esc.Bulk().
+		Add(elastic.NewBulkIndexRequest().Index("prod_results_en_1").Type("result").Id("u1").Doc(map[string]string{"mdb_uid": "u1"})).
+		Add(elastic.NewBulkDeleteRequest().Index("prod_results_en_1").Type("result").Id("u2")).
+		Do(suite.ctx)
+	r.Nil(err)
+	r.False(res.Errors)
+	r.Len(res.Indexed(), 1)
+	r.Len(res.Deleted(), 1)
+	lines := strings.Split(strings.TrimSpace(suite.lastRequest().body), "\n")
+	r.Equal([]string{
+		`{"index":{"_id":"u1","_index":"prod_results_en_1"}}`,
+		`{"mdb_uid":"u1"}`,
+		`{"delete":{"_id":"u2","_index":"prod_results_en_1"}}`,
+	}, lines)
+
+	doc, err := suite.esc.Get().Index("prod_results_en_1").Type("result").Id("u1").Do(suite.ctx)
+	r.Nil(err)
+	r.True(doc.Found)
+	r.Equal("GET /prod_results_en_1/_doc/u1", suite.lastRequest().key)
+}
+
+func (suite *TypelessBackendSuite) TestSearch() {
+	r := suite.Require()
+	res, err := suite.esc.Search("prod_results_en").Query(elastic.NewMatchQuery("title", "inner light")).Do(suite.ctx)
+	r.Nil(err)
+	r.Equal(int64(1), res.Hits.TotalHits)
+	r.Equal("u1", res.Hits.Hits[0].Id)
+	r.Equal(consts.ES_RESULTS_DOC_TYPE, res.Hits.Hits[0].Type)
+}
+
+func (suite *TypelessBackendSuite) TestTypedHits() {
+	r := suite.Require()
+	res, err := suite.esc.Search("prod_results_he").Query(elastic.NewMatchAllQuery()).Do(suite.ctx)
+	r.Nil(err)
+	hit := res.Hits.Hits[0]
+	r.Equal(consts.ES_RESULTS_DOC_TYPE, hit.Type)
+	r.Equal(consts.ES_RESULTS_DOC_TYPE, hit.InnerHits["units"].Hits.Hits[0].Type)
+	r.Equal("u3", hit.Id)
+
+	res, err = suite.esc.Search("prod_grammars_he").Query(elastic.NewMatchAllQuery()).Do(suite.ctx)
+	r.Nil(err)
+	r.Equal(consts.ES_GRAMMARS_DOC_TYPE, res.Hits.Hits[0].Type)
+	r.Equal("g1", res.Hits.Hits[0].Id)
+}
+
+func (suite *TypelessBackendSuite) TestMultiSearch() {
+	r := suite.Require()
+	mlt := elastic.NewMoreLikeThisQuery().
+		LikeItems(elastic.NewMoreLikeThisQueryItem().Index("prod_results_en").Type("result").Id("u1"))
+	res, err := suite.esc.MultiSearch().Add(
+		elastic.NewSearchRequest().Index("prod_results_en").Type("result").SearchSource(elastic.NewSearchSource().Query(mlt)),
+		elastic.NewSearchRequest().Index("prod_grammars_en"),
+	).Do(suite.ctx)
+	r.Nil(err)
+	r.Len(res.Responses, 2)
+	r.Equal(int64(0), res.Responses[0].Hits.TotalHits)
+	r.Equal("index_not_found_exception", res.Responses[1].Error.Type)
+
+	body := suite.lastRequest().body
+	r.NotContains(body, `"type"`)
+	r.NotContains(body, `"_type"`)
+	r.Contains(body, `"like":[{"_id":"u1","_index":"prod_results_en"}]`)
+}
@@ -24,10 +24,12 @@ LOG_FILE_HE="${LOGS_DIR}/eval_he_${TIMESTAMP}.log"
 LOG_FILE_RU="${LOGS_DIR}/eval_ru_${TIMESTAMP}.log"
 LOG_FILE_EN="${LOGS_DIR}/eval_en_${TIMESTAMP}.log"
 LOG_FILE_HTML="${LOGS_DIR}/eval_html_${TIMESTAMP}.log"
+LOG_FILE_GATE="${LOGS_DIR}/eval_gate_${TIMESTAMP}.log"
 REPORT_FILE_HE="${LOGS_DIR}/eval_he_${TIMESTAMP}.flat.report"
 REPORT_FILE_RU="${LOGS_DIR}/eval_ru_${TIMESTAMP}.flat.report"
 REPORT_FILE_EN="${LOGS_DIR}/eval_en_${TIMESTAMP}.flat.report"
 HTML_FILE="${LOGS_DIR}/eval_report_${TIMESTAMP}.html"
+GATE_FILE="${LOGS_DIR}/eval_gate_${TIMESTAMP}.json"
 GOLDEN_REPORT_FILE_HE="$(ls ${GOLDEN_DIR}/eval_he_*.flat.report)"
 GOLDEN_REPORT_FILE_RU="$(ls ${GOLDEN_DIR}/eval_ru_*.flat.report)"
 GOLDEN_REPORT_FILE_EN="$(ls ${GOLDEN_DIR}/eval_en_*.flat.report)"
@@ -67,6 +69,12 @@ if [ $? -ne 0 ]; then
     mail -s "Daily Eval: Error." -r "mdb@bbdomain.org" -a ${LOG_FILE_HTML} kolmanv@gmail.com
 fi
 
+# Regressions vs golden beyond tolerance.
+./archive-backend eval gate --flat_reports=${REPORT_FILE_HE},${REPORT_FILE_EN},${REPORT_FILE_RU} --golden_dir=${GOLDEN_DIR} --output=${GATE_FILE} >> ${LOG_FILE_GATE} 2>&1
+if [ $? -ne 0 ]; then
+    mail -s "Daily Eval: Gate failed." -r "mdb@bbdomain.org" -a ${GATE_FILE} -a ${LOG_FILE_GATE} kolmanv@gmail.com
+fi
+
 # Cleanup old logs and reports (older then week).
 find ${LOGS_DIR} -name "*" -type f -mtime +7 -exec rm -f {} \;
 
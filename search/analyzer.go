@@ -0,0 +1,611 @@
+package search
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+)
+
+// In process implementation of analyzers of our mappings (see es/mappings/make.py), used instead of
+// Elastic _analyze API to tokenize phrases for grammars. Only the main languages are supported:
+//
+//	english_synonym: standard, english_possessive_stemmer, lowercase, english_stop, english_stemmer, synonym_graph
+//	hebrew_synonym:  quotes, standard, synonym_graph, he_IL
+//	russian_synonym: standard, lowercase, russian_stop, russian_stemmer, synonym_graph
+//	spanish_synonym: standard, lowercase, spanish_stop, spanish_stemmer, synonym_graph
+//
+// he_IL hunspell is limited to prefix stripping with words of the .dic files in search/hunspell
+// and elasticsearch.hunspell-folder (e.g., he_IL folder of Elastic config).
+type LocalAnalyzer struct {
+	Language string
+
+	charFilter func(string) (string, []int)
+	filters    []tokenFilter
+	synonyms   *synonymGraph
+	// Filters after synonyms.
+	postFilters []tokenFilter
+}
+
+// Token in analysis chain, position is relative to the previous token as in Lucene.
+type analyzedToken struct {
+	Term   string
+	Start  int
+	End    int
+	Type   string
+	PosInc int
+	PosLen int
+}
+
+type tokenFilter func([]analyzedToken) []analyzedToken
+
+const (
+	TOKEN_TYPE_ALPHANUM   = "<ALPHANUM>"
+	TOKEN_TYPE_NUM        = "<NUM>"
+	TOKEN_TYPE_IDEOGRAPIC = "<IDEOGRAPHIC>"
+	TOKEN_TYPE_SYNONYM    = "SYNONYM"
+)
+
+var localAnalyzers = map[string]*LocalAnalyzer{}
+var localAnalyzersMutex sync.Mutex
+
+// Local analyzer of the language, nil if language is not supported.
+// Error is returned once, afterwards the language is not supported (analyzed with Elastic).
+func GetLocalAnalyzer(lang string) (*LocalAnalyzer, error) {
+	localAnalyzersMutex.Lock()
+	defer localAnalyzersMutex.Unlock()
+	if analyzer, ok := localAnalyzers[lang]; ok {
+		return analyzer, nil
+	}
+	analyzer, err := makeLocalAnalyzer(lang, es.DataFolder("es", "synonyms"), hunspellFolders())
+	localAnalyzers[lang] = analyzer
+	if err != nil {
+		return nil, err
+	}
+	return analyzer, nil
+}
+
+// Folders of he_IL dictionary files: .delta.dic files of the repo (relative to working directory,
+// as ./search/eval.html) and optional he_IL dictionary, relative to data-folder unless absolute.
+func hunspellFolders() []string {
+	folders := []string{filepath.Join("search", "hunspell")}
+	if folder := viper.GetString("elasticsearch.hunspell-folder"); folder != "" {
+		if !filepath.IsAbs(folder) {
+			folder = es.DataFolder(folder)
+		}
+		folders = append(folders, folder)
+	}
+	return folders
+}
+
+func makeLocalAnalyzer(lang string, synonymsFolder string, hunspellFolders []string) (*LocalAnalyzer, error) {
+	analyzer := &LocalAnalyzer{Language: lang}
+	switch lang {
+	case consts.LANG_ENGLISH:
+		analyzer.filters = []tokenFilter{
+			possessiveEnglishFilter,
+			lowercaseFilter,
+			stopFilter(englishStopWords),
+			stemFilter(porterStem),
+		}
+	case consts.LANG_HEBREW:
+		analyzer.charFilter = hebrewQuotesCharFilter
+		dictionary, err := loadHunspellWords(hunspellFolders)
+		if err != nil {
+			return nil, err
+		}
+		analyzer.postFilters = []tokenFilter{hebrewPrefixFilter(dictionary)}
+	case consts.LANG_RUSSIAN:
+		analyzer.filters = []tokenFilter{
+			lowercaseFilter,
+			stopFilter(russianStopWords),
+			stemFilter(russianStem),
+		}
+	case consts.LANG_SPANISH:
+		analyzer.filters = []tokenFilter{
+			lowercaseFilter,
+			stopFilter(spanishStopWords),
+			stemFilter(spanishLightStem),
+		}
+	default:
+		return nil, nil
+	}
+	synonyms, err := loadSynonymGraph(filepath.Join(synonymsFolder, fmt.Sprintf("%s.txt", lang)), analyzer)
+	if err != nil {
+		return nil, err
+	}
+	analyzer.synonyms = synonyms
+	return analyzer, nil
+}
+
+// Tokens as returned by Elastic _analyze API. Offsets are in runes of text.
+func (a *LocalAnalyzer) Analyze(text string) []Token {
+	tokens := a.analyze(text, true)
+	ret := make([]Token, 0, len(tokens))
+	position := -1
+	for _, t := range tokens {
+		position += t.PosInc
+		ret = append(ret, Token{
+			Token:          t.Term,
+			StartOffset:    t.Start,
+			EndOffset:      t.End,
+			Type:           t.Type,
+			Position:       position,
+			PositionLength: t.PosLen,
+		})
+	}
+	return ret
+}
+
+// Terms of text without synonyms, e.g., to match synonym rules.
+func (a *LocalAnalyzer) terms(text string) []string {
+	ret := []string(nil)
+	for _, t := range a.analyze(text, false) {
+		ret = append(ret, t.Term)
+	}
+	return ret
+}
+
+func (a *LocalAnalyzer) analyze(text string, withSynonyms bool) []analyzedToken {
+	offsets := []int(nil)
+	if a.charFilter != nil {
+		text, offsets = a.charFilter(text)
+	}
+	tokens := standardTokenize(text)
+	if offsets != nil {
+		for i := range tokens {
+			tokens[i].Start = offsets[tokens[i].Start]
+			tokens[i].End = offsets[tokens[i].End]
+		}
+	}
+	for _, filter := range a.filters {
+		tokens = filter(tokens)
+	}
+	if !withSynonyms {
+		return tokens
+	}
+	if a.synonyms != nil {
+		tokens = a.synonyms.apply(tokens)
+	}
+	for _, filter := range a.postFilters {
+		tokens = filter(tokens)
+	}
+	return tokens
+}
+
+// Approximation of Lucene StandardTokenizer (Unicode text segmentation, UAX#29) for
+// alphabetic scripts: letters, digits and marks with inner apostrophes, colons, dots
+// (and commas between digits) form a word, ideographs are single tokens.
+func standardTokenize(text string) []analyzedToken {
+	runes := []rune(text)
+	tokens := []analyzedToken(nil)
+	isWord := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Mc, r) || r == '_'
+	}
+	isHebrew := func(r rune) bool {
+		return unicode.Is(unicode.Hebrew, r) && unicode.IsLetter(r)
+	}
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		if unicode.Is(unicode.Han, r) {
+			tokens = append(tokens, analyzedToken{Term: string(r), Start: i, End: i + 1, Type: TOKEN_TYPE_IDEOGRAPIC, PosInc: 1, PosLen: 1})
+			i++
+			continue
+		}
+		if !isWord(r) || r == '_' {
+			i++
+			continue
+		}
+		start := i
+		for i < len(runes) {
+			if isWord(runes[i]) && !unicode.Is(unicode.Han, runes[i]) {
+				i++
+				continue
+			}
+			if i+1 < len(runes) && isWord(runes[i+1]) && !unicode.Is(unicode.Han, runes[i+1]) {
+				prev, next := runes[i-1], runes[i+1]
+				switch runes[i] {
+				case '\'', '’', ':', '·':
+					// MidLetter.
+					if unicode.IsLetter(prev) && unicode.IsLetter(next) {
+						i++
+						continue
+					}
+				case '.':
+					// MidNumLet.
+					if (unicode.IsLetter(prev) && unicode.IsLetter(next)) || (unicode.IsDigit(prev) && unicode.IsDigit(next)) {
+						i++
+						continue
+					}
+				case ',', ';':
+					// MidNum.
+					if unicode.IsDigit(prev) && unicode.IsDigit(next) {
+						i++
+						continue
+					}
+				case '"':
+					// Hebrew acronyms, e.g., רמב"ם.
+					if isHebrew(prev) && isHebrew(next) {
+						i++
+						continue
+					}
+				}
+			}
+			// Hebrew letter followed by apostrophe, e.g., צ'ק.
+			if runes[i] == '\'' && isHebrew(runes[i-1]) {
+				i++
+			}
+			break
+		}
+		term := string(runes[start:i])
+		tokenType := TOKEN_TYPE_NUM
+		for _, c := range term {
+			if unicode.IsLetter(c) {
+				tokenType = TOKEN_TYPE_ALPHANUM
+				break
+			}
+		}
+		tokens = append(tokens, analyzedToken{Term: term, Start: start, End: i, Type: tokenType, PosInc: 1, PosLen: 1})
+	}
+	return tokens
+}
+
+// Mapping char filter "quotes" of Hebrew analyzers. Returns filtered text and offsets of
+// filtered text runes (and end) in the original text.
+func hebrewQuotesCharFilter(text string) (string, []int) {
+	doubles := map[rune]bool{'\'': true, '\u0091': true, '\u0092': true, '‘': true, '’': true, '‛': true, '׳': true, '֜': true, '֝': true}
+	runes := []rune(text)
+	ret := []rune(nil)
+	offsets := []int(nil)
+	for i := 0; i < len(runes); i++ {
+		if doubles[runes[i]] && i+1 < len(runes) && runes[i+1] == runes[i] {
+			ret = append(ret, ')')
+			offsets = append(offsets, i)
+			i++
+		} else if doubles[runes[i]] {
+			ret = append(ret, '\'')
+			offsets = append(offsets, i)
+		} else {
+			ret = append(ret, runes[i])
+			offsets = append(offsets, i)
+		}
+	}
+	offsets = append(offsets, len(runes))
+	return string(ret), offsets
+}
+
+func lowercaseFilter(tokens []analyzedToken) []analyzedToken {
+	for i := range tokens {
+		tokens[i].Term = strings.ToLower(tokens[i].Term)
+	}
+	return tokens
+}
+
+// Removes trailing 's of english possessive.
+func possessiveEnglishFilter(tokens []analyzedToken) []analyzedToken {
+	for i := range tokens {
+		runes := []rune(tokens[i].Term)
+		if len(runes) >= 2 && (runes[len(runes)-1] == 's' || runes[len(runes)-1] == 'S') &&
+			(runes[len(runes)-2] == '\'' || runes[len(runes)-2] == '’' || runes[len(runes)-2] == '＇') {
+			tokens[i].Term = string(runes[:len(runes)-2])
+		}
+	}
+	return tokens
+}
+
+// Removes stop words, positions of removed words are kept as gaps.
+func stopFilter(stopWords map[string]bool) tokenFilter {
+	return func(tokens []analyzedToken) []analyzedToken {
+		ret := []analyzedToken(nil)
+		skipped := 0
+		for _, t := range tokens {
+			if stopWords[t.Term] {
+				skipped += t.PosInc
+				continue
+			}
+			t.PosInc += skipped
+			skipped = 0
+			ret = append(ret, t)
+		}
+		return ret
+	}
+}
+
+func stemFilter(stem func(string) string) tokenFilter {
+	return func(tokens []analyzedToken) []analyzedToken {
+		for i := range tokens {
+			tokens[i].Term = stem(tokens[i].Term)
+		}
+		return tokens
+	}
+}
+
+// Hebrew prefixes (conjunctions, prepositions and definite article) stripped by he_IL hunspell affixes.
+var hebrewPrefixes = []string{
+	"וכשה", "ולכש", "וכשב", "וכשל", "וכשמ", "ושה", "ושב", "ושל", "ושמ", "ושכ", "וכש", "ומה", "ובה", "ולה", "וכה",
+	"כשה", "לכש", "שבה", "שלה", "שמה", "שכה", "וה", "וב", "ול", "ומ", "וש", "וכ", "שה", "שב", "של", "שמ", "שכ",
+	"כש", "מה", "בה", "לה", "כה", "ו", "ה", "ב", "ל", "מ", "ש", "כ",
+}
+
+// Stems of Hebrew words by prefix stripping: words of the dictionary without prefixes,
+// words not in dictionary are kept as is, as hunspell does.
+func hebrewPrefixFilter(dictionary map[string]bool) tokenFilter {
+	return func(tokens []analyzedToken) []analyzedToken {
+		ret := []analyzedToken(nil)
+		for _, t := range tokens {
+			stems := []string(nil)
+			if dictionary[t.Term] {
+				stems = append(stems, t.Term)
+			}
+			for _, prefix := range hebrewPrefixes {
+				stem := strings.TrimPrefix(t.Term, prefix)
+				if stem != t.Term && len([]rune(stem)) >= 2 && dictionary[stem] && !stringsContain(stems, stem) {
+					stems = append(stems, stem)
+				}
+			}
+			if len(stems) == 0 {
+				ret = append(ret, t)
+				continue
+			}
+			for i, stem := range stems {
+				stemToken := t
+				stemToken.Term = stem
+				if i > 0 {
+					stemToken.PosInc = 0
+				}
+				ret = append(ret, stemToken)
+			}
+		}
+		return ret
+	}
+}
+
+func stringsContain(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Words of hunspell .dic files in folders. Files are in ISO-8859-8 encoding as he_IL dictionary,
+// first line is the number of words, each word may be followed by /flags.
+func loadHunspellWords(folders []string) (map[string]bool, error) {
+	words := map[string]bool{}
+	for _, folder := range folders {
+		matches, err := filepath.Glob(filepath.Join(folder, "*.dic"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error listing hunspell dictionaries in %s", folder)
+		}
+		if len(matches) == 0 {
+			return nil, errors.Errorf("No hunspell dictionary in %s", folder)
+		}
+		for _, path := range matches {
+			if err := loadHunspellFile(path, words); err != nil {
+				return nil, err
+			}
+		}
+	}
+	log.Infof("Loaded %d hunspell words.", len(words))
+	return words, nil
+}
+
+func loadHunspellFile(path string, words map[string]bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "Error reading hunspell dictionary: %s", path)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	first := true
+	for scanner.Scan() {
+		line := decodeISO88598(scanner.Bytes())
+		if first {
+			first = false
+			continue
+		}
+		if i := strings.Index(line, "/"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			words[line] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrapf(err, "Error reading hunspell dictionary: %s", path)
+	}
+	return nil
+}
+
+// Hebrew letters are 0xE0-0xFA in ISO-8859-8, ASCII is kept.
+func decodeISO88598(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if c >= 0xE0 && c <= 0xFA {
+			sb.WriteRune(rune(0x05D0 + int(c) - 0xE0))
+		} else {
+			sb.WriteRune(rune(c))
+		}
+	}
+	return sb.String()
+}
+
+// Equivalent synonyms rules as set for synonym_graph filter (see es.UpdateSynonyms).
+// Rules are matched on analyzed terms, matched terms are kept and all other phrases of the rule are added as graph.
+type synonymGraph struct {
+	// Rules by first term of input.
+	rules map[string][]synonymRule
+}
+
+type synonymRule struct {
+	input   []string
+	outputs [][]string
+}
+
+func loadSynonymGraph(path string, analyzer *LocalAnalyzer) (*synonymGraph, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Unable to open synonyms file: %s.", path)
+	}
+	defer file.Close()
+	graph := &synonymGraph{rules: map[string][]synonymRule{}}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		trimmed := strings.TrimSpace(scanner.Text())
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		phrases := [][]string(nil)
+		for _, phrase := range strings.FieldsFunc(trimmed, func(r rune) bool { return r == '\t' || r == ',' }) {
+			if terms := analyzer.terms(phrase); len(terms) > 0 {
+				phrases = append(phrases, terms)
+			}
+		}
+		// Each phrase is expanded to all other phrases.
+		for i := range phrases {
+			rule := synonymRule{input: phrases[i]}
+			for j := range phrases {
+				if !termsEqual(phrases[i], phrases[j]) && !termsIn(rule.outputs, phrases[j]) {
+					rule.outputs = append(rule.outputs, phrases[j])
+				}
+			}
+			if len(rule.outputs) > 0 {
+				graph.rules[rule.input[0]] = append(graph.rules[rule.input[0]], rule)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "Error at scanning synonym config file: %s.", path)
+	}
+	return graph, nil
+}
+
+func termsEqual(a []string, b []string) bool {
+	return strings.Join(a, " ") == strings.Join(b, " ")
+}
+
+func termsIn(phrases [][]string, terms []string) bool {
+	for _, phrase := range phrases {
+		if termsEqual(phrase, terms) {
+			return true
+		}
+	}
+	return false
+}
+
+// Longest rules input matching tokens from i: matched length and outputs of all such rules, in rules order.
+func (g *synonymGraph) match(tokens []analyzedToken, i int) (int, [][]string) {
+	length := 0
+	outputs := [][]string(nil)
+	for _, rule := range g.rules[tokens[i].Term] {
+		if i+len(rule.input) > len(tokens) || len(rule.input) < length {
+			continue
+		}
+		matched := true
+		for j := range rule.input {
+			matched = matched && tokens[i+j].Term == rule.input[j]
+		}
+		if !matched {
+			continue
+		}
+		if len(rule.input) > length {
+			length = len(rule.input)
+			outputs = nil
+		}
+		for _, output := range rule.outputs {
+			if !termsIn(outputs, output) {
+				outputs = append(outputs, output)
+			}
+		}
+	}
+	return length, outputs
+}
+
+// Adds synonyms graph as Lucene SynonymGraphFilter: outputs and then matched tokens are paths from
+// the match start node to a common end node, each path with its own intermediate nodes.
+// Tokens are ordered by start node.
+func (g *synonymGraph) apply(tokens []analyzedToken) []analyzedToken {
+	type positioned struct {
+		token    analyzedToken
+		position int
+	}
+	out := []positioned(nil)
+	position := -1 // Input position.
+	shift := 0     // Output position minus input position.
+	for i := 0; i < len(tokens); {
+		position += tokens[i].PosInc
+		length, outputs := g.match(tokens, i)
+		if length == 0 {
+			out = append(out, positioned{tokens[i], position + shift})
+			i++
+			continue
+		}
+		matched := []analyzedToken(nil)
+		lastPosition := position
+		for j := i; j < i+length; j++ {
+			if j > i {
+				lastPosition += tokens[j].PosInc
+			}
+			matched = append(matched, tokens[j])
+		}
+		start, end := matched[0].Start, matched[len(matched)-1].End
+		paths := [][]analyzedToken(nil)
+		for _, output := range outputs {
+			path := []analyzedToken(nil)
+			for _, term := range output {
+				path = append(path, analyzedToken{Term: term, Start: start, End: end, Type: TOKEN_TYPE_SYNONYM})
+			}
+			paths = append(paths, path)
+		}
+		paths = append(paths, matched)
+		inner := 0
+		for _, path := range paths {
+			inner += len(path) - 1
+		}
+		startNode := position + shift
+		endNode := startNode + inner + 1
+		nextNode := startNode + 1
+		graph := []positioned(nil)
+		for _, path := range paths {
+			node := startNode
+			for j, t := range path {
+				to := endNode
+				if j < len(path)-1 {
+					to = nextNode
+					nextNode++
+				}
+				t.PosLen = to - node
+				graph = append(graph, positioned{t, node})
+				node = to
+			}
+		}
+		sort.SliceStable(graph, func(a, b int) bool { return graph[a].position < graph[b].position })
+		out = append(out, graph...)
+		shift = endNode - lastPosition - 1
+		position = lastPosition
+		i += length
+	}
+	ret := []analyzedToken(nil)
+	last := -1
+	for _, p := range out {
+		p.token.PosInc = p.position - last
+		last = p.position
+		ret = append(ret, p.token)
+	}
+	return ret
+}
@@ -0,0 +1,470 @@
+package search
+
+import (
+	"strings"
+)
+
+// Stop words and stemmers of local analyzers, see LocalAnalyzer. Stop words are the default
+// sets of Elastic (_english_, _russian_, _spanish_), stemmers are ports of Lucene stemmers:
+// english (PorterStemmer), russian (Snowball RussianStemmer) and light_spanish (SpanishLightStemmer).
+
+func makeStopWords(words string) map[string]bool {
+	ret := map[string]bool{}
+	for _, word := range strings.Fields(words) {
+		ret[word] = true
+	}
+	return ret
+}
+
+var englishStopWords = makeStopWords(`a an and are as at be but by for if in into is it no not of on or such
+	that the their then there these they this to was will with`)
+
+var russianStopWords = makeStopWords(`и в во не что он на я с со как а то все она так его но да ты к у же вы за бы
+	по только ее мне было вот от меня еще нет о из ему теперь когда даже ну вдруг ли если уже или ни быть был
+	него до вас нибудь опять уж вам ведь там потом себя ничего ей может они тут где есть надо ней для мы тебя
+	их чем была сам чтоб без будто чего раз тоже себе под будет ж тогда кто этот того потому этого какой
+	совсем ним здесь этом один почти мой тем чтобы нее сейчас были куда зачем всех никогда можно при наконец
+	два об другой хоть после над больше тот через эти нас про всего них какая много разве три эту моя
+	впрочем хорошо свою этой перед иногда лучше чуть том нельзя такой им более всегда конечно всю между`)
+
+var spanishStopWords = makeStopWords(`de la que el en y a los del se las por un para con no una su al lo como más
+	pero sus le ya o este sí porque esta entre cuando muy sin sobre también me hasta hay donde quien desde
+	todo nos durante todos uno les ni contra otros ese eso ante ellos e esto mí antes algunos qué unos yo otro
+	otras otra él tanto esa estos mucho quienes nada muchos cual poco ella estar estas algunas algo nosotros
+	mi mis tú te ti tu tus ellas nosotras vosotros vosotras os mío mía míos mías tuyo tuya tuyos tuyas suyo
+	suya suyos suyas nuestro nuestra nuestros nuestras vuestro vuestra vuestros vuestras esos esas estoy
+	estás está estamos estáis están esté estés estemos estéis estén estaré estarás estará estaremos estaréis
+	estarán estaría estarías estaríamos estaríais estarían estaba estabas estábamos estabais estaban estuve
+	estuviste estuvo estuvimos estuvisteis estuvieron estuviera estuvieras estuviéramos estuvierais
+	estuvieran estuviese estuvieses estuviésemos estuvieseis estuviesen estando estado estada estados
+	estadas estad he has ha hemos habéis han haya hayas hayamos hayáis hayan habré habrás habrá habremos
+	habréis habrán habría habrías habríamos habríais habrían había habías habíamos habíais habían hube
+	hubiste hubo hubimos hubisteis hubieron hubiera hubieras hubiéramos hubierais hubieran hubiese hubieses
+	hubiésemos hubieseis hubiesen habiendo habido habida habidos habidas soy eres es somos sois son sea seas
+	seamos seáis sean seré serás será seremos seréis serán sería serías seríamos seríais serían era eras
+	éramos erais eran fui fuiste fue fuimos fuisteis fueron fuera fueras fuéramos fuerais fueran fuese
+	fueses fuésemos fueseis fuesen sintiendo sentido sentida sentidos sentidas siente sentid tengo tienes
+	tiene tenemos tenéis tienen tenga tengas tengamos tengáis tengan tendré tendrás tendrá tendremos
+	tendréis tendrán tendría tendrías tendríamos tendríais tendrían tenía tenías teníamos teníais tenían
+	tuve tuviste tuvo tuvimos tuvisteis tuvieron tuviera tuvieras tuviéramos tuvierais tuvieran tuviese
+	tuvieses tuviésemos tuvieseis tuviesen teniendo tenido tenida tenidos tenidas tened`)
+
+// Porter stemmer state, see https://tartarus.org/martin/PorterStemmer/
+type porterStemmer struct {
+	b []rune
+	k int
+	j int
+}
+
+func (p *porterStemmer) cons(i int) bool {
+	switch p.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !p.cons(i-1)
+	}
+	return true
+}
+
+// Number of consonant sequences between 0 and j.
+func (p *porterStemmer) m() int {
+	n := 0
+	i := 0
+	for {
+		if i > p.j {
+			return n
+		}
+		if !p.cons(i) {
+			break
+		}
+		i++
+	}
+	i++
+	for {
+		for {
+			if i > p.j {
+				return n
+			}
+			if p.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+		n++
+		for {
+			if i > p.j {
+				return n
+			}
+			if !p.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+	}
+}
+
+func (p *porterStemmer) vowelInStem() bool {
+	for i := 0; i <= p.j; i++ {
+		if !p.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *porterStemmer) doublec(j int) bool {
+	return j >= 1 && p.b[j] == p.b[j-1] && p.cons(j)
+}
+
+func (p *porterStemmer) cvc(i int) bool {
+	if i < 2 || !p.cons(i) || p.cons(i-1) || !p.cons(i-2) {
+		return false
+	}
+	ch := p.b[i]
+	return ch != 'w' && ch != 'x' && ch != 'y'
+}
+
+func (p *porterStemmer) ends(s string) bool {
+	suffix := []rune(s)
+	l := len(suffix)
+	o := p.k - l + 1
+	if o < 0 {
+		return false
+	}
+	for i := 0; i < l; i++ {
+		if p.b[o+i] != suffix[i] {
+			return false
+		}
+	}
+	p.j = p.k - l
+	return true
+}
+
+func (p *porterStemmer) setTo(s string) {
+	p.b = append(p.b[:p.j+1], []rune(s)...)
+	p.k = p.j + len([]rune(s))
+}
+
+func (p *porterStemmer) r(s string) {
+	if p.m() > 0 {
+		p.setTo(s)
+	}
+}
+
+// Plurals and -ed or -ing.
+func (p *porterStemmer) step1() {
+	if p.b[p.k] == 's' {
+		if p.ends("sses") {
+			p.k -= 2
+		} else if p.ends("ies") {
+			p.setTo("i")
+		} else if p.b[p.k-1] != 's' {
+			p.k--
+		}
+	}
+	if p.ends("eed") {
+		if p.m() > 0 {
+			p.k--
+		}
+	} else if (p.ends("ed") || p.ends("ing")) && p.vowelInStem() {
+		p.k = p.j
+		if p.ends("at") {
+			p.setTo("ate")
+		} else if p.ends("bl") {
+			p.setTo("ble")
+		} else if p.ends("iz") {
+			p.setTo("ize")
+		} else if p.doublec(p.k) {
+			p.k--
+			ch := p.b[p.k]
+			if ch == 'l' || ch == 's' || ch == 'z' {
+				p.k++
+			}
+		} else if p.m() == 1 && p.cvc(p.k) {
+			p.setTo("e")
+		}
+	}
+}
+
+// Terminal y to i when there is another vowel in the stem.
+func (p *porterStemmer) step2() {
+	if p.ends("y") && p.vowelInStem() {
+		p.b[p.k] = 'i'
+	}
+}
+
+// Replaces first matching suffix by its replacement with condition m() > 0.
+func (p *porterStemmer) replaceFirst(pairs ...string) {
+	for i := 0; i < len(pairs); i += 2 {
+		if p.ends(pairs[i]) {
+			p.r(pairs[i+1])
+			return
+		}
+	}
+}
+
+// Double suffixes to single ones.
+func (p *porterStemmer) step3() {
+	if p.k == 0 {
+		return
+	}
+	switch p.b[p.k-1] {
+	case 'a':
+		p.replaceFirst("ational", "ate", "tional", "tion")
+	case 'c':
+		p.replaceFirst("enci", "ence", "anci", "ance")
+	case 'e':
+		p.replaceFirst("izer", "ize")
+	case 'l':
+		p.replaceFirst("bli", "ble", "alli", "al", "entli", "ent", "eli", "e", "ousli", "ous")
+	case 'o':
+		p.replaceFirst("ization", "ize", "ation", "ate", "ator", "ate")
+	case 's':
+		p.replaceFirst("alism", "al", "iveness", "ive", "fulness", "ful", "ousness", "ous")
+	case 't':
+		p.replaceFirst("aliti", "al", "iviti", "ive", "biliti", "ble")
+	case 'g':
+		p.replaceFirst("logi", "log")
+	}
+}
+
+// -ic-, -full, -ness etc.
+func (p *porterStemmer) step4() {
+	switch p.b[p.k] {
+	case 'e':
+		p.replaceFirst("icate", "ic", "ative", "", "alize", "al")
+	case 'i':
+		p.replaceFirst("iciti", "ic")
+	case 'l':
+		p.replaceFirst("ical", "ic", "ful", "")
+	case 's':
+		p.replaceFirst("ness", "")
+	}
+}
+
+// Takes off -ant, -ence etc., in context <c>vcvc<v>.
+func (p *porterStemmer) step5() {
+	if p.k == 0 {
+		return
+	}
+	found := false
+	endsAny := func(suffixes ...string) bool {
+		for _, s := range suffixes {
+			if p.ends(s) {
+				return true
+			}
+		}
+		return false
+	}
+	switch p.b[p.k-1] {
+	case 'a':
+		found = endsAny("al")
+	case 'c':
+		found = endsAny("ance", "ence")
+	case 'e':
+		found = endsAny("er")
+	case 'i':
+		found = endsAny("ic")
+	case 'l':
+		found = endsAny("able", "ible")
+	case 'n':
+		found = endsAny("ant", "ement", "ment", "ent")
+	case 'o':
+		if p.ends("ion") && p.j >= 0 && (p.b[p.j] == 's' || p.b[p.j] == 't') {
+			found = true
+		} else {
+			found = endsAny("ou")
+		}
+	case 's':
+		found = endsAny("ism")
+	case 't':
+		found = endsAny("ate", "iti")
+	case 'u':
+		found = endsAny("ous")
+	case 'v':
+		found = endsAny("ive")
+	case 'z':
+		found = endsAny("ize")
+	}
+	if found && p.m() > 1 {
+		p.k = p.j
+	}
+}
+
+// Removes final -e and changes -ll to -l if m() > 1.
+func (p *porterStemmer) step6() {
+	p.j = p.k
+	if p.b[p.k] == 'e' {
+		a := p.m()
+		if a > 1 || a == 1 && !p.cvc(p.k-1) {
+			p.k--
+		}
+	}
+	if p.b[p.k] == 'l' && p.doublec(p.k) && p.m() > 1 {
+		p.k--
+	}
+}
+
+func porterStem(word string) string {
+	p := &porterStemmer{b: []rune(word)}
+	p.k = len(p.b) - 1
+	if p.k <= 1 {
+		return word
+	}
+	p.step1()
+	if p.k > 0 {
+		p.step2()
+		p.step3()
+		p.step4()
+		p.step5()
+		p.step6()
+	}
+	return string(p.b[:p.k+1])
+}
+
+const russianVowels = "аеиоуыэюя"
+
+var (
+	russianGerunds1      = []string{"в", "вши", "вшись"}
+	russianGerunds2      = []string{"ив", "ивши", "ившись", "ыв", "ывши", "ывшись"}
+	russianAdjectives    = []string{"ее", "ие", "ые", "ое", "ими", "ыми", "ей", "ий", "ый", "ой", "ем", "им", "ым", "ом", "его", "ого", "ему", "ому", "их", "ых", "ую", "юю", "ая", "яя", "ою", "ею"}
+	russianParticiples1  = []string{"ем", "нн", "вш", "ющ", "щ"}
+	russianParticiples2  = []string{"ивш", "ывш", "ующ"}
+	russianReflexives    = []string{"ся", "сь"}
+	russianVerbs1        = []string{"ла", "на", "ете", "йте", "ли", "й", "л", "ем", "н", "ло", "но", "ет", "ют", "ны", "ть", "ешь", "нно"}
+	russianVerbs2        = []string{"ила", "ыла", "ена", "ейте", "уйте", "ите", "или", "ыли", "ей", "уй", "ил", "ыл", "им", "ым", "ен", "ило", "ыло", "ено", "ят", "ует", "уют", "ит", "ыт", "ены", "ить", "ыть", "ишь", "ую", "ю"}
+	russianNouns         = []string{"а", "ев", "ов", "ие", "ье", "е", "иями", "ями", "ами", "еи", "ии", "и", "ией", "ей", "ой", "ий", "й", "иям", "ям", "ием", "ем", "ам", "ом", "о", "у", "ах", "иях", "ях", "ы", "ь", "ию", "ью", "ю", "ия", "ья", "я"}
+	russianDerivationals = []string{"ост", "ость"}
+	russianTidyUps       = []string{"ейш", "ейше", "н", "ь"}
+)
+
+// Longest of suffixes (in groups) that word ends with, starting not before limit.
+func longestSuffix(word []rune, limit int, groups ...[]string) (string, int) {
+	longest := ""
+	group := -1
+	for g, suffixes := range groups {
+		for _, suffix := range suffixes {
+			s := []rune(suffix)
+			if len(s) > len([]rune(longest)) && len(word)-len(s) >= limit && string(word[len(word)-len(s):]) == suffix {
+				longest = suffix
+				group = g
+			}
+		}
+	}
+	return longest, group
+}
+
+// Snowball russian stemmer, see https://snowballstem.org/algorithms/russian/stemmer.html
+func russianStem(word string) string {
+	w := []rune(word)
+	isVowel := func(r rune) bool { return strings.ContainsRune(russianVowels, r) }
+	rv := len(w)
+	for i, r := range w {
+		if isVowel(r) {
+			rv = i + 1
+			break
+		}
+	}
+	r1 := len(w)
+	for i := 1; i < len(w); i++ {
+		if !isVowel(w[i]) && isVowel(w[i-1]) {
+			r1 = i + 1
+			break
+		}
+	}
+	r2 := len(w)
+	for i := r1 + 1; i < len(w); i++ {
+		if !isVowel(w[i]) && isVowel(w[i-1]) {
+			r2 = i + 1
+			break
+		}
+	}
+	// Deletes suffix of the first group preceded by а or я, or of the second group.
+	deleteGrouped := func(suffix string, group int) bool {
+		start := len(w) - len([]rune(suffix))
+		if group == 0 && (start-1 < rv || (w[start-1] != 'а' && w[start-1] != 'я')) {
+			return false
+		}
+		w = w[:start]
+		return true
+	}
+
+	// Step 1.
+	if suffix, group := longestSuffix(w, rv, russianGerunds1, russianGerunds2); suffix == "" || !deleteGrouped(suffix, group) {
+		if suffix, _ := longestSuffix(w, rv, russianReflexives); suffix != "" {
+			w = w[:len(w)-len([]rune(suffix))]
+		}
+		if suffix, _ := longestSuffix(w, rv, russianAdjectives); suffix != "" {
+			w = w[:len(w)-len([]rune(suffix))]
+			if suffix, group := longestSuffix(w, rv, russianParticiples1, russianParticiples2); suffix != "" {
+				deleteGrouped(suffix, group)
+			}
+		} else if suffix, group := longestSuffix(w, rv, russianVerbs1, russianVerbs2); suffix == "" || !deleteGrouped(suffix, group) {
+			if suffix, _ := longestSuffix(w, rv, russianNouns); suffix != "" {
+				w = w[:len(w)-len([]rune(suffix))]
+			}
+		}
+	}
+	// Step 2.
+	if len(w) > rv && w[len(w)-1] == 'и' {
+		w = w[:len(w)-1]
+	}
+	// Step 3.
+	if suffix, _ := longestSuffix(w, rv, russianDerivationals); suffix != "" && len(w)-len([]rune(suffix)) >= r2 {
+		w = w[:len(w)-len([]rune(suffix))]
+	}
+	// Step 4.
+	switch suffix, _ := longestSuffix(w, rv, russianTidyUps); suffix {
+	case "ейш", "ейше":
+		w = w[:len(w)-len([]rune(suffix))]
+		if len(w)-2 >= rv && w[len(w)-1] == 'н' && w[len(w)-2] == 'н' {
+			w = w[:len(w)-1]
+		}
+	case "н":
+		if len(w)-2 >= rv && w[len(w)-2] == 'н' {
+			w = w[:len(w)-1]
+		}
+	case "ь":
+		w = w[:len(w)-1]
+	}
+	return string(w)
+}
+
+// Lucene SpanishLightStemmer: removes accents and plural and gender endings of words of 5 letters or more.
+func spanishLightStem(word string) string {
+	s := []rune(word)
+	l := len(s)
+	if l < 5 {
+		return word
+	}
+	for i := range s {
+		switch s[i] {
+		case 'à', 'á', 'â', 'ä':
+			s[i] = 'a'
+		case 'ò', 'ó', 'ô', 'ö':
+			s[i] = 'o'
+		case 'è', 'é', 'ê', 'ë':
+			s[i] = 'e'
+		case 'ù', 'ú', 'û', 'ü':
+			s[i] = 'u'
+		case 'ì', 'í', 'î', 'ï':
+			s[i] = 'i'
+		}
+	}
+	switch s[l-1] {
+	case 'o', 'a', 'e':
+		l--
+	case 's':
+		if s[l-2] == 'e' && s[l-3] == 's' && s[l-4] == 'e' {
+			l -= 2
+		} else if s[l-2] == 'e' && s[l-3] == 'c' {
+			s[l-3] = 'z'
+			l -= 2
+		} else if s[l-2] == 'o' || s[l-2] == 'a' || s[l-2] == 'e' {
+			l -= 2
+		}
+	}
+	return string(s[:l])
+}
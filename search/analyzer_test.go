@@ -0,0 +1,161 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+)
+
+const ANALYZE_FIXTURES = "testdata/analyze.json"
+
+// Records fixtures from Elastic with our mappings and synonyms, e.g.:
+// go test ./search -run TestLocalAnalyzers -analyze-record=http://localhost:9200
+var analyzeRecord = flag.String("analyze-record", "", "Elastic url to record _analyze fixtures from.")
+
+// Hebrew is compared with the .delta.dic files, optionally also with the full he_IL dictionary of Elastic, e.g.:
+// go test ./search -run TestLocalAnalyzers -hunspell-folder=/usr/share/elasticsearch/config/hunspell/he_IL
+var hunspellFolder = flag.String("hunspell-folder", "", "Folder of full he_IL hunspell dictionary.")
+
+// Phrases with _analyze results by language.
+type analyzeFixtures map[string][]struct {
+	Text   string  `json:"text"`
+	Tokens []Token `json:"tokens"`
+}
+
+type LocalAnalyzersSuite struct {
+	suite.Suite
+	fixtures analyzeFixtures
+}
+
+func TestLocalAnalyzers(t *testing.T) {
+	suite.Run(t, new(LocalAnalyzersSuite))
+}
+
+func (suite *LocalAnalyzersSuite) SetupSuite() {
+	r := suite.Require()
+	data, err := ioutil.ReadFile(ANALYZE_FIXTURES)
+	r.Nil(err)
+	r.Nil(json.Unmarshal(data, &suite.fixtures))
+	if *analyzeRecord != "" {
+		suite.record(*analyzeRecord)
+	}
+}
+
+func (suite *LocalAnalyzersSuite) record(esUrl string) {
+	r := suite.Require()
+	esc, err := elastic.NewClient(elastic.SetURL(esUrl), elastic.SetSniff(false))
+	r.Nil(err)
+	for lang, phrases := range suite.fixtures {
+		index := url.QueryEscape(es.IndexNameForServing("prod", consts.ES_RESULTS_INDEX, lang))
+		for i := range phrases {
+			res, err := esc.PerformRequest(context.TODO(), elastic.PerformRequestOptions{
+				Method: "GET",
+				Path:   fmt.Sprintf("/%s/_analyze", index),
+				Body:   map[string]string{"text": phrases[i].Text, "analyzer": consts.ANALYZERS[lang]},
+			})
+			r.Nil(err)
+			tokens := struct {
+				Tokens []Token `json:"tokens"`
+			}{}
+			r.Nil(json.Unmarshal(res.Body, &tokens))
+			phrases[i].Tokens = tokens.Tokens
+		}
+	}
+	data, err := json.MarshalIndent(suite.fixtures, "", "  ")
+	r.Nil(err)
+	r.Nil(ioutil.WriteFile(ANALYZE_FIXTURES, append(data, '\n'), 0644))
+}
+
+func (suite *LocalAnalyzersSuite) TestCompatibility() {
+	r := suite.Require()
+	hunspellFolders := []string{"hunspell"}
+	if *hunspellFolder != "" {
+		hunspellFolders = append(hunspellFolders, *hunspellFolder)
+	}
+	for _, lang := range []string{consts.LANG_ENGLISH, consts.LANG_HEBREW, consts.LANG_RUSSIAN, consts.LANG_SPANISH} {
+		analyzer, err := makeLocalAnalyzer(lang, "../data/es/synonyms", hunspellFolders)
+		r.Nil(err)
+		r.NotNil(analyzer)
+		r.NotEmpty(suite.fixtures[lang], lang)
+		for _, fixture := range suite.fixtures[lang] {
+			r.NotNil(fixture.Tokens, "%s: %s not recorded, run with -analyze-record", lang, fixture.Text)
+			expected := fixture.Tokens
+			for i := range expected {
+				// Elastic omits position length of 1.
+				if expected[i].PositionLength == 0 {
+					expected[i].PositionLength = 1
+				}
+			}
+			r.Equal(expected, analyzer.Analyze(fixture.Text), "%s: %s", lang, fixture.Text)
+		}
+	}
+	analyzer, err := makeLocalAnalyzer(consts.LANG_GERMAN, "../data/es/synonyms", nil)
+	r.Nil(err)
+	r.Nil(analyzer)
+}
+
+func (suite *LocalAnalyzersSuite) TestFallback() {
+	r := suite.Require()
+	_, err := makeLocalAnalyzer(consts.LANG_HEBREW, "../data/es/synonyms", []string{"missing"})
+	r.NotNil(err)
+
+	// Tests run in search folder, search/hunspell is missing.
+	localAnalyzersMutex.Lock()
+	delete(localAnalyzers, consts.LANG_HEBREW)
+	localAnalyzersMutex.Unlock()
+	_, err = GetLocalAnalyzer(consts.LANG_HEBREW)
+	r.NotNil(err)
+	analyzer, err := GetLocalAnalyzer(consts.LANG_HEBREW)
+	r.Nil(err)
+	r.Nil(analyzer)
+
+	// Analyzed with Elastic.
+	_, err = analyzePhrase("שיעורים", consts.LANG_HEBREW, nil)
+	r.NotNil(err)
+	r.Contains(err.Error(), "No elastic client")
+}
+
+func (suite *LocalAnalyzersSuite) TestStemmers() {
+	r := suite.Require()
+	for word, stem := range map[string]string{
+		"caresses": "caress", "ponies": "poni", "agreed": "agre", "hopping": "hop", "filing": "file",
+		"happy": "happi", "relational": "relat", "generalizations": "gener", "electrical": "electr",
+		"adjustment": "adjust", "adoption": "adopt", "controll": "control", "at": "at",
+	} {
+		r.Equal(stem, porterStem(word), word)
+	}
+	for word, stem := range map[string]string{
+		"уроки": "урок", "любви": "любв", "любовь": "любов", "бесконечность": "бесконечн",
+		"важнейшие": "важн", "читая": "чит", "конгресса": "конгресс",
+	} {
+		r.Equal(stem, russianStem(word), word)
+	}
+	for word, stem := range map[string]string{
+		"lecciones": "leccion", "lección": "leccion", "amor": "amor", "felices": "feliz", "congresos": "congres",
+	} {
+		r.Equal(stem, spanishLightStem(word), word)
+	}
+}
+
+func (suite *LocalAnalyzersSuite) TestTokenForest() {
+	r := suite.Require()
+	analyzer, err := makeLocalAnalyzer(consts.LANG_ENGLISH, "../data/es/synonyms", nil)
+	r.Nil(err)
+	phrase := "Ramchal lessons"
+	roots := makeTokenForest(analyzer.Analyze(phrase), phrase)
+	terms := map[string]bool{}
+	for _, root := range roots {
+		terms[root.Token.Token] = true
+	}
+	r.Equal(map[string]bool{"mosh": true, "luzzato": true, "ramchal": true}, terms)
+}
@@ -0,0 +1,395 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+	"github.com/Bnei-Baruch/archive-backend/utils"
+)
+
+const (
+	BEST_BETS_FILE_SUFFIX    = "best_bets"
+	BEST_BET_ACTION_PIN      = "pin"
+	BEST_BET_ACTION_HIDE     = "hide"
+	BEST_BET_ACTION_REDIRECT = "redirect"
+)
+
+// Curated rule for queries matching the pattern.
+type BestBetRule struct {
+	// Normalized query, may contain '*' to match any sequence of characters.
+	Pattern  string
+	Pinned   []string
+	Hidden   []string
+	Redirect string
+
+	re *regexp.Regexp
+}
+
+// Result of applying all matching rules on a query.
+type BestBetMatch struct {
+	Pinned   []string
+	Hidden   map[string]bool
+	Redirect string
+}
+
+// Curated best bets loaded from per language rules files (e.g., en.best_bets).
+// Each line of a file has the following format:
+//
+//	<query pattern> => pin:<mdb_uid>[,<mdb_uid>...]
+//	<query pattern> => hide:<mdb_uid>[,<mdb_uid>...]
+//	<query pattern> => redirect:<url>
+//
+// Empty lines and lines starting with # are ignored.
+// The rules are reloaded from the files every refresh interval.
+// Eval set of the rules is data/search/best_bets.csv.
+type BestBets struct {
+	dir    string
+	rules  map[string][]*BestBetRule // By language.
+	mutex  sync.RWMutex
+	ticker *time.Ticker
+}
+
+func MakeBestBets(dir string, refreshInterval time.Duration) (*BestBets, error) {
+	bb := &BestBets{dir: dir, rules: make(map[string][]*BestBetRule)}
+	if err := bb.Refresh(); err != nil {
+		return nil, err
+	}
+	if refreshInterval > 0 {
+		bb.ticker = time.NewTicker(refreshInterval)
+		go func() {
+			for range bb.ticker.C {
+				if err := bb.Refresh(); err != nil {
+					log.Errorf("Refresh %s: %s", bb, err.Error())
+					utils.LogError(err)
+				}
+			}
+		}()
+	}
+	return bb, nil
+}
+
+func (bb *BestBets) String() string {
+	return "BestBets"
+}
+
+func (bb *BestBets) Close() {
+	if bb != nil && bb.ticker != nil {
+		bb.ticker.Stop()
+	}
+}
+
+// Reloads all rules files. On error the previous rules are kept.
+func (bb *BestBets) Refresh() error {
+	matches, err := filepath.Glob(filepath.Join(bb.dir, fmt.Sprintf("*.%s", BEST_BETS_FILE_SUFFIX)))
+	if err != nil {
+		return errors.Wrap(err, "BestBets.Refresh")
+	}
+	rules := make(map[string][]*BestBetRule)
+	for _, rulesFile := range matches {
+		basename := filepath.Base(rulesFile)
+		lang := basename[:len(basename)-len(BEST_BETS_FILE_SUFFIX)-1]
+		langRules, err := LoadBestBetRulesFromFile(rulesFile)
+		if err != nil {
+			return err
+		}
+		rules[lang] = langRules
+	}
+	bb.mutex.Lock()
+	bb.rules = rules
+	bb.mutex.Unlock()
+	return nil
+}
+
+func LoadBestBetRulesFromFile(rulesFile string) ([]*BestBetRule, error) {
+	f, err := os.Open(rulesFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "LoadBestBetRulesFromFile - Error opening %s.", rulesFile)
+	}
+	defer f.Close()
+
+	rules := []*BestBetRule{}
+	byPattern := make(map[string]*BestBetRule)
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=>", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("LoadBestBetRulesFromFile - Expected '<query pattern> => <action>:<values>' at %s:%d, got: [%s].", rulesFile, lineNum, line)
+		}
+		pattern := normalizeBestBetQuery(parts[0])
+		actionValues := strings.SplitN(strings.TrimSpace(parts[1]), ":", 2)
+		if pattern == "" || len(actionValues) != 2 || strings.TrimSpace(actionValues[1]) == "" {
+			return nil, errors.Errorf("LoadBestBetRulesFromFile - Bad rule at %s:%d: [%s].", rulesFile, lineNum, line)
+		}
+		rule, ok := byPattern[pattern]
+		if !ok {
+			rule = &BestBetRule{Pattern: pattern}
+			quoted := strings.Split(pattern, "*")
+			for i := range quoted {
+				quoted[i] = regexp.QuoteMeta(quoted[i])
+			}
+			rule.re = regexp.MustCompile(fmt.Sprintf("^%s$", strings.Join(quoted, ".*")))
+			byPattern[pattern] = rule
+			rules = append(rules, rule)
+		}
+		values := strings.TrimSpace(actionValues[1])
+		switch strings.TrimSpace(actionValues[0]) {
+		case BEST_BET_ACTION_PIN:
+			rule.Pinned = append(rule.Pinned, splitBestBetValues(values)...)
+		case BEST_BET_ACTION_HIDE:
+			rule.Hidden = append(rule.Hidden, splitBestBetValues(values)...)
+		case BEST_BET_ACTION_REDIRECT:
+			rule.Redirect = values
+		default:
+			return nil, errors.Errorf("LoadBestBetRulesFromFile - Unknown action [%s] at %s:%d.", actionValues[0], rulesFile, lineNum)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "LoadBestBetRulesFromFile - Error reading %s.", rulesFile)
+	}
+	return rules, nil
+}
+
+func splitBestBetValues(values string) []string {
+	ret := []string{}
+	for _, v := range strings.Split(values, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+func normalizeBestBetQuery(q string) string {
+	return strings.Join(strings.Fields(strings.ToLower(q)), " ")
+}
+
+// Returns the combined matching rules for the query in the language or nil if no rule matches.
+// Pinned results and redirect are ignored when query has filters, as they might not respect the filters.
+func (bb *BestBets) Match(query Query, language string) *BestBetMatch {
+	if bb == nil {
+		return nil
+	}
+	normalized := normalizeBestBetQuery(strings.Join(append([]string{query.Term}, query.ExactTerms...), " "))
+	if normalized == "" {
+		return nil
+	}
+	bb.mutex.RLock()
+	defer bb.mutex.RUnlock()
+	var match *BestBetMatch
+	for _, rule := range bb.rules[language] {
+		if !rule.re.MatchString(normalized) {
+			continue
+		}
+		if match == nil {
+			match = &BestBetMatch{Hidden: make(map[string]bool)}
+		}
+		for _, uid := range rule.Hidden {
+			match.Hidden[uid] = true
+		}
+		if len(query.Filters) > 0 {
+			continue
+		}
+		for _, uid := range rule.Pinned {
+			if !utils.StringInSlice(uid, match.Pinned) {
+				match.Pinned = append(match.Pinned, uid)
+			}
+		}
+		if match.Redirect == "" {
+			match.Redirect = rule.Redirect
+		}
+	}
+	return match
+}
+
+// Hidden and pinned results, skipped by cursor pagination of organic results.
+func (m *BestBetMatch) excluded() map[string]bool {
+	if m == nil {
+		return nil
+	}
+	ret := make(map[string]bool)
+	for uid := range m.Hidden {
+		ret[uid] = true
+	}
+	for _, uid := range m.Pinned {
+		ret[uid] = true
+	}
+	return ret
+}
+
+// Number of pinned results set at the top of the first page.
+func (m *BestBetMatch) pinnedCount(pinnedHits map[string]*elastic.SearchHit) int {
+	if m == nil {
+		return 0
+	}
+	count := 0
+	for _, uid := range m.Pinned {
+		if _, ok := pinnedHits[uid]; ok && !m.Hidden[uid] {
+			count++
+		}
+	}
+	return count
+}
+
+// Applies best bet on results joined from the first hit and keeps the [from, from+size) page,
+// so pinned results count against the page size and following pages continue right after them.
+// Results are expected to be fetched with from+size+excluded hits, so removed results do not make the page short.
+func bestBetsPage(ret *elastic.SearchResult, match *BestBetMatch, pinnedHits map[string]*elastic.SearchHit, from int, size int, debug *searchDebugTracker) {
+	if ret == nil || ret.Hits == nil {
+		return
+	}
+	applyBestBetMatch(ret, match, true, pinnedHits, debug)
+	if from >= len(ret.Hits.Hits) {
+		ret.Hits.Hits = []*elastic.SearchHit{}
+	} else {
+		ret.Hits.Hits = ret.Hits.Hits[from:utils.Min(from+size, len(ret.Hits.Hits))]
+	}
+}
+
+// Cursor mode page with best bet applied. Hidden and pinned results are skipped in organic results,
+// on the first page the pinned results are set at the top and count against the page size.
+func bestBetsCursorPage(sortBy string, size int, cursor *SearchCursor, subResults []cursorSubResult, match *BestBetMatch, pinnedHits map[string]*elastic.SearchHit, debug *searchDebugTracker) (*elastic.SearchResult, *SearchCursor, error) {
+	firstPage := cursor.Offset == 0
+	organicSize := size
+	if firstPage {
+		if organicSize -= match.pinnedCount(pinnedHits); organicSize < 0 {
+			organicSize = 0
+		}
+	}
+	ret, next, err := cursorPage(sortBy, organicSize, cursor, subResults, match.excluded())
+	if err != nil || ret == nil || match == nil {
+		return ret, next, err
+	}
+	applyBestBetMatch(ret, match, firstPage, pinnedHits, debug)
+	if len(ret.Hits.Hits) > size {
+		// More pinned results than page size.
+		ret.Hits.Hits = ret.Hits.Hits[:size]
+	}
+	if next != nil {
+		next.Offset = cursor.Offset + len(ret.Hits.Hits)
+	}
+	return ret, next, nil
+}
+
+// Applies best bet on the joined results page.
+// Hidden results and pinned results are removed from the page, then on first page
+// the pinned results (found in page or in pinnedHits) are set at the top.
+func applyBestBetMatch(ret *elastic.SearchResult, match *BestBetMatch, firstPage bool, pinnedHits map[string]*elastic.SearchHit, debug *searchDebugTracker) {
+	if ret == nil || ret.Hits == nil || match == nil {
+		return
+	}
+	inPage := make(map[string]*elastic.SearchHit)
+	hits := []*elastic.SearchHit{}
+	removed := int64(0)
+	for _, hit := range ret.Hits.Hits {
+		key := cursorHitKey(hit)
+		if match.Hidden[key] {
+			removed++
+			continue
+		}
+		if utils.StringInSlice(key, match.Pinned) {
+			inPage[key] = hit
+			continue
+		}
+		hits = append(hits, hit)
+	}
+	ret.Hits.TotalHits = int64(math.Max(0, float64(ret.Hits.TotalHits-removed)))
+	if !firstPage {
+		// Pinned results were already returned in the first page.
+		ret.Hits.Hits = hits
+		return
+	}
+
+	pinned := []*elastic.SearchHit{}
+	for _, uid := range match.Pinned {
+		if match.Hidden[uid] {
+			continue
+		}
+		if hit, ok := inPage[uid]; ok {
+			pinned = append(pinned, hit)
+		} else if hit, ok := pinnedHits[uid]; ok {
+			debug.trackHit(hit, DEBUG_ORIGIN_BEST_BETS, "")
+			pinned = append(pinned, hit)
+			ret.Hits.TotalHits++
+		}
+	}
+	if len(pinned) > 0 {
+		// Keep pinned results above all other results when the client sorts by score.
+		maxScore := 0.0
+		if ret.Hits.MaxScore != nil {
+			maxScore = *ret.Hits.MaxScore
+		}
+		for _, hit := range hits {
+			if hit.Score != nil && *hit.Score > maxScore {
+				maxScore = *hit.Score
+			}
+		}
+		for i, hit := range pinned {
+			before := hit.Score
+			score := maxScore + float64(len(pinned)-i)
+			hit.Score = &score
+			debug.adjust(hit, "Pinned by best bets.", before)
+		}
+		ret.Hits.MaxScore = pinned[0].Score
+	}
+	ret.Hits.Hits = append(pinned, hits...)
+}
+
+// Fetches the pinned results documents from the results index, by language order.
+func (e *ESEngine) fetchPinnedHits(ctx context.Context, uids []string, languages []string) (map[string]*elastic.SearchHit, error) {
+	ret := make(map[string]*elastic.SearchHit)
+	if len(uids) == 0 {
+		return ret, nil
+	}
+	mss := e.esc.MultiSearch()
+	for _, language := range languages {
+		index := es.IndexNameForServing("prod", consts.ES_RESULTS_INDEX, language)
+		source := elastic.NewSearchSource().
+			Query(elastic.NewTermsQuery("mdb_uid", utils.ConvertArgsString(uids)...)).
+			FetchSourceContext(elastic.NewFetchSourceContext(true).Exclude("content", "title_suggest")).
+			Size(len(uids))
+		mss.Add(elastic.NewSearchRequest().Index(index).SearchSource(source))
+	}
+	mr, err := mss.Do(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "ESEngine.fetchPinnedHits - Error multisearch Do.")
+	}
+	for _, res := range mr.Responses {
+		if res.Error != nil {
+			return nil, errors.New(fmt.Sprintf("ESEngine.fetchPinnedHits - Failed multi get: %+v", res.Error))
+		}
+		if !haveHits(res) {
+			continue
+		}
+		for _, hit := range res.Hits.Hits {
+			var mdbUid es.MdbUid
+			if err := json.Unmarshal(*hit.Source, &mdbUid); err != nil {
+				return nil, errors.Wrap(err, "ESEngine.fetchPinnedHits - Error unmarshal source.")
+			}
+			if _, ok := ret[mdbUid.MDB_UID]; !ok {
+				ret[mdbUid.MDB_UID] = hit
+			}
+		}
+	}
+	return ret, nil
+}
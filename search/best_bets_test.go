@@ -0,0 +1,252 @@
+package search
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+	"github.com/Bnei-Baruch/archive-backend/utils"
+)
+
+type BestBetsSuite struct {
+	suite.Suite
+	dir string
+}
+
+func TestBestBets(t *testing.T) {
+	suite.Run(t, new(BestBetsSuite))
+}
+
+func (suite *BestBetsSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "best_bets")
+	suite.Require().Nil(err)
+	suite.dir = dir
+}
+
+func (suite *BestBetsSuite) TearDownTest() {
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *BestBetsSuite) writeRules(lang string, rules string) {
+	suite.Require().Nil(ioutil.WriteFile(filepath.Join(suite.dir, lang+".best_bets"), []byte(rules), 0644))
+}
+
+func (suite *BestBetsSuite) TestMatchAndRefresh() {
+	r := require.New(suite.T())
+	suite.writeRules("en", `
+# Comment
+Daily  Lesson => pin:aaaaaaaa,bbbbbbbb
+daily lesson => hide:cccccccc
+convention* => redirect:https://kabbalahmedia.info/en/events
+`)
+	bb, err := MakeBestBets(suite.dir, 0)
+	r.Nil(err)
+	defer bb.Close()
+
+	match := bb.Match(ParseQuery("daily   LESSON"), "en")
+	r.NotNil(match)
+	r.Equal([]string{"aaaaaaaa", "bbbbbbbb"}, match.Pinned)
+	r.True(match.Hidden["cccccccc"])
+	r.Equal("", match.Redirect)
+
+	r.Nil(bb.Match(ParseQuery("daily lesson"), "he"))
+	r.Nil(bb.Match(ParseQuery("daily lessons"), "en"))
+	r.Equal("https://kabbalahmedia.info/en/events", bb.Match(ParseQuery("convention 2020"), "en").Redirect)
+
+	// Pinned and redirect are not applied with filters.
+	match = bb.Match(ParseQuery("daily lesson content_type:lessons"), "en")
+	r.Equal(0, len(match.Pinned))
+	r.True(match.Hidden["cccccccc"])
+
+	// Reload at runtime.
+	suite.writeRules("en", "daily lesson => pin:dddddddd\n")
+	r.Nil(bb.Refresh())
+	r.Equal([]string{"dddddddd"}, bb.Match(ParseQuery("daily lesson"), "en").Pinned)
+
+	// Bad file keeps previous rules.
+	suite.writeRules("en", "daily lesson => unknown:dddddddd\n")
+	r.NotNil(bb.Refresh())
+	r.Equal([]string{"dddddddd"}, bb.Match(ParseQuery("daily lesson"), "en").Pinned)
+}
+
+func (suite *BestBetsSuite) TestApplyBestBetMatch() {
+	r := require.New(suite.T())
+	page := func() *elastic.SearchResult {
+		return &elastic.SearchResult{Hits: &elastic.SearchHits{TotalHits: 4, Hits: []*elastic.SearchHit{
+			unitHit("a", "", 9), unitHit("b", "", 7), unitHit("c", "", 5), unitHit("d", "", 3),
+		}}}
+	}
+	match := &BestBetMatch{Pinned: []string{"p", "c"}, Hidden: map[string]bool{"b": true}}
+	pinnedHits := map[string]*elastic.SearchHit{"p": unitHit("p", "", 1)}
+
+	first := page()
+	applyBestBetMatch(first, match, true, pinnedHits, nil)
+	ids := []string{}
+	for _, h := range first.Hits.Hits {
+		ids = append(ids, h.Id)
+	}
+	r.Equal([]string{"p", "c", "a", "d"}, ids)
+	r.Equal(int64(4), first.Hits.TotalHits)
+	r.True(*first.Hits.Hits[0].Score > *first.Hits.Hits[1].Score)
+	r.True(*first.Hits.Hits[1].Score > *first.Hits.Hits[2].Score)
+
+	second := page()
+	applyBestBetMatch(second, match, false, nil, nil)
+	ids = []string{}
+	for _, h := range second.Hits.Hits {
+		ids = append(ids, h.Id)
+	}
+	r.Equal([]string{"a", "d"}, ids)
+}
+
+// Pinned results count against the page size, pages do not repeat or skip results.
+func (suite *BestBetsSuite) TestPaging() {
+	r := require.New(suite.T())
+	organic := []cursorHit{{9, "a"}, {7, "b"}, {5, "c"}, {3, "d"}, {2, "e"}, {1, "f"}}
+	match := &BestBetMatch{Pinned: []string{"p", "c"}, Hidden: map[string]bool{"b": true}}
+	pinnedHits := func() map[string]*elastic.SearchHit {
+		return map[string]*elastic.SearchHit{"p": cursorResult([]cursorHit{{1, "p"}}).Hits.Hits[0], "c": cursorResult([]cursorHit{{5, "c"}}).Hits.Hits[0]}
+	}
+	expected := []string{"p", "c", "a", "d", "e", "f"}
+	size := 2
+
+	// Offset pagination, sub results are fetched from the first hit including the excluded results.
+	all := []string{}
+	for from := 0; from < 10; from += size {
+		ret := cursorResult(organic[:utils.Min(from+size+len(match.excluded()), len(organic))])
+		bestBetsPage(ret, match, pinnedHits(), from, size, nil)
+		if len(ret.Hits.Hits) == 0 {
+			break
+		}
+		r.Equal(utils.Min(size, len(expected)-from), len(ret.Hits.Hits))
+		for _, h := range ret.Hits.Hits {
+			all = append(all, h.Id)
+		}
+	}
+	r.Equal(expected, all)
+
+	// Hidden results do not make pages short.
+	hideOnly := &BestBetMatch{Hidden: map[string]bool{"a": true, "b": true}}
+	ret := cursorResult(organic[:utils.Min(size+len(hideOnly.excluded()), len(organic))])
+	bestBetsPage(ret, hideOnly, nil, 0, size, nil)
+	ids := []string{}
+	for _, h := range ret.Hits.Hits {
+		ids = append(ids, h.Id)
+	}
+	r.Equal([]string{"c", "d"}, ids)
+
+	// Cursor pagination, regular results continue with search_after.
+	cursor := &SearchCursor{}
+	all = []string{}
+	for page := 0; page < 10; page++ {
+		fetchSize := size + len(match.excluded())
+		subResults := []cursorSubResult{
+			{key: regularCursorKey("en"), searchAfter: true, result: cursorResult(searchAfter(organic, cursor.SearchAfter[regularCursorKey("en")], fetchSize))},
+		}
+		ret, next, err := bestBetsCursorPage(consts.SORT_BY_RELEVANCE, size, cursor, subResults, match, pinnedHits(), nil)
+		r.Nil(err)
+		r.True(len(ret.Hits.Hits) <= size)
+		for _, h := range ret.Hits.Hits {
+			all = append(all, h.Id)
+		}
+		if next == nil {
+			break
+		}
+		r.Equal(len(all), next.Offset)
+		cursor = next
+	}
+	r.Equal(expected, all)
+}
+
+// Evaluates queries against a fake server returning results with best bets applied.
+func (suite *BestBetsSuite) TestEval() {
+	r := require.New(suite.T())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ret := &elastic.SearchResult{Hits: &elastic.SearchHits{TotalHits: 4, Hits: []*elastic.SearchHit{
+			unitHit("aaaaaaaa", "", 9), unitHit("bbbbbbbb", "", 7), unitHit("cccccccc", "", 5), unitHit("dddddddd", "", 3),
+		}}}
+		res := QueryResult{SearchResult: ret, Language: "en"}
+		switch req.URL.Query().Get("q") {
+		case "pinned":
+			applyBestBetMatch(ret, &BestBetMatch{Pinned: []string{"dddddddd"}, Hidden: map[string]bool{"aaaaaaaa": true}}, true, nil, nil)
+		case "redirect":
+			res.Redirect = "https://kabbalahmedia.info/en/lessons"
+		}
+		json.NewEncoder(w).Encode(res)
+	}))
+	defer server.Close()
+
+	unitUrl := "https://kabbalahmedia.info/en/lessons/cu/"
+	evalQuery := func(q string, expectations ...string) EvalResult {
+		eq := EvalQuery{Language: "en", Query: q}
+		for _, e := range expectations {
+			eq.Expectations = append(eq.Expectations, ParseExpectation(e, nil))
+		}
+		return EvaluateQuery(eq, server.URL, false)
+	}
+
+	res := evalQuery("regular", unitUrl+"aaaaaaaa", unitUrl+"dddddddd")
+	r.Equal([]int{1, 4}, res.Rank)
+	r.Equal([]int{SQ_GOOD, SQ_REGULAR}, res.SearchQuality)
+
+	res = evalQuery("pinned", unitUrl+"aaaaaaaa", unitUrl+"dddddddd")
+	r.Equal([]int{-1, 1}, res.Rank)
+	r.Equal([]int{SQ_UNKNOWN, SQ_GOOD}, res.SearchQuality)
+
+	res = evalQuery("redirect", "https://kabbalahmedia.info/en/lessons", unitUrl+"bbbbbbbb")
+	r.Equal([]int{1, 2}, res.Rank)
+	r.Equal([]int{SQ_GOOD, SQ_GOOD}, res.SearchQuality)
+}
+
+// Shipped rules satisfy the best bets eval set, organic results do not.
+func (suite *BestBetsSuite) TestRepoRules() {
+	r := require.New(suite.T())
+	bb, err := MakeBestBets("../data/search/best_bets", 0)
+	r.Nil(err)
+	defer bb.Close()
+
+	sourceHit := func(mdbUid string) *elastic.SearchHit {
+		msg, err := json.Marshal(es.Result{ResultType: consts.ES_RESULT_TYPE_SOURCES, MDB_UID: mdbUid})
+		r.Nil(err)
+		score := 1.0
+		return &elastic.SearchHit{Id: mdbUid, Type: consts.ES_RESULTS_DOC_TYPE, Score: &score, Source: (*json.RawMessage)(&msg)}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ret := &elastic.SearchResult{Hits: &elastic.SearchHits{TotalHits: 2, Hits: []*elastic.SearchHit{
+			unitHit("aaaaaaaa", "", 9), unitHit("bbbbbbbb", "", 7),
+		}}}
+		res := QueryResult{SearchResult: ret, Language: req.URL.Query().Get("language")}
+		if match := bb.Match(ParseQuery(req.URL.Query().Get("q")), res.Language); match != nil {
+			pinnedHits := map[string]*elastic.SearchHit{}
+			for _, uid := range match.Pinned {
+				pinnedHits[uid] = sourceHit(uid)
+			}
+			applyBestBetMatch(ret, match, true, pinnedHits, nil)
+			res.Redirect = match.Redirect
+		}
+		json.NewEncoder(w).Encode(res)
+	}))
+	defer server.Close()
+
+	f, err := os.Open("../data/search/best_bets.csv")
+	r.Nil(err)
+	defer f.Close()
+	queries, err := ReadEvalSet(f, nil)
+	r.Nil(err)
+	r.NotEmpty(queries)
+	for _, q := range queries {
+		res := EvaluateQuery(q, server.URL, false)
+		r.Equal(1, res.Rank[0], "%s: %s", q.Language, q.Query)
+		r.Equal(SQ_GOOD, res.SearchQuality[0], "%s: %s", q.Language, q.Query)
+	}
+}
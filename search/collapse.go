@@ -0,0 +1,169 @@
+package search
+
+import (
+	"encoding/json"
+	"math"
+
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+)
+
+// Returns the first collection of a content unit hit or empty string if hit is not a content unit.
+func hitUnitCollection(hit *elastic.SearchHit) string {
+	if hit.Source == nil || hit.Score == nil || hit.Type != consts.ES_RESULTS_DOC_TYPE {
+		return ""
+	}
+	var src es.Result
+	if err := json.Unmarshal(*hit.Source, &src); err != nil || src.ResultType != consts.ES_RESULT_TYPE_UNITS {
+		return ""
+	}
+	collections, err := es.KeyValuesToValues(consts.ES_UID_TYPE_COLLECTION, src.TypedUids)
+	if err != nil || len(collections) == 0 {
+		return ""
+	}
+	return collections[0]
+}
+
+// Groups content unit hits sharing same collection into a single hit (per collection) with inner hits.
+// The best scoring unit is used as representative (source and score) of the group.
+// Groups are done over all results together as same unit or collection may come from several results
+// (e.g. regular and grammar results). The group hit is set in the result of the representative.
+func collapseByCollection(results []*elastic.SearchResult) {
+	type groupHit struct {
+		result *elastic.SearchResult
+		hit    *elastic.SearchHit
+	}
+	groups := make(map[string][]groupHit)
+	order := []string{}
+	for _, r := range results {
+		if r == nil || r.Hits == nil {
+			continue
+		}
+		for _, hit := range r.Hits.Hits {
+			if collection := hitUnitCollection(hit); collection != "" {
+				if _, ok := groups[collection]; !ok {
+					order = append(order, collection)
+				}
+				groups[collection] = append(groups[collection], groupHit{r, hit})
+			}
+		}
+	}
+
+	collapsed := make(map[*elastic.SearchHit]*elastic.SearchHit)
+	for _, collection := range order {
+		group := groups[collection]
+		// Keep single units as is, also avoid grouping the same unit found in several results.
+		unique := []groupHit{}
+		byMdbUid := make(map[string]int)
+		for _, gh := range group {
+			var mdbUid es.MdbUid
+			if err := json.Unmarshal(*gh.hit.Source, &mdbUid); err != nil {
+				continue
+			}
+			if i, ok := byMdbUid[mdbUid.MDB_UID]; ok {
+				if *gh.hit.Score > *unique[i].hit.Score {
+					collapsed[unique[i].hit] = nil
+					unique[i] = gh
+				} else {
+					collapsed[gh.hit] = nil
+				}
+				continue
+			}
+			byMdbUid[mdbUid.MDB_UID] = len(unique)
+			unique = append(unique, gh)
+		}
+		if len(unique) < 2 {
+			continue
+		}
+		best := 0
+		for i := range unique {
+			if *unique[i].hit.Score > *unique[best].hit.Score {
+				best = i
+			}
+		}
+		innerHits := &elastic.SearchHits{TotalHits: int64(len(unique)), MaxScore: unique[best].hit.Score}
+		innerHits.Hits = append(innerHits.Hits, unique[best].hit)
+		for i := range unique {
+			if i != best {
+				innerHits.Hits = append(innerHits.Hits, unique[i].hit)
+			}
+		}
+		groupHit := &elastic.SearchHit{
+			Source:      unique[best].hit.Source,
+			Type:        consts.SEARCH_RESULT_UNITS_BY_COLLECTION,
+			Score:       unique[best].hit.Score,
+			Sort:        unique[best].hit.Sort,
+			Uid:         collection,
+			Explanation: unique[best].hit.Explanation,
+			InnerHits: map[string]*elastic.SearchHitInnerHits{
+				consts.SEARCH_RESULT_UNITS_BY_COLLECTION: &elastic.SearchHitInnerHits{Hits: innerHits},
+			},
+		}
+		for i := range unique {
+			if i == best {
+				collapsed[unique[i].hit] = groupHit
+			} else {
+				collapsed[unique[i].hit] = nil
+			}
+		}
+	}
+
+	if len(collapsed) == 0 {
+		return
+	}
+	for _, r := range results {
+		if r == nil || r.Hits == nil {
+			continue
+		}
+		hits := []*elastic.SearchHit{}
+		removed := int64(0)
+		for _, hit := range r.Hits.Hits {
+			if replace, ok := collapsed[hit]; ok {
+				if replace == nil {
+					removed++
+					continue
+				}
+				hit = replace
+			}
+			hits = append(hits, hit)
+		}
+		r.Hits.Hits = hits
+		r.Hits.TotalHits = int64(math.Max(0, float64(r.Hits.TotalHits-removed)))
+	}
+}
+
+// Clears the fields the client has no need for in the group hit and its inner hits.
+func nativizeCollapsedHitForClient(hit *elastic.SearchHit) error {
+	nativize := func(h *elastic.SearchHit) error {
+		if h.Source == nil {
+			return nil
+		}
+		var src es.Result
+		if err := json.Unmarshal(*h.Source, &src); err != nil {
+			return err
+		}
+		src.TypedUids = nil // Client has no need for TypedUids list
+		nsrc, err := json.Marshal(src)
+		if err != nil {
+			return err
+		}
+		h.Source = (*json.RawMessage)(&nsrc)
+		if h.Highlight == nil {
+			h.Highlight = elastic.SearchHitHighlight{}
+		}
+		return nil
+	}
+	if err := nativize(hit); err != nil {
+		return err
+	}
+	if unitHits, ok := hit.InnerHits[consts.SEARCH_RESULT_UNITS_BY_COLLECTION]; ok && unitHits.Hits != nil {
+		for _, h := range unitHits.Hits.Hits {
+			if err := nativize(h); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package search
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+	"github.com/Bnei-Baruch/archive-backend/utils"
+)
+
+type CollapseSuite struct {
+	suite.Suite
+}
+
+func TestCollapse(t *testing.T) {
+	suite.Run(t, new(CollapseSuite))
+}
+
+func unitHit(mdbUid string, collection string, score float64) *elastic.SearchHit {
+	src := es.Result{ResultType: consts.ES_RESULT_TYPE_UNITS, MDB_UID: mdbUid}
+	if collection != "" {
+		src.TypedUids = []string{es.KeyValue(consts.ES_UID_TYPE_COLLECTION, collection)}
+	}
+	msg, err := json.Marshal(src)
+	if err != nil {
+		panic(err)
+	}
+	return &elastic.SearchHit{Id: mdbUid, Type: consts.ES_RESULTS_DOC_TYPE, Score: &score, Source: (*json.RawMessage)(&msg)}
+}
+
+func (suite *CollapseSuite) TestCollapseByCollection() {
+	r := require.New(suite.T())
+	regular := &elastic.SearchResult{Hits: &elastic.SearchHits{TotalHits: 4, Hits: []*elastic.SearchHit{
+		unitHit("a1", "A", 5), unitHit("a2", "A", 7), unitHit("b1", "B", 6), unitHit("x", "", 3),
+	}}}
+	grammar := &elastic.SearchResult{Hits: &elastic.SearchHits{TotalHits: 2, Hits: []*elastic.SearchHit{
+		unitHit("a3", "A", 9), unitHit("b1", "B", 4),
+	}}}
+	collapseByCollection([]*elastic.SearchResult{regular, grammar})
+
+	// Collection A is represented by a3 from grammar results, b1 is kept once with the higher score.
+	r.Equal(2, len(regular.Hits.Hits))
+	r.Equal("b1", regular.Hits.Hits[0].Id)
+	r.Equal(6.0, *regular.Hits.Hits[0].Score)
+	r.Equal("x", regular.Hits.Hits[1].Id)
+	r.Equal(1, len(grammar.Hits.Hits))
+	group := grammar.Hits.Hits[0]
+	r.Equal(consts.SEARCH_RESULT_UNITS_BY_COLLECTION, group.Type)
+	r.Equal("A", group.Uid)
+	r.Equal(9.0, *group.Score)
+	inner := group.InnerHits[consts.SEARCH_RESULT_UNITS_BY_COLLECTION].Hits.Hits
+	r.Equal(3, len(inner))
+	r.Equal("a3", inner[0].Id)
+
+	r.Nil(nativizeCollapsedHitForClient(group))
+	var src es.Result
+	r.Nil(json.Unmarshal(*inner[1].Source, &src))
+	r.Nil(src.TypedUids)
+}
+
+// Collapse is done within the hits fetched for each page, units of a collection
+// returned as collapsed hit are skipped in next pages.
+func (suite *CollapseSuite) TestCursorPages() {
+	r := require.New(suite.T())
+	regular := []*elastic.SearchHit{
+		unitHit("a1", "A", 9), unitHit("x", "", 8), unitHit("a2", "A", 7),
+		unitHit("y", "", 6), unitHit("a3", "A", 5), unitHit("z", "", 4), unitHit("a4", "A", 3),
+	}
+	for _, hit := range regular {
+		hit.Sort = []interface{}{*hit.Score, hit.Id}
+	}
+	// Elastic search_after, page is fetched with one more hit.
+	fetch := func(after []interface{}, size int) *elastic.SearchResult {
+		start := 0
+		for i, hit := range regular {
+			if len(after) > 0 && hit.Id == after[1].(string) {
+				start = i + 1
+			}
+		}
+		hits := regular[start:utils.Min(start+size+1, len(regular))]
+		return &elastic.SearchResult{Hits: &elastic.SearchHits{TotalHits: int64(len(hits)), Hits: append([]*elastic.SearchHit{}, hits...)}}
+	}
+
+	size := 2
+	cursor := &SearchCursor{}
+	all := []string{}
+	for page := 0; page < 10; page++ {
+		result := fetch(cursor.SearchAfter[regularCursorKey("en")], size)
+		collapseByCollection([]*elastic.SearchResult{result})
+		subResults := []cursorSubResult{{key: regularCursorKey("en"), searchAfter: true, result: result}}
+		ret, next, err := cursorPage(consts.SORT_BY_RELEVANCE, size, cursor, subResults, nil)
+		r.Nil(err)
+		r.True(len(ret.Hits.Hits) <= size)
+		for _, hit := range ret.Hits.Hits {
+			if hit.Type == consts.SEARCH_RESULT_UNITS_BY_COLLECTION {
+				all = append(all, hit.Uid)
+			} else {
+				all = append(all, hit.Id)
+			}
+		}
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	r.Equal([]string{"A", "x", "y", "z"}, all)
+}
@@ -0,0 +1,253 @@
+package search
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+)
+
+// SearchCursor holds the state required to load the next page of a search in cursor mode.
+// It is passed to the client as an opaque base64 string (next_cursor).
+// Regular results are paginated with elastic search_after per sub query,
+// all other sub results (intents, grammars, tweets, lesson series) are paginated
+// by the number of hits already consumed from each of them.
+type SearchCursor struct {
+	// Number of hits already returned to the client (merged offset).
+	Offset int `json:"o"`
+	// Sub query key => sort values of the last consumed hit of that sub query.
+	SearchAfter map[string][]interface{} `json:"sa,omitempty"`
+	// Sub query key => number of consumed hits for sub queries without search_after.
+	Consumed map[string]int `json:"c,omitempty"`
+	// Hits (by mdb_uid or id) that were already returned but are not covered
+	// by the search_after or consumed values above, e.g., after score adjustments.
+	Seen []string `json:"s,omitempty"`
+}
+
+// Sub result of DoSearch that takes part in cursor pagination.
+type cursorSubResult struct {
+	key         string
+	searchAfter bool
+	result      *elastic.SearchResult
+}
+
+func EncodeSearchCursor(cursor *SearchCursor) (string, error) {
+	b, err := json.Marshal(cursor)
+	if err != nil {
+		return "", errors.Wrap(err, "EncodeSearchCursor")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func DecodeSearchCursor(str string) (*SearchCursor, error) {
+	cursor := &SearchCursor{}
+	if str == "" {
+		return cursor, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil {
+		return nil, errors.Wrap(err, "DecodeSearchCursor - Illegal cursor encoding.")
+	}
+	if err := json.Unmarshal(b, cursor); err != nil {
+		return nil, errors.Wrap(err, "DecodeSearchCursor - Illegal cursor content.")
+	}
+	if cursor.Offset < 0 {
+		return nil, errors.New("DecodeSearchCursor - Negative offset.")
+	}
+	return cursor, nil
+}
+
+func regularCursorKey(lang string) string {
+	return fmt.Sprintf("regular:%s", lang)
+}
+
+// Seen key of a collection returned as collapsed hit, its units are not returned again
+// (collapse is done only within the hits fetched for the page).
+func collapsedCursorKey(collection string) string {
+	return fmt.Sprintf("collapsed:%s", collection)
+}
+
+// Sort values used with search_after. The mdb_uid is used as a tie breaker to
+// keep the order stable between pages.
+func cursorSorters(sortBy string) []elastic.Sorter {
+	switch sortBy {
+	case consts.SORT_BY_OLDER_TO_NEWER:
+		return []elastic.Sorter{elastic.NewFieldSort("effective_date").Asc(), elastic.NewFieldSort("mdb_uid").Asc()}
+	case consts.SORT_BY_NEWER_TO_OLDER:
+		return []elastic.Sorter{elastic.NewFieldSort("effective_date").Desc(), elastic.NewFieldSort("mdb_uid").Asc()}
+	default:
+		return []elastic.Sorter{elastic.NewScoreSort(), elastic.NewFieldSort("mdb_uid").Asc()}
+	}
+}
+
+// Identifies the hit across sub results, same hit may come from regular and grammar search.
+func cursorHitKey(hit *elastic.SearchHit) string {
+	if hit.Source != nil {
+		var mdbUid es.MdbUid
+		if err := json.Unmarshal(*hit.Source, &mdbUid); err == nil && mdbUid.MDB_UID != "" {
+			return mdbUid.MDB_UID
+		}
+	}
+	if hit.Id != "" {
+		return hit.Id
+	}
+	return hit.Uid
+}
+
+func sortHits(hits []*elastic.SearchHit, sortBy string) {
+	if sortBy == consts.SORT_BY_RELEVANCE {
+		sort.Stable(byRelevance(hits))
+	} else if sortBy == consts.SORT_BY_OLDER_TO_NEWER {
+		sort.Stable(byOlderToNewer(hits))
+	} else if sortBy == consts.SORT_BY_NEWER_TO_OLDER {
+		sort.Stable(byNewerToOlder(hits))
+	} else if sortBy == consts.SORT_BY_SOURCE_FIRST {
+		sort.Stable(bySourceFirst(hits))
+	}
+}
+
+// Selects the next page of size hits from the sub results and calculates the cursor for the following page.
+// Sub results with search_after are expected to start right after the previous page, all other sub results
+// are expected to start from the first hit (the consumed hits are skipped here).
+// Hits in excluded (e.g., hidden or pinned by best bets) are skipped as if already seen.
+// Returns nil cursor when there are no more results.
+func cursorPage(sortBy string, size int, cursor *SearchCursor, subResults []cursorSubResult, excluded map[string]bool) (*elastic.SearchResult, *SearchCursor, error) {
+	if len(subResults) == 0 {
+		return nil, nil, nil
+	}
+
+	seen := make(map[string]bool)
+	for _, key := range cursor.Seen {
+		seen[key] = true
+	}
+
+	skipped := func(key string) bool {
+		return seen[key] || excluded[key]
+	}
+	skippedHit := func(hit *elastic.SearchHit) bool {
+		if skipped(cursorHitKey(hit)) {
+			return true
+		}
+		collection := hitUnitCollection(hit)
+		if hit.Type == consts.SEARCH_RESULT_UNITS_BY_COLLECTION {
+			collection = hit.Uid
+		}
+		return collection != "" && seen[collapsedCursorKey(collection)]
+	}
+
+	// Whether search_after sub results had skipped hits, then a short page is not the last one.
+	skippedAfter := false
+
+	// Hits of each sub result in their own order, without consumed hits.
+	subHits := make([][]*elastic.SearchHit, len(subResults))
+	results := make([]*elastic.SearchResult, len(subResults))
+	for i, sr := range subResults {
+		hits := []*elastic.SearchHit{}
+		if sr.result.Hits != nil {
+			hits = append(hits, sr.result.Hits.Hits...)
+		} else {
+			sr.result.Hits = &elastic.SearchHits{}
+		}
+		if !sr.searchAfter {
+			sortHits(hits, sortBy)
+			if consumed := cursor.Consumed[sr.key]; consumed > 0 {
+				if consumed >= len(hits) {
+					hits = []*elastic.SearchHit{}
+				} else {
+					hits = hits[consumed:]
+				}
+			}
+		}
+		filtered := []*elastic.SearchHit{}
+		for _, hit := range hits {
+			if !skippedHit(hit) {
+				filtered = append(filtered, hit)
+			} else if sr.searchAfter {
+				skippedAfter = true
+			}
+		}
+		subHits[i] = hits
+		sr.result.Hits.Hits = append([]*elastic.SearchHit{}, filtered...)
+		results[i] = sr.result
+	}
+
+	page, err := joinResponses(sortBy, 0, size, results...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	returned := make(map[string]bool)
+	for _, hit := range page.Hits.Hits {
+		returned[cursorHitKey(hit)] = true
+	}
+
+	if len(page.Hits.Hits) < size && !skippedAfter {
+		return page, nil, nil
+	}
+
+	next := &SearchCursor{
+		Offset:      cursor.Offset + len(page.Hits.Hits),
+		SearchAfter: make(map[string][]interface{}),
+		Consumed:    make(map[string]int),
+	}
+	for k, v := range cursor.SearchAfter {
+		next.SearchAfter[k] = v
+	}
+	for k, v := range cursor.Consumed {
+		next.Consumed[k] = v
+	}
+	nextSeen := append([]string{}, cursor.Seen...)
+	// Units collapsed into a returned hit should not show up again.
+	for _, hit := range page.Hits.Hits {
+		if unitHits, ok := hit.InnerHits[consts.SEARCH_RESULT_UNITS_BY_COLLECTION]; ok && unitHits.Hits != nil {
+			if key := collapsedCursorKey(hit.Uid); !seen[key] {
+				seen[key] = true
+				nextSeen = append(nextSeen, key)
+			}
+			for _, uh := range unitHits.Hits.Hits {
+				if key := cursorHitKey(uh); !returned[key] && !seen[key] {
+					seen[key] = true
+					nextSeen = append(nextSeen, key)
+				}
+			}
+		}
+	}
+	for i, sr := range subResults {
+		// Consumed prefix of the sub result, skipped hits in the prefix are consumed as well.
+		prefix := 0
+		for prefix < len(subHits[i]) {
+			hit := subHits[i][prefix]
+			if !returned[cursorHitKey(hit)] && !skippedHit(hit) {
+				break
+			}
+			prefix++
+		}
+		if prefix > 0 {
+			if sr.searchAfter {
+				next.SearchAfter[sr.key] = subHits[i][prefix-1].Sort
+			} else {
+				next.Consumed[sr.key] += prefix
+			}
+		}
+		// Returned hits out of the consumed prefix should not show up again.
+		for _, hit := range subHits[i][prefix:] {
+			key := cursorHitKey(hit)
+			if returned[key] && !seen[key] {
+				seen[key] = true
+				nextSeen = append(nextSeen, key)
+			}
+		}
+	}
+	if len(nextSeen) > consts.SEARCH_CURSOR_MAX_SEEN {
+		nextSeen = nextSeen[len(nextSeen)-consts.SEARCH_CURSOR_MAX_SEEN:]
+	}
+	next.Seen = nextSeen
+
+	return page, next, nil
+}
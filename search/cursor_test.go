@@ -0,0 +1,140 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+)
+
+type CursorSuite struct {
+	suite.Suite
+}
+
+func TestCursor(t *testing.T) {
+	suite.Run(t, new(CursorSuite))
+}
+
+type cursorHit struct {
+	Score  float64
+	MdbUid string
+}
+
+func cursorResult(hits []cursorHit) *elastic.SearchResult {
+	res := &elastic.SearchResult{Hits: &elastic.SearchHits{TotalHits: int64(len(hits))}}
+	for _, h := range hits {
+		score := h.Score
+		msg, err := json.Marshal(es.MdbUid{MDB_UID: h.MdbUid})
+		if err != nil {
+			panic(err)
+		}
+		res.Hits.Hits = append(res.Hits.Hits, &elastic.SearchHit{
+			Id:     h.MdbUid,
+			Score:  &score,
+			Source: (*json.RawMessage)(&msg),
+			Sort:   []interface{}{score, h.MdbUid},
+		})
+	}
+	return res
+}
+
+// Simulates elastic search_after on sorted hits.
+func searchAfter(hits []cursorHit, after []interface{}, size int) []cursorHit {
+	start := 0
+	if len(after) > 0 {
+		for i, h := range hits {
+			if h.MdbUid == after[1].(string) {
+				start = i + 1
+				break
+			}
+		}
+	}
+	end := start + size
+	if end > len(hits) {
+		end = len(hits)
+	}
+	return hits[start:end]
+}
+
+func (suite *CursorSuite) TestEncodeDecode() {
+	r := require.New(suite.T())
+	cursor := &SearchCursor{
+		Offset:      20,
+		SearchAfter: map[string][]interface{}{regularCursorKey("en"): []interface{}{1.5, "abc"}},
+		Consumed:    map[string]int{"intents:en": 2},
+		Seen:        []string{"xyz"},
+	}
+	encoded, err := EncodeSearchCursor(cursor)
+	r.Nil(err)
+	decoded, err := DecodeSearchCursor(encoded)
+	r.Nil(err)
+	r.Equal(cursor, decoded)
+
+	empty, err := DecodeSearchCursor("")
+	r.Nil(err)
+	r.Equal(0, empty.Offset)
+
+	_, err = DecodeSearchCursor("not a cursor!")
+	r.NotNil(err)
+}
+
+func (suite *CursorSuite) TestIteratePages() {
+	r := require.New(suite.T())
+	regular := []cursorHit{{9, "a"}, {7, "b"}, {5, "c"}, {3, "d"}, {1, "e"}}
+	intents := []cursorHit{{8, "i1"}, {2, "i2"}}
+	// Grammar returns same hit as regular search with higher score.
+	grammar := []cursorHit{{6, "d"}, {4, "g1"}}
+
+	size := 3
+	cursor := &SearchCursor{}
+	all := []string{}
+	for page := 0; page < 10; page++ {
+		subResults := []cursorSubResult{
+			{key: regularCursorKey("en"), searchAfter: true, result: cursorResult(searchAfter(regular, cursor.SearchAfter[regularCursorKey("en")], size))},
+			{key: "intents:en", result: cursorResult(intents)},
+			{key: "grammar:en:filter:content_type=lessons:0", result: cursorResult(grammar)},
+		}
+		ret, next, err := cursorPage(consts.SORT_BY_RELEVANCE, size, cursor, subResults, nil)
+		r.Nil(err)
+		for _, h := range ret.Hits.Hits {
+			all = append(all, h.Id)
+		}
+		if next == nil {
+			break
+		}
+		r.Equal(len(all), next.Offset)
+		cursor = next
+	}
+	r.Equal([]string{"a", "i1", "b", "d", "c", "g1", "i2", "e"}, all, fmt.Sprintf("%+v", all))
+}
+
+func (suite *CursorSuite) TestFilterIntentsKeys() {
+	r := require.New(suite.T())
+	lessons := FilterValue{Name: "content_type", Value: "lessons"}
+	text := FilterValue{Name: "text", Value: "arvut"}
+	// Key does not depend on the order of filter values.
+	r.Equal("filter:content_type=lessons,text=arvut", filterIntentKey("filter", []FilterValue{text, lessons}))
+
+	e := &ESEngine{}
+	search := func(key string) *filterIntentSearch {
+		return &filterIntentSearch{language: consts.LANG_ENGLISH, intentKey: key}
+	}
+	response := func(id string) []*elastic.SearchResult {
+		return []*elastic.SearchResult{cursorResult([]cursorHit{{1, id}})}
+	}
+	// Failed search of the first intent does not shift the keys of the others.
+	byLang := e.filterIntentsResults(
+		[]*filterIntentSearch{search("filter:a"), search("filter:b"), search("filter:b")},
+		[][]*elastic.SearchResult{nil, response("x"), response("y")})
+	keys := []string{}
+	for _, fr := range byLang[consts.LANG_ENGLISH] {
+		keys = append(keys, fr.IntentKey)
+	}
+	r.Equal([]string{"filter:b", "filter:b#1"}, keys)
+}
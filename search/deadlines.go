@@ -0,0 +1,74 @@
+package search
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DoSearch stages that may be skipped when they fail or exceed their deadline.
+const (
+	SEARCH_STAGE_GRAMMARS      = "grammars"
+	SEARCH_STAGE_INTENTS       = "intents"
+	SEARCH_STAGE_MAIN_QUERY    = "main_query"
+	SEARCH_STAGE_HIGHLIGHTS    = "highlights"
+	SEARCH_STAGE_TYPO_SUGGEST  = "typo_suggest"
+	SEARCH_STAGE_TWEETS        = "tweets"
+	SEARCH_STAGE_LESSON_SERIES = "lesson_series"
+)
+
+// Deadline of each DoSearch stage, counted from the stage start.
+// Zero means the stage is bounded only by the request context.
+type SearchDeadlines struct {
+	Grammars     time.Duration
+	Intents      time.Duration
+	MainQuery    time.Duration
+	Highlights   time.Duration
+	TypoSuggest  time.Duration
+	Tweets       time.Duration
+	LessonSeries time.Duration
+}
+
+func stageContext(ctx context.Context, deadline time.Duration) (context.Context, context.CancelFunc) {
+	if deadline > 0 {
+		return context.WithTimeout(ctx, deadline)
+	}
+	return context.WithCancel(ctx)
+}
+
+// Longest of the deadlines, zero (no deadline) if any of them is zero.
+func maxDeadline(deadlines ...time.Duration) time.Duration {
+	var max time.Duration
+	for _, d := range deadlines {
+		if d <= 0 {
+			return 0
+		}
+		if d > max {
+			max = d
+		}
+	}
+	return max
+}
+
+// Collects the stages that did not complete, safe for concurrent use.
+type degradedStages struct {
+	mutex  sync.Mutex
+	stages []string
+}
+
+func (d *degradedStages) add(stage string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, s := range d.stages {
+		if s == stage {
+			return
+		}
+	}
+	d.stages = append(d.stages, stage)
+}
+
+func (d *degradedStages) list() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]string(nil), d.stages...)
+}
@@ -0,0 +1,56 @@
+package search
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type DeadlinesSuite struct {
+	suite.Suite
+}
+
+func TestDeadlines(t *testing.T) {
+	suite.Run(t, new(DeadlinesSuite))
+}
+
+func (suite *DeadlinesSuite) TestStageContext() {
+	r := require.New(suite.T())
+
+	ctx, cancel := stageContext(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	r.Equal(context.DeadlineExceeded, ctx.Err())
+
+	// No deadline, bounded by the parent only.
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel = stageContext(parent, 0)
+	defer cancel()
+	_, hasDeadline := ctx.Deadline()
+	r.False(hasDeadline)
+	r.Nil(ctx.Err())
+	cancelParent()
+	<-ctx.Done()
+	r.Equal(context.Canceled, ctx.Err())
+}
+
+func (suite *DeadlinesSuite) TestDegradedStages() {
+	r := require.New(suite.T())
+	degraded := &degradedStages{}
+	r.Empty(degraded.list())
+
+	done := make(chan bool)
+	for _, stage := range []string{SEARCH_STAGE_TWEETS, SEARCH_STAGE_HIGHLIGHTS, SEARCH_STAGE_TWEETS} {
+		go func(stage string) {
+			degraded.add(stage)
+			done <- true
+		}(stage)
+	}
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+	r.ElementsMatch([]string{SEARCH_STAGE_TWEETS, SEARCH_STAGE_HIGHLIGHTS}, degraded.list())
+}
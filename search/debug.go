@@ -0,0 +1,164 @@
+package search
+
+import (
+	"fmt"
+	"sync"
+
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+)
+
+const (
+	DEBUG_ORIGIN_REGULAR               = "regular"
+	DEBUG_ORIGIN_GRAMMAR_INTENT        = "grammar_intent"
+	DEBUG_ORIGIN_CLASSIFICATION_INTENT = "classification_intent"
+	DEBUG_ORIGIN_GRAMMAR_FILTER        = "grammar_filter"
+	DEBUG_ORIGIN_TWEETS                = "tweets"
+	DEBUG_ORIGIN_LESSON_SERIES         = "lesson_series"
+	DEBUG_ORIGIN_BEST_BETS             = "best_bets"
+	DEBUG_ORIGIN_UNKNOWN               = "unknown"
+	// Prefix of origin for hits grouped by collapse, followed by origin of the representative hit.
+	DEBUG_ORIGIN_COLLAPSED_PREFIX = "collapsed:"
+	// Internal origin of intents results, resolved per hit to grammar or classification intent.
+	debugOriginIntents = "intents"
+)
+
+type ScoreAdjustment struct {
+	Reason string  `json:"reason"`
+	Before float64 `json:"before"`
+	After  float64 `json:"after"`
+}
+
+// Explains why a hit got its rank.
+type HitDebug struct {
+	Id          string                     `json:"id,omitempty"`
+	Origin      string                     `json:"origin"`
+	Language    string                     `json:"language,omitempty"`
+	Index       string                     `json:"index,omitempty"`
+	RawScore    *float64                   `json:"raw_score,omitempty"`
+	Score       *float64                   `json:"score,omitempty"`
+	Explanation *elastic.SearchExplanation `json:"explanation,omitempty"`
+	Adjustments []ScoreAdjustment          `json:"adjustments,omitempty"`
+}
+
+type TypoSuggestDebug struct {
+	Checked    bool     `json:"checked"`
+	Path       []string `json:"path,omitempty"`
+	Suggestion string   `json:"suggestion,omitempty"`
+}
+
+func (t *TypoSuggestDebug) step(format string, args ...interface{}) {
+	if t != nil {
+		t.Path = append(t.Path, fmt.Sprintf(format, args...))
+	}
+}
+
+// Returned with the search results in debug mode (deb=true).
+// Hits are in the same order as the search result hits.
+type SearchDebug struct {
+	Hits        []*HitDebug       `json:"hits"`
+	TypoSuggest *TypoSuggestDebug `json:"typo_suggest,omitempty"`
+	TokensCache *TokensCacheStats `json:"tokens_cache,omitempty"`
+}
+
+// Collects debug information of hits during DoSearch.
+// All methods do nothing on nil tracker, i.e., when not in debug mode.
+type searchDebugTracker struct {
+	mutex sync.Mutex
+	hits  map[*elastic.SearchHit]*HitDebug
+}
+
+func newSearchDebugTracker(enabled bool) *searchDebugTracker {
+	if !enabled {
+		return nil
+	}
+	return &searchDebugTracker{hits: make(map[*elastic.SearchHit]*HitDebug)}
+}
+
+// Records origin and raw scores of all hits of the result. Should be called before scores are modified.
+func (t *searchDebugTracker) trackResult(result *elastic.SearchResult, origin string, language string) {
+	if t == nil || result == nil || result.Hits == nil {
+		return
+	}
+	for _, hit := range result.Hits.Hits {
+		t.trackHit(hit, origin, language)
+	}
+}
+
+func (t *searchDebugTracker) trackHit(hit *elastic.SearchHit, origin string, language string) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if _, ok := t.hits[hit]; ok {
+		return
+	}
+	if origin == debugOriginIntents {
+		if hit.Index == consts.INTENT_INDEX_TAG || hit.Index == consts.INTENT_INDEX_SOURCE {
+			origin = DEBUG_ORIGIN_CLASSIFICATION_INTENT
+		} else {
+			origin = DEBUG_ORIGIN_GRAMMAR_INTENT
+		}
+	}
+	hd := &HitDebug{Id: hit.Id, Origin: origin, Language: language, Index: hit.Index, Explanation: hit.Explanation}
+	if hit.Score != nil {
+		raw := *hit.Score
+		hd.RawScore = &raw
+	}
+	t.hits[hit] = hd
+}
+
+// Records score change of the hit, before is the score prior to the change.
+func (t *searchDebugTracker) adjust(hit *elastic.SearchHit, reason string, before *float64) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	hd, ok := t.hits[hit]
+	if !ok {
+		hd = &HitDebug{Id: hit.Id, Origin: DEBUG_ORIGIN_UNKNOWN, Index: hit.Index, Explanation: hit.Explanation}
+		t.hits[hit] = hd
+	}
+	adjustment := ScoreAdjustment{Reason: reason}
+	if before != nil {
+		adjustment.Before = *before
+	}
+	if hit.Score != nil {
+		adjustment.After = *hit.Score
+	}
+	hd.Adjustments = append(hd.Adjustments, adjustment)
+}
+
+// Returns debug information for each of the hits.
+func (t *searchDebugTracker) hitsDebug(hits []*elastic.SearchHit) []*HitDebug {
+	if t == nil {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	ret := make([]*HitDebug, len(hits))
+	for i, hit := range hits {
+		hd, ok := t.hits[hit]
+		if !ok {
+			hd = &HitDebug{Id: hit.Id, Origin: DEBUG_ORIGIN_UNKNOWN, Index: hit.Index, Explanation: hit.Explanation}
+			// Collapsed group hit is represented by its first inner hit.
+			if unitHits, ok := hit.InnerHits[consts.SEARCH_RESULT_UNITS_BY_COLLECTION]; ok && unitHits.Hits != nil && len(unitHits.Hits.Hits) > 0 {
+				if rhd, ok := t.hits[unitHits.Hits.Hits[0]]; ok {
+					copied := *rhd
+					hd = &copied
+					hd.Origin = fmt.Sprintf("%s%s", DEBUG_ORIGIN_COLLAPSED_PREFIX, rhd.Origin)
+				}
+			}
+		}
+		copied := *hd
+		if hit.Score != nil {
+			score := *hit.Score
+			copied.Score = &score
+		}
+		ret[i] = &copied
+	}
+	return ret
+}
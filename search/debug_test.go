@@ -0,0 +1,95 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+)
+
+type DebugSuite struct {
+	suite.Suite
+}
+
+func TestDebug(t *testing.T) {
+	suite.Run(t, new(DebugSuite))
+}
+
+func (suite *DebugSuite) TestTrackerDisabled() {
+	r := require.New(suite.T())
+	debug := newSearchDebugTracker(false)
+	r.Nil(debug)
+	hit := unitHit("a", "", 1)
+	debug.trackHit(hit, DEBUG_ORIGIN_REGULAR, "en")
+	debug.adjust(hit, "reason", nil)
+	r.Nil(debug.hitsDebug([]*elastic.SearchHit{hit}))
+}
+
+func (suite *DebugSuite) TestOriginsAndAdjustments() {
+	r := require.New(suite.T())
+	debug := newSearchDebugTracker(true)
+
+	regular := &elastic.SearchResult{Hits: &elastic.SearchHits{Hits: []*elastic.SearchHit{unitHit("a", "", 5)}}}
+	grammar := unitHit("b", "", 4)
+	grammar.Index = "prod_results_en"
+	classification := unitHit("c", "", 3)
+	classification.Index = consts.INTENT_INDEX_TAG
+	intents := &elastic.SearchResult{Hits: &elastic.SearchHits{Hits: []*elastic.SearchHit{grammar, classification}}}
+	debug.trackResult(regular, DEBUG_ORIGIN_REGULAR, "en")
+	debug.trackResult(intents, debugOriginIntents, "en")
+
+	// Tracking again does not override the origin and raw score.
+	hit := regular.Hits.Hits[0]
+	before := *hit.Score
+	*hit.Score += 200
+	debug.adjust(hit, "increment", &before)
+	debug.trackHit(hit, DEBUG_ORIGIN_GRAMMAR_FILTER, "en")
+
+	unknown := unitHit("d", "", 1)
+	hits := debug.hitsDebug([]*elastic.SearchHit{hit, grammar, classification, unknown})
+	r.Len(hits, 4)
+	r.Equal(DEBUG_ORIGIN_REGULAR, hits[0].Origin)
+	r.Equal("en", hits[0].Language)
+	r.Equal(5.0, *hits[0].RawScore)
+	r.Equal(205.0, *hits[0].Score)
+	r.Equal([]ScoreAdjustment{{Reason: "increment", Before: 5, After: 205}}, hits[0].Adjustments)
+	r.Equal(DEBUG_ORIGIN_GRAMMAR_INTENT, hits[1].Origin)
+	r.Equal(DEBUG_ORIGIN_CLASSIFICATION_INTENT, hits[2].Origin)
+	r.Equal(DEBUG_ORIGIN_UNKNOWN, hits[3].Origin)
+	r.Nil(hits[3].RawScore)
+	r.Equal(1.0, *hits[3].Score)
+}
+
+func (suite *DebugSuite) TestCollapsedAndPinned() {
+	r := require.New(suite.T())
+	debug := newSearchDebugTracker(true)
+
+	regular := &elastic.SearchResult{Hits: &elastic.SearchHits{TotalHits: 3, Hits: []*elastic.SearchHit{
+		unitHit("a1", "A", 5), unitHit("a2", "A", 7), unitHit("x", "", 3),
+	}}}
+	debug.trackResult(regular, DEBUG_ORIGIN_REGULAR, "en")
+	collapseByCollection([]*elastic.SearchResult{regular})
+	pinned := unitHit("p", "", 1)
+	applyBestBetMatch(regular, &BestBetMatch{Pinned: []string{"p"}}, true, map[string]*elastic.SearchHit{"p": pinned}, debug)
+
+	hits := debug.hitsDebug(regular.Hits.Hits)
+	r.Len(hits, 3)
+	r.Equal(DEBUG_ORIGIN_BEST_BETS, hits[0].Origin)
+	r.Len(hits[0].Adjustments, 1)
+	r.Equal(1.0, hits[0].Adjustments[0].Before)
+	r.Equal(fmt.Sprintf("%s%s", DEBUG_ORIGIN_COLLAPSED_PREFIX, DEBUG_ORIGIN_REGULAR), hits[1].Origin)
+	r.Equal(DEBUG_ORIGIN_REGULAR, hits[2].Origin)
+}
+
+func (suite *DebugSuite) TestTypoSuggestDebug() {
+	r := require.New(suite.T())
+	var disabled *TypoSuggestDebug
+	disabled.step("ignored %d", 1)
+	typoDebug := &TypoSuggestDebug{Checked: true}
+	typoDebug.step("Checking term [%s].", "helo")
+	r.Equal([]string{"Checking term [helo]."}, typoDebug.Path)
+}
@@ -7,29 +7,42 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/spf13/viper"
 	elastic "gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/es"
 )
 
 type ESManager struct {
-	esc *elastic.Client
-	url string
+	esc     *elastic.Client
+	backend es.Backend
 }
 
 func MakeESManager(url string) *ESManager {
 	esManager := &ESManager{}
-	esManager.url = url
+	backend, err := es.MakeBackend(viper.GetString("elasticsearch.backend"), url)
+	if err != nil {
+		log.Errorf("Failed setting up search backend: %+v", err)
+	}
+	esManager.backend = backend
 	esManager.GetClient()
 	return esManager
 }
 
+// Url of the search backend.
+func (esManager *ESManager) Url() string {
+	if esManager.backend == nil {
+		return ""
+	}
+	return esManager.backend.Url()
+}
+
 func (esManager *ESManager) GetClient() (*elastic.Client, error) {
 	var err error
+	if esManager.backend == nil {
+		return nil, errors.New("No search backend.")
+	}
 	if esManager.esc == nil {
 		log.Info("Trying to set up new connection to ElasticSearch")
-		url := viper.GetString("elasticsearch.url")
-
-		esManager.esc, err = elastic.NewClient(
-			elastic.SetURL(url),
-			elastic.SetSniff(false),
+		esManager.esc, err = esManager.backend.NewClient(
 			elastic.SetHealthcheckInterval(10*time.Second),
 			elastic.SetErrorLog(log.StandardLogger()),
 			// Should be commented out in prod.
@@ -47,4 +60,7 @@ func (esManager *ESManager) Stop() {
 	if esManager.esc != nil {
 		esManager.esc.Stop()
 	}
+	if esManager.backend != nil {
+		esManager.backend.Stop()
+	}
 }
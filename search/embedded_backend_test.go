@@ -0,0 +1,233 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+)
+
+// Runs the engine against the embedded backend with the real results mapping.
+type EmbeddedBackendSuite struct {
+	suite.Suite
+	backend es.Backend
+	esc     *elastic.Client
+	engine  *ESEngine
+}
+
+func TestEmbeddedBackend(t *testing.T) {
+	suite.Run(t, new(EmbeddedBackendSuite))
+}
+
+func (suite *EmbeddedBackendSuite) SetupSuite() {
+	r := suite.Require()
+	var err error
+	suite.backend, err = es.MakeBackend(consts.ES_BACKEND_EMBEDDED, "")
+	r.Nil(err)
+	suite.esc, err = suite.backend.NewClient()
+	r.Nil(err)
+	suite.engine = NewESEngine(suite.esc, nil, nil, nil, VariablesV2{}, consts.ES_SEARCH_RESULT_TYPES)
+
+	mappings, err := ioutil.ReadFile("../data/es/mappings/results/results-en.json")
+	r.Nil(err)
+	indexName := es.IndexName("prod", consts.ES_RESULTS_INDEX, consts.LANG_ENGLISH, "test")
+	_, err = suite.esc.CreateIndex(indexName).Body(string(mappings)).Do(context.TODO())
+	r.Nil(err)
+	_, err = suite.esc.Alias().Add(indexName, es.IndexNameForServing("prod", consts.ES_RESULTS_INDEX, consts.LANG_ENGLISH)).Do(context.TODO())
+	r.Nil(err)
+	grammarMappings, err := ioutil.ReadFile("../data/es/mappings/grammars/grammars-en.json")
+	r.Nil(err)
+	_, err = suite.esc.CreateIndex(GrammarIndexName(consts.LANG_ENGLISH, "")).Body(string(grammarMappings)).Do(context.TODO())
+	r.Nil(err)
+
+	results := []es.Result{
+		{
+			ResultType: consts.ES_RESULT_TYPE_UNITS,
+			MDB_UID:    "unit1",
+			TypedUids:  []string{es.KeyValue(consts.ES_UID_TYPE_CONTENT_UNIT, "unit1")},
+			FilterValues: append([]string{es.KeyValue(consts.FILTER_MEDIA_LANGUAGE, consts.LANG_ENGLISH)},
+				es.KeyValues(consts.FILTER_MEDIA_TYPE, []string{consts.MEDIA_TYPE_AUDIO, consts.MEDIA_TYPE_VIDEO})...),
+			Title:        "Lesson about the inner light",
+			FullTitle:    "Lesson about the inner light",
+			Duration:     15 * 60,
+			TitleSuggest: es.SuggestField{Input: []string{"Lesson about the inner light"}, Weight: 1},
+		},
+		{
+			ResultType:   consts.ES_RESULT_TYPE_UNITS,
+			MDB_UID:      "unit2",
+			TypedUids:    []string{es.KeyValue(consts.ES_UID_TYPE_CONTENT_UNIT, "unit2")},
+			FilterValues: []string{es.KeyValue(consts.FILTER_MEDIA_LANGUAGE, consts.LANG_ENGLISH), es.KeyValue(consts.FILTER_MEDIA_TYPE, consts.MEDIA_TYPE_VIDEO)},
+			Title:        "Congress opening",
+			FullTitle:    "Congress opening",
+			Content:      "Talk about unity.",
+			Duration:     90 * 60,
+			TitleSuggest: es.SuggestField{Input: []string{"Congress opening"}, Weight: 1},
+		},
+	}
+	bulk := suite.esc.Bulk()
+	for _, result := range results {
+		bulk.Add(elastic.NewBulkIndexRequest().Index(indexName).Type("result").Id(result.MDB_UID).Doc(result))
+	}
+	res, err := bulk.Do(context.TODO())
+	r.Nil(err)
+	r.False(res.Errors)
+}
+
+func (suite *EmbeddedBackendSuite) TearDownSuite() {
+	suite.esc.Stop()
+	suite.backend.Stop()
+}
+
+func (suite *EmbeddedBackendSuite) TestDoSearch() {
+	r := suite.Require()
+	query := Query{Term: "inner light", Original: "inner light", LanguageOrder: []string{consts.LANG_ENGLISH}}
+	res, err := suite.engine.DoSearch(context.TODO(), query, consts.SORT_BY_RELEVANCE, 0, 10, "", false, false, false, true, SearchDeadlines{}, nil)
+	r.Nil(err)
+	r.Empty(res.Degraded)
+	r.NotNil(res.SearchResult)
+	r.Len(res.SearchResult.Hits.Hits, 1)
+	var result es.Result
+	r.Nil(json.Unmarshal(*res.SearchResult.Hits.Hits[0].Source, &result))
+	r.Equal("unit1", result.MDB_UID)
+}
+
+// Fails or delays multi search requests to the grammars index.
+type grammarsFailingTransport struct {
+	delay time.Duration
+}
+
+func (t *grammarsFailingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && strings.HasSuffix(req.URL.Path, "/_msearch") {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if bytes.Contains(body, []byte(GrammarIndexName(consts.LANG_ENGLISH, ""))) {
+			if t.delay == 0 {
+				return &http.Response{
+					StatusCode: http.StatusInternalServerError,
+					Body:       ioutil.NopCloser(strings.NewReader(`{"error": "grammars failure"}`)),
+					Header:     http.Header{"Content-Type": []string{"application/json"}},
+					Request:    req,
+				}, nil
+			}
+			select {
+			case <-time.After(t.delay):
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+		}
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// Failed or late sub searches are skipped and reported, main query results are returned.
+func (suite *EmbeddedBackendSuite) TestDoSearchDegraded() {
+	r := suite.Require()
+	query := Query{Term: "inner light", Original: "inner light", LanguageOrder: []string{consts.LANG_ENGLISH}}
+	for _, c := range []struct {
+		delay     time.Duration
+		deadlines SearchDeadlines
+	}{
+		{0, SearchDeadlines{}},
+		{time.Second, SearchDeadlines{Grammars: 50 * time.Millisecond, Tweets: 50 * time.Millisecond, LessonSeries: 50 * time.Millisecond}},
+	} {
+		esc, err := suite.backend.NewClient(elastic.SetHttpClient(&http.Client{Transport: &grammarsFailingTransport{delay: c.delay}}))
+		r.Nil(err)
+		engine := NewESEngine(esc, nil, nil, nil, VariablesV2{}, consts.ES_SEARCH_RESULT_TYPES)
+		res, err := engine.DoSearch(context.TODO(), query, consts.SORT_BY_RELEVANCE, 0, 10, "", false, false, false, true, c.deadlines, nil)
+		esc.Stop()
+		r.Nil(err)
+		r.Contains(res.Degraded, SEARCH_STAGE_GRAMMARS)
+		r.NotContains(res.Degraded, SEARCH_STAGE_MAIN_QUERY)
+		r.NotNil(res.SearchResult)
+		r.Len(res.SearchResult.Hits.Hits, 1)
+		r.Equal("unit1", res.SearchResult.Hits.Hits[0].Id)
+	}
+}
+
+func (suite *EmbeddedBackendSuite) TestGetSuggestions() {
+	r := suite.Require()
+	query := Query{Term: "congr", LanguageOrder: []string{consts.LANG_ENGLISH}}
+	res, err := suite.engine.GetSuggestions(context.TODO(), query, "")
+	r.Nil(err)
+	sr, ok := res.(*elastic.SearchResult)
+	r.True(ok)
+	found := false
+	for _, suggestions := range sr.Suggest {
+		for _, s := range suggestions {
+			for _, option := range s.Options {
+				found = found || option.Id == "unit2"
+			}
+		}
+	}
+	r.True(found)
+}
+
+func (suite *EmbeddedBackendSuite) TestBuildTypoVocabularies() {
+	r := suite.Require()
+	variables := VariablesV2{consts.VAR_CONTENT_TYPE: {consts.LANG_ENGLISH: {"lessons": {"lessons", "lesson"}}}}
+	vocabularies, err := BuildTypoVocabularies(context.TODO(), suite.esc, variables, []string{consts.LANG_ENGLISH, consts.LANG_HEBREW})
+	r.Nil(err)
+	r.Equal(map[string]int{"lesson": 2, "about": 1, "the": 1, "inner": 1, "light": 1, "congress": 1, "opening": 1, "lessons": 1}, vocabularies[consts.LANG_ENGLISH])
+	r.Empty(vocabularies[consts.LANG_HEBREW])
+}
+
+func (suite *EmbeddedBackendSuite) searchUids(query Query) []string {
+	r := suite.Require()
+	resultsQuery, err := createResultsQuery(consts.ES_SEARCH_RESULT_TYPES, query, nil, nil, false)
+	r.Nil(err)
+	res, err := suite.esc.Search(es.IndexNameForServing("prod", consts.ES_RESULTS_INDEX, consts.LANG_ENGLISH)).Query(resultsQuery).Do(context.TODO())
+	r.Nil(err)
+	var uids []string
+	for _, hit := range res.Hits.Hits {
+		uids = append(uids, hit.Id)
+	}
+	return uids
+}
+
+func (suite *EmbeddedBackendSuite) TestDurationAndMediaTypeFilters() {
+	r := suite.Require()
+	query := ParseQuery("max_duration:20")
+	query.LanguageOrder = []string{consts.LANG_ENGLISH}
+	r.Equal([]string{"unit1"}, suite.searchUids(query))
+	query = ParseQuery("min_duration:20 media_type:video")
+	query.LanguageOrder = []string{consts.LANG_ENGLISH}
+	r.Equal([]string{"unit2"}, suite.searchUids(query))
+	query = ParseQuery("media_type:audio")
+	query.LanguageOrder = []string{consts.LANG_ENGLISH}
+	r.Equal([]string{"unit1"}, suite.searchUids(query))
+
+	query = ParseQuery("min_duration:twenty")
+	_, err := createResultsQuery(consts.ES_SEARCH_RESULT_TYPES, query, nil, nil, false)
+	r.NotNil(err)
+}
+
+func (suite *EmbeddedBackendSuite) TestDurationAndMediaTypeFacets() {
+	r := suite.Require()
+	request, err := NewFacetSearchRequest(Query{LanguageOrder: []string{consts.LANG_ENGLISH}}, CreateFacetAggregationOptions{
+		mediaTypeValues: consts.ALL_MEDIA_TYPES,
+		durationRanges:  []string{consts.DURATION_FILTER_UNDER_20_MIN, consts.DURATION_FILTER_20_TO_60_MIN, consts.DURATION_FILTER_OVER_60_MIN},
+	})
+	r.Nil(err)
+	mr, err := suite.esc.MultiSearch().Add(request).Do(context.TODO())
+	r.Nil(err)
+	r.Len(mr.Responses, 1)
+	mediaTypes, err := parseFacetAggregationForName(&mr.Responses[0].Aggregations, consts.FILTER_MEDIA_TYPE)
+	r.Nil(err)
+	r.Equal(map[string]int64{consts.MEDIA_TYPE_AUDIO: 1, consts.MEDIA_TYPE_VIDEO: 2, consts.MEDIA_TYPE_TEXT: 0}, mediaTypes)
+	durations, err := parseFacetAggregationForName(&mr.Responses[0].Aggregations, consts.AGG_FILTER_DURATIONS)
+	r.Nil(err)
+	r.Equal(map[string]int64{consts.DURATION_FILTER_UNDER_20_MIN: 1, consts.DURATION_FILTER_20_TO_60_MIN: 0, consts.DURATION_FILTER_OVER_60_MIN: 1}, durations)
+}
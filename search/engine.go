@@ -35,6 +35,16 @@ type ESEngine struct {
 	TokensCache       *TokensCache
 	variables         VariablesV2
 	searchResultTypes []string
+	// Optional curated results, applied on search results when set.
+	BestBets *BestBets
+	// Optional local typo dictionaries, used for typo suggest instead of Elastic suggester when set for the query language.
+	TypoDictionaries *TypoDictionaries
+	// Optional, adds forms of the query term in other scripts to the search.
+	Transliterator *Transliterator
+	// Optional, definitions for definition grammar intents.
+	Glossary *Glossary
+	// Send each stage of a multi search batch separately, used to compare requests count.
+	splitMultiSearch bool
 }
 
 type ClassificationIntent struct {
@@ -55,7 +65,8 @@ type ClassificationIntent struct {
 
 type FilteredSearchResult struct {
 	Term                     string
-	PreserveTermForHighlight bool //Use the term as highlight term even if we have same hit result from regular search
+	IntentKey                string // Intent type and filter values, stable between cursor pages.
+	PreserveTermForHighlight bool   //Use the term as highlight term even if we have same hit result from regular search
 	HitIdsMap                map[string]bool
 	Results                  []*elastic.SearchResult
 	MaxScore                 *float64
@@ -672,16 +683,41 @@ func (e *ESEngine) timeTrack(start time.Time, operation string) {
 	e.ExecutionTimeLog.Store(operation, elapsed)
 }
 
-func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, from int, size int, preference string, checkTypo bool, searchTweets bool, searchLessonSeries bool, withHighlights bool, timeoutForHighlight time.Duration) (*QueryResult, error) {
+// DoSearch searches for results page of the given query.
+// If cursor is not nil, from is ignored and the page starting at the cursor is returned
+// together with the next cursor, see SearchCursor.
+func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, from int, size int, preference string, checkTypo bool, searchTweets bool, searchLessonSeries bool, withHighlights bool, deadlines SearchDeadlines, cursor *SearchCursor) (*QueryResult, error) {
 	defer e.timeTrack(time.Now(), consts.LAT_DOSEARCH)
 
+	if cursor != nil {
+		from = cursor.Offset
+	}
+	// Keys of sub results for cursor pagination.
+	cursorKeys := make(map[*elastic.SearchResult]string)
+	debug := newSearchDebugTracker(query.Deb)
+	var typoDebug *TypoSuggestDebug
+	if query.Deb {
+		typoDebug = &TypoSuggestDebug{Checked: checkTypo}
+		if !checkTypo {
+			typoDebug.step("Typo suggest is disabled for this search.")
+		}
+	}
+
+	// Stages that did not complete in time or failed, their results are skipped.
+	degraded := &degradedStages{}
+
+	if e.Transliterator != nil && query.Term != "" {
+		query.Transliterations = e.Transliterator.Transliterate(query.Term, query.LanguageOrder)
+		LogIfDeb(&query, fmt.Sprintf("Transliterations: %v", query.Transliterations))
+	}
+
 	// Initializing all channels.
-	suggestChannel := make(chan null.String)
+	// Channels are buffered so that stages completing after their deadline will not block.
+	suggestChannel := make(chan null.String, 1)
 	grammarsSingleHitIntentsChannel := make(chan []Intent, 1)
 	grammarsFilterIntentsChannel := make(chan []Intent, 1)
-	grammarsFilteredResultsByLangChannel := make(chan map[string][]FilteredSearchResult)
-	tweetsByLangChannel := make(chan map[string]*elastic.SearchResult)
-	seriesLangChannel := make(chan map[string]*elastic.SearchResult)
+	tweetsByLangChannel := make(chan map[string]*elastic.SearchResult, 1)
+	seriesLangChannel := make(chan map[string]*elastic.SearchResult, 1)
 
 	filterIntents := []Intent{}
 	filteredByLang := map[string][]FilteredSearchResult{}
@@ -700,91 +736,149 @@ func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, fro
 		resultTypes = e.searchResultTypes
 	}
 
-	// Search grammars in parallel to native search.
-	go func() {
+	// Grammars, tweets and lesson series requests are independent, they are sent together in parallel to native search.
+	firstBatch := e.newMultiSearchBatch()
+	grammarsSearch, err := e.grammarsV2Search(&query, preference)
+	var grammarsBatched *batchedSearch
+	if err != nil {
+		log.Errorf("ESEngine.DoSearch - Error preparing grammars search: %+v", err)
+		degraded.add(SEARCH_STAGE_GRAMMARS)
+	} else {
+		grammarsBatched = firstBatch.add(SEARCH_STAGE_GRAMMARS, grammarsSearch.requests...)
+	}
+	var tweetsBatched *batchedSearch
+	if searchTweets {
+		if requests, err := e.tweetsRequests(query, preference); err != nil {
+			log.Errorf("ESEngine.DoSearch - Error preparing tweets search: %+v", err)
+			degraded.add(SEARCH_STAGE_TWEETS)
+		} else {
+			tweetsBatched = firstBatch.add(SEARCH_STAGE_TWEETS, requests...)
+		}
+	}
+	var seriesBatched *batchedSearch
+	if searchLessonSeries {
+		if requests, err := e.lessonsSeriesRequests(query, preference); err != nil {
+			log.Errorf("ESEngine.DoSearch - Error preparing lesson series search: %+v", err)
+			degraded.add(SEARCH_STAGE_LESSON_SERIES)
+		} else {
+			seriesBatched = firstBatch.add(SEARCH_STAGE_LESSON_SERIES, requests...)
+		}
+	}
+	firstBatchCtx, cancelFirstBatch := stageContext(ctx, maxDeadline(deadlines.Grammars, deadlines.Tweets, deadlines.LessonSeries))
+	defer cancelFirstBatch()
+	go firstBatch.do(firstBatchCtx)
+
+	grammarsCtx, cancelGrammars := stageContext(ctx, deadlines.Grammars)
+	// Stages get a copy of the query, as intents are appended to it while they may still run.
+	defer cancelGrammars()
+	go func(query Query) {
+		// Channels are buffered for a single value, results are sent once, also on panic.
+		singleHitIntents, filterIntents := []Intent{}, []Intent{}
 		defer func() {
 			if err := recover(); err != nil {
 				log.Errorf("ESEngine.DoSearch - Panic searching grammars: %+v", err)
-				grammarsSingleHitIntentsChannel <- []Intent{}
-				grammarsFilterIntentsChannel <- []Intent{}
-				grammarsFilteredResultsByLangChannel <- map[string][]FilteredSearchResult{}
+				degraded.add(SEARCH_STAGE_GRAMMARS)
+				singleHitIntents, filterIntents = []Intent{}, []Intent{}
 			}
-		}()
-		if singleHitIntents, filterIntents, err := e.SearchGrammarsV2(&query, from, size, sortBy, resultTypes, preference); err != nil {
-			log.Errorf("ESEngine.DoSearch - Error searching grammars: %+v", err)
-			grammarsSingleHitIntentsChannel <- []Intent{}
-			grammarsFilterIntentsChannel <- []Intent{}
-			grammarsFilteredResultsByLangChannel <- map[string][]FilteredSearchResult{}
-		} else {
 			grammarsSingleHitIntentsChannel <- singleHitIntents
 			grammarsFilterIntentsChannel <- filterIntents
-			if filtered, err := e.SearchByFilterIntents(filterIntents, query.Filters, query.Term, from, size, sortBy, resultTypes, preference, query.Deb); err != nil {
-				log.Errorf("ESEngine.DoSearch - Error searching filtered results by grammars: %+v", err)
-				grammarsFilteredResultsByLangChannel <- map[string][]FilteredSearchResult{}
-			} else {
-				grammarsFilteredResultsByLangChannel <- filtered
+		}()
+		if grammarsBatched == nil {
+			return
+		}
+		responses, err := grammarsBatched.wait(grammarsCtx)
+		if err == nil {
+			var singleHit, filter []Intent
+			if singleHit, filter, err = e.grammarsV2Intents(&query, grammarsSearch, responses); err == nil {
+				singleHitIntents, filterIntents = singleHit, filter
 			}
 		}
-	}()
+		if err != nil {
+			log.Errorf("ESEngine.DoSearch - Error searching grammars: %+v", err)
+			degraded.add(SEARCH_STAGE_GRAMMARS)
+		}
+	}(query)
 
-	if searchTweets {
+	tweetsCtx, cancelTweets := stageContext(ctx, deadlines.Tweets)
+	defer cancelTweets()
+	if tweetsBatched != nil {
 		// Search tweets in parallel to native search.
-		go func() {
+		go func(query Query) {
+			tweetsByLang := map[string]*elastic.SearchResult{}
 			defer func() {
 				if err := recover(); err != nil {
 					log.Errorf("ESEngine.DoSearch - Panic searching tweets: %+v", err)
-					tweetsByLangChannel <- map[string]*elastic.SearchResult{}
+					degraded.add(SEARCH_STAGE_TWEETS)
+					tweetsByLang = map[string]*elastic.SearchResult{}
 				}
+				tweetsByLangChannel <- tweetsByLang
 			}()
-			if tweetsByLang, err := e.SearchTweets(query, sortBy, from, size, preference); err != nil {
+			responses, err := tweetsBatched.wait(tweetsCtx)
+			if err == nil {
+				var byLang map[string]*elastic.SearchResult
+				if byLang, err = e.tweetsFromResponses(query, responses); err == nil {
+					tweetsByLang = byLang
+				}
+			}
+			if err != nil {
 				log.Errorf("ESEngine.DoSearch - Error searching tweets: %+v", err)
-				tweetsByLangChannel <- map[string]*elastic.SearchResult{}
-			} else {
-				tweetsByLangChannel <- tweetsByLang
+				degraded.add(SEARCH_STAGE_TWEETS)
 			}
-		}()
+		}(query)
+	} else {
+		tweetsByLangChannel <- map[string]*elastic.SearchResult{}
 	}
 
-	if searchLessonSeries {
+	seriesCtx, cancelSeries := stageContext(ctx, deadlines.LessonSeries)
+	defer cancelSeries()
+	if seriesBatched != nil {
 		// Search lesson series
-		go func() {
+		go func(query Query) {
+			seriesByLang := map[string]*elastic.SearchResult{}
 			defer func() {
 				if err := recover(); err != nil {
 					log.Errorf("ESEngine.DoSearch - Panic searching lesson series: %+v", err)
-					seriesLangChannel <- map[string]*elastic.SearchResult{}
+					degraded.add(SEARCH_STAGE_LESSON_SERIES)
+					seriesByLang = map[string]*elastic.SearchResult{}
 				}
+				seriesLangChannel <- seriesByLang
 			}()
-			if byLang, err := e.LessonsSeries(query, preference); err != nil {
+			responses, err := seriesBatched.wait(seriesCtx)
+			if err == nil {
+				var byLang map[string]*elastic.SearchResult
+				if byLang, err = e.lessonsSeriesFromResponses(query, responses); err == nil {
+					seriesByLang = byLang
+				}
+			}
+			if err != nil {
 				log.Errorf("ESEngine.DoSearch - Error searching lesson series: %+v", err)
-				seriesLangChannel <- map[string]*elastic.SearchResult{}
-			} else {
-				seriesLangChannel <- byLang
+				degraded.add(SEARCH_STAGE_LESSON_SERIES)
 			}
-		}()
+		}(query)
+	} else {
+		seriesLangChannel <- map[string]*elastic.SearchResult{}
+	}
+
+	// Single hit intents are sent before filter intents, so both are available when grammars stage is in time.
+	grammarsInTime := false
+	select {
+	case filterIntents = <-grammarsFilterIntentsChannel:
+		grammarsInTime = true
+	case <-grammarsCtx.Done():
+		select {
+		case filterIntents = <-grammarsFilterIntentsChannel:
+			grammarsInTime = true
+		default:
+			log.Warnf("ESEngine.DoSearch - Grammars search exceeded deadline: %+v", grammarsCtx.Err())
+			degraded.add(SEARCH_STAGE_GRAMMARS)
+		}
 	}
-
-	filterIntents = <-grammarsFilterIntentsChannel
 	LogIfDeb(&query, IntentsToStringDebug("GRAMMAR FILTER INTENTS", filterIntents))
 
-	if checkTypo {
-		go func() {
-			defer func() {
-				if err := recover(); err != nil {
-					log.Errorf("ESEngine.GetTypoSuggest - Panic getting typo suggest: %+v", err)
-					suggestChannel <- null.String{"", false}
-				}
-			}()
-			if suggestText, err := e.GetTypoSuggest(query, filterIntents); err != nil {
-				log.Errorf("ESEngine.GetTypoSuggest - Error getting typo suggest: %+v", err)
-				suggestChannel <- null.String{"", false}
-			} else {
-				suggestChannel <- suggestText
-			}
-		}()
-	}
-
 	LogIfDeb(&query, fmt.Sprintf("query.Intents: %d", len(query.Intents)))
-	query.Intents = append(query.Intents, <-grammarsSingleHitIntentsChannel...)
+	if grammarsInTime {
+		query.Intents = append(query.Intents, <-grammarsSingleHitIntentsChannel...)
+	}
 	LogIfDeb(&query, IntentsToStringDebug("GRAMMARS SINGLE HIT INTENTS", query.Intents))
 
 	hasClassificationIntentFromGrammar := false
@@ -796,12 +890,112 @@ func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, fro
 	}
 	LogIfDeb(&query, fmt.Sprintf("Has classification intent from grammar: %s", strconv.FormatBool(hasClassificationIntentFromGrammar)))
 
+	// Grammar filtered results, typo suggest and first round of intents depend only on grammars, they are sent together.
+	secondBatch := e.newMultiSearchBatch()
+	filterSearches, err := e.filterIntentsSearches(filterIntents, query.Filters, query.Term, from, size, sortBy, resultTypes, preference, query.Deb)
+	if err != nil {
+		log.Errorf("ESEngine.DoSearch - Error preparing filtered search by grammars: %+v", err)
+		degraded.add(SEARCH_STAGE_GRAMMARS)
+	}
+	filteredBatched := make([]*batchedSearch, len(filterSearches))
+	for i, fs := range filterSearches {
+		filteredBatched[i] = secondBatch.add(SEARCH_STAGE_GRAMMARS, fs.requests...)
+	}
+
+	// Filled by the typo suggest goroutine, should be read only after receiving the suggest.
+	var typoSuggestSteps *TypoSuggestDebug
+	if typoDebug != nil {
+		typoSuggestSteps = &TypoSuggestDebug{}
+	}
+	var typoSearch *typoSuggestSearch
+	var typoBatched *batchedSearch
+	if checkTypo {
+		if typoSearch, err = e.typoSuggestSearch(query, filterIntents, typoSuggestSteps); err != nil {
+			log.Errorf("ESEngine.GetTypoSuggest - Error preparing typo suggest: %+v", err)
+			degraded.add(SEARCH_STAGE_TYPO_SUGGEST)
+		} else if typoSearch != nil && !typoSearch.local {
+			typoBatched = secondBatch.add(SEARCH_STAGE_TYPO_SUGGEST, typoSearch.request())
+		}
+	}
+
 	LogIfDeb(&query, fmt.Sprintf("query.Intents: %d", len(query.Intents)))
 	// Grammar engine is currently support a search for classification intents according to 'by_content_type_and_source' rule only.
 	// If we have classification intents from Grammar, IntentsEngine will search for intents only by tag.
-	intents, err := e.AddIntents(&query, preference, sortBy, true, !hasClassificationIntentFromGrammar, filterIntents)
+	intentsSearch, err := e.intentsSearch(&query, preference, sortBy, true, !hasClassificationIntentFromGrammar, filterIntents)
+	var intentsBatched *batchedSearch
 	if err != nil {
-		log.Errorf("ESEngine.DoSearch - Error adding intents: %+v", err)
+		log.Errorf("ESEngine.DoSearch - Error preparing intents search: %+v", err)
+		degraded.add(SEARCH_STAGE_INTENTS)
+	} else if intentsSearch != nil {
+		intentsBatched = secondBatch.add(SEARCH_STAGE_INTENTS, intentsSearch.requests...)
+	}
+	secondBatchCtx, cancelSecondBatch := stageContext(ctx, maxDeadline(deadlines.Grammars, deadlines.TypoSuggest, deadlines.Intents))
+	defer cancelSecondBatch()
+	go secondBatch.do(secondBatchCtx)
+
+	typoSuggestCtx, cancelTypoSuggest := stageContext(ctx, deadlines.TypoSuggest)
+	defer cancelTypoSuggest()
+	if checkTypo {
+		go func(query Query) {
+			suggestText := null.String{"", false}
+			defer func() {
+				if err := recover(); err != nil {
+					log.Errorf("ESEngine.GetTypoSuggest - Panic getting typo suggest: %+v", err)
+					degraded.add(SEARCH_STAGE_TYPO_SUGGEST)
+					suggestText = null.String{"", false}
+				}
+				suggestChannel <- suggestText
+			}()
+			if typoSearch != nil && typoSearch.local {
+				suggestText = e.typoSuggestFromDictionaries(query, typoSearch, typoSuggestSteps)
+				return
+			}
+			if typoBatched == nil {
+				return
+			}
+			if responses, err := typoBatched.wait(typoSuggestCtx); err != nil {
+				log.Errorf("ESEngine.GetTypoSuggest - Error getting typo suggest: %+v", err)
+				degraded.add(SEARCH_STAGE_TYPO_SUGGEST)
+			} else {
+				suggestText = typoSuggestFromResult(query, typoSearch, responses[0], typoSuggestSteps)
+			}
+		}(query)
+	}
+	receiveTypoSuggest := func() null.String {
+		var suggestText null.String
+		select {
+		case suggestText = <-suggestChannel:
+		case <-typoSuggestCtx.Done():
+			select {
+			case suggestText = <-suggestChannel:
+			default:
+				log.Warnf("ESEngine.DoSearch - Typo suggest exceeded deadline: %+v", typoSuggestCtx.Err())
+				degraded.add(SEARCH_STAGE_TYPO_SUGGEST)
+				typoDebug.step("Typo suggest exceeded deadline.")
+				return null.String{"", false}
+			}
+		}
+		if typoDebug != nil {
+			typoDebug.Path = append(typoDebug.Path, typoSuggestSteps.Path...)
+			if suggestText.Valid {
+				typoDebug.Suggestion = suggestText.String
+			}
+		}
+		return suggestText
+	}
+
+	intents := []Intent{}
+	if intentsBatched != nil {
+		intentsCtx, cancelIntents := stageContext(ctx, deadlines.Intents)
+		responses, err := intentsBatched.wait(intentsCtx)
+		if err == nil {
+			intents, err = e.intentsFromFirstRound(intentsCtx, &query, preference, intentsSearch, responses)
+		}
+		cancelIntents()
+		if err != nil {
+			log.Errorf("ESEngine.DoSearch - Error adding intents: %+v", err)
+			degraded.add(SEARCH_STAGE_INTENTS)
+		}
 	}
 	LogIfDeb(&query, IntentsToStringDebug("ADD INTENTS", intents))
 	query.Intents = append(query.Intents, intents...)
@@ -818,19 +1012,33 @@ func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, fro
 			}
 		}
 	}
+	// Hidden and pinned results are skipped from the organic results, fetch more to fill the page.
+	bestBetsExcluded := 0
+	for _, lang := range query.LanguageOrder {
+		bestBetsExcluded = utils.MaxInt(bestBetsExcluded, len(e.BestBets.Match(query, lang).excluded()))
+	}
+	regularOptions := SearchRequestOptions{
+		resultTypes:        resultTypes,
+		index:              "",
+		query:              query,
+		sortBy:             sortBy,
+		from:               0,
+		size:               from + size + bestBetsExcluded,
+		preference:         preference,
+		useHighlight:       false,
+		partialHighlight:   false,
+		filterOutCUSources: filterOutCUSources}
+	if cursor != nil {
+		// Regular results continue right after the last hit of previous page.
+		regularOptions.size = size + bestBetsExcluded
+		regularOptions.cursorSort = true
+		regularOptions.searchAfterByLang = make(map[string][]interface{})
+		for _, lang := range query.LanguageOrder {
+			regularOptions.searchAfterByLang[lang] = cursor.SearchAfter[regularCursorKey(lang)]
+		}
+	}
 	multiSearchService := e.esc.MultiSearch()
-	requests, err := NewResultsSearchRequests(
-		SearchRequestOptions{
-			resultTypes:        resultTypes,
-			index:              "",
-			query:              query,
-			sortBy:             sortBy,
-			from:               0,
-			size:               from + size,
-			preference:         preference,
-			useHighlight:       false,
-			partialHighlight:   false,
-			filterOutCUSources: filterOutCUSources})
+	requests, err := NewResultsSearchRequests(regularOptions)
 	if err != nil {
 		return nil, errors.Wrap(err, "ESEngine.DoSearch - Error multisearch Do on creating requests.")
 	}
@@ -838,10 +1046,21 @@ func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, fro
 
 	// Do regular search.
 	beforeDoSearch := time.Now()
-	mr, err := multiSearchService.Do(context.TODO())
+	mainQueryCtx, cancelMainQuery := stageContext(ctx, deadlines.MainQuery)
+	mr, err := multiSearchService.Do(mainQueryCtx)
+	cancelMainQuery()
 	e.timeTrack(beforeDoSearch, consts.LAT_DOSEARCH_MULTISEARCHDO)
 	if err != nil {
-		return nil, errors.Wrap(err, "ESEngine.DoSearch - Error multisearch Do.")
+		if ctx.Err() != nil || mainQueryCtx.Err() != context.DeadlineExceeded {
+			return nil, errors.Wrap(err, "ESEngine.DoSearch - Error multisearch Do.")
+		}
+		// Continue with results of other stages.
+		log.Warnf("ESEngine.DoSearch - Main query exceeded deadline: %+v", err)
+		degraded.add(SEARCH_STAGE_MAIN_QUERY)
+		mr = &elastic.MultiSearchResult{Responses: make([]*elastic.SearchResult, len(query.LanguageOrder))}
+		for i := range mr.Responses {
+			mr.Responses[i] = &elastic.SearchResult{Hits: &elastic.SearchHits{Hits: []*elastic.SearchHit{}}}
+		}
 	}
 	shouldMergeResults := false
 	//  Right now we are testing the language results merge for Spanish UI only
@@ -937,6 +1156,8 @@ func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, fro
 				resultsByLang[lang] = make([]*elastic.SearchResult, 0)
 			}
 			resultsByLang[lang] = append(resultsByLang[lang], currentResults)
+			cursorKeys[currentResults] = regularCursorKey(lang)
+			debug.trackResult(currentResults, DEBUG_ORIGIN_REGULAR, lang)
 		}
 	}
 
@@ -958,32 +1179,72 @@ func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, fro
 				resultsByLang[lang] = make([]*elastic.SearchResult, 0)
 			}
 			resultsByLang[lang] = append(resultsByLang[lang], intentResults)
+			cursorKeys[intentResults] = fmt.Sprintf("intents:%s", lang)
+			debug.trackResult(intentResults, debugOriginIntents, lang)
 		}
 	}
 
 	if searchTweets {
-		tweetsByLang = <-tweetsByLangChannel
+		select {
+		case tweetsByLang = <-tweetsByLangChannel:
+		case <-tweetsCtx.Done():
+			select {
+			case tweetsByLang = <-tweetsByLangChannel:
+			default:
+				log.Warnf("ESEngine.DoSearch - Tweets search exceeded deadline: %+v", tweetsCtx.Err())
+				degraded.add(SEARCH_STAGE_TWEETS)
+			}
+		}
 		LogIfDeb(&query, ResultsMapToStringDebug("TWEETS", tweetsByLang, 3))
 		for lang, tweets := range tweetsByLang {
 			if _, ok := resultsByLang[lang]; !ok {
 				resultsByLang[lang] = make([]*elastic.SearchResult, 0)
 			}
 			resultsByLang[lang] = append(resultsByLang[lang], tweets)
+			cursorKeys[tweets] = fmt.Sprintf("tweets:%s", lang)
+			debug.trackResult(tweets, DEBUG_ORIGIN_TWEETS, lang)
 		}
 	}
 
 	if searchLessonSeries {
-		seriesByLang = <-seriesLangChannel
+		select {
+		case seriesByLang = <-seriesLangChannel:
+		case <-seriesCtx.Done():
+			select {
+			case seriesByLang = <-seriesLangChannel:
+			default:
+				log.Warnf("ESEngine.DoSearch - Lesson series search exceeded deadline: %+v", seriesCtx.Err())
+				degraded.add(SEARCH_STAGE_LESSON_SERIES)
+			}
+		}
 		LogIfDeb(&query, ResultsMapToStringDebug("SERIES", seriesByLang, 3))
 		for lang, s := range seriesByLang {
 			if _, ok := resultsByLang[lang]; !ok {
 				resultsByLang[lang] = make([]*elastic.SearchResult, 0)
 			}
 			resultsByLang[lang] = append(resultsByLang[lang], s)
+			cursorKeys[s] = fmt.Sprintf("series:%s", lang)
+			debug.trackResult(s, DEBUG_ORIGIN_LESSON_SERIES, lang)
 		}
 	}
 
-	filteredByLang = <-grammarsFilteredResultsByLangChannel
+	filteredResponses := make([][]*elastic.SearchResult, len(filterSearches))
+	for i, fb := range filteredBatched {
+		if responses, err := fb.wait(grammarsCtx); err != nil {
+			log.Errorf("ESEngine.DoSearch - Error searching filtered results by grammars: %+v", err)
+			degraded.add(SEARCH_STAGE_GRAMMARS)
+		} else {
+			filteredResponses[i] = responses
+		}
+	}
+	filteredByLang = e.filterIntentsResults(filterSearches, filteredResponses)
+	for lang, filtered := range filteredByLang {
+		for _, fr := range filtered {
+			for _, result := range fr.Results {
+				debug.trackResult(result, DEBUG_ORIGIN_GRAMMAR_FILTER, lang)
+			}
+		}
+	}
 	LogIfDeb(&query, fmt.Sprintf("---- GRAMMAR SEARCH FILTERED ----"))
 	for k, v := range filteredByLang {
 		LogIfDeb(&query, fmt.Sprintf("\t%+v:", k))
@@ -1014,14 +1275,17 @@ func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, fro
 							}
 							if src.ResultType == consts.ES_RESULT_TYPE_UNITS {
 								if utils.Contains(utils.Is(src.TypedUids), es.KeyValue(consts.ES_UID_TYPE_COLLECTION, *fr.ProgramCollection)) {
+									before := hit.Score
 									if programToReplaceIndex < len(programsToReplaceWithGrammarResults) {
 										hit.Score = &programsToReplaceWithGrammarResults[programToReplaceIndex].score
 										programsToReplaceWithGrammarResults[programToReplaceIndex].grammarHitId = &hit.Id
 										// TBD update hit explanation
 										programToReplaceIndex++
+										debug.adjust(hit, "Program grammar result takes the score of regular program result.", before)
 									} else {
 										zero := 0.0
 										hit.Score = &zero
+										debug.adjust(hit, "Program grammar result without regular program result to replace.", before)
 									}
 								}
 							}
@@ -1114,7 +1378,9 @@ func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, fro
 							}
 						}
 						if !replaced && hit.Score != nil {
+							before := *hit.Score
 							*hit.Score *= boost
+							debug.adjust(hit, fmt.Sprintf("Normalize grammar filter results scores by regular results max score (boost %.2f).", boost), &before)
 						}
 						maxScore = math.Max(*hit.Score, maxScore)
 						result.Hits.MaxScore = &maxScore
@@ -1130,8 +1396,10 @@ func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, fro
 						for i := 0; i < programToReplaceIndex; i++ {
 							if hit.Id == programsToReplaceWithGrammarResults[i].hitId {
 								LogIfDeb(&query, fmt.Sprintf("Setting zero score for %s.", hit.Id))
+								before := hit.Score
 								zero := 0.0
 								hit.Score = &zero
+								debug.adjust(hit, "Regular program result replaced by program grammar result.", before)
 								break
 							}
 						}
@@ -1140,7 +1408,9 @@ func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, fro
 						if _, hasId := fr.HitIdsMap[hit.Id]; hasId {
 							LogIfDeb(&query, fmt.Sprintf("Same hit found for both regular and grammar filtered results: %v", hit.Id))
 							if hit.Score != nil && *hit.Score > 5 { // We will increment the score only if the result is relevant enough (score > 5)
+								before := *hit.Score
 								*hit.Score += consts.FILTER_GRAMMAR_INCREMENT_FOR_MATCH_TO_FULL_TERM
+								debug.adjust(hit, "Regular result also found by grammar filter search.", &before)
 							}
 							if !fr.PreserveTermForHighlight {
 								// We remove this hit id from HitIdsMap in order to highlight the original search term and not $Text val.
@@ -1153,6 +1423,9 @@ func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, fro
 		}
 		for _, fr := range filtered {
 			resultsByLang[lang] = append(resultsByLang[lang], fr.Results...)
+			for j, r := range fr.Results {
+				cursorKeys[r] = fmt.Sprintf("grammar:%s:%s:%d", lang, fr.IntentKey, j)
+			}
 		}
 	}
 
@@ -1172,7 +1445,72 @@ func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, fro
 		}
 	}
 
-	ret, err := joinResponses(sortBy, from, size, results...)
+	if query.Collapse == consts.SEARCH_COLLAPSE_COLLECTION {
+		collapseByCollection(results)
+	}
+
+	// Best bets are matched before paging, pinned results count against the page size.
+	bestBetsLangs := query.LanguageOrder
+	if currentLang != "" {
+		bestBetsLangs = []string{currentLang}
+	}
+	var match *BestBetMatch
+	pinnedHits := map[string]*elastic.SearchHit{}
+	if len(bestBetsLangs) > 0 {
+		if match = e.BestBets.Match(query, bestBetsLangs[0]); match != nil {
+			LogIfDeb(&query, fmt.Sprintf("Best bets match: %+v", match))
+			// Pinned results are needed for offset of every page, in cursor mode only for the first page.
+			if len(match.Pinned) > 0 && (cursor == nil || cursor.Offset == 0) {
+				pinnedHits, err = e.fetchPinnedHits(ctx, match.Pinned, bestBetsLangs)
+				if err != nil {
+					return nil, errors.Wrap(err, "ESEngine.DoSearch - Error fetching pinned results.")
+				}
+			}
+		}
+	}
+
+	var ret *elastic.SearchResult
+	var nextCursor *string
+	if cursor != nil {
+		subResults := make([]cursorSubResult, len(results))
+		for i, r := range results {
+			key := cursorKeys[r]
+			subResults[i] = cursorSubResult{key: key, searchAfter: strings.HasPrefix(key, regularCursorKey("")), result: r}
+		}
+		var next *SearchCursor
+		ret, next, err = bestBetsCursorPage(sortBy, size, cursor, subResults, match, pinnedHits, debug)
+		if err == nil && next != nil {
+			encoded, encodeErr := EncodeSearchCursor(next)
+			if encodeErr != nil {
+				return nil, errors.Wrap(encodeErr, "ESEngine.DoSearch - Error encoding next cursor.")
+			}
+			nextCursor = &encoded
+		}
+	} else if match != nil {
+		ret, err = joinResponses(sortBy, 0, from+size+len(match.excluded()), results...)
+		if err == nil && ret != nil {
+			bestBetsPage(ret, match, pinnedHits, from, size, debug)
+		}
+	} else {
+		ret, err = joinResponses(sortBy, from, size, results...)
+	}
+
+	var redirect string
+	if err == nil && ret != nil && match != nil {
+		redirect = match.Redirect
+	}
+
+	var searchDebug *SearchDebug
+	if query.Deb {
+		searchDebug = &SearchDebug{Hits: []*HitDebug{}, TypoSuggest: typoDebug}
+		if e.TokensCache != nil {
+			stats := e.TokensCache.Stats()
+			searchDebug.TokensCache = &stats
+		}
+		if ret != nil && ret.Hits != nil {
+			searchDebug.Hits = debug.hitsDebug(ret.Hits.Hits)
+		}
+	}
 
 	LogIfDeb(&query, "--- AFTER JOIN ---")
 	LogIfDeb(&query, ResultToStringDebug(ret, 20))
@@ -1221,6 +1559,29 @@ func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, fro
 					}
 					continue
 				}
+				if h.Type == consts.SEARCH_RESULT_UNITS_BY_COLLECTION && h.InnerHits != nil {
+					if unitHits, ok := h.InnerHits[consts.SEARCH_RESULT_UNITS_BY_COLLECTION]; ok {
+						for _, uh := range unitHits.Hits.Hits {
+							req, err := NewResultsSearchRequest(
+								SearchRequestOptions{
+									resultTypes:      []string{consts.ES_RESULT_TYPE_UNITS},
+									docIds:           []string{uh.Id},
+									index:            uh.Index,
+									query:            Query{ExactTerms: query.ExactTerms, Term: query.Term, Filters: query.Filters, LanguageOrder: highlightsLangs, Deb: query.Deb},
+									sortBy:           consts.SORT_BY_RELEVANCE,
+									from:             0,
+									size:             1,
+									preference:       preference,
+									useHighlight:     true,
+									partialHighlight: true})
+							if err != nil {
+								return nil, errors.Wrap(err, "ESEngine.DoSearch - Error creating collapsed units highlight request in multisearch Do.")
+							}
+							highlightRequests = append(highlightRequests, req)
+						}
+					}
+					continue
+				}
 				if h.Id == "" || strings.HasPrefix(h.Index, "intent-") {
 					// Bypass intent
 					continue
@@ -1272,7 +1633,7 @@ func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, fro
 				beforeHighlightsDoSearch := time.Now()
 				for i, hr := range highlightRequests {
 					go func(req *elastic.SearchRequest, idx int) {
-						highlightCtx, cancelFn := context.WithTimeout(context.TODO(), timeoutForHighlight)
+						highlightCtx, cancelFn := stageContext(ctx, deadlines.Highlights)
 						defer cancelFn()
 						mssHighlights := e.esc.MultiSearch().Add(req)
 						mr, err := mssHighlights.Do(highlightCtx)
@@ -1290,6 +1651,7 @@ func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, fro
 				responses := []*elastic.SearchResult{}
 				for i, mhResult := range mhResults {
 					if mhErrors[i] == context.DeadlineExceeded {
+						degraded.add(SEARCH_STAGE_HIGHLIGHTS)
 						continue
 					}
 					if mhErrors[i] != nil {
@@ -1319,6 +1681,16 @@ func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, fro
 											}
 										}
 									}
+								} else if h.Type == consts.SEARCH_RESULT_UNITS_BY_COLLECTION && h.InnerHits != nil {
+									if unitHits, ok := h.InnerHits[consts.SEARCH_RESULT_UNITS_BY_COLLECTION]; ok {
+										for k, uh := range unitHits.Hits.Hits {
+											if uh.Id == hr.Id {
+												//  Replacing original unit result with highlighted unit result, keep the original score.
+												hr.Score = uh.Score
+												unitHits.Hits.Hits[k] = hr
+											}
+										}
+									}
 								}
 							}
 						}
@@ -1331,6 +1703,8 @@ func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, fro
 		for _, hit := range ret.Hits.Hits {
 			if hit.Type == consts.SEARCH_RESULT_TWEETS_MANY {
 				err = e.NativizeTweetsHitForClient(hit, consts.SEARCH_RESULT_TWEETS_MANY)
+			} else if hit.Type == consts.SEARCH_RESULT_UNITS_BY_COLLECTION {
+				err = nativizeCollapsedHitForClient(hit)
 			} else if hit.Type != consts.GRAMMAR_TYPE_LANDING_PAGE {
 				var src es.Result
 				err = json.Unmarshal(*hit.Source, &src)
@@ -1368,19 +1742,26 @@ func (e *ESEngine) DoSearch(ctx context.Context, query Query, sortBy string, fro
 			}
 		}
 		if checkTypo && (ret.Hits.MaxScore == nil || *ret.Hits.MaxScore < consts.MIN_RESULTS_SCORE_TO_IGNOGRE_TYPO_SUGGEST) {
-			suggestText = <-suggestChannel
+			suggestText = receiveTypoSuggest()
+			if ret.Hits.MaxScore != nil {
+				typoDebug.step("Results max score %.2f is below %d, suggestion is used.", *ret.Hits.MaxScore, consts.MIN_RESULTS_SCORE_TO_IGNOGRE_TYPO_SUGGEST)
+			}
+		} else if checkTypo && query.Deb {
+			// Wait for the suggest to complete the debug path.
+			receiveTypoSuggest()
+			typoDebug.step("Results max score %.2f is not below %d, suggestion is ignored.", *ret.Hits.MaxScore, consts.MIN_RESULTS_SCORE_TO_IGNOGRE_TYPO_SUGGEST)
 		}
-		return &QueryResult{ret, suggestText, currentLang, nil}, err
+		return &QueryResult{ret, suggestText, currentLang, nil, nextCursor, redirect, searchDebug, degraded.list(), DefinitionIntents(query.Intents)}, err
 	}
 
 	if checkTypo {
-		suggestText = <-suggestChannel
+		suggestText = receiveTypoSuggest()
 	}
 
 	if len(mr.Responses) > 0 {
 		// This happens when there are no responses with hits.
 		// Note, we don't filter here intents by language.
-		return &QueryResult{mr.Responses[0], suggestText, currentLang, nil}, err
+		return &QueryResult{mr.Responses[0], suggestText, currentLang, nil, nil, "", searchDebug, degraded.list(), DefinitionIntents(query.Intents)}, err
 	}
 	return nil, errors.Wrap(err, "ESEngine.DoSearch - No responses from multi search.")
 }
@@ -1396,6 +1777,8 @@ func (e *ESEngine) GetCounts(ctx context.Context, query Query, allSourceUIDs []s
 		contentTypeValues:      consts.SECTION_CT_TYPES[:],
 		dateRanges:             []string{consts.DATE_FILTER_TODAY, consts.DATE_FILTER_YESTERDAY, consts.DATE_FILTER_LAST_7_DAYS, consts.DATE_FILTER_LAST_30_DAYS},
 		personUIDs:             []string{mdb.PERSONS_REGISTRY.ByPattern[consts.P_RAV].UID, mdb.PERSONS_REGISTRY.ByPattern[consts.P_RABASH].UID},
+		mediaTypeValues:        consts.ALL_MEDIA_TYPES[:],
+		durationRanges:         []string{consts.DURATION_FILTER_UNDER_20_MIN, consts.DURATION_FILTER_20_TO_60_MIN, consts.DURATION_FILTER_OVER_60_MIN},
 	}
 
 	multiSearchService := e.esc.MultiSearch()
@@ -1407,18 +1790,25 @@ func (e *ESEngine) GetCounts(ctx context.Context, query Query, allSourceUIDs []s
 		consts.FILTER_ORIGINAL_LANGUAGE,
 		consts.AGG_FILTER_DATES,
 		consts.FILTER_PERSON,
+		consts.FILTER_MEDIA_TYPE,
+		consts.AGG_FILTER_DURATIONS,
 	} {
 		// If filter exist in query, count it with separate facet request.
-		// Handle dates in special way as the AGG_FILTER_DATES is applied via
-		// two different filters FILTER_START_DATE and FILTER_END_DATE.
-		if (countFilter == consts.AGG_FILTER_DATES &&
-			(len(query.Filters[consts.FILTER_START_DATE]) > 0 || len(query.Filters[consts.FILTER_END_DATE]) > 0)) ||
+		// Handle dates and durations in special way as AGG_FILTER_DATES is applied via
+		// two different filters FILTER_START_DATE and FILTER_END_DATE, same for
+		// AGG_FILTER_DURATIONS with FILTER_MIN_DURATION and FILTER_MAX_DURATION.
+		rangeFilters := map[string][]string{
+			consts.AGG_FILTER_DATES:     {consts.FILTER_START_DATE, consts.FILTER_END_DATE},
+			consts.AGG_FILTER_DURATIONS: {consts.FILTER_MIN_DURATION, consts.FILTER_MAX_DURATION},
+		}[countFilter]
+		if (len(rangeFilters) > 0 &&
+			(len(query.Filters[rangeFilters[0]]) > 0 || len(query.Filters[rangeFilters[1]]) > 0)) ||
 			len(query.Filters[countFilter]) > 0 {
 			// Shallow copy query without the relevant filter.
 			filterQuery := query
 			filterQuery.Filters = make(map[string][]string)
 			for k, v := range query.Filters {
-				if k != countFilter || (countFilter == consts.AGG_FILTER_DATES && (k != consts.FILTER_START_DATE && k != consts.FILTER_END_DATE)) {
+				if k != countFilter && !utils.StringInSlice(k, rangeFilters) {
 					filterQuery.Filters[k] = v
 				}
 			}
@@ -1446,6 +1836,12 @@ func (e *ESEngine) GetCounts(ctx context.Context, query Query, allSourceUIDs []s
 			case consts.FILTER_PERSON:
 				filterOptions.personUIDs = options.personUIDs
 				options.personUIDs = []string(nil)
+			case consts.FILTER_MEDIA_TYPE:
+				filterOptions.mediaTypeValues = options.mediaTypeValues
+				options.mediaTypeValues = []string(nil)
+			case consts.AGG_FILTER_DURATIONS:
+				filterOptions.durationRanges = options.durationRanges
+				options.durationRanges = []string(nil)
 			}
 
 			request, err := NewFacetSearchRequest(filterQuery, filterOptions)
@@ -1460,7 +1856,8 @@ func (e *ESEngine) GetCounts(ctx context.Context, query Query, allSourceUIDs []s
 	if len(options.contentTypeValues) > 0 || len(options.sourceUIDs) > 0 ||
 		len(options.tagUIDs) > 0 || len(options.mediaLanguageValues) > 0 ||
 		len(options.originalLanguageValues) > 0 || len(options.dateRanges) > 0 ||
-		len(options.personUIDs) > 0 {
+		len(options.personUIDs) > 0 || len(options.mediaTypeValues) > 0 ||
+		len(options.durationRanges) > 0 {
 		request, err := NewFacetSearchRequest(query, options)
 		if err != nil {
 			return nil, errors.Wrap(err, "ESEngine.GetSourceCounts - Error creating facet search source.")
@@ -1550,6 +1947,24 @@ func parseFacetAggregationsResult(results []*elastic.SearchResult) (*FacetSearch
 			}
 			r.Persons = persons
 		}
+
+		if mediaTypes, err := parseFacetAggregationForName(agg, consts.FILTER_MEDIA_TYPE); err != nil {
+			return nil, err
+		} else if len(mediaTypes) > 0 {
+			if r.MediaTypes != nil {
+				return nil, errors.New("ESEngine.GetSourceCounts - Aggregating media type filter twice")
+			}
+			r.MediaTypes = mediaTypes
+		}
+
+		if durations, err := parseFacetAggregationForName(agg, consts.AGG_FILTER_DURATIONS); err != nil {
+			return nil, err
+		} else if len(durations) > 0 {
+			if r.Durations != nil {
+				return nil, errors.New("ESEngine.GetSourceCounts - Aggregating durations filter twice")
+			}
+			r.Durations = durations
+		}
 	}
 
 	if len(r.Tags) == 0 ||
@@ -1558,7 +1973,9 @@ func parseFacetAggregationsResult(results []*elastic.SearchResult) (*FacetSearch
 		len(r.OriginalLanguages) == 0 ||
 		len(r.Sources) == 0 ||
 		len(r.Dates) == 0 ||
-		len(r.Persons) == 0 {
+		len(r.Persons) == 0 ||
+		len(r.MediaTypes) == 0 ||
+		len(r.Durations) == 0 {
 		return nil, errors.New("ESEngine.GetSourceCounts - One of the aggregations is empty, expected all to be non-empty.")
 	}
 
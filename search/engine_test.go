@@ -20,7 +20,8 @@ import (
 
 type EngineSuite struct {
 	suite.Suite
-	esc *elastic.Client
+	backend es.Backend
+	esc     *elastic.Client
 }
 
 func (suite *EngineSuite) SetupSuite() {
@@ -28,9 +29,9 @@ func (suite *EngineSuite) SetupSuite() {
 
 	la := ESLogAdapter{T: suite.T()}
 	var err error
-	suite.esc, err = elastic.NewClient(
-		elastic.SetURL(viper.GetString("elasticsearch.url")),
-		elastic.SetSniff(false),
+	suite.backend, err = es.MakeBackend(viper.GetString("elasticsearch.backend"), viper.GetString("elasticsearch.url"))
+	suite.Require().Nil(err)
+	suite.esc, err = suite.backend.NewClient(
 		elastic.SetHealthcheckInterval(10*time.Second),
 		elastic.SetErrorLog(la),
 		elastic.SetInfoLog(la),
@@ -40,6 +41,7 @@ func (suite *EngineSuite) SetupSuite() {
 
 func (suite *EngineSuite) TearDownSuite() {
 	suite.esc.Stop()
+	suite.backend.Stop()
 }
 
 // In order for 'go test' to run this suite, we need to create
@@ -0,0 +1,103 @@
+package search
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/olivere/elastic.v6"
+)
+
+type EvalSearcherSuite struct {
+	suite.Suite
+}
+
+func TestEvalSearcher(t *testing.T) {
+	suite.Run(t, new(EvalSearcherSuite))
+}
+
+// Searches with function, as in process searcher.
+type funcEvalSearcher func(q EvalQuery, limit int) (QueryResult, error)
+
+func (f funcEvalSearcher) Search(q EvalQuery, limit int) (QueryResult, error) {
+	return f(q, limit)
+}
+
+func (f funcEvalSearcher) String() string {
+	return "func"
+}
+
+func evalSearcherResult(q EvalQuery) QueryResult {
+	hits := []*elastic.SearchHit{unitHit("aaaaaaaa", "", 9), unitHit("bbbbbbbb", "", 7), unitHit("cccccccc", "", 5)}
+	if q.Query == "reversed" {
+		hits[0], hits[2] = hits[2], hits[0]
+	}
+	return QueryResult{SearchResult: &elastic.SearchResult{Hits: &elastic.SearchHits{TotalHits: 3, Hits: hits}}, Language: q.Language}
+}
+
+func (suite *EvalSearcherSuite) TestSameReports() {
+	r := suite.Require()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		q := EvalQuery{Query: req.URL.Query().Get("q"), Language: req.URL.Query().Get("language")}
+		json.NewEncoder(w).Encode(evalSearcherResult(q))
+	}))
+	defer server.Close()
+
+	unitUrl := "https://kabbalahmedia.info/en/lessons/cu/"
+	queries := []EvalQuery(nil)
+	for _, q := range []string{"regular", "reversed", "failed"} {
+		eq := EvalQuery{Language: "en", Query: q, Weight: 2}
+		for _, e := range []string{unitUrl + "aaaaaaaa", unitUrl + "cccccccc"} {
+			eq.Expectations = append(eq.Expectations, ParseExpectation(e, nil))
+		}
+		queries = append(queries, eq)
+	}
+	limits := []int(nil)
+	mutex := sync.Mutex{}
+	inProcess := funcEvalSearcher(func(q EvalQuery, limit int) (QueryResult, error) {
+		mutex.Lock()
+		limits = append(limits, limit)
+		mutex.Unlock()
+		if q.Query == "failed" {
+			return QueryResult{}, errors.New("failed")
+		}
+		return evalSearcherResult(q), nil
+	})
+
+	results, losses, err := EvalWithSearcher(queries[:2], inProcess)
+	r.Nil(err)
+	serverResults, serverLosses, err := Eval(queries[:2], server.URL)
+	r.Nil(err)
+	r.Equal(ResultsByExpectation(queries[:2], serverResults), ResultsByExpectation(queries[:2], results))
+	r.Equal(serverLosses, losses)
+	r.Equal([]int{1, 3}, results.Results[0].Rank)
+	r.Equal([]int{3, 1}, results.Results[1].Rank)
+	r.Equal([]int{10, 10}, limits)
+
+	res := EvaluateQueryWithSearcher(queries[2], inProcess, false)
+	r.NotNil(res.err)
+	r.Equal([]int{SQ_SERVER_ERROR, SQ_SERVER_ERROR}, res.SearchQuality)
+}
+
+// Base and exp are scraped concurrently, run with -race.
+func (suite *EvalSearcherSuite) TestDiff() {
+	r := suite.Require()
+	searcher := funcEvalSearcher(func(q EvalQuery, limit int) (QueryResult, error) {
+		return evalSearcherResult(q), nil
+	})
+	queries := []EvalQuery{
+		{Language: "en", Query: "regular", Weight: 2},
+		{Language: "en", Query: "reversed", Weight: 1},
+		{Language: "en", Query: "other", Weight: 3},
+	}
+	diffs, err := EvalQuerySetDiffWithSearchers(queries, searcher, searcher, -1)
+	r.Nil(err)
+	r.Equal("", diffs.ErrorStr)
+	r.Equal(3, diffs.Scraped)
+	r.Equal(0, diffs.Diffs)
+	r.Equal(float64(6), diffs.TotalWeight)
+}
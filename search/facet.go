@@ -89,6 +89,28 @@ func createFacetAggregationQueries(options CreateFacetAggregationOptions) map[st
 		queries[consts.FILTER_PERSON] = createFacetAggregationQuery(options.personUIDs, consts.FILTER_PERSON)
 	}
 
+	if len(options.mediaTypeValues) > 0 {
+		queries[consts.FILTER_MEDIA_TYPE] = createFacetAggregationQuery(options.mediaTypeValues, consts.FILTER_MEDIA_TYPE)
+	}
+
+	if len(options.durationRanges) > 0 {
+		agg := elastic.NewFiltersAggregation()
+		for _, durationRange := range options.durationRanges {
+			// Duration is indexed in seconds.
+			durationQuery := elastic.NewRangeQuery("duration")
+			switch durationRange {
+			case consts.DURATION_FILTER_UNDER_20_MIN:
+				durationQuery.Lt(20 * 60)
+			case consts.DURATION_FILTER_20_TO_60_MIN:
+				durationQuery.Gte(20 * 60).Lte(60 * 60)
+			case consts.DURATION_FILTER_OVER_60_MIN:
+				durationQuery.Gt(60 * 60)
+			}
+			agg.FilterWithName(durationRange, durationQuery)
+		}
+		queries[consts.AGG_FILTER_DURATIONS] = agg
+	}
+
 	return queries
 }
 
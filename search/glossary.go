@@ -0,0 +1,199 @@
+package search
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+)
+
+const (
+	GLOSSARY_FILE_SUFFIX = "glossary"
+
+	GLOSSARY_FIELD_NAME       = "name"
+	GLOSSARY_FIELD_DEFINITION = "definition"
+	GLOSSARY_FIELD_SOURCE     = "source"
+)
+
+// Definition of a glossary term in some language.
+type GlossaryEntry struct {
+	Term string `json:"term"`
+	// Phrases of the term in the language, the first is the title.
+	Names      []string `json:"names"`
+	Definition string   `json:"definition"`
+	// Uids of sources explaining the term.
+	Sources []string `json:"sources,omitempty"`
+}
+
+// Value of definition intent, see consts.GRAMMAR_TYPE_DEFINITION.
+type DefinitionIntent struct {
+	Term       string   `json:"term"`
+	Title      string   `json:"title"`
+	Definition string   `json:"definition"`
+	Sources    []string `json:"sources,omitempty"`
+	Score      float64  `json:"score"`
+}
+
+// Map from language => term => entry.
+type Glossary struct {
+	entries map[string]map[string]*GlossaryEntry
+}
+
+func MakeGlossary(glossaryDir string) (*Glossary, error) {
+	matches, err := filepath.Glob(filepath.Join(glossaryDir, fmt.Sprintf("*.%s", GLOSSARY_FILE_SUFFIX)))
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Globed %d glossary files.", len(matches))
+	glossary := &Glossary{entries: make(map[string]map[string]*GlossaryEntry)}
+	for _, glossaryFile := range matches {
+		if err := glossary.loadFile(glossaryFile); err != nil {
+			return nil, err
+		}
+	}
+	for lang, entries := range glossary.entries {
+		for term, entry := range entries {
+			if len(entry.Names) == 0 || entry.Definition == "" {
+				return nil, errors.New(fmt.Sprintf("Glossary term [%s] in %s expected to have name and definition.", term, lang))
+			}
+		}
+	}
+	return glossary, nil
+}
+
+func (g *Glossary) loadFile(glossaryFile string) error {
+	file, err := os.Open(glossaryFile)
+	if err != nil {
+		return errors.Wrapf(err, "Error reading glossary file: %s", glossaryFile)
+	}
+	defer file.Close()
+	log.Infof("Reading %s glossary file.", glossaryFile)
+
+	re := regexp.MustCompile(`^([^,]*),([^,]*),([^,]*) => (.*)$`)
+	scanner := bufio.NewScanner(file)
+	scanner.Split(bufio.ScanLines)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		// Ignore comments and empty lines.
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		matches := re.FindStringSubmatch(line)
+		if len(matches) != 5 || matches[1] == "" || matches[2] == "" || matches[4] == "" {
+			return errors.New(fmt.Sprintf("[%s:%d] Error reading glossary line: [%s]", glossaryFile, lineNum, line))
+		}
+		lang, term, field, value := matches[1], matches[2], matches[3], strings.TrimSpace(matches[4])
+		if _, ok := g.entries[lang]; !ok {
+			g.entries[lang] = make(map[string]*GlossaryEntry)
+		}
+		entry, ok := g.entries[lang][term]
+		if !ok {
+			entry = &GlossaryEntry{Term: term}
+			g.entries[lang][term] = entry
+		}
+		switch field {
+		case GLOSSARY_FIELD_NAME:
+			entry.Names = append(entry.Names, value)
+		case GLOSSARY_FIELD_DEFINITION:
+			if entry.Definition != "" {
+				return errors.New(fmt.Sprintf("[%s:%d] Duplicate definition of [%s] in %s.", glossaryFile, lineNum, term, lang))
+			}
+			entry.Definition = value
+		case GLOSSARY_FIELD_SOURCE:
+			entry.Sources = append(entry.Sources, value)
+		default:
+			return errors.New(fmt.Sprintf("[%s:%d] Unknown glossary field [%s].", glossaryFile, lineNum, field))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrapf(err, "Error reading glossary file: %s", glossaryFile)
+	}
+	return nil
+}
+
+// Returns nil when the term has no definition in the language.
+func (g *Glossary) Entry(term string, lang string) *GlossaryEntry {
+	if g == nil {
+		return nil
+	}
+	return g.entries[lang][term]
+}
+
+// Translations of the $Glossary grammar variable: language => term => names.
+func (g *Glossary) Translations() TranslationsV2 {
+	translations := make(TranslationsV2)
+	if g == nil {
+		return translations
+	}
+	for lang, entries := range g.entries {
+		translations[lang] = make(map[string][]string)
+		for term, entry := range entries {
+			translations[lang][term] = entry.Names
+		}
+	}
+	return translations
+}
+
+// Adds the glossary terms as $Glossary variable, for indexing and serving definition grammars.
+func AddGlossaryVariable(variables VariablesV2, glossary *Glossary) {
+	if variables == nil {
+		return
+	}
+	variables[consts.VAR_GLOSSARY] = glossary.Translations()
+}
+
+func (g *Glossary) definitionIntent(term string, lang string, score float64) (Intent, bool) {
+	entry := g.Entry(term, lang)
+	if entry == nil {
+		return Intent{}, false
+	}
+	return Intent{
+		Type:     consts.GRAMMAR_TYPE_DEFINITION,
+		Language: lang,
+		Value: DefinitionIntent{
+			Term:       entry.Term,
+			Title:      entry.Names[0],
+			Definition: entry.Definition,
+			Sources:    entry.Sources,
+			Score:      score,
+		},
+	}, true
+}
+
+// Definition intents, best first, at most one per term.
+func DefinitionIntents(intents []Intent) []Intent {
+	var ret []Intent
+	for _, intent := range intents {
+		value, ok := intent.Value.(DefinitionIntent)
+		if !ok {
+			continue
+		}
+		duplicate := false
+		for i := range ret {
+			if ret[i].Value.(DefinitionIntent).Term == value.Term {
+				duplicate = true
+				if ret[i].Value.(DefinitionIntent).Score < value.Score {
+					ret[i] = intent
+				}
+				break
+			}
+		}
+		if !duplicate {
+			ret = append(ret, intent)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Value.(DefinitionIntent).Score > ret[j].Value.(DefinitionIntent).Score
+	})
+	return ret
+}
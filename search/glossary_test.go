@@ -0,0 +1,116 @@
+package search
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+)
+
+type GlossarySuite struct {
+	suite.Suite
+	engine *ESEngine
+}
+
+func TestGlossary(t *testing.T) {
+	suite.Run(t, new(GlossarySuite))
+}
+
+func (suite *GlossarySuite) SetupTest() {
+	glossary, err := MakeGlossary("../data/search/glossary")
+	suite.Require().Nil(err)
+	suite.engine = NewESEngine(nil, nil, nil, nil, VariablesV2{}, nil)
+	suite.engine.Glossary = glossary
+}
+
+func (suite *GlossarySuite) ruleHit(term string, score float64) *elastic.SearchHit {
+	rule := GrammarRuleWithPercolatorQuery{GrammarRule: GrammarRule{
+		HitType:   consts.GRAMMAR_TYPE_DEFINITION,
+		Intent:    consts.GRAMMAR_INTENT_DEFINITION,
+		Variables: []string{consts.VAR_GLOSSARY},
+		Values:    []string{term},
+	}}
+	b, err := json.Marshal(rule)
+	suite.Require().Nil(err)
+	source := json.RawMessage(b)
+	return &elastic.SearchHit{Score: &score, Source: &source}
+}
+
+func (suite *GlossarySuite) TestLoad() {
+	r := suite.Require()
+	entry := suite.engine.Glossary.Entry("reshimo", consts.LANG_RUSSIAN)
+	r.NotNil(entry)
+	r.Equal("Решимо", entry.Names[0])
+	r.NotEmpty(entry.Definition)
+	r.Nil(suite.engine.Glossary.Entry("reshimo", consts.LANG_SPANISH))
+	r.Nil(suite.engine.Glossary.Entry("unknown", consts.LANG_ENGLISH))
+
+	variables := VariablesV2{}
+	AddGlossaryVariable(variables, suite.engine.Glossary)
+	r.Contains(variables[consts.VAR_GLOSSARY][consts.LANG_HEBREW]["masach"], "מסך")
+
+	grammars, err := ReadGrammarFileV2("../data/search/grammars/definition.grammar")
+	r.Nil(err)
+	for _, lang := range []string{consts.LANG_ENGLISH, consts.LANG_HEBREW, consts.LANG_RUSSIAN} {
+		r.Contains(grammars[lang], consts.GRAMMAR_INTENT_DEFINITION, lang)
+	}
+}
+
+func (suite *GlossarySuite) TestDefinitionIntents() {
+	r := suite.Require()
+	cases := []struct {
+		term     string
+		lang     string
+		variable string
+		title    string
+	}{
+		{"what is reshimo", consts.LANG_ENGLISH, "reshimo", "Reshimo"},
+		{"מהו מסך", consts.LANG_HEBREW, "masach", "מסך"},
+		{"что такое решимо", consts.LANG_RUSSIAN, "reshimo", "Решимо"},
+	}
+	for _, c := range cases {
+		query := &Query{Term: c.term, LanguageOrder: []string{c.lang}}
+		result := &elastic.SearchResult{Hits: &elastic.SearchHits{Hits: []*elastic.SearchHit{suite.ruleHit(c.variable, 10)}}}
+		singleHitIntents, filterIntents, err := suite.engine.searchResultsToIntents(query, c.lang, result)
+		r.Nil(err, c.term)
+		r.Empty(filterIntents, c.term)
+		r.Len(singleHitIntents, 1, c.term)
+		r.Equal(consts.GRAMMAR_TYPE_DEFINITION, singleHitIntents[0].Type)
+		r.Equal(c.lang, singleHitIntents[0].Language)
+		definition := singleHitIntents[0].Value.(DefinitionIntent)
+		r.Equal(c.variable, definition.Term)
+		r.Equal(c.title, definition.Title)
+		r.NotEmpty(definition.Definition)
+		r.NotEmpty(definition.Sources)
+	}
+
+	// Terms without definition in the language are ignored.
+	query := &Query{Term: "qué es reshimo", LanguageOrder: []string{consts.LANG_SPANISH}}
+	result := &elastic.SearchResult{Hits: &elastic.SearchHits{Hits: []*elastic.SearchHit{suite.ruleHit("reshimo", 10)}}}
+	singleHitIntents, _, err := suite.engine.searchResultsToIntents(query, consts.LANG_SPANISH, result)
+	r.Nil(err)
+	r.Empty(singleHitIntents)
+}
+
+func (suite *GlossarySuite) TestDedupAndSort() {
+	r := suite.Require()
+	query := &Query{Term: "what is masach", LanguageOrder: []string{consts.LANG_ENGLISH}}
+	result := &elastic.SearchResult{Hits: &elastic.SearchHits{Hits: []*elastic.SearchHit{
+		suite.ruleHit("reshimo", 5),
+		suite.ruleHit("masach", 8),
+		suite.ruleHit("reshimo", 12),
+	}}}
+	singleHitIntents, _, err := suite.engine.searchResultsToIntents(query, consts.LANG_ENGLISH, result)
+	r.Nil(err)
+	r.Len(singleHitIntents, 3)
+	// Other intents are skipped.
+	singleHitIntents = append(singleHitIntents, Intent{Language: consts.LANG_ENGLISH, Value: GrammarIntent{Score: 100}})
+	intents := DefinitionIntents(singleHitIntents)
+	r.Len(intents, 2)
+	r.Equal("reshimo", intents[0].Value.(DefinitionIntent).Term)
+	r.Equal("masach", intents[1].Value.(DefinitionIntent).Term)
+	r.Nil(DefinitionIntents(nil))
+}
@@ -0,0 +1,204 @@
+package search
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Bnei-Baruch/archive-backend/cache"
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/utils"
+)
+
+const (
+	GRAMMAR_DEFAULT_WARN_DOCS_PER_RULE = 1000
+)
+
+// Limits of grammar rules expansion into percolator docs, one doc for each combination of variables values.
+type GrammarExpansionLimits struct {
+	// Warn when rules of one variables set expand into more docs.
+	WarnDocs int
+	// Cap of docs per variables set, 0 for no cap. Rules with $Year over the cap are matched by
+	// years range, other rules are truncated.
+	MaxDocs int
+	// Always match $Year by years range instead of enumerating all years.
+	YearRange bool
+}
+
+func GrammarExpansionLimitsFromConfig() GrammarExpansionLimits {
+	limits := GrammarExpansionLimits{
+		WarnDocs:  GRAMMAR_DEFAULT_WARN_DOCS_PER_RULE,
+		MaxDocs:   viper.GetInt("elasticsearch.grammar-max-docs-per-rule"),
+		YearRange: viper.GetBool("elasticsearch.grammar-year-range"),
+	}
+	if viper.IsSet("elasticsearch.grammar-warn-docs-per-rule") {
+		limits.WarnDocs = viper.GetInt("elasticsearch.grammar-warn-docs-per-rule")
+	}
+	return limits
+}
+
+// Expansion of grammar rules of one variables set, e.g., [$ConventionLocation $Year congress] and
+// [congress $Year $ConventionLocation], into percolator docs.
+type GrammarExpansion struct {
+	Language  string
+	Intent    string
+	Variables []string
+	// Number of rules with these variables.
+	Rules int
+	// Size of variables values cross product.
+	Combinations int
+	// Combinations matching the intent, see GrammarVariablesMatch. One doc for each.
+	Docs int
+	// Docs actually indexed, less than Docs when capped.
+	Indexed int
+	// Rules phrases of all indexed docs, i.e., rules with all values phrases assigned.
+	Phrases int
+	// $Year is matched by range query between YearFrom and YearTo.
+	YearRange bool
+	YearFrom  int
+	YearTo    int
+
+	// Values of indexed docs.
+	values [][]string
+}
+
+func (e GrammarExpansion) Capped() bool {
+	return e.Indexed < e.Docs
+}
+
+// Phrases of variable value, e.g., ["Moscow", "Russia, Moscow"] for "moscow".
+func grammarValuePhrases(variables VariablesV2, variable string, lang string, value string) []string {
+	if variable == consts.VAR_YEAR && value == consts.VAR_YEAR_RANGE_PLACEHOLDER {
+		return []string{value}
+	}
+	return variables[variable][lang][value]
+}
+
+func ExpandGrammarVariablesSet(lang string, intent string, variablesSet []string, rules []string, variables VariablesV2, cm cache.CacheManager, limits GrammarExpansionLimits) GrammarExpansion {
+	expansion := GrammarExpansion{Language: lang, Intent: intent, Variables: variablesSet, Rules: len(rules), Combinations: 1}
+
+	// Set of possible variable values: [["2000", "2001", ...], ["Moscow", "Tel Aviv", "New York", ...]]
+	variablesValues := [][]string(nil)
+	yearIndex := -1
+	for i, variable := range variablesSet {
+		values := utils.StringMapOrderedKeys(variables[variable][lang])
+		variablesValues = append(variablesValues, values)
+		expansion.Combinations *= len(values)
+		if variable == consts.VAR_YEAR {
+			yearIndex = i
+		}
+	}
+
+	// Percolator rules ($Text) are matched by phrases, range is supported for search rules only.
+	overCap := limits.MaxDocs > 0 && expansion.Combinations > limits.MaxDocs
+	if yearIndex >= 0 && !utils.StringInSlice(consts.VAR_TEXT, variablesSet) && (limits.YearRange || overCap) {
+		for _, value := range variablesValues[yearIndex] {
+			year, err := strconv.Atoi(value)
+			if err != nil {
+				continue
+			}
+			if expansion.YearFrom == 0 || year < expansion.YearFrom {
+				expansion.YearFrom = year
+			}
+			if year > expansion.YearTo {
+				expansion.YearTo = year
+			}
+		}
+		if expansion.YearFrom > 0 {
+			expansion.YearRange = true
+			variablesValues[yearIndex] = []string{consts.VAR_YEAR_RANGE_PLACEHOLDER}
+		}
+	}
+
+	// Iterate over each pair of values, e.g., ["2018", "Moscow"], ["2019", "Moscow"], ..., ["2018", "Tel Aviv"], ...
+	for valueIter := CreateCrossIter(variablesValues); valueIter.Next(); {
+		variableValues := valueIter.Values()
+		// With years range the year is known only in query time, it is matched then, see grammarRuleVariables.
+		if !expansion.YearRange {
+			vMap := make(map[string][]string)
+			for i := range variablesSet {
+				vMap[variablesSet[i]] = []string{variableValues[i]}
+			}
+			if !GrammarVariablesMatch(intent, vMap, cm) {
+				continue
+			}
+		}
+		expansion.Docs++
+		if limits.MaxDocs > 0 && expansion.Indexed >= limits.MaxDocs {
+			continue
+		}
+		phrases := len(rules)
+		for i := range variableValues {
+			phrases *= len(grammarValuePhrases(variables, variablesSet[i], lang, variableValues[i]))
+		}
+		expansion.Indexed++
+		expansion.Phrases += phrases
+		expansion.values = append(expansion.values, variableValues)
+	}
+
+	if expansion.Capped() {
+		log.Warnf("Rules [%s] of intent \"%s\" in %s: %d docs over cap of %d, only %d indexed.",
+			strings.Join(variablesSet, " "), intent, lang, expansion.Docs, limits.MaxDocs, expansion.Indexed)
+	} else if limits.WarnDocs > 0 && expansion.Docs > limits.WarnDocs {
+		log.Warnf("Rules [%s] of intent \"%s\" in %s expand into %d docs.",
+			strings.Join(variablesSet, " "), intent, lang, expansion.Docs)
+	}
+	return expansion
+}
+
+// Expansions of all grammar rules with variables, the largest first.
+func AnalyzeGrammarExpansion(grammars GrammarsV2, variables VariablesV2, cm cache.CacheManager, limits GrammarExpansionLimits) []GrammarExpansion {
+	ret := []GrammarExpansion(nil)
+	for lang, grammarsByIntent := range grammars {
+		for intent, grammar := range grammarsByIntent {
+			for variablesSetAsString, rules := range grammar.Patterns {
+				if variablesSetAsString == "" {
+					continue
+				}
+				ret = append(ret, ExpandGrammarVariablesSet(lang, intent, VariablesFromString(variablesSetAsString), rules, variables, cm, limits))
+			}
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Docs != ret[j].Docs {
+			return ret[i].Docs > ret[j].Docs
+		}
+		if ret[i].Language != ret[j].Language {
+			return ret[i].Language < ret[j].Language
+		}
+		if ret[i].Intent != ret[j].Intent {
+			return ret[i].Intent < ret[j].Intent
+		}
+		return strings.Join(ret[i].Variables, "|") < strings.Join(ret[j].Variables, "|")
+	})
+	return ret
+}
+
+// Years in query, e.g., [2019] for "moscow 2019", to be matched against rules with years range.
+func grammarQueryYears(text string) []int {
+	ret := []int(nil)
+	for _, word := range strings.Fields(text) {
+		if len(word) != 4 {
+			continue
+		}
+		if year, err := strconv.Atoi(word); err == nil && year > 0 && !utils.Contains(utils.Is(ret), year) {
+			ret = append(ret, year)
+		}
+	}
+	return ret
+}
+
+// Query text with year replaced by placeholder, to match rules with years range.
+func grammarQueryWithYearPlaceholder(text string, year int) string {
+	words := strings.Fields(text)
+	yearStr := strconv.Itoa(year)
+	for i := range words {
+		if words[i] == yearStr {
+			words[i] = consts.VAR_YEAR_RANGE_PLACEHOLDER
+		}
+	}
+	return strings.Join(words, " ")
+}
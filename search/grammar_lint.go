@@ -0,0 +1,483 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/cache"
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/utils"
+)
+
+const (
+	GRAMMAR_LINT_ERROR   = "error"
+	GRAMMAR_LINT_WARNING = "warning"
+
+	// Expected intent of queries that should not match any rule.
+	GRAMMAR_EXPECT_NONE = "none"
+
+	// Stop looking for a matching variables combination after that many combinations.
+	GRAMMAR_LINT_MAX_COMBINATIONS = 100000
+)
+
+var grammarVariablesRegexp = regexp.MustCompile(`\$[a-zA-Z]+`)
+
+// Intents their variables match requires the cache, see GrammarVariablesMatch.
+var grammarLintCacheIntents = map[string]bool{
+	consts.GRAMMAR_INTENT_PROGRAM_POSITION_WITHOUT_TERM: true,
+	consts.GRAMMAR_INTENT_SOURCE_POSITION_WITHOUT_TERM:  true,
+	consts.GRAMMAR_INTENT_LANDING_PAGE_CONVENTIONS:      true,
+	consts.GRAMMAR_INTENT_LANDING_PAGE_HOLIDAYS:         true,
+}
+
+// Single rule of a grammar file with its position.
+type GrammarLineV2 struct {
+	File      string
+	Line      int
+	HitType   string
+	Language  string
+	Intent    string
+	Pattern   string
+	Variables []string
+}
+
+// Inline annotation of the rule following it:
+// # expect: <query> -> <intent> {$Var: value, ...}
+// The query is expected to match a rule of the intent having (at least) these variable values,
+// in the language of the rule. Intent "none" expects no match.
+type GrammarExpectation struct {
+	File      string
+	Line      int
+	Language  string
+	Query     string
+	Intent    string
+	Variables map[string]string
+}
+
+type GrammarLintIssue struct {
+	File     string
+	Line     int
+	Severity string
+	Message  string
+}
+
+func (i GrammarLintIssue) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s", i.File, i.Line, i.Severity, i.Message)
+}
+
+// Match of a grammar rule for a query, see GrammarRuleMatches.
+type GrammarRuleMatch struct {
+	Intent    string
+	HitType   string
+	Variables map[string][]string
+	Score     float64
+}
+
+// Reads grammar rules and expectations of all grammar files in the folder.
+func ReadGrammarLinesV2(grammarsDir string) ([]GrammarLineV2, []GrammarExpectation, error) {
+	matches, err := filepath.Glob(filepath.Join(grammarsDir, "*.grammar"))
+	if err != nil {
+		return nil, nil, err
+	}
+	lines := []GrammarLineV2(nil)
+	expectations := []GrammarExpectation(nil)
+	for _, grammarFile := range matches {
+		fileLines, fileExpectations, err := ReadGrammarFileLinesV2(grammarFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		lines = append(lines, fileLines...)
+		expectations = append(expectations, fileExpectations...)
+	}
+	return lines, expectations, nil
+}
+
+// Same syntax as ReadGrammarFileV2, keeps the position of each rule for linting.
+func ReadGrammarFileLinesV2(grammarFile string) ([]GrammarLineV2, []GrammarExpectation, error) {
+	re := regexp.MustCompile(`^(.*).grammar$`)
+	matches := re.FindStringSubmatch(filepath.Base(grammarFile))
+	if len(matches) != 2 {
+		return nil, nil, errors.New(fmt.Sprintf("Bad gramamr file: %s, expected: <hit-type>.grammar", grammarFile))
+	}
+	hitType := matches[1]
+
+	file, err := os.Open(grammarFile)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Error reading grammar file: %s", grammarFile)
+	}
+	defer file.Close()
+
+	scanLineRegexp := regexp.MustCompile(`^(.*),(.*) => (.*)$`)
+	expectRegexp := regexp.MustCompile(`^#\s*expect:\s*(.+?)\s*->\s*(\S+)\s*(\{(.*)\})?$`)
+
+	lines := []GrammarLineV2(nil)
+	expectations := []GrammarExpectation(nil)
+	// Expectations waiting for the language of the next rule.
+	pending := []GrammarExpectation(nil)
+	scanner := bufio.NewScanner(file)
+	scanner.Split(bufio.ScanLines)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			if !strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(line, "#")), "expect:") {
+				continue
+			}
+			matches := expectRegexp.FindStringSubmatch(line)
+			if len(matches) != 5 {
+				return nil, nil, errors.New(fmt.Sprintf("[%s:%d] Error reading expectation: [%s]", grammarFile, lineNum, line))
+			}
+			variables, err := parseExpectationVariables(matches[4])
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "[%s:%d] Error reading expectation: [%s]", grammarFile, lineNum, line)
+			}
+			pending = append(pending, GrammarExpectation{
+				File:      grammarFile,
+				Line:      lineNum,
+				Query:     matches[1],
+				Intent:    matches[2],
+				Variables: variables,
+			})
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		matches := scanLineRegexp.FindStringSubmatch(line)
+		if len(matches) != 4 || matches[1] == "" || matches[2] == "" || matches[3] == "" {
+			return nil, nil, errors.New(fmt.Sprintf("[%s:%d] Error reading pattern: [%s]", grammarFile, lineNum, line))
+		}
+		lines = append(lines, GrammarLineV2{
+			File:      grammarFile,
+			Line:      lineNum,
+			HitType:   hitType,
+			Language:  matches[1],
+			Intent:    matches[2],
+			Pattern:   matches[3],
+			Variables: grammarVariablesRegexp.FindAllString(matches[3], -1),
+		})
+		for i := range pending {
+			pending[i].Language = matches[1]
+		}
+		expectations = append(expectations, pending...)
+		pending = nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, errors.Wrapf(err, "Error reading grammar file: %s", grammarFile)
+	}
+	if len(pending) > 0 {
+		return nil, nil, errors.New(fmt.Sprintf("[%s:%d] Expectation should be followed by a rule.", grammarFile, pending[0].Line))
+	}
+	return lines, expectations, nil
+}
+
+// Parses "$Var: value, $Var2: value".
+func parseExpectationVariables(str string) (map[string]string, error) {
+	variables := make(map[string]string)
+	if strings.TrimSpace(str) == "" {
+		return variables, nil
+	}
+	for _, pair := range strings.Split(str, ",") {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.New(fmt.Sprintf("Expected $Var: value, got: [%s]", pair))
+		}
+		variable, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if !strings.HasPrefix(variable, "$") || value == "" {
+			return nil, errors.New(fmt.Sprintf("Expected $Var: value, got: [%s]", pair))
+		}
+		variables[variable] = value
+	}
+	return variables, nil
+}
+
+func normalizeGrammarPattern(pattern string) string {
+	return strings.Join(strings.Fields(strings.ToLower(pattern)), " ")
+}
+
+// Pattern with variables replaced by placeholder, rules with same skeleton may match same text.
+func grammarPatternSkeleton(line GrammarLineV2) string {
+	return normalizeGrammarPattern(grammarVariablesRegexp.ReplaceAllString(line.Pattern, "$$"))
+}
+
+// Checks the grammar rules for errors and suspicious rules.
+// Cache is optional, without it combinations of cache dependent intents are not checked.
+// Without mdbVariables (variables loaded from files only, see MakeFileVariablesV2) rules with
+// MDB_VARIABLES are checked for structure only.
+func LintGrammars(lines []GrammarLineV2, variables VariablesV2, cm cache.CacheManager, mdbVariables bool) []GrammarLintIssue {
+	issues := []GrammarLintIssue(nil)
+	issue := func(line GrammarLineV2, severity string, format string, args ...interface{}) {
+		issues = append(issues, GrammarLintIssue{line.File, line.Line, severity, fmt.Sprintf(format, args...)})
+	}
+
+	// Phrases of variable values by variable and language, to find rules shadowing each other.
+	phrases := make(map[string]map[string]map[string]bool)
+	variablePhrases := func(variable string, lang string) map[string]bool {
+		if _, ok := phrases[variable]; !ok {
+			phrases[variable] = make(map[string]map[string]bool)
+		}
+		if _, ok := phrases[variable][lang]; !ok {
+			phrases[variable][lang] = make(map[string]bool)
+			for _, valuePhrases := range variables[variable][lang] {
+				for _, phrase := range valuePhrases {
+					phrases[variable][lang][normalizeGrammarPattern(phrase)] = true
+				}
+			}
+		}
+		return phrases[variable][lang]
+	}
+
+	valid := []GrammarLineV2(nil)
+	seen := make(map[string]GrammarLineV2)
+	for _, line := range lines {
+		if _, ok := consts.GRAMMAR_INTENTS_TO_FILTER_VALUES[line.Intent]; !ok {
+			issue(line, GRAMMAR_LINT_ERROR, "Unknown intent [%s].", line.Intent)
+			continue
+		}
+		undefined := false
+		for _, variable := range line.Variables {
+			if !mdbVariables && MDB_VARIABLES[variable] {
+				// Values are not known.
+				undefined = true
+			} else if _, ok := variables[variable]; !ok {
+				issue(line, GRAMMAR_LINT_ERROR, "Undefined variable %s.", variable)
+				undefined = true
+			} else if len(variables[variable][line.Language]) == 0 {
+				issue(line, GRAMMAR_LINT_ERROR, "Variable %s has no values in [%s], rule is unreachable.", variable, line.Language)
+				undefined = true
+			}
+		}
+		for _, word := range strings.Fields(grammarVariablesRegexp.ReplaceAllString(line.Pattern, " ")) {
+			variable := "$" + word
+			if _, ok := variables[variable]; ok || MDB_VARIABLES[variable] {
+				issue(line, GRAMMAR_LINT_ERROR, "Word [%s] is not a variable, missing $ of %s?", word, variable)
+				undefined = true
+			}
+		}
+		key := strings.Join([]string{line.Language, line.Intent, normalizeGrammarPattern(line.Pattern)}, "|")
+		if first, ok := seen[key]; ok {
+			issue(line, GRAMMAR_LINT_ERROR, "Duplicate rule, first defined at %s:%d.", first.File, first.Line)
+			continue
+		}
+		seen[key] = line
+		if !undefined {
+			valid = append(valid, line)
+		}
+	}
+
+	// Rules shadowing each other, i.e., same text may match rules of different intents or variables.
+	for i := range valid {
+		for j := 0; j < i; j++ {
+			a, b := valid[i], valid[j]
+			if a.Language != b.Language || len(a.Variables) != len(b.Variables) ||
+				(a.Intent == b.Intent && VariablesAsString(append([]string(nil), a.Variables...)) == VariablesAsString(append([]string(nil), b.Variables...))) ||
+				grammarPatternSkeleton(a) != grammarPatternSkeleton(b) {
+				continue
+			}
+			overlap := true
+			for k := range a.Variables {
+				if a.Variables[k] == b.Variables[k] || a.Variables[k] == consts.VAR_TEXT || b.Variables[k] == consts.VAR_TEXT {
+					continue
+				}
+				common := false
+				for phrase := range variablePhrases(a.Variables[k], a.Language) {
+					if variablePhrases(b.Variables[k], b.Language)[phrase] {
+						common = true
+						break
+					}
+				}
+				if !common {
+					overlap = false
+					break
+				}
+			}
+			if overlap {
+				issue(a, GRAMMAR_LINT_WARNING, "Rule [%s] (%s) shadows rule [%s] (%s) at %s:%d.", a.Pattern, a.Intent, b.Pattern, b.Intent, b.File, b.Line)
+			}
+		}
+	}
+
+	// Missing languages per intent, compared to all languages of the same hit type.
+	hitTypeLanguages := make(map[string]map[string]bool)
+	intentLanguages := make(map[string]map[string]bool)
+	intentFirstLine := make(map[string]GrammarLineV2)
+	for _, line := range lines {
+		if _, ok := consts.GRAMMAR_INTENTS_TO_FILTER_VALUES[line.Intent]; !ok {
+			continue
+		}
+		if _, ok := hitTypeLanguages[line.HitType]; !ok {
+			hitTypeLanguages[line.HitType] = make(map[string]bool)
+		}
+		hitTypeLanguages[line.HitType][line.Language] = true
+		key := fmt.Sprintf("%s|%s", line.HitType, line.Intent)
+		if _, ok := intentLanguages[key]; !ok {
+			intentLanguages[key] = make(map[string]bool)
+			intentFirstLine[key] = line
+		}
+		intentLanguages[key][line.Language] = true
+	}
+	for key, languages := range intentLanguages {
+		line := intentFirstLine[key]
+		missing := []string(nil)
+		for lang := range hitTypeLanguages[line.HitType] {
+			if !languages[lang] {
+				missing = append(missing, lang)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			issue(line, GRAMMAR_LINT_WARNING, "Intent [%s] has no rules in: %s.", line.Intent, strings.Join(missing, ", "))
+		}
+	}
+
+	// Unreachable variable combinations, i.e., no combination of values matches the intent.
+	checked := make(map[string]bool)
+	for _, line := range valid {
+		if len(line.Variables) == 0 || (cm == nil && grammarLintCacheIntents[line.Intent]) {
+			continue
+		}
+		variablesSet := VariablesFromString(VariablesAsString(append([]string(nil), line.Variables...)))
+		key := strings.Join([]string{line.Language, line.Intent, strings.Join(variablesSet, "|")}, "|")
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+		variablesValues := [][]string(nil)
+		for _, variable := range variablesSet {
+			variablesValues = append(variablesValues, utils.StringMapOrderedKeys(variables[variable][line.Language]))
+		}
+		reachable := false
+		iterations := 0
+		for valueIter := CreateCrossIter(variablesValues); valueIter.Next() && iterations < GRAMMAR_LINT_MAX_COMBINATIONS; iterations++ {
+			vMap := make(map[string][]string)
+			for i, value := range valueIter.Values() {
+				vMap[variablesSet[i]] = append(vMap[variablesSet[i]], value)
+			}
+			if GrammarVariablesMatch(line.Intent, vMap, cm) {
+				reachable = true
+				break
+			}
+		}
+		if !reachable && iterations < GRAMMAR_LINT_MAX_COMBINATIONS {
+			issue(line, GRAMMAR_LINT_ERROR, "No combination of %s values matches intent [%s] in [%s], rules are never indexed.",
+				strings.Join(variablesSet, ", "), line.Intent, line.Language)
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].File != issues[j].File {
+			return issues[i].File < issues[j].File
+		}
+		return issues[i].Line < issues[j].Line
+	})
+	return issues
+}
+
+// Grammar rules matching the query in the language, best first.
+// Runs the same grammar searches as SearchGrammarsV2 without resolving the matches to intents.
+func (e *ESEngine) GrammarRuleMatches(ctx context.Context, query *Query, language string) ([]GrammarRuleMatch, error) {
+	mr, err := e.esc.MultiSearch().Add(
+		NewSuggestGammarV2Request(query, language, "", nil),
+		NewGammarPerculateRequest(query, language, ""),
+	).Do(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error looking for grammar search.")
+	}
+	matches := []GrammarRuleMatch(nil)
+	for _, result := range mr.Responses {
+		if result.Error != nil {
+			return nil, errors.New(fmt.Sprintf("Failed multi get: %+v", result.Error))
+		}
+		if !haveHits(result) {
+			continue
+		}
+		for _, hit := range result.Hits.Hits {
+			rule, err := unmarshalGrammarRule(hit)
+			if err != nil {
+				return nil, err
+			}
+			vMap := grammarRuleVariables(query, rule, hit)
+			if !GrammarVariablesMatch(rule.Intent, vMap, e.cache) {
+				continue
+			}
+			matches = append(matches, GrammarRuleMatch{
+				Intent:    rule.Intent,
+				HitType:   rule.HitType,
+				Variables: vMap,
+				Score:     grammarRuleScore(hit, vMap),
+			})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	return matches, nil
+}
+
+func unmarshalGrammarRule(hit *elastic.SearchHit) (GrammarRule, error) {
+	var ruleObj GrammarRuleWithPercolatorQuery
+	if err := json.Unmarshal(*hit.Source, &ruleObj); err != nil {
+		return GrammarRule{}, err
+	}
+	rule := ruleObj.GrammarRule
+	if len(rule.Values) != len(rule.Variables) {
+		return GrammarRule{}, errors.New(fmt.Sprintf("Expected Variables to be of size %d, but it is %d", len(rule.Values), len(rule.Variables)))
+	}
+	return rule, nil
+}
+
+// Verifies the expectations against grammar index of the engine, see IndexGrammars.
+// Expectation holds if the best matching rule has the expected intent and variable values.
+func (e *ESEngine) VerifyGrammarExpectations(ctx context.Context, expectations []GrammarExpectation) ([]GrammarLintIssue, error) {
+	issues := []GrammarLintIssue(nil)
+	for _, expectation := range expectations {
+		query := ParseQuery(expectation.Query)
+		query.LanguageOrder = []string{expectation.Language}
+		matches, err := e.GrammarRuleMatches(ctx, &query, expectation.Language)
+		if err != nil {
+			return nil, err
+		}
+		if message := grammarExpectationFailure(expectation, matches); message != "" {
+			issues = append(issues, GrammarLintIssue{expectation.File, expectation.Line, GRAMMAR_LINT_ERROR, message})
+		}
+	}
+	return issues, nil
+}
+
+// Returns why the expectation does not hold, empty if it does.
+func grammarExpectationFailure(expectation GrammarExpectation, matches []GrammarRuleMatch) string {
+	if expectation.Intent == GRAMMAR_EXPECT_NONE {
+		if len(matches) > 0 {
+			return fmt.Sprintf("[%s] expected no match, got %s.", expectation.Query, grammarRuleMatchString(matches[0]))
+		}
+		return ""
+	}
+	if len(matches) == 0 {
+		return fmt.Sprintf("[%s] expected %s %v, got no match.", expectation.Query, expectation.Intent, expectation.Variables)
+	}
+	best := matches[0]
+	if best.Intent != expectation.Intent {
+		return fmt.Sprintf("[%s] expected %s %v, got %s.", expectation.Query, expectation.Intent, expectation.Variables, grammarRuleMatchString(best))
+	}
+	for variable, value := range expectation.Variables {
+		if !utils.StringInSlice(value, best.Variables[variable]) {
+			return fmt.Sprintf("[%s] expected %s %v, got %s.", expectation.Query, expectation.Intent, expectation.Variables, grammarRuleMatchString(best))
+		}
+	}
+	return ""
+}
+
+func grammarRuleMatchString(match GrammarRuleMatch) string {
+	return fmt.Sprintf("%s %v (%.2f)", match.Intent, match.Variables, match.Score)
+}
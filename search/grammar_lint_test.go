@@ -0,0 +1,209 @@
+package search
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+)
+
+type GrammarLintSuite struct {
+	suite.Suite
+	dir       string
+	variables VariablesV2
+}
+
+func TestGrammarLint(t *testing.T) {
+	suite.Run(t, new(GrammarLintSuite))
+}
+
+func (suite *GrammarLintSuite) SetupTest() {
+	var err error
+	suite.dir, err = ioutil.TempDir("", "grammars")
+	suite.Require().Nil(err)
+	suite.variables = VariablesV2{
+		consts.VAR_TEXT: {
+			consts.LANG_ENGLISH: {consts.VAR_TEXT: {consts.VAR_TEXT}},
+			consts.LANG_HEBREW:  {consts.VAR_TEXT: {consts.VAR_TEXT}},
+		},
+		consts.VAR_CONTENT_TYPE: {
+			consts.LANG_ENGLISH: {"lessons": {"lessons", "lesson"}, "clips": {"clips"}},
+			consts.LANG_HEBREW:  {"lessons": {"שיעורים"}},
+		},
+		consts.VAR_PROGRAM: {
+			consts.LANG_ENGLISH: {"program1": {"clips", "new life"}},
+		},
+	}
+}
+
+func (suite *GrammarLintSuite) TearDownTest() {
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *GrammarLintSuite) writeGrammar(name string, lines ...string) string {
+	path := filepath.Join(suite.dir, name)
+	suite.Require().Nil(ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644))
+	return path
+}
+
+func (suite *GrammarLintSuite) messages(issues []GrammarLintIssue) []string {
+	ret := []string(nil)
+	for _, issue := range issues {
+		ret = append(ret, issue.String())
+	}
+	return ret
+}
+
+func (suite *GrammarLintSuite) TestReadLines() {
+	r := suite.Require()
+	path := suite.writeGrammar("filter.grammar",
+		"# Comment",
+		"# expect: lessons about light -> by_content_type {$ContentType: lessons, $Text: light}",
+		"# expect: light -> none",
+		"en,by_content_type => $ContentType about $Text",
+		"",
+		"he,by_content_type => $Text $ContentType",
+	)
+	lines, expectations, err := ReadGrammarFileLinesV2(path)
+	r.Nil(err)
+	r.Len(lines, 2)
+	r.Equal(GrammarLineV2{path, 4, "filter", consts.LANG_ENGLISH, consts.GRAMMAR_INTENT_FILTER_BY_CONTENT_TYPE,
+		"$ContentType about $Text", []string{consts.VAR_CONTENT_TYPE, consts.VAR_TEXT}}, lines[0])
+	r.Equal(6, lines[1].Line)
+	r.Equal([]GrammarExpectation{
+		{path, 2, consts.LANG_ENGLISH, "lessons about light", consts.GRAMMAR_INTENT_FILTER_BY_CONTENT_TYPE,
+			map[string]string{consts.VAR_CONTENT_TYPE: "lessons", consts.VAR_TEXT: "light"}},
+		{path, 3, consts.LANG_ENGLISH, "light", GRAMMAR_EXPECT_NONE, map[string]string{}},
+	}, expectations)
+
+	path = suite.writeGrammar("bad.grammar", "# expect: light -> by_content_type {$ContentType}", "en,by_content_type => $ContentType")
+	_, _, err = ReadGrammarFileLinesV2(path)
+	r.NotNil(err)
+	path = suite.writeGrammar("bad.grammar", "en,by_content_type => $ContentType", "# expect: light -> none")
+	_, _, err = ReadGrammarFileLinesV2(path)
+	r.NotNil(err)
+
+	// All repo grammars are readable.
+	lines, _, err = ReadGrammarLinesV2("../data/search/grammars")
+	r.Nil(err)
+	r.NotEmpty(lines)
+}
+
+func (suite *GrammarLintSuite) TestLint() {
+	r := suite.Require()
+	path := suite.writeGrammar("filter.grammar",
+		"en,by_content_type => $ContentType about $Text",
+		"en,by_content_type => $ContentType  About $Text",
+		"en,by_content_type => $Missing about $Text",
+		"en,by_program => $Program about $Text",
+		"en,by_program => $Program",
+		"en,no_such_intent => $Text",
+		"he,by_content_type => $ContentType על $Text",
+		"he,by_program => $Program על $Text",
+		"en,by_content_type => $ContentType from Text",
+	)
+	lines, _, err := ReadGrammarFileLinesV2(path)
+	r.Nil(err)
+	r.Equal([]string{
+		path + ":2: error: Duplicate rule, first defined at " + path + ":1.",
+		path + ":3: error: Undefined variable $Missing.",
+		path + ":4: warning: Rule [$Program about $Text] (by_program) shadows rule [$ContentType about $Text] (by_content_type) at " + path + ":1.",
+		path + ":5: error: No combination of $Program values matches intent [by_program] in [en], rules are never indexed.",
+		path + ":6: error: Unknown intent [no_such_intent].",
+		path + ":8: error: Variable $Program has no values in [he], rule is unreachable.",
+		path + ":9: error: Word [Text] is not a variable, missing $ of $Text?",
+	}, suite.messages(LintGrammars(lines, suite.variables, nil, true)))
+}
+
+func (suite *GrammarLintSuite) TestMissingLanguages() {
+	r := suite.Require()
+	path := suite.writeGrammar("filter.grammar",
+		"en,by_content_type => $ContentType about $Text",
+		"en,by_program => $Text from $Program",
+		"he,by_content_type => $ContentType על $Text",
+	)
+	lines, _, err := ReadGrammarFileLinesV2(path)
+	r.Nil(err)
+	r.Equal([]string{
+		path + ":2: warning: Intent [by_program] has no rules in: he.",
+	}, suite.messages(LintGrammars(lines, suite.variables, nil, true)))
+}
+
+func (suite *GrammarLintSuite) TestRepoGrammars() {
+	r := suite.Require()
+	variables, err := MakeFileVariablesV2("../data/search/variables")
+	r.Nil(err)
+	glossary, err := MakeGlossary("../data/search/glossary")
+	r.Nil(err)
+	AddGlossaryVariable(variables, glossary)
+	lines, _, err := ReadGrammarLinesV2("../data/search/grammars")
+	r.Nil(err)
+	errors := []string(nil)
+	for _, issue := range LintGrammars(lines, variables, nil, false) {
+		if issue.Severity == GRAMMAR_LINT_ERROR {
+			errors = append(errors, issue.String())
+		}
+	}
+	r.Empty(errors)
+}
+
+func (suite *GrammarLintSuite) TestVerifyExpectations() {
+	r := suite.Require()
+	viper.Set("elasticsearch.data-folder", "../data")
+	viper.Set("elasticsearch.unzip-url", "http://localhost")
+	es.InitEnv()
+
+	backend, err := es.MakeBackend(consts.ES_BACKEND_EMBEDDED, "")
+	r.Nil(err)
+	defer backend.Stop()
+	esc, err := backend.NewClient()
+	r.Nil(err)
+	defer esc.Stop()
+
+	glossary, err := MakeGlossary("../data/search/glossary")
+	r.Nil(err)
+	AddGlossaryVariable(suite.variables, glossary)
+	grammars, err := MakeGrammarsV2("../data/search/grammars")
+	r.Nil(err)
+	definitions := GrammarsV2{}
+	for lang, byIntent := range grammars {
+		if grammar, ok := byIntent[consts.GRAMMAR_INTENT_DEFINITION]; ok {
+			definitions[lang] = map[string]*GrammarV2{consts.GRAMMAR_INTENT_DEFINITION: grammar}
+		}
+	}
+	r.Nil(IndexGrammars(esc, "", definitions, suite.variables, nil))
+	engine := NewESEngine(esc, nil, nil, nil, suite.variables, nil)
+
+	// Annotations of the repo definition grammar hold.
+	_, expectations, err := ReadGrammarFileLinesV2("../data/search/grammars/definition.grammar")
+	r.Nil(err)
+	r.NotEmpty(expectations)
+	issues, err := engine.VerifyGrammarExpectations(context.TODO(), expectations)
+	r.Nil(err)
+	r.Empty(suite.messages(issues))
+
+	path := suite.writeGrammar("definition.grammar",
+		"# expect: what is masach -> definition {$Glossary: reshimo}",
+		"# expect: what is masach -> by_content_type",
+		"# expect: what is masach -> none",
+		"# expect: hello world -> definition",
+		"# expect: hello world -> none",
+		"en,definition => what is $Glossary",
+	)
+	_, expectations, err = ReadGrammarFileLinesV2(path)
+	r.Nil(err)
+	issues, err = engine.VerifyGrammarExpectations(context.TODO(), expectations)
+	r.Nil(err)
+	r.Len(issues, 4)
+	r.Equal([]int{1, 2, 3, 4}, []int{issues[0].Line, issues[1].Line, issues[2].Line, issues[3].Line})
+	r.Contains(issues[0].Message, "got definition map[$Glossary:[masach]]")
+	r.Contains(issues[3].Message, "got no match")
+}
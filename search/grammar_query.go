@@ -35,17 +35,30 @@ func createGrammarQueryOfSpecificHitType(q *Query, hitType string) elastic.Query
 func createGrammarQuery(q *Query) elastic.Query {
 	boolQuery := elastic.NewBoolQuery()
 	if simpleQuery(q) != "" {
-		boolQuery = boolQuery.Should(
-			elastic.NewDisMaxQuery().Query(
-				elastic.NewMatchPhraseQuery("grammar_rule.rules.keyword", simpleQuery(q)).Slop(SLOP).Boost(GRAMMAR_BOOST_KEYWORD),
-				elastic.NewMatchPhraseQuery("grammar_rule.rules.language", simpleQuery(q)).Slop(SLOP).Boost(GRAMMAR_BOOST),
-				elastic.NewMatchPhraseQuery("grammar_rule.rules", simpleQuery(q)).Slop(SLOP).Boost(GRAMMAR_BOOST),
-			),
-		)
+		boolQuery = boolQuery.Should(createGrammarRulesQuery(simpleQuery(q)))
+		// Rules with $Year matched by years range, see ExpandGrammarVariablesSet.
+		for _, year := range grammarQueryYears(simpleQuery(q)) {
+			boolQuery = boolQuery.Should(
+				elastic.NewBoolQuery().
+					Must(createGrammarRulesQuery(grammarQueryWithYearPlaceholder(simpleQuery(q), year))).
+					Filter(
+						elastic.NewRangeQuery("grammar_rule.year_from").Lte(year),
+						elastic.NewRangeQuery("grammar_rule.year_to").Gte(year),
+					),
+			)
+		}
 	}
 	return boolQuery
 }
 
+func createGrammarRulesQuery(text string) elastic.Query {
+	return elastic.NewDisMaxQuery().Query(
+		elastic.NewMatchPhraseQuery("grammar_rule.rules.keyword", text).Slop(SLOP).Boost(GRAMMAR_BOOST_KEYWORD),
+		elastic.NewMatchPhraseQuery("grammar_rule.rules.language", text).Slop(SLOP).Boost(GRAMMAR_BOOST),
+		elastic.NewMatchPhraseQuery("grammar_rule.rules", text).Slop(SLOP).Boost(GRAMMAR_BOOST),
+	)
+}
+
 func createPerculateQuery(q *Query) elastic.Query {
 	if len(q.ExactTerms) > 0 { // TBD consider support for query with partly exact term
 		return elastic.NewMatchNoneQuery()
@@ -80,7 +93,8 @@ func NewSuggestGammarV2Request(query *Query, language string, preference string,
 	} else {
 		grammarQuery = createGrammarQuery(query)
 	}
-	fetchSourceContext := elastic.NewFetchSourceContext(true).Include("grammar_rule.intent", "grammar_rule.variables", "grammar_rule.values", "grammar_rule.rules")
+	fetchSourceContext := elastic.NewFetchSourceContext(true).Include("grammar_rule.intent", "grammar_rule.variables", "grammar_rule.values", "grammar_rule.rules",
+		"grammar_rule.year_from", "grammar_rule.year_to")
 	source := elastic.NewSearchSource().
 		Query(grammarQuery).
 		FetchSourceContext(fetchSourceContext).
@@ -115,10 +129,11 @@ func NewResultsSuggestGrammarV2CompletionRequest(query *Query, language string,
 		Preference(preference)
 }
 
-func NewFilteredResultsSearchRequest(text string, filters map[string][]string, contentType string, programCollection string, sources []string, from int, size int, sortBy string, resultTypes []string, language string, preference string, deb bool) ([]*elastic.SearchRequest, error) {
+// |entityFilters| are topic, person or congress filters of filter intents, added to content type filters.
+func NewFilteredResultsSearchRequest(text string, filters map[string][]string, contentType string, programCollection string, sources []string, entityFilters map[string][]string, from int, size int, sortBy string, resultTypes []string, language string, preference string, deb bool) ([]*elastic.SearchRequest, error) {
 	// THOSE CONSTRAINTS ARE NO LONGER TRUE...
-	if contentType == "" && programCollection == "" && len(sources) == 0 {
-		return nil, fmt.Errorf("No contentType or programCollection or sources provided for NewFilteredResultsSearchRequest().")
+	if contentType == "" && programCollection == "" && len(sources) == 0 && len(entityFilters) == 0 {
+		return nil, fmt.Errorf("No contentType or programCollection or sources or entity filters provided for NewFilteredResultsSearchRequest().")
 	}
 	if contentType != "" && len(sources) > 0 {
 		return nil, fmt.Errorf("Filter by source and content type combination is not currently supported.")
@@ -137,7 +152,10 @@ func NewFilteredResultsSearchRequest(text string, filters map[string][]string, c
 			if len(filters) > 0 && !hasCommonFilter(filters, consts.CT_VARIABLE_TO_FILTER_VALUES[contentType]) {
 				return nil, fmt.Errorf("No common query filters with filters by content type operation.")
 			}
-			filters, _ = consts.CT_VARIABLE_TO_FILTER_VALUES[contentType] // We override the given query filters. Consider merging filters.
+			filters = map[string][]string{} // We override the given query filters. Consider merging filters.
+			for k, v := range consts.CT_VARIABLE_TO_FILTER_VALUES[contentType] {
+				filters[k] = v
+			}
 			_, enableSourcesSearch := consts.CT_VARIABLES_ENABLE_SOURCES_SEARCH[contentType]
 			if len(filters) == 0 && !enableSourcesSearch {
 				return nil, fmt.Errorf("Content type '%s' is not found in CT_VARIABLE_TO_FILTER_VALUES and not in CT_VARIABLES_ENABLE_SOURCES_SEARCH.", contentType)
@@ -153,6 +171,10 @@ func NewFilteredResultsSearchRequest(text string, filters map[string][]string, c
 		// by program
 		filters[consts.FILTER_COLLECTION] = []string{programCollection}
 	}
+	for filter, values := range entityFilters {
+		// by topic, person or congress
+		filters[filter] = values
+	}
 	requests := []*elastic.SearchRequest{}
 	if searchSources {
 		sourceOnlyFilter := map[string][]string{consts.FILTER_CONTENT_TYPE: []string{consts.CT_SOURCE}}
@@ -149,19 +149,46 @@ func (e *ESEngine) suggestResultsToVariablesByPhrases(query *Query, result *elas
 	return ret, nil
 }
 
+// Grammars search requests with the single hit intents found before searching.
+type grammarsV2Search struct {
+	requests []*elastic.SearchRequest
+	// Number of requests for each language.
+	queriesNumForLang int
+	singleHitIntents  []Intent
+}
+
 // Return: single hit intents, filtering intents
-func (e *ESEngine) SearchGrammarsV2(query *Query, from int, size int, sortBy string, resultTypes []string, preference string) ([]Intent, []Intent, error) {
+func (e *ESEngine) SearchGrammarsV2(ctx context.Context, query *Query, from int, size int, sortBy string, resultTypes []string, preference string) ([]Intent, []Intent, error) {
+	gs, err := e.grammarsV2Search(query, preference)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(gs.requests) == 0 {
+		return e.grammarsV2Intents(query, gs, nil)
+	}
+	multiSearchService := e.esc.MultiSearch()
+	multiSearchService.Add(gs.requests...)
+	beforeGrammarSearch := time.Now()
+	mr, err := multiSearchService.Do(ctx)
+	e.timeTrack(beforeGrammarSearch, consts.LAT_DOSEARCH_GRAMMARS_MULTISEARCHGRAMMARSDO)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error looking for grammar search.")
+	}
+	return e.grammarsV2Intents(query, gs, mr.Responses)
+}
+
+// Prepares the grammars search requests, no requests when the query should not trigger grammars.
+func (e *ESEngine) grammarsV2Search(query *Query, preference string) (*grammarsV2Search, error) {
 	singleHitIntents := []Intent{}
-	filterIntents := []Intent{}
 	if query.Term != "" && len(query.ExactTerms) > 0 {
 		// Will never match any grammar for query having simple terms and exact terms.
 		// This is not acurate but an edge case. Need to better think of query representation.
 		log.Infof("Both term and exact terms are defined, should not trigger grammar: [%s] [%s]", query.Term, strings.Join(query.ExactTerms, " - "))
-		return singleHitIntents, filterIntents, nil
+		return &grammarsV2Search{singleHitIntents: singleHitIntents}, nil
 	}
 	if e.isTermRestricted(query.Term, query.LanguageOrder) {
 		log.Infof("Term is restricted, should not trigger grammar: [%s]", query.Term)
-		return singleHitIntents, filterIntents, nil
+		return &grammarsV2Search{singleHitIntents: singleHitIntents}, nil
 	}
 	searchLandingPagesOnly := false
 	// queriesNumForLang is the number of multiSearchService requests for each language.
@@ -189,7 +216,7 @@ func (e *ESEngine) SearchGrammarsV2(query *Query, from int, size int, sortBy str
 				log.Infof("Adding intents by the source [%s] (%s).", *sourceUid, query.Term)
 				parent, position, _, err := e.cache.SearchStats().GetSourceParentAndPosition(*sourceUid, false)
 				if err != nil {
-					return nil, nil, errors.Wrap(err, "GetSourceParentAndPosition")
+					return nil, errors.Wrap(err, "GetSourceParentAndPosition")
 				}
 				var leafPrefixType *consts.PositionIndexType
 				if parent != nil {
@@ -199,43 +226,47 @@ func (e *ESEngine) SearchGrammarsV2(query *Query, from int, size int, sortBy str
 				}
 				path, err := e.sourcePathFromSql(*sourceUid, language, position, leafPrefixType)
 				if err != nil {
-					return nil, nil, errors.Wrap(err, "sourcePathFromSql")
+					return nil, errors.Wrap(err, "sourcePathFromSql")
 				}
 				intents, err := e.getSingleHitIntentsBySource(*sourceUid, query.Filters, language, path, 3000.0, elastic.SearchExplanation{})
 				if err != nil {
-					return nil, nil, errors.Wrap(err, "getSingleHitIntentsBySource")
+					return nil, errors.Wrap(err, "getSingleHitIntentsBySource")
 				}
 				singleHitIntents = append(singleHitIntents, intents...)
 			}
 		}
 	}
-	multiSearchService := e.esc.MultiSearch()
+	requests := []*elastic.SearchRequest{}
 	if searchLandingPagesOnly {
 		for _, language := range query.LanguageOrder {
 			hitType := "landing-pages"
-			multiSearchService.Add(NewSuggestGammarV2Request(query, language, preference, &hitType))
+			requests = append(requests, NewSuggestGammarV2Request(query, language, preference, &hitType))
 		}
 	} else {
 		for _, language := range query.LanguageOrder {
-			multiSearchService.Add(NewSuggestGammarV2Request(query, language, preference, nil))
-			multiSearchService.Add(NewGammarPerculateRequest(query, language, preference))
+			requests = append(requests, NewSuggestGammarV2Request(query, language, preference, nil))
+			requests = append(requests, NewGammarPerculateRequest(query, language, preference))
 		}
 	}
-	beforeGrammarSearch := time.Now()
-	mr, err := multiSearchService.Do(context.TODO())
-	e.timeTrack(beforeGrammarSearch, consts.LAT_DOSEARCH_GRAMMARS_MULTISEARCHGRAMMARSDO)
-	if err != nil {
-		return nil, nil, errors.Wrap(err, "Error looking for grammar search.")
-	}
+	return &grammarsV2Search{requests: requests, queriesNumForLang: queriesNumForLang, singleHitIntents: singleHitIntents}, nil
+}
 
-	if len(mr.Responses) != len(query.LanguageOrder)*queriesNumForLang {
+// Return: single hit intents, filtering intents from the responses of the grammars search requests.
+func (e *ESEngine) grammarsV2Intents(query *Query, gs *grammarsV2Search, responses []*elastic.SearchResult) ([]Intent, []Intent, error) {
+	singleHitIntents := gs.singleHitIntents
+	filterIntents := []Intent{}
+	if len(gs.requests) == 0 {
+		return singleHitIntents, filterIntents, nil
+	}
+	queriesNumForLang := gs.queriesNumForLang
+	if len(responses) != len(query.LanguageOrder)*queriesNumForLang {
 		return nil, nil, errors.New(fmt.Sprintf("Unexpected number of results %d, expected %d",
-			len(mr.Responses), len(query.LanguageOrder)*queriesNumForLang))
+			len(responses), len(query.LanguageOrder)*queriesNumForLang))
 	}
 
 	start := time.Now()
 	filterIntentsByLanguage := map[string][]Intent{}
-	for i, currentResults := range mr.Responses {
+	for i, currentResults := range responses {
 		if currentResults.Error != nil {
 			log.Warnf("%+v", currentResults.Error)
 			return nil, nil, errors.New(fmt.Sprintf("Failed multi get: %+v", currentResults.Error))
@@ -269,16 +300,57 @@ func (e *ESEngine) SearchGrammarsV2(query *Query, from int, size int, sortBy str
 	return singleHitIntents, filterIntents, nil
 }
 
+// Grammar based filter search for a single filter intent.
+type filterIntentSearch struct {
+	language            string
+	intentKey           string
+	requests            []*elastic.SearchRequest
+	text                string
+	programCollection   string
+	scoreIncrement      *float64
+	scoreMultiplication *float64
+}
+
 // Search according to grammar based filter.
-func (e *ESEngine) SearchByFilterIntents(filterIntents []Intent, filters map[string][]string, originalSearchTerm string, from int, size int, sortBy string, resultTypes []string, preference string, deb bool) (map[string][]FilteredSearchResult, error) {
-	resultsByLang := map[string][]FilteredSearchResult{}
+func (e *ESEngine) SearchByFilterIntents(ctx context.Context, filterIntents []Intent, filters map[string][]string, originalSearchTerm string, from int, size int, sortBy string, resultTypes []string, preference string, deb bool) (map[string][]FilteredSearchResult, error) {
+	searches, err := e.filterIntentsSearches(filterIntents, filters, originalSearchTerm, from, size, sortBy, resultTypes, preference, deb)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([][]*elastic.SearchResult, len(searches))
 	var wg sync.WaitGroup
+	for i, fs := range searches {
+		wg.Add(1)
+		go func(i int, fs *filterIntentSearch) {
+			defer func() {
+				if err := recover(); err != nil {
+					log.Errorf("SearchByFilterIntents panic: %+v", err)
+				}
+				wg.Done()
+			}()
+			mr, err := e.filterSearchDo(ctx, fs.requests)
+			if err != nil {
+				log.Errorf("FilterSearch error: %+v", err)
+				return
+			}
+			responses[i] = mr.Responses
+		}(i, fs)
+	}
+	wg.Wait()
+	return e.filterIntentsResults(searches, responses), nil
+}
+
+// Prepares the filtered search requests for each of the grammar filter intents.
+func (e *ESEngine) filterIntentsSearches(filterIntents []Intent, filters map[string][]string, originalSearchTerm string, from int, size int, sortBy string, resultTypes []string, preference string, deb bool) ([]*filterIntentSearch, error) {
+	searches := []*filterIntentSearch{}
 	for _, intent := range filterIntents {
 		if intentValue, ok := intent.Value.(GrammarIntent); ok {
 			var contentType string
 			var text string
 			var programCollection string
 			sources := []string{}
+			// Topic, person or congress filters.
+			entityFilters := map[string][]string{}
 			for _, fv := range intentValue.FilterValues {
 				if fv.Name == consts.VARIABLE_TO_FILTER[consts.VAR_CONTENT_TYPE] {
 					contentType = fv.Value
@@ -288,69 +360,101 @@ func (e *ESEngine) SearchByFilterIntents(filterIntents []Intent, filters map[str
 					sources = append(sources, fv.Value)
 				} else if fv.Name == consts.VARIABLE_TO_FILTER[consts.VAR_PROGRAM] {
 					programCollection = fv.Value
+				} else if fv.Name == consts.VARIABLE_TO_FILTER[consts.VAR_TAG] ||
+					fv.Name == consts.VARIABLE_TO_FILTER[consts.VAR_PERSON] ||
+					fv.Name == consts.VARIABLE_TO_FILTER[consts.VAR_COLLECTION] {
+					entityFilters[fv.Name] = append(entityFilters[fv.Name], fv.Value)
 				}
 			}
 			searchWithoutTerm := text == ""
-			if contentType != "" || programCollection != "" || len(sources) > 0 {
-				log.Infof("Filtered Search Request: ContentType is '%s', Text is '%s', Program collection is '%s', Sources are '%+v'.", contentType, text, programCollection, sources)
+			if contentType != "" || programCollection != "" || len(sources) > 0 || len(entityFilters) > 0 {
+				log.Infof("Filtered Search Request: ContentType is '%s', Text is '%s', Program collection is '%s', Sources are '%+v', Filters are '%+v'.", contentType, text, programCollection, sources, entityFilters)
 				requests := []*elastic.SearchRequest{}
-				textValSearchRequests, err := NewFilteredResultsSearchRequest(text, filters, contentType, programCollection, sources, from, size, sortBy, resultTypes, intent.Language, preference, deb)
+				textValSearchRequests, err := NewFilteredResultsSearchRequest(text, filters, contentType, programCollection, sources, entityFilters, from, size, sortBy, resultTypes, intent.Language, preference, deb)
 				if err != nil {
 					return nil, err
 				}
 				requests = append(requests, textValSearchRequests...)
 				if !searchWithoutTerm && contentType != consts.VAR_CT_ARTICLES {
-					fullTermSearchRequests, err := NewFilteredResultsSearchRequest(originalSearchTerm, filters, contentType, programCollection, sources, from, size, sortBy, resultTypes, intent.Language, preference, deb)
+					fullTermSearchRequests, err := NewFilteredResultsSearchRequest(originalSearchTerm, filters, contentType, programCollection, sources, entityFilters, from, size, sortBy, resultTypes, intent.Language, preference, deb)
 					if err != nil {
 						return nil, err
 					}
 					requests = append(requests, fullTermSearchRequests...)
 				}
 				if len(requests) > 0 {
-					wg.Add(1)
-					go func() {
-						defer func() {
-							if err := recover(); err != nil {
-								log.Errorf("SearchByFilterIntents panic: %+v", err)
-							}
-							wg.Done()
-						}()
-						// All search requests here are for the same language
-						var scoreIncrement *float64
-						var scoreMultiplication *float64
-						if searchWithoutTerm {
-							incr := consts.SCORE_INCREMENT_FOR_SEARCH_WITHOUT_TERM_RESULTS
-							scoreIncrement = &incr
-						} else {
-							scoreMultiplication = &intentValue.Score
-						}
-						results, hitIdsMap, maxScore, err := e.filterSearch(requests, scoreIncrement, scoreMultiplication)
-						if err != nil {
-							log.Errorf("FilterSearch error: %+v", err)
-							return
-						}
-						if maxScore != nil && *maxScore > 0 {
-							resultByLang := FilteredSearchResult{
-								Results:                  results,
-								Term:                     text,
-								PreserveTermForHighlight: programCollection != "",
-								HitIdsMap:                hitIdsMap,
-								MaxScore:                 maxScore,
-							}
-							if programCollection != "" {
-								resultByLang.ProgramCollection = &programCollection
-							}
-							resultsByLang[intent.Language] = append(resultsByLang[intent.Language], resultByLang)
-						}
-					}()
+					// All search requests here are for the same language
+					fs := &filterIntentSearch{
+						language:          intent.Language,
+						intentKey:         filterIntentKey(intent.Type, intentValue.FilterValues),
+						requests:          requests,
+						text:              text,
+						programCollection: programCollection,
+					}
+					if searchWithoutTerm {
+						incr := consts.SCORE_INCREMENT_FOR_SEARCH_WITHOUT_TERM_RESULTS
+						fs.scoreIncrement = &incr
+					} else {
+						score := intentValue.Score
+						fs.scoreMultiplication = &score
+					}
+					searches = append(searches, fs)
 				}
 			}
 		} else {
 			return nil, errors.Errorf("FilterSearch error. Intent is not GrammarIntent. Intent: %+v", intent)
 		}
 	}
-	wg.Wait()
-	return resultsByLang, nil
+	return searches, nil
+}
+
+// Builds the filtered search results by language from the responses of each of the filter intents searches.
+// Searches without responses (failed) are skipped.
+func (e *ESEngine) filterIntentsResults(searches []*filterIntentSearch, responses [][]*elastic.SearchResult) map[string][]FilteredSearchResult {
+	resultsByLang := map[string][]FilteredSearchResult{}
+	// Number of searches by language and intent key, same intents (from different rules) get distinct keys.
+	keysCount := map[string]int{}
+	for i, fs := range searches {
+		if responses[i] == nil {
+			continue
+		}
+		intentKey := fs.intentKey
+		if count := keysCount[fs.language+":"+intentKey]; count > 0 {
+			intentKey = fmt.Sprintf("%s#%d", intentKey, count)
+		}
+		keysCount[fs.language+":"+fs.intentKey]++
+		results, hitIdsMap, maxScore, err := filterSearchResults(responses[i], fs.scoreIncrement, fs.scoreMultiplication)
+		if err != nil {
+			log.Errorf("FilterSearch error: %+v", err)
+			continue
+		}
+		if maxScore != nil && *maxScore > 0 {
+			resultByLang := FilteredSearchResult{
+				Results:                  results,
+				Term:                     fs.text,
+				IntentKey:                intentKey,
+				PreserveTermForHighlight: fs.programCollection != "",
+				HitIdsMap:                hitIdsMap,
+				MaxScore:                 maxScore,
+			}
+			if fs.programCollection != "" {
+				programCollection := fs.programCollection
+				resultByLang.ProgramCollection = &programCollection
+			}
+			resultsByLang[fs.language] = append(resultsByLang[fs.language], resultByLang)
+		}
+	}
+	return resultsByLang
+}
+
+// Identifies a filter intent by its type and filter values regardless of its position among the intents.
+func filterIntentKey(intentType string, filterValues []FilterValue) string {
+	values := make([]string, len(filterValues))
+	for i, fv := range filterValues {
+		values[i] = fmt.Sprintf("%s=%s", fv.Name, fv.Value)
+	}
+	sort.Strings(values)
+	return fmt.Sprintf("%s:%s", intentType, strings.Join(values, ","))
 }
 
 func (e *ESEngine) VariableMapToFilterValues(vMap map[string][]string, language string) []FilterValue {
@@ -379,6 +483,40 @@ func (e *ESEngine) VariableMapToFilterValues(vMap map[string][]string, language
 	return ret
 }
 
+// Variable values of a grammar rule hit, $Text values are taken from the percolator highlight.
+func grammarRuleVariables(query *Query, rule GrammarRule, hit *elastic.SearchHit) map[string][]string {
+	vMap := make(map[string][]string)
+	for i := range rule.Variables {
+		if rule.Variables[i] == consts.VAR_YEAR && rule.Values[i] == consts.VAR_YEAR_RANGE_PLACEHOLDER {
+			// Rule matched by years range, take the year from the query.
+			for _, year := range grammarQueryYears(simpleQuery(query)) {
+				if year >= rule.YearFrom && year <= rule.YearTo {
+					vMap[rule.Variables[i]] = []string{strconv.Itoa(year)}
+					break
+				}
+			}
+		} else if rule.Variables[i] == consts.VAR_TEXT {
+			if hit.Highlight != nil {
+				if text, ok := hit.Highlight["search_text"]; ok {
+					log.Infof("search_text: %s", text)
+					if len(text) == 1 && text[0] != "" {
+						textVarValues := retrieveTextVarValues(text[0])
+						vMap[rule.Variables[i]] = textVarValues
+						log.Infof("$Text values are %+v", textVarValues)
+					}
+				}
+			}
+		} else {
+			vMap[rule.Variables[i]] = []string{rule.Values[i]}
+		}
+	}
+	return vMap
+}
+
+func grammarRuleScore(hit *elastic.SearchHit, vMap map[string][]string) float64 {
+	return *hit.Score * (float64(4) / float64(4+len(vMap))) * YearScorePenalty(vMap)
+}
+
 // For specific landing page, keep only some amount of intents with the highest score (according to MAX_MATCHES_PER_GRAMMAR_INTENT) and filter out all the rest.
 // Return the minimum score of the intents slice for the given intent landing page.
 func updateIntentCount(intentsCount map[string][]Intent, intent Intent) float64 {
@@ -456,26 +594,10 @@ func (e *ESEngine) searchResultsToIntents(query *Query, language string, result
 			}
 		}
 
-		vMap := make(map[string][]string)
-		for i := range rule.Variables {
-			if rule.Variables[i] == consts.VAR_TEXT {
-				if hit.Highlight != nil {
-					if text, ok := hit.Highlight["search_text"]; ok {
-						log.Infof("search_text: %s", text)
-						if len(text) == 1 && text[0] != "" {
-							textVarValues := retrieveTextVarValues(text[0])
-							vMap[rule.Variables[i]] = textVarValues
-							log.Infof("$Text values are %+v", textVarValues)
-						}
-					}
-				}
-			} else {
-				vMap[rule.Variables[i]] = []string{rule.Values[i]}
-			}
-		}
+		vMap := grammarRuleVariables(query, rule, hit)
 
 		if GrammarVariablesMatch(rule.Intent, vMap, e.cache) {
-			score := *hit.Score * (float64(4) / float64(4+len(vMap))) * YearScorePenalty(vMap)
+			score := grammarRuleScore(hit, vMap)
 			// Issue with tf/idf. For query [congress] the score if very low. For [arava] ok.
 			// Fix this by moving the grammar index into the common index. So tha similar tf/idf will be used.
 			// For now solve by normalizing very small scores.
@@ -546,7 +668,10 @@ func (e *ESEngine) searchResultsToIntents(query *Query, language string, result
 				}
 				singleHitIntents = append(singleHitIntents, Intent{"", language, singleProgramIntent})
 				addProgramPositionWithoutTerm = false // We add results only one time for this rule type
-			} else if rule.Intent == consts.GRAMMAR_INTENT_FILTER_BY_PROGRAM_WITHOUT_TERM {
+			} else if rule.Intent == consts.GRAMMAR_INTENT_FILTER_BY_PROGRAM_WITHOUT_TERM ||
+				rule.Intent == consts.GRAMMAR_INTENT_FILTER_BY_TAG ||
+				rule.Intent == consts.GRAMMAR_INTENT_FILTER_BY_PERSON ||
+				rule.Intent == consts.GRAMMAR_INTENT_FILTER_BY_COLLECTION {
 				filterIntents = append(filterIntents, Intent{
 					Type:     consts.GRAMMAR_TYPE_FILTER_WITHOUT_TERM,
 					Language: language,
@@ -615,6 +740,14 @@ func (e *ESEngine) searchResultsToIntents(query *Query, language string, result
 				}
 				singleHitIntents = append(singleHitIntents, intents...)
 				addSourcePositionWithoutTerm = false // We add results only one time for this rule type
+			} else if rule.Intent == consts.GRAMMAR_INTENT_DEFINITION {
+				for _, term := range vMap[consts.VAR_GLOSSARY] {
+					if intent, ok := e.Glossary.definitionIntent(term, language, score); ok {
+						singleHitIntents = append(singleHitIntents, intent)
+					} else {
+						log.Warnf("No definition of glossary term [%s] in %s.", term, language)
+					}
+				}
 			} else {
 				if intentsByLandingPage, ok := intentsCount[rule.Intent]; ok && len(intentsByLandingPage) >= consts.MAX_MATCHES_PER_GRAMMAR_INTENT {
 					if score <= minScoreByLandingPage[rule.Intent] {
@@ -1099,23 +1232,27 @@ func retrieveTextVarValues(str string) []string {
 }
 
 // Results search according to grammar based filter.
-// Return: Results, Unique list of hit id's as a map, Max score
-func (e *ESEngine) filterSearch(requests []*elastic.SearchRequest, scoreIncrement *float64, scoreMultiplication *float64) ([]*elastic.SearchResult, map[string]bool, *float64, error) {
-	results := []*elastic.SearchResult{}
-	hitIdsMap := map[string]bool{}
-	var maxScore *float64
-
+func (e *ESEngine) filterSearchDo(ctx context.Context, requests []*elastic.SearchRequest) (*elastic.MultiSearchResult, error) {
 	multiSearchFilteredService := e.esc.MultiSearch()
 	multiSearchFilteredService.Add(requests...)
 	beforeFilterSearch := time.Now()
-	mr, err := multiSearchFilteredService.Do(context.TODO())
+	mr, err := multiSearchFilteredService.Do(ctx)
 	e.timeTrack(beforeFilterSearch, consts.LAT_DOSEARCH_GRAMMARS_MULTISEARCHGRAMMARSDO) // TBC differentiate calls to filterSearch under single request
 
 	if err != nil {
-		return nil, nil, nil, errors.Wrap(err, "Error looking for grammar based filter search.")
+		return nil, errors.Wrap(err, "Error looking for grammar based filter search.")
 	}
+	return mr, nil
+}
+
+// Applies the score logic on grammar based filter search responses.
+// Return: Results, Unique list of hit id's as a map, Max score
+func filterSearchResults(responses []*elastic.SearchResult, scoreIncrement *float64, scoreMultiplication *float64) ([]*elastic.SearchResult, map[string]bool, *float64, error) {
+	results := []*elastic.SearchResult{}
+	hitIdsMap := map[string]bool{}
+	var maxScore *float64
 
-	for _, currentResults := range mr.Responses {
+	for _, currentResults := range responses {
 		if currentResults.Error != nil {
 			log.Warnf("%+v", currentResults.Error)
 			return nil, nil, nil, errors.New(fmt.Sprintf("Failed multi get in grammar based filter search: %+v", currentResults.Error))
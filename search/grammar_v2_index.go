@@ -2,8 +2,12 @@ package search
 
 import (
 	"context"
+	"crypto/sha1"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"sort"
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
@@ -24,12 +28,17 @@ type GrammarRule struct {
 	Values       []string        `json:"values,omitempty"`
 	Rules        []string        `json:"rules"`
 	RulesSuggest es.SuggestField `json:"rules_suggest"`
+	// Years range of $Year when matched by range query, see ExpandGrammarVariablesSet.
+	YearFrom int `json:"year_from,omitempty"`
+	YearTo   int `json:"year_to,omitempty"`
 }
 
 type GrammarRuleWithPercolatorQuery struct {
 	GrammarRule GrammarRule `json:"grammar_rule"`
 	Query       interface{} `json:"query"`
 	SearchText  string      `json:"search_text"`
+	SetKey      string      `json:"set_key,omitempty"`
+	SetHash     string      `json:"set_hash,omitempty"`
 }
 
 const (
@@ -159,155 +168,347 @@ func IndexGrammars(esc *elastic.Client, indexDate string, grammars GrammarsV2, v
 	log.Infof("Indexing %d grammars.", len(grammars))
 	for lang, grammarsByIntent := range grammars {
 		name := GrammarIndexName(lang, indexDate)
-		bulkService := elastic.NewBulkService(esc).Index(name)
 		log.Infof("Indexing %d intents for %s.", len(grammarsByIntent), lang)
-		for intent, grammar := range grammarsByIntent {
-			log.Infof("Indexing %d variable sets for intent \"%s\".", len(grammar.Patterns), intent)
-			for variablesSetAsString, rules := range grammar.Patterns {
-				if variablesSetAsString == "" {
-					assignedRulesSuggest := []string{}
-					for i := range rules {
-						assignedRulesSuggest = append(assignedRulesSuggest, es.Suffixes(rules[i])...)
-					}
-					qs, err := elastic.NewMatchNoneQuery().Source()
-					if err != nil {
-						return nil
-					}
-					doc := GrammarRuleWithPercolatorQuery{
-						Query: qs,
-						GrammarRule: GrammarRule{
-							HitType:      grammar.HitType,
-							Intent:       intent,
-							Rules:        rules,
-							RulesSuggest: es.SuggestField{es.Unique(assignedRulesSuggest), float64(consts.ES_GRAMMAR_SUGGEST_DEFAULT_WEIGHT)},
-							Variables:    []string{},
-							Values:       []string{},
-						},
+		sets, err := grammarRulesSets(lang, grammarsByIntent, variables, cm)
+		if err != nil {
+			return err
+		}
+		requests := []elastic.BulkableRequest{}
+		for _, set := range sets {
+			for i, doc := range set.Docs {
+				requests = append(requests, elastic.NewBulkIndexRequest().Index(name).Type("grammars").Id(grammarRulesSetDocId(set.Hash, i)).Doc(doc))
+			}
+		}
+		if err := doGrammarBulk(esc, name, requests); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Updates existing grammar index with changed rules only. Rules are compared by sets (intent and
+// variables set), percolator docs of changed or removed sets are deleted and of new or changed
+// sets are added, unchanged sets are not touched.
+func IndexGrammarsIncremental(esc *elastic.Client, indexDate string, grammars GrammarsV2, variables VariablesV2, cm cache.CacheManager) error {
+	if err := CreateGrammarIndex(esc, indexDate); err != nil {
+		return err
+	}
+
+	for _, lang := range consts.ALL_KNOWN_LANGS {
+		name := GrammarIndexName(lang, indexDate)
+		sets := map[string]grammarRulesSet{}
+		if grammarsByIntent, ok := grammars[lang]; ok {
+			var err error
+			if sets, err = grammarRulesSets(lang, grammarsByIntent, variables, cm); err != nil {
+				return err
+			}
+		}
+		indexedHashes, indexedIds, err := indexedGrammarRulesSets(esc, name)
+		if err != nil {
+			return err
+		}
+
+		// Set is unchanged when all of its docs are indexed with same hash, sets partially
+		// indexed (e.g., failed bulk items of previous update) are indexed again.
+		indexed := func(key string, set grammarRulesSet) bool {
+			hashes := indexedHashes[key]
+			return len(hashes) == 1 && hashes[0] == set.Hash && len(indexedIds[key]) == len(set.Docs)
+		}
+		requests := []elastic.BulkableRequest{}
+		added, removed, unchanged := 0, 0, 0
+		for key := range indexedHashes {
+			if set, ok := sets[key]; ok && indexed(key, set) {
+				continue
+			}
+			for _, id := range indexedIds[key] {
+				requests = append(requests, elastic.NewBulkDeleteRequest().Index(name).Type("grammars").Id(id))
+			}
+			removed++
+		}
+		for key, set := range sets {
+			if indexed(key, set) {
+				unchanged++
+				continue
+			}
+			for i, doc := range set.Docs {
+				requests = append(requests, elastic.NewBulkIndexRequest().Index(name).Type("grammars").Id(grammarRulesSetDocId(set.Hash, i)).Doc(doc))
+			}
+			added++
+		}
+		log.Infof("Incremental grammar update of %s: %d sets added, %d removed, %d unchanged.", name, added, removed, unchanged)
+		if len(requests) == 0 {
+			continue
+		}
+		if err := doGrammarBulk(esc, name, requests); err != nil {
+			return err
+		}
+		if _, err := esc.Refresh(name).Do(context.TODO()); err != nil {
+			return errors.Wrapf(err, "Refresh %s.", name)
+		}
+	}
+
+	return nil
+}
+
+// Reads set hashes and doc ids of indexed percolator docs, by set key.
+// Docs indexed without set key are all returned under empty key.
+func indexedGrammarRulesSets(esc *elastic.Client, name string) (map[string][]string, map[string][]string, error) {
+	hashes := make(map[string][]string)
+	ids := make(map[string][]string)
+	scroll := esc.Scroll(name).
+		Query(elastic.NewMatchAllQuery()).
+		FetchSourceContext(elastic.NewFetchSourceContext(true).Include("set_key", "set_hash")).
+		Size(1000)
+	for {
+		res, err := scroll.Do(context.TODO())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Scroll %s.", name)
+		}
+		for _, hit := range res.Hits.Hits {
+			var doc struct {
+				SetKey  string `json:"set_key"`
+				SetHash string `json:"set_hash"`
+			}
+			if err := json.Unmarshal(*hit.Source, &doc); err != nil {
+				return nil, nil, errors.Wrapf(err, "Unmarshal %s.", hit.Id)
+			}
+			if !utils.Contains(utils.Is(hashes[doc.SetKey]), doc.SetHash) {
+				hashes[doc.SetKey] = append(hashes[doc.SetKey], doc.SetHash)
+			}
+			ids[doc.SetKey] = append(ids[doc.SetKey], hit.Id)
+		}
+	}
+	if err := scroll.Clear(context.TODO()); err != nil {
+		log.Warnf("Failed clearing scroll of %s: %+v", name, err)
+	}
+	return hashes, ids, nil
+}
+
+// Sends the requests in bulks of GRAMMAR_BULK_BATCH_SIZE, fails on failed items of any bulk.
+// Deletes of missing docs are not failures.
+func doGrammarBulk(esc *elastic.Client, name string, requests []elastic.BulkableRequest) error {
+	failed := 0
+	var firstFailure *elastic.BulkResponseItem
+	for start := 0; start < len(requests); start += consts.GRAMMAR_BULK_BATCH_SIZE {
+		end := utils.MinInt(start+consts.GRAMMAR_BULK_BATCH_SIZE, len(requests))
+		bulkRes, err := elastic.NewBulkService(esc).Index(name).Add(requests[start:end]...).Do(context.TODO())
+		if err != nil {
+			return errors.Wrapf(err, "Bulk %s [%d, %d).", name, start, end)
+		}
+		for _, res := range bulkRes.Failed() {
+			if res.Error == nil && res.Status == http.StatusNotFound {
+				continue
+			}
+			if firstFailure == nil {
+				firstFailure = res
+			}
+			failed++
+		}
+	}
+	if failed > 0 {
+		reason := ""
+		if firstFailure.Error != nil {
+			reason = fmt.Sprintf("%s: %s", firstFailure.Error.Type, firstFailure.Error.Reason)
+		}
+		return errors.Errorf("Bulk %s: %d of %d items failed, first failure [%s] %d %s.", name, failed, len(requests), firstFailure.Id, firstFailure.Status, reason)
+	}
+	return nil
+}
+
+// Percolator docs generated for one intent and variables set of a grammar.
+type grammarRulesSet struct {
+	Hash string
+	Docs []GrammarRuleWithPercolatorQuery
+}
+
+func grammarRulesSetKey(intent string, variablesSetAsString string) string {
+	return fmt.Sprintf("%s:%s", intent, variablesSetAsString)
+}
+
+// Doc ids depend on set hash, so reindexing unchanged set does not change the index.
+func grammarRulesSetDocId(hash string, i int) string {
+	return fmt.Sprintf("%s-%d", hash, i)
+}
+
+// Generates percolator docs of all grammars of one language, by set key.
+func grammarRulesSets(lang string, grammarsByIntent map[string]*GrammarV2, variables VariablesV2, cm cache.CacheManager) (map[string]grammarRulesSet, error) {
+	sets := make(map[string]grammarRulesSet)
+	for intent, grammar := range grammarsByIntent {
+		log.Infof("Indexing %d variable sets for intent \"%s\".", len(grammar.Patterns), intent)
+		for variablesSetAsString, rules := range grammar.Patterns {
+			docs, err := grammarRulesSetDocs(lang, intent, grammar, variablesSetAsString, rules, variables, cm)
+			if err != nil {
+				return nil, err
+			}
+			key := grammarRulesSetKey(intent, variablesSetAsString)
+			hash, err := grammarRulesSetHash(key, docs)
+			if err != nil {
+				return nil, err
+			}
+			for i := range docs {
+				docs[i].SetKey = key
+				docs[i].SetHash = hash
+			}
+			sets[key] = grammarRulesSet{Hash: hash, Docs: docs}
+		}
+	}
+	return sets, nil
+}
+
+// Hash of canonical form of set docs, independent of order of values, rules and phrases.
+// Docs are sorted by canonical form, so doc ids of same set are stable.
+func grammarRulesSetHash(key string, docs []GrammarRuleWithPercolatorQuery) (string, error) {
+	canonical := make([]string, len(docs))
+	for i, doc := range docs {
+		doc.GrammarRule.Rules = append([]string(nil), doc.GrammarRule.Rules...)
+		sort.Strings(doc.GrammarRule.Rules)
+		doc.GrammarRule.RulesSuggest.Input = append([]string(nil), doc.GrammarRule.RulesSuggest.Input...)
+		sort.Strings(doc.GrammarRule.RulesSuggest.Input)
+		docJson, err := json.Marshal(doc)
+		if err != nil {
+			return "", errors.Wrapf(err, "Marshal rules set %s.", key)
+		}
+		canonical[i] = string(docJson)
+	}
+	order := make([]int, len(docs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return canonical[order[i]] < canonical[order[j]]
+	})
+	sortedDocs := make([]GrammarRuleWithPercolatorQuery, len(docs))
+	h := sha1.New()
+	h.Write([]byte(key))
+	for i, j := range order {
+		sortedDocs[i] = docs[j]
+		h.Write([]byte(canonical[j]))
+	}
+	copy(docs, sortedDocs)
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Generates percolator docs for one variables set, e.g., "$Year|$ConventionLocation", of grammar rules.
+func grammarRulesSetDocs(lang string, intent string, grammar *GrammarV2, variablesSetAsString string, rules []string, variables VariablesV2, cm cache.CacheManager) ([]GrammarRuleWithPercolatorQuery, error) {
+	docs := []GrammarRuleWithPercolatorQuery(nil)
+	if variablesSetAsString == "" {
+		assignedRulesSuggest := []string{}
+		for i := range rules {
+			assignedRulesSuggest = append(assignedRulesSuggest, es.Suffixes(rules[i])...)
+		}
+		qs, err := elastic.NewMatchNoneQuery().Source()
+		if err != nil {
+			return nil, err
+		}
+		doc := GrammarRuleWithPercolatorQuery{
+			Query: qs,
+			GrammarRule: GrammarRule{
+				HitType:      grammar.HitType,
+				Intent:       intent,
+				Rules:        rules,
+				RulesSuggest: es.SuggestField{es.Unique(assignedRulesSuggest), float64(consts.ES_GRAMMAR_SUGGEST_DEFAULT_WEIGHT)},
+				Variables:    []string{},
+				Values:       []string{},
+			},
+		}
+		docs = append(docs, doc)
+	} else {
+
+		// List of variables: ["$Year", "$ConventionLocation"]
+		variablesSet := VariablesFromString(variablesSetAsString)
+		hasTextVar := utils.StringInSlice(consts.VAR_TEXT, variablesSet)
+		expansion := ExpandGrammarVariablesSet(lang, intent, variablesSet, rules, variables, cm, GrammarExpansionLimitsFromConfig())
+		// Iterate over each matching pair of values, e.g., ["2018", "Moscow"], ["2019", "Moscow"], ..., ["2018", "Tel Aviv"], ...
+		for _, variableValues := range expansion.values {
+			log.Infof("values set for intent '%s': %+v", intent, variableValues)
+			assignedRules := []string(nil)
+			for i := range rules {
+				var assignedRule string
+				// For set of values: ["2018", "Moscow"] provide list of phrases:
+				// [["2018", "Two thousand and eigheen"], ["Moscow", "Russian, Moscow"]]
+				variableValuesPhrases := [][]string(nil)
+				for j := range variableValues {
+					variableValuesPhrases = append(variableValuesPhrases, grammarValuePhrases(variables, variablesSet[j], lang, variableValues[j]))
+				}
+				// Iterate over different pheases for each value, see |variableValuesPhrases| variable.
+				for phrasesIter := CreateCrossIter(variableValuesPhrases); phrasesIter.Next(); {
+					assignValues := phrasesIter.Values()
+					assignedRule = rules[i]
+					for j := range assignValues {
+						assignedRule = strings.Replace(assignedRule, variablesSet[j], assignValues[j], -1)
 					}
-					bulkService.Add(elastic.NewBulkIndexRequest().Index(name).Type("grammars").Doc(doc))
-				} else {
-
-					// List of variables: ["$Year", "$ConventionLocation"]
-					variablesSet := VariablesFromString(variablesSetAsString)
-
-					// Set of possible variable values: [["2000", "2001", ...], ["Moscow", "Tel Aviv", "New York", ...]]
-					variablesValues := [][]string(nil)
-					hasTextVar := false
-					for i, variable := range variablesSet {
-						if !hasTextVar && variable == consts.VAR_TEXT {
-							hasTextVar = true
+					assignedRules = append(assignedRules, assignedRule)
+				}
+			}
+			var percolatorQuery elastic.Query
+			assignedRulesSuggest := []string{}
+			if hasTextVar {
+				ruleClauses := []string{}
+				for _, ruleStr := range assignedRules {
+					splitted := strings.Split(ruleStr, consts.VAR_TEXT)
+					withinQuotaionMarks := []string{}
+					for _, str := range splitted {
+						if len(str) > 0 {
+							str = strings.Replace(str, "\"", "\\\"", -1)
+							withinQuotaionMarks = append(withinQuotaionMarks, fmt.Sprintf("\"%s\"", strings.TrimSpace(str)))
 						}
-						variablesValues = append(variablesValues, utils.StringMapOrderedKeys(variables[variablesSet[i]][lang]))
 					}
-					log.Infof("Cross iterating over %+v", variablesValues)
-					// Iterate over each pair of values, e.g., ["2018", "Moscow"], ["2019", "Moscow"], ..., ["2018", "Tel Aviv"], ...
-					for valueIter := CreateCrossIter(variablesValues); valueIter.Next(); {
-
-						variableValues := valueIter.Values()
-						vMap := make(map[string][]string)
-						for i := range variablesSet {
-							vMap[variablesSet[i]] = []string{variableValues[i]}
-						}
-						if !GrammarVariablesMatch(intent, vMap, cm) {
-							continue
-						}
-
-						log.Infof("values set for intent '%s': %+v", intent, variableValues)
-						assignedRules := []string(nil)
-						for i := range rules {
-							var assignedRule string
-							// For set of values: ["2018", "Moscow"] provide list of phrases:
-							// [["2018", "Two thousand and eigheen"], ["Moscow", "Russian, Moscow"]]
-							variableValuesPhrases := [][]string(nil)
-							for j := range variableValues {
-								variableValuesPhrases = append(variableValuesPhrases, variables[variablesSet[j]][lang][variableValues[j]])
-							}
-							// Iterate over different pheases for each value, see |variableValuesPhrases| variable.
-							for phrasesIter := CreateCrossIter(variableValuesPhrases); phrasesIter.Next(); {
-								assignValues := phrasesIter.Values()
-								assignedRule = rules[i]
-								for j := range assignValues {
-									assignedRule = strings.Replace(assignedRule, variablesSet[j], assignValues[j], -1)
-								}
-								assignedRules = append(assignedRules, assignedRule)
-							}
-						}
-						var percolatorQuery elastic.Query
-						assignedRulesSuggest := []string{}
-						if hasTextVar {
-							ruleClauses := []string{}
-							for _, ruleStr := range assignedRules {
-								splitted := strings.Split(ruleStr, consts.VAR_TEXT)
-								withinQuotaionMarks := []string{}
-								for _, str := range splitted {
-									if len(str) > 0 {
-										str = strings.Replace(str, "\"", "\\\"", -1)
-										withinQuotaionMarks = append(withinQuotaionMarks, fmt.Sprintf("\"%s\"", strings.TrimSpace(str)))
-									}
-								}
-								if len(withinQuotaionMarks) > 0 {
-									var ruleClause string
-									if len(withinQuotaionMarks) == 1 {
-										ruleClause = fmt.Sprintf("(%s)", withinQuotaionMarks[0])
-									} else {
-										ruleClause = fmt.Sprintf("(%s)", strings.Join(withinQuotaionMarks, " AND "))
-									}
-									if !utils.Contains(utils.Is(ruleClauses), ruleClause) {
-										ruleClauses = append(ruleClauses, ruleClause)
-									}
-								}
-							}
-							queryStr := strings.Join(ruleClauses, " OR ")
-							fmt.Printf("Query for percolator: %s\n", queryStr)
-							percolatorQuery = elastic.NewQueryStringQuery(queryStr).Field("search_text")
+					if len(withinQuotaionMarks) > 0 {
+						var ruleClause string
+						if len(withinQuotaionMarks) == 1 {
+							ruleClause = fmt.Sprintf("(%s)", withinQuotaionMarks[0])
 						} else {
-							percolatorQuery = elastic.MatchNoneQuery{}
-							if val, ok := consts.ES_SUGGEST_SUPPORTED_GRAMMAR_RULES[intent]; ok && val {
-								for i := range assignedRules {
-									assignedRulesSuggest = append(assignedRulesSuggest, assignedRules[i])
-								}
-								for i := range assignedRulesSuggest {
-									if assignedRulesSuggest[i] == "" {
-										log.Infof("NNN: %+v", assignedRulesSuggest[i])
-									}
-								}
-								log.Infof("Rules suggest: [%s]", strings.Join(assignedRulesSuggest, "|"))
-							}
-						}
-						rule := GrammarRule{
-							HitType:      grammar.HitType,
-							Intent:       intent,
-							Rules:        assignedRules,
-							RulesSuggest: es.SuggestField{es.Unique(assignedRulesSuggest), float64(consts.ES_GRAMMAR_SUGGEST_DEFAULT_WEIGHT)},
-							Variables:    variablesSet,
-							Values:       variableValues,
+							ruleClause = fmt.Sprintf("(%s)", strings.Join(withinQuotaionMarks, " AND "))
 						}
-						qs, err := percolatorQuery.Source()
-						if err != nil {
-							return err
+						if !utils.Contains(utils.Is(ruleClauses), ruleClause) {
+							ruleClauses = append(ruleClauses, ruleClause)
 						}
-						doc := GrammarRuleWithPercolatorQuery{
-							Query:       qs,
-							GrammarRule: rule,
-						}
-						bulkService.Add(elastic.NewBulkIndexRequest().Index(name).Type("grammars").Doc(doc))
 					}
 				}
-			}
-		}
-		if bulkRes, err := bulkService.Do(context.TODO()); err != nil {
-			return err
-		} else {
-			for _, itemMap := range bulkRes.Items {
-				for _, res := range itemMap {
-					if res.Error != nil {
-						log.Infof("Error: %+v", res.Error)
-						log.Infof("Res: %+v", res)
+				// Stable query for set hash, clauses are in order of values phrases.
+				sort.Strings(ruleClauses)
+				queryStr := strings.Join(ruleClauses, " OR ")
+				log.Debugf("Query for percolator: %s", queryStr)
+				percolatorQuery = elastic.NewQueryStringQuery(queryStr).Field("search_text")
+			} else {
+				percolatorQuery = elastic.MatchNoneQuery{}
+				// Rules with years range are not suggested, the year is known only from the query.
+				if val, ok := consts.ES_SUGGEST_SUPPORTED_GRAMMAR_RULES[intent]; ok && val && !expansion.YearRange {
+					for i := range assignedRules {
+						assignedRulesSuggest = append(assignedRulesSuggest, assignedRules[i])
+					}
+					for i := range assignedRulesSuggest {
+						if assignedRulesSuggest[i] == "" {
+							log.Infof("NNN: %+v", assignedRulesSuggest[i])
+						}
 					}
+					log.Infof("Rules suggest: [%s]", strings.Join(assignedRulesSuggest, "|"))
 				}
 			}
+			rule := GrammarRule{
+				HitType:      grammar.HitType,
+				Intent:       intent,
+				Rules:        assignedRules,
+				RulesSuggest: es.SuggestField{es.Unique(assignedRulesSuggest), float64(consts.ES_GRAMMAR_SUGGEST_DEFAULT_WEIGHT)},
+				Variables:    variablesSet,
+				Values:       variableValues,
+				YearFrom:     expansion.YearFrom,
+				YearTo:       expansion.YearTo,
+			}
+			qs, err := percolatorQuery.Source()
+			if err != nil {
+				return nil, err
+			}
+			doc := GrammarRuleWithPercolatorQuery{
+				Query:       qs,
+				GrammarRule: rule,
+			}
+			docs = append(docs, doc)
 		}
 	}
-
-	return nil
+	return docs, nil
 }
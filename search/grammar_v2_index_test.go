@@ -0,0 +1,324 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/cache"
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+)
+
+type GrammarIndexSuite struct {
+	suite.Suite
+	dir       string
+	backend   es.Backend
+	esc       *elastic.Client
+	variables VariablesV2
+}
+
+func TestGrammarIndex(t *testing.T) {
+	suite.Run(t, new(GrammarIndexSuite))
+}
+
+func (suite *GrammarIndexSuite) SetupTest() {
+	r := suite.Require()
+	viper.Set("elasticsearch.data-folder", "../data")
+	viper.Set("elasticsearch.unzip-url", "http://localhost")
+	es.InitEnv()
+
+	var err error
+	suite.dir, err = ioutil.TempDir("", "grammars")
+	r.Nil(err)
+	suite.backend, err = es.MakeBackend(consts.ES_BACKEND_EMBEDDED, "")
+	r.Nil(err)
+	suite.esc, err = suite.backend.NewClient()
+	r.Nil(err)
+	suite.variables = VariablesV2{
+		consts.VAR_TEXT: {
+			consts.LANG_ENGLISH: {consts.VAR_TEXT: {consts.VAR_TEXT}},
+		},
+		consts.VAR_CONTENT_TYPE: {
+			consts.LANG_ENGLISH: {"lessons": {"lessons", "lesson"}, "clips": {"clips"}},
+		},
+		consts.VAR_PROGRAM: {
+			consts.LANG_ENGLISH: {"program1": {"new life"}},
+		},
+	}
+}
+
+func (suite *GrammarIndexSuite) TearDownTest() {
+	suite.esc.Stop()
+	suite.backend.Stop()
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *GrammarIndexSuite) grammars(lines ...string) GrammarsV2 {
+	path := filepath.Join(suite.dir, "filter.grammar")
+	suite.Require().Nil(ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644))
+	grammars, err := ReadGrammarFileV2(path)
+	suite.Require().Nil(err)
+	return grammars
+}
+
+func (suite *GrammarIndexSuite) indexedIds() map[string][]string {
+	_, ids, err := indexedGrammarRulesSets(suite.esc, GrammarIndexName(consts.LANG_ENGLISH, ""))
+	suite.Require().Nil(err)
+	return ids
+}
+
+func (suite *GrammarIndexSuite) TestIncremental() {
+	r := suite.Require()
+	contentTypeKey := grammarRulesSetKey(consts.GRAMMAR_INTENT_FILTER_BY_CONTENT_TYPE, "$ContentType|$Text")
+	programKey := grammarRulesSetKey(consts.GRAMMAR_INTENT_FILTER_BY_PROGRAM, "$Program|$Text")
+
+	grammars := suite.grammars(
+		"en,by_content_type => $ContentType about $Text",
+		"en,by_program => $Text from $Program",
+	)
+	r.Nil(IndexGrammars(suite.esc, "", grammars, suite.variables, nil))
+	_, err := suite.esc.Refresh(GrammarIndexName(consts.LANG_ENGLISH, "")).Do(context.TODO())
+	r.Nil(err)
+	full := suite.indexedIds()
+	r.Len(full, 2)
+	r.Len(full[contentTypeKey], 2)
+	r.Len(full[programKey], 1)
+
+	// Nothing changed.
+	r.Nil(IndexGrammarsIncremental(suite.esc, "", grammars, suite.variables, nil))
+	r.Equal(full, suite.indexedIds())
+
+	// Order of phrases changed, e.g., merged from DB, nothing is reindexed.
+	contentTypes := suite.variables[consts.VAR_CONTENT_TYPE][consts.LANG_ENGLISH]
+	contentTypes["lessons"] = []string{"lesson", "lessons"}
+	r.Nil(IndexGrammarsIncremental(suite.esc, "", grammars, suite.variables, nil))
+	r.Equal(full, suite.indexedIds())
+
+	// New program value, only program rules are reindexed.
+	suite.variables[consts.VAR_PROGRAM][consts.LANG_ENGLISH]["program2"] = []string{"program two"}
+	r.Nil(IndexGrammarsIncremental(suite.esc, "", grammars, suite.variables, nil))
+	ids := suite.indexedIds()
+	r.Equal(full[contentTypeKey], ids[contentTypeKey])
+	r.Len(ids[programKey], 2)
+	r.NotContains(ids[programKey], full[programKey][0])
+
+	// Stale docs without set are removed together with removed rules.
+	_, err = suite.esc.Index().Index(GrammarIndexName(consts.LANG_ENGLISH, "")).Type("grammars").Id("stale").
+		BodyJson(GrammarRuleWithPercolatorQuery{GrammarRule: GrammarRule{HitType: "filter", Intent: "stale"}, Query: elastic.MatchNoneQuery{}}).
+		Refresh("true").Do(context.TODO())
+	r.Nil(err)
+	r.Equal([]string{"stale"}, suite.indexedIds()[""])
+	grammars = suite.grammars(
+		"en,by_content_type => $ContentType about $Text",
+	)
+	r.Nil(IndexGrammarsIncremental(suite.esc, "", grammars, suite.variables, nil))
+	r.Equal(map[string][]string{contentTypeKey: full[contentTypeKey]}, suite.indexedIds())
+}
+
+func (suite *GrammarIndexSuite) TestIncrementalPartialSet() {
+	r := suite.Require()
+	contentTypeKey := grammarRulesSetKey(consts.GRAMMAR_INTENT_FILTER_BY_CONTENT_TYPE, "$ContentType|$Text")
+	grammars := suite.grammars("en,by_content_type => $ContentType about $Text")
+	r.Nil(IndexGrammars(suite.esc, "", grammars, suite.variables, nil))
+	_, err := suite.esc.Refresh(GrammarIndexName(consts.LANG_ENGLISH, "")).Do(context.TODO())
+	r.Nil(err)
+	full := suite.indexedIds()
+	r.Len(full[contentTypeKey], 2)
+
+	// E.g., failed bulk item, the set is indexed again.
+	_, err = suite.esc.Delete().Index(GrammarIndexName(consts.LANG_ENGLISH, "")).Type("grammars").Id(full[contentTypeKey][0]).
+		Refresh("true").Do(context.TODO())
+	r.Nil(err)
+	r.Len(suite.indexedIds()[contentTypeKey], 1)
+	r.Nil(IndexGrammarsIncremental(suite.esc, "", grammars, suite.variables, nil))
+	r.ElementsMatch(full[contentTypeKey], suite.indexedIds()[contentTypeKey])
+}
+
+func (suite *GrammarIndexSuite) TestBulkFailures() {
+	r := suite.Require()
+	bulks := 0
+	failIndex := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		bulks++
+		items := []string{`{"delete": {"_id": "missing", "status": 404, "result": "not_found"}}`}
+		if failIndex {
+			items = append(items, `{"index": {"_id": "bad", "status": 400, "error": {"type": "mapper_parsing_exception", "reason": "failed to parse"}}}`)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"took": 1, "errors": true, "items": [%s]}`, strings.Join(items, ","))
+	}))
+	defer server.Close()
+	esc, err := elastic.NewClient(elastic.SetURL(server.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	r.Nil(err)
+
+	requests := []elastic.BulkableRequest{}
+	for i := 0; i < 2*consts.GRAMMAR_BULK_BATCH_SIZE+1; i++ {
+		requests = append(requests, elastic.NewBulkDeleteRequest().Type("grammars").Id(fmt.Sprintf("%d", i)))
+	}
+	// Deletes of missing docs are not failures.
+	r.Nil(doGrammarBulk(esc, "grammars", requests))
+	r.Equal(3, bulks)
+
+	failIndex = true
+	err = doGrammarBulk(esc, "grammars", requests)
+	r.NotNil(err)
+	r.Contains(err.Error(), fmt.Sprintf("3 of %d items failed", len(requests)))
+	r.Contains(err.Error(), "mapper_parsing_exception")
+}
+
+// Conventions stats, other caches are not used.
+type conventionsCacheManager struct {
+	cache.CacheManager
+	conventions map[string]bool
+}
+
+func (cm conventionsCacheManager) SearchStats() cache.SearchStatsCache {
+	return conventionsSearchStats{conventions: cm.conventions}
+}
+
+type conventionsSearchStats struct {
+	cache.SearchStatsCache
+	conventions map[string]bool
+}
+
+func (s conventionsSearchStats) DoesConventionExist(location string, year string) bool {
+	return s.conventions[location+" "+year]
+}
+
+func (suite *GrammarIndexSuite) TestExpansion() {
+	r := suite.Require()
+	suite.variables[consts.VAR_YEAR] = TranslationsV2{
+		consts.LANG_ENGLISH: {"2018": {"2018"}, "2019": {"2019"}, "2020": {"2020"}},
+	}
+	suite.variables[consts.VAR_CONVENTION_LOCATION] = TranslationsV2{
+		consts.LANG_ENGLISH: {"moscow": {"moscow", "russia moscow"}, "sofia": {"sofia"}},
+	}
+	cm := conventionsCacheManager{conventions: map[string]bool{"moscow 2019": true, "sofia 2018": true}}
+	conventions := []string{consts.VAR_CONVENTION_LOCATION, consts.VAR_YEAR}
+	rules := []string{"$ConventionLocation $Year", "$ConventionLocation congress $Year"}
+
+	e := ExpandGrammarVariablesSet(consts.LANG_ENGLISH, consts.GRAMMAR_INTENT_LANDING_PAGE_CONVENTIONS, conventions, rules, suite.variables, cm, GrammarExpansionLimits{})
+	r.Equal(6, e.Combinations)
+	r.Equal(2, e.Docs)
+	r.Equal(2, e.Indexed)
+	r.Equal(6, e.Phrases)
+	r.False(e.YearRange)
+
+	// Over cap $Year is matched by range.
+	e = ExpandGrammarVariablesSet(consts.LANG_ENGLISH, consts.GRAMMAR_INTENT_LANDING_PAGE_CONVENTIONS, conventions, rules, suite.variables, cm, GrammarExpansionLimits{MaxDocs: 4})
+	r.True(e.YearRange)
+	r.Equal([]int{2018, 2020}, []int{e.YearFrom, e.YearTo})
+	r.Equal(2, e.Docs)
+	r.False(e.Capped())
+
+	// Other rules are truncated.
+	e = ExpandGrammarVariablesSet(consts.LANG_ENGLISH, consts.GRAMMAR_INTENT_FILTER_BY_CONTENT_TYPE, []string{consts.VAR_CONTENT_TYPE, consts.VAR_TEXT}, []string{"$ContentType about $Text"}, suite.variables, nil, GrammarExpansionLimits{MaxDocs: 1})
+	r.Equal(2, e.Docs)
+	r.Equal(1, e.Indexed)
+	r.True(e.Capped())
+
+	r.Equal([]int{2019}, grammarQueryYears("moscow 2019 19 12345 2019"))
+	r.Equal("moscow 0000 congress", grammarQueryWithYearPlaceholder("moscow  2019 congress", 2019))
+}
+
+func (suite *GrammarIndexSuite) TestYearRange() {
+	r := suite.Require()
+	suite.variables[consts.VAR_YEAR] = TranslationsV2{
+		consts.LANG_ENGLISH: {"2018": {"2018"}, "2019": {"2019"}, "2020": {"2020"}},
+	}
+	suite.variables[consts.VAR_CONVENTION_LOCATION] = TranslationsV2{
+		consts.LANG_ENGLISH: {"moscow": {"moscow"}, "sofia": {"sofia"}},
+	}
+	cm := conventionsCacheManager{conventions: map[string]bool{"moscow 2019": true, "sofia 2018": true}}
+	viper.Set("elasticsearch.grammar-year-range", true)
+	defer viper.Set("elasticsearch.grammar-year-range", false)
+	viper.Set("elasticsearch.grammar-index-date", "")
+
+	grammars := suite.grammars("en,conventions => $ConventionLocation congress $Year")
+	r.Nil(IndexGrammars(suite.esc, "", grammars, suite.variables, cm))
+	_, err := suite.esc.Refresh(GrammarIndexName(consts.LANG_ENGLISH, "")).Do(context.TODO())
+	r.Nil(err)
+	r.Len(suite.indexedIds()[grammarRulesSetKey(consts.GRAMMAR_INTENT_LANDING_PAGE_CONVENTIONS, "$ConventionLocation|$Year")], 2)
+
+	engine := NewESEngine(suite.esc, nil, cm, nil, suite.variables, nil)
+	matches, err := engine.GrammarRuleMatches(context.TODO(), &Query{Term: "moscow congress 2019", LanguageOrder: []string{consts.LANG_ENGLISH}}, consts.LANG_ENGLISH)
+	r.Nil(err)
+	r.Len(matches, 1)
+	r.Equal(map[string][]string{consts.VAR_CONVENTION_LOCATION: {"moscow"}, consts.VAR_YEAR: {"2019"}}, matches[0].Variables)
+
+	// Year in range without convention, out of range and missing.
+	for _, term := range []string{"moscow congress 2018", "moscow congress 2021", "moscow congress"} {
+		matches, err = engine.GrammarRuleMatches(context.TODO(), &Query{Term: term, LanguageOrder: []string{consts.LANG_ENGLISH}}, consts.LANG_ENGLISH)
+		r.Nil(err)
+		r.Empty(matches, term)
+	}
+}
+
+func (suite *GrammarIndexSuite) TestEntityVariables() {
+	r := suite.Require()
+	r.Equal([]string{"Baal HaSulam", "Yehuda Ashlag"}, normalizeVariablePhrases(" \"Baal  HaSulam\" (Yehuda Ashlag)"))
+	r.Equal([]string{"Love", "Bestowal"}, normalizeVariablePhrases("Love / Bestowal"))
+
+	mergeVariableTranslations(suite.variables, consts.VAR_TAG, TranslationsV2{
+		consts.LANG_ENGLISH: {"tag1": normalizeVariablePhrases("Love (Bestowal)")},
+	})
+	mergeVariableTranslations(suite.variables, consts.VAR_PERSON, TranslationsV2{
+		consts.LANG_ENGLISH: {"person1": normalizeVariablePhrases("Michael Laitman")},
+	})
+	// Merged phrases are sorted, same on each load.
+	r.Equal([]string{"Bestowal", "Love"}, suite.variables[consts.VAR_TAG][consts.LANG_ENGLISH]["tag1"])
+	for i := 0; i < 10; i++ {
+		merged := VariablesV2{consts.VAR_TAG: {consts.LANG_ENGLISH: {"tag1": {"Zohar", "Bestowal"}}}}
+		mergeVariableTranslations(merged, consts.VAR_TAG, TranslationsV2{
+			consts.LANG_ENGLISH: {"tag1": {"Love", "Arvut", "Bestowal", "Kabbalah"}},
+		})
+		r.Equal([]string{"Arvut", "Bestowal", "Kabbalah", "Love", "Zohar"}, merged[consts.VAR_TAG][consts.LANG_ENGLISH]["tag1"])
+	}
+	viper.Set("elasticsearch.grammar-index-date", "")
+	grammars := suite.grammars(
+		"en,by_content_type => $ContentType about $Text",
+		"en,by_tag => $ContentType about $Tag",
+		"en,by_person => $ContentType with $Person",
+	)
+	r.Nil(IndexGrammars(suite.esc, "", grammars, suite.variables, nil))
+	_, err := suite.esc.Refresh(GrammarIndexName(consts.LANG_ENGLISH, "")).Do(context.TODO())
+	r.Nil(err)
+
+	engine := NewESEngine(suite.esc, nil, nil, nil, suite.variables, nil)
+	intents := map[string]map[string][]string{}
+	for _, term := range []string{"lessons about bestowal", "lessons with michael laitman"} {
+		matches, err := engine.GrammarRuleMatches(context.TODO(), &Query{Term: term, LanguageOrder: []string{consts.LANG_ENGLISH}}, consts.LANG_ENGLISH)
+		r.Nil(err)
+		for _, match := range matches {
+			intents[match.Intent] = match.Variables
+		}
+	}
+	r.Equal(map[string][]string{consts.VAR_CONTENT_TYPE: {"lessons"}, consts.VAR_TAG: {"tag1"}}, intents[consts.GRAMMAR_INTENT_FILTER_BY_TAG])
+	r.Equal(map[string][]string{consts.VAR_CONTENT_TYPE: {"lessons"}, consts.VAR_PERSON: {"person1"}}, intents[consts.GRAMMAR_INTENT_FILTER_BY_PERSON])
+
+	// Content types without filter values and other variables do not match.
+	r.False(GrammarVariablesMatch(consts.GRAMMAR_INTENT_FILTER_BY_TAG, map[string][]string{consts.VAR_CONTENT_TYPE: {consts.VAR_CT_SOURCES}, consts.VAR_TAG: {"tag1"}}, nil))
+	r.False(GrammarVariablesMatch(consts.GRAMMAR_INTENT_FILTER_BY_TAG, map[string][]string{consts.VAR_PERSON: {"person1"}, consts.VAR_TAG: {"tag1"}}, nil))
+	r.True(GrammarVariablesMatch(consts.GRAMMAR_INTENT_FILTER_BY_PERSON, map[string][]string{consts.VAR_PERSON: {"person1"}}, nil))
+
+	// Entity filters are added to content type filters.
+	requests, err := NewFilteredResultsSearchRequest("", nil, consts.VAR_CT_LESSONS, "", nil,
+		map[string][]string{consts.FILTER_TAG: {"tag1"}}, 0, 10, consts.SORT_BY_RELEVANCE, nil, consts.LANG_ENGLISH, "", false)
+	r.Nil(err)
+	r.NotEmpty(requests)
+	body, err := requests[0].Body()
+	r.Nil(err)
+	r.Contains(body, "tag1")
+	r.NotContains(consts.CT_VARIABLE_TO_FILTER_VALUES[consts.VAR_CT_LESSONS], consts.FILTER_TAG)
+}
@@ -31,6 +31,12 @@ func GrammarVariablesMatch(intent string, vMap map[string][]string, cm cache.Cac
 		return sourcePositionWithoutTermMatch(vMap, cm)
 	case consts.GRAMMAR_INTENT_FILTER_BY_CONTENT_TYPE:
 		return filterByContentTypeMatch(vMap)
+	case consts.GRAMMAR_INTENT_FILTER_BY_TAG:
+		return filterByEntityMatch(vMap, consts.VAR_TAG)
+	case consts.GRAMMAR_INTENT_FILTER_BY_PERSON:
+		return filterByEntityMatch(vMap, consts.VAR_PERSON)
+	case consts.GRAMMAR_INTENT_FILTER_BY_COLLECTION:
+		return filterByEntityMatch(vMap, consts.VAR_COLLECTION)
 	case consts.GRAMMAR_INTENT_LANDING_PAGE_CONVENTIONS:
 		return landingPageConventionsMatch(vMap, cm)
 	case consts.GRAMMAR_INTENT_LANDING_PAGE_HOLIDAYS:
@@ -136,6 +142,10 @@ func programPositionWithoutTermMatch(vMap map[string][]string, cm cache.CacheMan
 	if varProgramCollection == "" {
 		varProgramCollection = consts.PROGRAM_COLLECTION_NEW_LIFE
 	}
+	// Uninitialized, usually for tests. Return false.
+	if cm == nil {
+		return false
+	}
 	c := cm.SearchStats().GetProgramByCollectionAndPosition(varProgramCollection, varPosition)
 	return c != nil
 }
@@ -243,6 +253,10 @@ func sourcePositionWithoutTermMatch(vMap map[string][]string, cm cache.CacheMana
 			divTypes = val
 		}
 	}
+	// Uninitialized, usually for tests. Return false.
+	if cm == nil {
+		return false
+	}
 	// If divTypes is not assigned, GetSourceByPositionAndParent will check all types
 	src := cm.SearchStats().GetSourceByPositionAndParent(varSource, varPosition, divTypes)
 	return src != nil
@@ -275,6 +289,28 @@ func filterByContentTypeMatch(vMap map[string][]string) bool {
 	return true
 }
 
+// Filter intents without term by topic, person or congress. One value of |entityVariable| and optional
+// $ContentType that has content type filters.
+func filterByEntityMatch(vMap map[string][]string, entityVariable string) bool {
+	hasEntity := false
+	for variable, values := range vMap {
+		if len(values) != 1 {
+			return false
+		}
+		switch variable {
+		case entityVariable:
+			hasEntity = true
+		case consts.VAR_CONTENT_TYPE:
+			if _, ok := consts.CT_VARIABLE_TO_FILTER_VALUES[values[0]]; !ok {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return hasEntity
+}
+
 func landingPageConventionsMatch(vMap map[string][]string, cm cache.CacheManager) bool {
 	location := ""
 	year := ""
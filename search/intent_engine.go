@@ -48,32 +48,59 @@ func (e *ESEngine) AddIntentSecondRound(h *elastic.SearchHit, intent Intent, que
 	return nil, nil, nil
 }
 
-func (e *ESEngine) AddIntents(query *Query, preference string, sortBy string, searchTags bool, searchSources bool, filterIntents []Intent) ([]Intent, error) {
+// First round of intents search: requests for tags and sources by language, with the potential intent of each request.
+type intentsSearch struct {
+	requests               []*elastic.SearchRequest
+	potentialIntents       []Intent
+	queryWithoutFilters    Query
+	checkContentUnitsTypes []string
+	size                   int
+}
 
-	intents := make([]Intent, 0)
+func (e *ESEngine) AddIntents(ctx context.Context, query *Query, preference string, sortBy string, searchTags bool, searchSources bool, filterIntents []Intent) ([]Intent, error) {
+	is, err := e.intentsSearch(query, preference, sortBy, searchTags, searchSources, filterIntents)
+	if err != nil {
+		return nil, err
+	}
+	if is == nil {
+		return make([]Intent, 0), nil
+	}
+
+	defer e.timeTrack(time.Now(), consts.LAT_DOSEARCH_ADDINTENTS)
 
+	mssFirstRound := e.esc.MultiSearch()
+	mssFirstRound.Add(is.requests...)
+	beforeFirstRoundDo := time.Now()
+	mr, err := mssFirstRound.Do(ctx)
+	e.timeTrack(beforeFirstRoundDo, consts.LAT_DOSEARCH_ADDINTENTS_FIRSTROUNDDO)
+	if err != nil {
+		return make([]Intent, 0), errors.Wrap(err, "ESEngine.AddIntents - Error multisearch Do.")
+	}
+	return e.intentsFromFirstRound(ctx, query, preference, is, mr.Responses)
+}
+
+// Prepares the first round of intents search, returns nil when intents should not be searched for the query.
+func (e *ESEngine) intentsSearch(query *Query, preference string, sortBy string, searchTags bool, searchSources bool, filterIntents []Intent) (*intentsSearch, error) {
 	if (len(query.Term) == 0 && len(query.ExactTerms) == 0) ||
 		sortBy == consts.SORT_BY_NEWER_TO_OLDER ||
 		sortBy == consts.SORT_BY_OLDER_TO_NEWER {
-		return intents, nil
+		return nil, nil
 	}
 
 	for filterKey := range query.Filters {
 		if _, ok := consts.ES_INTENT_SUPPORTED_FILTERS[filterKey]; !ok {
-			return intents, nil
+			return nil, nil
 		}
 	}
 
 	if contentTypes, ok := query.Filters[consts.FILTER_CONTENT_TYPE]; ok {
 		for _, contentType := range contentTypes {
 			if _, ok := consts.ES_INTENT_SUPPORTED_CONTENT_TYPES[contentType]; !ok {
-				return intents, nil
+				return nil, nil
 			}
 		}
 	}
 
-	defer e.timeTrack(time.Now(), consts.LAT_DOSEARCH_ADDINTENTS)
-
 	checkContentUnitsTypes := []string{}
 	if values, ok := query.Filters[consts.FILTER_CONTENT_TYPE]; ok {
 		for _, value := range values {
@@ -102,7 +129,7 @@ func (e *ESEngine) AddIntents(query *Query, preference string, sortBy string, se
 		}
 	}
 
-	mssFirstRound := e.esc.MultiSearch()
+	requests := []*elastic.SearchRequest{}
 	potentialIntents := make([]Intent, 0)
 	size := consts.INTENTS_SEARCH_DEFAULT_COUNT
 	for _, language := range query.LanguageOrder {
@@ -163,7 +190,7 @@ func (e *ESEngine) AddIntents(query *Query, preference string, sortBy string, se
 				log.Warnf("ESEngine.AddIntents - Failed on creating tags request %+v", err)
 				return nil, err
 			}
-			mssFirstRound.Add(req)
+			requests = append(requests, req)
 			potentialIntents = append(potentialIntents, Intent{consts.INTENT_TYPE_TAG, language, grammarIntent})
 		}
 		if searchSources && searchSourcesForLang {
@@ -183,22 +210,38 @@ func (e *ESEngine) AddIntents(query *Query, preference string, sortBy string, se
 				log.Warnf("ESEngine.AddIntents - Failed on creating sources request %+v", err)
 				return nil, err
 			}
-			mssFirstRound.Add(req)
+			requests = append(requests, req)
 			potentialIntents = append(potentialIntents, Intent{consts.INTENT_TYPE_SOURCE, language, grammarIntent})
 		}
 	}
-	beforeFirstRoundDo := time.Now()
-	mr, err := mssFirstRound.Do(context.TODO())
-	e.timeTrack(beforeFirstRoundDo, consts.LAT_DOSEARCH_ADDINTENTS_FIRSTROUNDDO)
-	if err != nil {
-		return intents, errors.Wrap(err, "ESEngine.AddIntents - Error multisearch Do.")
+	if len(requests) == 0 {
+		return nil, nil
+	}
+	return &intentsSearch{
+		requests:               requests,
+		potentialIntents:       potentialIntents,
+		queryWithoutFilters:    queryWithoutFilters,
+		checkContentUnitsTypes: checkContentUnitsTypes,
+		size:                   size,
+	}, nil
+}
+
+// Runs the second round of intents search according to the first round responses and returns the found intents.
+func (e *ESEngine) intentsFromFirstRound(ctx context.Context, query *Query, preference string, is *intentsSearch, responses []*elastic.SearchResult) ([]Intent, error) {
+	intents := make([]Intent, 0)
+	potentialIntents := is.potentialIntents
+	queryWithoutFilters := is.queryWithoutFilters
+	checkContentUnitsTypes := is.checkContentUnitsTypes
+	size := is.size
+	if len(responses) != len(potentialIntents) {
+		return intents, errors.New(fmt.Sprintf("ESEngine.AddIntents - Unexpected number of first run results %d, expected %d", len(responses), len(potentialIntents)))
 	}
 
 	// Build second request to evaluate how close the search is toward the full name.
 	mssSecondRound := e.esc.MultiSearch()
 	finalIntents := make([]Intent, 0)
 	for i := 0; i < len(potentialIntents); i++ {
-		res := mr.Responses[i]
+		res := responses[i]
 		if res.Error != nil {
 			log.Warnf("ESEngine.AddIntents - First Run %+v", res.Error)
 			return intents, errors.New("ESEngine.AddIntents - First Run Failed multi get (S).")
@@ -234,9 +277,15 @@ func (e *ESEngine) AddIntents(query *Query, preference string, sortBy string, se
 		}
 	}
 
+	if len(finalIntents) == 0 {
+		return intents, nil
+	}
 	beforeSecondRoundDo := time.Now()
-	mr, err = mssSecondRound.Do(context.TODO())
+	mr, err := mssSecondRound.Do(ctx)
 	e.timeTrack(beforeSecondRoundDo, consts.LAT_DOSEARCH_ADDINTENTS_SECONDROUNDDO)
+	if err != nil {
+		return intents, errors.Wrap(err, "ESEngine.AddIntents - Error second round multisearch Do.")
+	}
 	for i := 0; i < len(finalIntents); i++ {
 		res := mr.Responses[i]
 		if res.Error != nil {
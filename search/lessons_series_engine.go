@@ -14,10 +14,26 @@ import (
 	"gopkg.in/olivere/elastic.v6"
 )
 
-func (e *ESEngine) LessonsSeries(query Query, preference string) (map[string]*elastic.SearchResult, error) {
-	byLang := make(map[string]*elastic.SearchResult)
+func (e *ESEngine) LessonsSeries(ctx context.Context, query Query, preference string) (map[string]*elastic.SearchResult, error) {
+	requests, err := e.lessonsSeriesRequests(query, preference)
+	if err != nil {
+		return nil, err
+	}
 	mss := e.esc.MultiSearch()
-	_, queryTermHasDigit := utils.HasNumeric(query.Term)
+	mss.Add(requests...)
+	before := time.Now()
+	mr, err := mss.Do(ctx)
+
+	e.timeTrack(before, consts.LAT_DOSEARCH_MULTISEARCHTWEETSDO)
+	if err != nil {
+		return nil, err
+	}
+	return e.lessonsSeriesFromResponses(query, mr.Responses)
+}
+
+// Lesson series search requests, one for each language of the query.
+func (e *ESEngine) lessonsSeriesRequests(query Query, preference string) ([]*elastic.SearchRequest, error) {
+	requests := []*elastic.SearchRequest{}
 	filter := map[string][]string{consts.FILTER_CONTENT_TYPE: {consts.CT_LESSONS_SERIES}}
 	for _, language := range query.LanguageOrder {
 		index := es.IndexNameForServing("prod", consts.ES_RESULTS_INDEX, language)
@@ -35,17 +51,15 @@ func (e *ESEngine) LessonsSeries(query Query, preference string) (map[string]*el
 		if err != nil {
 			return nil, err
 		}
-		mss.Add(req)
-	}
-	before := time.Now()
-	mr, err := mss.Do(context.TODO())
-
-	e.timeTrack(before, consts.LAT_DOSEARCH_MULTISEARCHTWEETSDO)
-	if err != nil {
-		return nil, err
+		requests = append(requests, req)
 	}
+	return requests, nil
+}
 
-	for i, res := range mr.Responses {
+func (e *ESEngine) lessonsSeriesFromResponses(query Query, responses []*elastic.SearchResult) (map[string]*elastic.SearchResult, error) {
+	byLang := make(map[string]*elastic.SearchResult)
+	_, queryTermHasDigit := utils.HasNumeric(query.Term)
+	for i, res := range responses {
 		if res.Error != nil {
 			err := errors.New(fmt.Sprintf("Failed series get: %+v", res.Error))
 			return nil, err
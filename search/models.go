@@ -23,6 +23,15 @@ type QueryResult struct {
 	TypoSuggest      null.String           `json:"typo_suggest"`
 	Language         string                `json:"language"`
 	ExecutionTimeLog []TimeLog             `json:"execution_time_log,omitempty"`
+	NextCursor       *string               `json:"next_cursor,omitempty"`
+	// Curated landing page for the query (best bets), when set the client may redirect to it.
+	Redirect string `json:"redirect,omitempty"`
+	// Per hit ranking explanation, returned in debug mode (deb=true).
+	Debug *SearchDebug `json:"debug,omitempty"`
+	// Stages skipped due to error or deadline (e.g., "highlights"), results are partial when not empty.
+	Degraded []string `json:"degraded,omitempty"`
+	// Definition cards of glossary terms for definition questions, best first.
+	Intents []Intent `json:"intents,omitempty"`
 }
 
 type Engine interface {
@@ -55,6 +64,11 @@ type SearchRequestOptions struct {
 	titlesOnly bool
 	// If not nil, set how long a search is allowed to take, e.g. "1s" or "500ms". Note: Not always respected by ES.
 	Timeout *string
+	// Setting the following field to 'true' sorts the results with a tie breaker to allow search_after pagination.
+	cursorSort bool
+	// Sort values of the last hit from previous page, by language. Used with cursorSort.
+	searchAfterByLang map[string][]interface{}
+	searchAfter       []interface{}
 }
 
 type CreateFacetAggregationOptions struct {
@@ -65,6 +79,8 @@ type CreateFacetAggregationOptions struct {
 	sourceUIDs             []string
 	dateRanges             []string
 	personUIDs             []string
+	mediaTypeValues        []string
+	durationRanges         []string
 }
 
 type FacetSearchResults struct {
@@ -75,4 +91,6 @@ type FacetSearchResults struct {
 	Sources           map[string]int64 `json:"sources,omitempty"`
 	Dates             map[string]int64 `json:"dates,omitempty"`
 	Persons           map[string]int64 `json:"persons,omitempty"`
+	MediaTypes        map[string]int64 `json:"media_types,omitempty"`
+	Durations         map[string]int64 `json:"durations,omitempty"`
 }
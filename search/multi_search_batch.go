@@ -0,0 +1,114 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+)
+
+// Collects independent search requests of several DoSearch stages and sends them
+// to Elastic in a single _msearch call, to reduce round-trips.
+// Responses are mapped back to the stage that added the requests, an error in one
+// of the responses fails only the stage it belongs to.
+type multiSearchBatch struct {
+	e        *ESEngine
+	searches []*batchedSearch
+	done     chan struct{}
+}
+
+// Requests of a single stage in a batch.
+type batchedSearch struct {
+	stage     string
+	requests  []*elastic.SearchRequest
+	responses []*elastic.SearchResult
+	err       error
+	batch     *multiSearchBatch
+}
+
+func (e *ESEngine) newMultiSearchBatch() *multiSearchBatch {
+	return &multiSearchBatch{e: e, done: make(chan struct{})}
+}
+
+// Adds requests of the stage, should not be called after do.
+func (b *multiSearchBatch) add(stage string, requests ...*elastic.SearchRequest) *batchedSearch {
+	s := &batchedSearch{stage: stage, requests: requests, batch: b}
+	b.searches = append(b.searches, s)
+	return s
+}
+
+// Sends all requests and maps the responses to their stages. Should be called exactly once.
+func (b *multiSearchBatch) do(ctx context.Context) {
+	defer close(b.done)
+
+	if b.e.splitMultiSearch {
+		// Each stage in its own _msearch call, as with no batching.
+		for _, s := range b.searches {
+			b.doSearches(ctx, []*batchedSearch{s})
+		}
+		return
+	}
+	b.doSearches(ctx, b.searches)
+}
+
+func (b *multiSearchBatch) doSearches(ctx context.Context, searches []*batchedSearch) {
+	mss := b.e.esc.MultiSearch()
+	count := 0
+	for _, s := range searches {
+		mss.Add(s.requests...)
+		count += len(s.requests)
+	}
+	if count == 0 {
+		for _, s := range searches {
+			s.responses = []*elastic.SearchResult{}
+		}
+		return
+	}
+
+	beforeBatchDo := time.Now()
+	mr, err := mss.Do(ctx)
+	b.e.timeTrack(beforeBatchDo, consts.LAT_DOSEARCH_MULTISEARCHBATCHDO)
+	if err == nil && len(mr.Responses) != count {
+		err = errors.Errorf("Unexpected number of results %d, expected %d", len(mr.Responses), count)
+	}
+	if err != nil {
+		for _, s := range searches {
+			s.err = errors.Wrapf(err, "multiSearchBatch - Error multisearch Do for %s.", s.stage)
+		}
+		return
+	}
+
+	offset := 0
+	for _, s := range searches {
+		s.responses = mr.Responses[offset : offset+len(s.requests)]
+		offset += len(s.requests)
+		for i, res := range s.responses {
+			if res.Error != nil {
+				s.err = errors.New(fmt.Sprintf("multiSearchBatch - Failed multi get for %s request %d: %+v", s.stage, i, res.Error))
+				break
+			}
+		}
+	}
+}
+
+// Waits for the batch and returns the responses ordered as the added requests.
+// Returns an error if ctx is done before the batch completes.
+func (s *batchedSearch) wait(ctx context.Context) ([]*elastic.SearchResult, error) {
+	select {
+	case <-s.batch.done:
+	case <-ctx.Done():
+		select {
+		case <-s.batch.done:
+		default:
+			return nil, errors.Wrapf(ctx.Err(), "multiSearchBatch - Waiting for %s.", s.stage)
+		}
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.responses, nil
+}
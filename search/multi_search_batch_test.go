@@ -0,0 +1,192 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+)
+
+// Fake Elastic server answering every _msearch request with empty results,
+// or with an error for the requests whose index is listed in failIndices.
+type fakeMultiSearchServer struct {
+	server      *httptest.Server
+	failIndices map[string]bool
+	mutex       sync.Mutex
+	requests    int
+	searches    int
+}
+
+func newFakeMultiSearchServer(failIndices ...string) *fakeMultiSearchServer {
+	f := &fakeMultiSearchServer{failIndices: make(map[string]bool)}
+	for _, index := range failIndices {
+		f.failIndices[index] = true
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+func (f *fakeMultiSearchServer) handle(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	f.requests++
+	f.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !strings.HasSuffix(r.URL.Path, "/_msearch") {
+		// Single search request, i.e. typo suggest with no batching.
+		w.Write([]byte(`{"hits":{"total":0,"hits":[]}}`))
+		return
+	}
+	responses := []string{}
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for line := 0; scanner.Scan(); line++ {
+		if line%2 == 1 || strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		header := struct {
+			Index interface{} `json:"index"`
+		}{}
+		json.Unmarshal(scanner.Bytes(), &header)
+		index, _ := header.Index.(string)
+		if indices, ok := header.Index.([]interface{}); ok && len(indices) > 0 {
+			index, _ = indices[0].(string)
+		}
+		if f.failIndices[index] {
+			responses = append(responses, `{"error":{"type":"index_not_found_exception","reason":"no such index"},"status":404}`)
+		} else {
+			responses = append(responses, `{"hits":{"total":0,"hits":[]}}`)
+		}
+	}
+	f.mutex.Lock()
+	f.searches += len(responses)
+	f.mutex.Unlock()
+	w.Write([]byte(`{"responses":[` + strings.Join(responses, ",") + `]}`))
+}
+
+func (f *fakeMultiSearchServer) reset() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.requests = 0
+	f.searches = 0
+}
+
+func (f *fakeMultiSearchServer) counts() (int, int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.requests, f.searches
+}
+
+func (f *fakeMultiSearchServer) engine(t require.TestingT) *ESEngine {
+	esc, err := elastic.NewClient(elastic.SetURL(f.server.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	require.Nil(t, err)
+	return NewESEngine(esc, nil, nil, nil, VariablesV2{}, consts.ES_SEARCH_RESULT_TYPES)
+}
+
+func fakeServerQuery() Query {
+	return Query{Term: "אור פנימי", LanguageOrder: []string{consts.LANG_HEBREW}}
+}
+
+func doFakeSearch(e *ESEngine) (*QueryResult, error) {
+	return e.DoSearch(context.Background(), fakeServerQuery(), consts.SORT_BY_RELEVANCE, 0, 10, "", true, true, true, false, SearchDeadlines{}, nil)
+}
+
+type MultiSearchBatchSuite struct {
+	suite.Suite
+}
+
+func TestMultiSearchBatch(t *testing.T) {
+	suite.Run(t, new(MultiSearchBatchSuite))
+}
+
+func (suite *MultiSearchBatchSuite) TestErrorMapping() {
+	r := require.New(suite.T())
+	f := newFakeMultiSearchServer("failing")
+	defer f.server.Close()
+	e := f.engine(suite.T())
+
+	b := e.newMultiSearchBatch()
+	ok := b.add(SEARCH_STAGE_TWEETS, elastic.NewSearchRequest().Index("ok"), elastic.NewSearchRequest().Index("ok"))
+	failing := b.add(SEARCH_STAGE_INTENTS, elastic.NewSearchRequest().Index("ok"), elastic.NewSearchRequest().Index("failing"))
+	empty := b.add(SEARCH_STAGE_LESSON_SERIES)
+	b.do(context.Background())
+
+	requests, searches := f.counts()
+	r.Equal(1, requests)
+	r.Equal(4, searches)
+
+	responses, err := ok.wait(context.Background())
+	r.Nil(err)
+	r.Len(responses, 2)
+	_, err = failing.wait(context.Background())
+	r.NotNil(err)
+	r.Contains(err.Error(), SEARCH_STAGE_INTENTS)
+	responses, err = empty.wait(context.Background())
+	r.Nil(err)
+	r.Empty(responses)
+}
+
+func (suite *MultiSearchBatchSuite) TestWaitDeadline() {
+	r := require.New(suite.T())
+	b := (&ESEngine{}).newMultiSearchBatch()
+	s := b.add(SEARCH_STAGE_TWEETS, elastic.NewSearchRequest())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.wait(ctx)
+	r.Equal(context.Canceled, errors.Cause(err))
+}
+
+func (suite *MultiSearchBatchSuite) TestDoSearchRequestsCount() {
+	r := require.New(suite.T())
+	f := newFakeMultiSearchServer()
+	defer f.server.Close()
+	e := f.engine(suite.T())
+
+	e.splitMultiSearch = true
+	_, err := doFakeSearch(e)
+	r.Nil(err)
+	splitRequests, splitSearches := f.counts()
+
+	f.reset()
+	e.splitMultiSearch = false
+	_, err = doFakeSearch(e)
+	r.Nil(err)
+	batchedRequests, batchedSearches := f.counts()
+
+	r.Less(batchedRequests, splitRequests)
+	r.Equal(splitSearches, batchedSearches)
+}
+
+func benchmarkDoSearch(b *testing.B, split bool) {
+	f := newFakeMultiSearchServer()
+	defer f.server.Close()
+	e := f.engine(b)
+	e.splitMultiSearch = split
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := doFakeSearch(e); err != nil {
+			b.Fatal(err)
+		}
+	}
+	requests, _ := f.counts()
+	b.ReportMetric(float64(requests)/float64(b.N), "requests/op")
+}
+
+func BenchmarkDoSearchSplitMultiSearch(b *testing.B) {
+	benchmarkDoSearch(b, true)
+}
+
+func BenchmarkDoSearchBatchedMultiSearch(b *testing.B) {
+	benchmarkDoSearch(b, false)
+}
@@ -180,9 +180,9 @@ const (
 	BLOG_OR_TWEET_MARK       = "blog_or_tweet"
 )
 
-var FLAT_REPORT_HEADERS = []string{
+var FLAT_REPORT_HEADERS = append([]string{
 	"Language", "Query", "Weight", "Bucket", "Comment",
-	"Expectation", "Parsed", "SearchQuality", "Rank"}
+	"Expectation", "Parsed", "SearchQuality", "Rank", "Grade"}, IR_METRICS_NAMES...)
 
 type Filter struct {
 	Name  string `json:"name"`
@@ -210,6 +210,8 @@ type EvalQuery struct {
 	Bucket       string        `json:"bucket,omitempty"`
 	Expectations []Expectation `json:"expectations"`
 	Comment      string        `json:"comment,omitempty"`
+	// Relevance grades of expectations, see RelevanceGrade.
+	Grades []int `json:"grades,omitempty"`
 }
 
 type EvalResults struct {
@@ -317,10 +319,12 @@ func ReadEvalSet(reader io.Reader, db *sql.DB) ([]EvalQuery, error) {
 			continue
 		}
 		var expectations []Expectation
+		var grades []int
 		hasGoodExpectations := false
 		for i := EVAL_SET_EXPECTATION_FIRST_COLUMN; i <= EVAL_SET_EXPECTATION_LAST_COLUMN; i++ {
-			e := ParseExpectation(strings.TrimSpace(line[i]), db)
+			e, grade := ParseGradedExpectation(strings.TrimSpace(line[i]), db)
 			expectations = append(expectations, e)
+			grades = append(grades, grade)
 			if EXPECTATIONS_FOR_EVALUATION[e.Type] {
 				expectationsCount++
 				hasGoodExpectations = true
@@ -336,6 +340,7 @@ func ReadEvalSet(reader io.Reader, db *sql.DB) ([]EvalQuery, error) {
 			Bucket:       strings.TrimSpace(line[3]),
 			Expectations: expectations,
 			Comment:      line[EVAL_SET_EXPECTATION_LAST_COLUMN+1],
+			Grades:       grades,
 		})
 	}
 	log.Infof("Read %d queries, with total %d expectations. %d Queries had expectations.",
@@ -567,6 +572,20 @@ func ParseExpectation(e string, db *sql.DB) Expectation {
 	return Expectation{t, uidOrSection, nil, originalE}
 }
 
+// Returns true if the redirect url of the query result points to the expected page.
+func RedirectMatchesExpectation(redirect string, e Expectation) bool {
+	re := ParseExpectation(redirect, nil)
+	if re.Type != e.Type || re.Uid != e.Uid || len(re.Filters) != len(e.Filters) {
+		return false
+	}
+	for i := range re.Filters {
+		if re.Filters[i] != e.Filters[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func FilterValueToUid(value string) string {
 	sl := strings.Split(value, "_")
 	if len(sl) == 0 {
@@ -577,7 +596,7 @@ func FilterValueToUid(value string) string {
 
 func HitMatchesExpectation(hit *elastic.SearchHit, hitSource HitSource, e Expectation) bool {
 	hitType := hit.Type
-	if hitType == "result" {
+	if hitType == consts.ES_RESULTS_DOC_TYPE {
 		hitType = hitSource.ResultType
 	}
 	if e.Type == ET_BLOG_OR_TWEET {
@@ -607,7 +626,50 @@ func HitMatchesExpectation(hit *elastic.SearchHit, hitSource HitSource, e Expect
 	}
 }
 
+// Searches evaluated queries, either on a running server or in process.
+type EvalSearcher interface {
+	Search(q EvalQuery, limit int) (QueryResult, error)
+	String() string
+}
+
+// Searches on running archive backend at |serverUrl|.
+type ServerEvalSearcher string
+
+func (serverUrl ServerEvalSearcher) String() string {
+	return string(serverUrl)
+}
+
+func (serverUrl ServerEvalSearcher) Search(q EvalQuery, limit int) (QueryResult, error) {
+	queryResult := QueryResult{}
+	urlTemplate := "%s/search?q=%s&language=%s&page_no=1&page_size=%d&sort_by=relevance&deb=true"
+	url := fmt.Sprintf(urlTemplate, serverUrl, url.QueryEscape(q.Query), q.Language, limit)
+	resp, err := http.Get(url)
+	if err != nil {
+		log.Warnf("Error %+v", err)
+		return queryResult, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return queryResult, errors.Wrapf(err, "Status not ok (%d), failed reading body. Url: %s.", resp.StatusCode, url)
+		}
+		errMsg := fmt.Sprintf("Status not ok (%d), body: %s, url: %s.", resp.StatusCode, string(bodyBytes), url)
+		log.Warn(errMsg)
+		return queryResult, errors.New(errMsg)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&queryResult); err != nil {
+		log.Warnf("Error decoding %+v", err)
+		return queryResult, err
+	}
+	return queryResult, nil
+}
+
 func EvaluateQuery(q EvalQuery, serverUrl string, skipExpectations bool) EvalResult {
+	return EvaluateQueryWithSearcher(q, ServerEvalSearcher(serverUrl), skipExpectations)
+}
+
+func EvaluateQueryWithSearcher(q EvalQuery, searcher EvalSearcher, skipExpectations bool) EvalResult {
 	r := EvalResult{
 		SearchQuality: make([]int, len(q.Expectations)),
 		Rank:          make([]int, len(q.Expectations)),
@@ -636,42 +698,8 @@ func EvaluateQuery(q EvalQuery, serverUrl string, skipExpectations bool) EvalRes
 		// and thus their order changes. We want to detect this and count this as non-diff.
 		limit = 20
 	}
-	urlTemplate := "%s/search?q=%s&language=%s&page_no=1&page_size=%d&sort_by=relevance&deb=true"
-	url := fmt.Sprintf(urlTemplate, serverUrl, url.QueryEscape(q.Query), q.Language, limit)
-	resp, err := http.Get(url)
+	queryResult, err := searcher.Search(q, limit)
 	if err != nil {
-		log.Warnf("Error %+v", err)
-		if !skipExpectations {
-			for i := range q.Expectations {
-				if EXPECTATIONS_FOR_EVALUATION[q.Expectations[i].Type] {
-					r.SearchQuality[i] = SQ_SERVER_ERROR
-				}
-			}
-		}
-		r.err = err
-		return r
-	}
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			r.err = errors.Wrapf(err, "Status not ok (%d), failed reading body. Url: %s.", resp.StatusCode, url)
-		}
-		errMsg := fmt.Sprintf("Status not ok (%d), body: %s, url: %s.", resp.StatusCode, string(bodyBytes), url)
-		log.Warn(errMsg)
-		if !skipExpectations {
-			for i := range q.Expectations {
-				if EXPECTATIONS_FOR_EVALUATION[q.Expectations[i].Type] {
-					r.SearchQuality[i] = SQ_SERVER_ERROR
-				}
-			}
-		}
-		r.err = errors.New(errMsg)
-		return r
-	}
-	queryResult := QueryResult{}
-	defer resp.Body.Close()
-	if err := json.NewDecoder(resp.Body).Decode(&queryResult); err != nil {
-		log.Warnf("Error decoding %+v", err)
 		if !skipExpectations {
 			for i := range q.Expectations {
 				if EXPECTATIONS_FOR_EVALUATION[q.Expectations[i].Type] {
@@ -691,7 +719,14 @@ func EvaluateQuery(q EvalQuery, serverUrl string, skipExpectations bool) EvalRes
 					sq = SQ_BAD_STRUCTURE
 				}
 				rank := -1
-				for j, hit := range queryResult.SearchResult.Hits.Hits {
+				hits := queryResult.SearchResult.Hits.Hits
+				if queryResult.Redirect != "" && RedirectMatchesExpectation(queryResult.Redirect, q.Expectations[i]) {
+					// The client redirects to the curated (best bets) page, counts as first result.
+					sq = SQ_GOOD
+					rank = 1
+					hits = nil
+				}
+				for j, hit := range hits {
 					hitSource := HitSource{}
 					if hit.Type != consts.SEARCH_RESULT_TWEETS_MANY {
 						if err := json.Unmarshal(*hit.Source, &hitSource); err != nil {
@@ -726,8 +761,8 @@ func EvaluateQuery(q EvalQuery, serverUrl string, skipExpectations bool) EvalRes
 	return r
 }
 
-func EvalScrape(queries []EvalQuery, serverUrl string, skipExpectations bool) ([]EvalResult, error) {
-	log.Infof("Evaluating %d queries on %s.", len(queries), serverUrl)
+func EvalScrape(queries []EvalQuery, searcher EvalSearcher, skipExpectations bool) ([]EvalResult, error) {
+	log.Infof("Evaluating %d queries on %s.", len(queries), searcher)
 	evalResults := []EvalResult(nil)
 
 	in := make(chan EvalQuery)
@@ -739,9 +774,9 @@ func EvalScrape(queries []EvalQuery, serverUrl string, skipExpectations bool) ([
 	}()
 	out := make(chan EvalResult)
 
-	var err error
+	errChan := make(chan error, 1)
 	go func() {
-		err = EvalScrapeStreaming(in, out, serverUrl, skipExpectations)
+		errChan <- EvalScrapeStreaming(in, out, searcher, skipExpectations)
 	}()
 
 	for {
@@ -753,6 +788,8 @@ func EvalScrape(queries []EvalQuery, serverUrl string, skipExpectations bool) ([
 		}
 	}
 
+	err := <-errChan
+
 	sort.SliceStable(evalResults, func(i, j int) bool {
 		return evalResults[i].Order < evalResults[j].Order
 	})
@@ -763,7 +800,7 @@ func EvalScrape(queries []EvalQuery, serverUrl string, skipExpectations bool) ([
 
 // In case of error, this function will close the |out| channel.
 // In case of |in| closed, |out| will be closed after everything scraped.
-func EvalScrapeStreaming(in chan EvalQuery, out chan EvalResult, serverUrl string, skipExpectations bool) error {
+func EvalScrapeStreaming(in chan EvalQuery, out chan EvalResult, searcher EvalSearcher, skipExpectations bool) error {
 	var doneWG sync.WaitGroup
 
 	// Max inflight queries.
@@ -780,12 +817,16 @@ func EvalScrapeStreaming(in chan EvalQuery, out chan EvalResult, serverUrl strin
 
 	log.Infof("Scrape streaming parralellism: %d. Rate: %d per second.", len(c), RATE)
 
+	// |sent| is updated by the scraping goroutines.
+	var sentMutex sync.Mutex
 	sent := 0
 	read := 0
 	for {
 		q, ok := <-in
 		if !ok {
+			sentMutex.Lock()
 			log.Debugf("In is closed now (sent %d, read %d). Breaking.", sent, read)
+			sentMutex.Unlock()
 			break
 		} else {
 			read++
@@ -798,11 +839,13 @@ func EvalScrapeStreaming(in chan EvalQuery, out chan EvalResult, serverUrl strin
 		go func(q EvalQuery, order int) {
 			defer doneWG.Done()
 			defer func() { c <- true }()
-			evalResult := EvaluateQuery(q, serverUrl, skipExpectations)
+			evalResult := EvaluateQueryWithSearcher(q, searcher, skipExpectations)
 			evalResult.Order = order
 			out <- evalResult
+			sentMutex.Lock()
 			sent++
-			log.Debugf("Done sent %d read %d (%s).", sent, read, serverUrl)
+			log.Debugf("Done sent %d read %d (%s).", sent, order, searcher)
+			sentMutex.Unlock()
 		}(q, read)
 	}
 
@@ -813,11 +856,15 @@ func EvalScrapeStreaming(in chan EvalQuery, out chan EvalResult, serverUrl strin
 }
 
 func Eval(queries []EvalQuery, serverUrl string) (EvalResults, map[int][]Loss, error) {
+	return EvalWithSearcher(queries, ServerEvalSearcher(serverUrl))
+}
+
+func EvalWithSearcher(queries []EvalQuery, searcher EvalSearcher) (EvalResults, map[int][]Loss, error) {
 	ret := EvalResults{}
 	ret.UniqueMap = make(map[int]float64)
 	ret.WeightedMap = make(map[int]float64)
 
-	evalResults, err := EvalScrape(queries, serverUrl, false /*skipExpectations*/)
+	evalResults, err := EvalScrape(queries, searcher, false /*skipExpectations*/)
 	if err != nil {
 		return ret, nil, err
 	}
@@ -883,19 +930,20 @@ func ExpectationToString(e Expectation) string {
 }
 
 func ResultsByExpectation(queries []EvalQuery, results EvalResults) [][]string {
-	records := [][]string{FLAT_REPORT_HEADERS}
+	records := [][]string(nil)
 	for i, q := range queries {
 		goodExpectationsLen := GoodExpectations(q.Expectations)
 		for j, sq := range results.Results[i].SearchQuality {
 			if EXPECTATIONS_FOR_EVALUATION[q.Expectations[j].Type] {
 				record := []string{q.Language, q.Query, fmt.Sprintf("%.2f", float64(q.Weight)/float64(goodExpectationsLen)),
 					q.Bucket, q.Comment, q.Expectations[j].Source, ExpectationToString(q.Expectations[j]),
-					SEARCH_QUALITY_NAME[sq], fmt.Sprintf("%d", results.Results[i].Rank[j])}
+					SEARCH_QUALITY_NAME[sq], fmt.Sprintf("%d", results.Results[i].Rank[j]),
+					fmt.Sprintf("%d", q.RelevanceGrade(j))}
 				records = append(records, record)
 			}
 		}
 	}
-	return records
+	return append([][]string{FLAT_REPORT_HEADERS}, addFlatRecordsIRMetrics(records)...)
 }
 
 func WriteResultsByExpectation(path string, queries []EvalQuery, results EvalResults) ([][]string, error) {
@@ -952,6 +1000,48 @@ func diffToHtml(diff float64, round bool, percentage bool) string {
 	return fmt.Sprintf("<span style='color: red'> (%s)</span>", diffStr)
 }
 
+// Table of mean metrics by language and bucket with diffs to golden metrics.
+func irMetricsToHtml(metrics map[string]map[string]IRMetrics, goldenMetrics map[string]map[string]IRMetrics) []string {
+	htmlParts := []string{"<table>", "<tr><th>Language</th><th>Bucket</th><th>Queries</th>"}
+	for _, name := range IR_METRICS_NAMES {
+		htmlParts = append(htmlParts, fmt.Sprintf("<th>%s</th>", name))
+	}
+	htmlParts = append(htmlParts, "</tr>")
+	for _, language := range utils.StringMapOrderedKeys(metrics) {
+		byBucket := metrics[language]
+		// Language total first.
+		buckets := []string{""}
+		for bucket := range byBucket {
+			if bucket != "" {
+				buckets = append(buckets, bucket)
+			}
+		}
+		sort.Strings(buckets[1:])
+		for i, bucket := range buckets {
+			m := byBucket[bucket]
+			golden := goldenMetrics[language][bucket]
+			if i == 0 {
+				htmlParts = append(htmlParts, fmt.Sprintf(
+					"<tr><td style='text-align: center; font-size: x-large; font-weight: bold;' rowspan='%d'>%s</td><td><b>All</b></td>",
+					len(buckets), language))
+			} else {
+				htmlParts = append(htmlParts, fmt.Sprintf("<tr><td>%s</td>", bucket))
+			}
+			htmlParts = append(htmlParts, fmt.Sprintf(
+				`<td><div style="display: flex; justify-content: space-evenly"><span>%d</span>%s</div></td>`,
+				m.Queries, diffToHtml(float64(m.Queries-golden.Queries), true /*round*/, false /*%*/)))
+			goldenValues := golden.Values()
+			for j, value := range m.Values() {
+				htmlParts = append(htmlParts, fmt.Sprintf(
+					`<td><div style="display: flex; justify-content: space-evenly"><span>%.2f</span>%s</div></td>`,
+					100*value, diffToHtml(100*(value-goldenValues[j]), false /*round*/, false /*%*/)))
+			}
+			htmlParts = append(htmlParts, "</tr>")
+		}
+	}
+	return append(htmlParts, "</table>")
+}
+
 func rankValue(rank string) int {
 	val, err := strconv.Atoi(rank)
 	if err != nil {
@@ -964,6 +1054,9 @@ func rankValue(rank string) int {
 }
 
 func WriteVsGoldenHTML(vsGoldenHtml string, records [][]string, goldenRecords [][]string, bottomPart string) error {
+	// Golden reports may be older, without grade and metrics columns.
+	records = normalizeFlatRecords(records)
+	goldenRecords = normalizeFlatRecords(goldenRecords)
 	// Map from language => quality => (Unique, Weighted, Unique Golden, Weighted Golden)
 	data := make(map[string]map[string][]float64)
 	if err := updateVsGoldenDataFromRecords(data, records, false /*isGolden*/); err != nil {
@@ -1058,8 +1151,9 @@ func WriteVsGoldenHTML(vsGoldenHtml string, records [][]string, goldenRecords []
 		}
 	}
 	htmlParts = append(htmlParts, "</table>")
+	htmlParts = append(htmlParts, irMetricsToHtml(FlatRecordsIRMetrics(records), FlatRecordsIRMetrics(goldenRecords))...)
 
-	// Records: "Language", "Query", "Weight", "Bucket", "Comment", "Expectation", "Parsed", "SearchQuality", "Rank"
+	// Records: "Language", "Query", "Weight", "Bucket", "Comment", "Expectation", "Parsed", "SearchQuality", "Rank", "Grade", metrics...
 	// Stores diffs between records and goldenRecords. Map from language to query to expectation to row.
 	recordsDiff := make(map[string]map[string]map[string][][]string)
 	for _, goldenRecord := range goldenRecords {
@@ -1152,7 +1246,7 @@ func WriteVsGoldenHTML(vsGoldenHtml string, records [][]string, goldenRecords []
 		})
 
 		htmlParts = append(htmlParts, "<table>")
-		htmlParts = append(htmlParts, "<tr><th>Language</th><th>Query</th><th>Weight</th><th>Expectation</th><th>Quality</th><th>Rank</th></tr>")
+		htmlParts = append(htmlParts, "<tr><th>Language</th><th>Query</th><th>Weight</th><th>Expectation</th><th>Quality</th><th>Rank</th><th>Grade</th></tr>")
 		firstForLanguage := true
 		for _, records := range recordsToSort {
 			goldenRecord := records[0]
@@ -1172,7 +1266,8 @@ func WriteVsGoldenHTML(vsGoldenHtml string, records [][]string, goldenRecords []
 				if len(goldenRecord) != len(newRecord) {
 					return errors.New(fmt.Sprintf("Golden size %d is not new record size %d.", len(goldenRecord), len(newRecord)))
 				}
-				for i, newCell := range newRecord {
+				// Per query metrics change with any expectation of the query, compare expectation columns only.
+				for i, newCell := range newRecord[:FLAT_REPORT_METRICS_COLUMN] {
 					if newCell != goldenRecord[i] {
 						same = false
 						break
@@ -1183,7 +1278,7 @@ func WriteVsGoldenHTML(vsGoldenHtml string, records [][]string, goldenRecords []
 			if !same || onlyNew || onlyGolden {
 				//log.Infof("Not same: %+v and %+v", newRecord, goldenRecord)
 				htmlParts = append(htmlParts, "<tr>")
-				for i, cell := range newRecord {
+				for i, cell := range newRecord[:FLAT_REPORT_METRICS_COLUMN] {
 					style := "text-overflow: ellipsis; max-width: 200; overflow: hidden;"
 					if onlyGolden {
 						style = fmt.Sprintf("%s; %s", style, "color: purple;")
@@ -1614,7 +1709,8 @@ func EvalResultsDiffsCount(evalSet []EvalQuery, expResults []EvalResult, baseRes
 		} else if expOrder > baseOrder {
 			baseIdx++
 		} else {
-			if diff, err := EvalResultDiff(evalSet[baseOrder], expResults[expIdx], baseResults[baseIdx]); err != nil {
+			// Order is 1-based, see EvalScrapeStreaming.
+			if diff, err := EvalResultDiff(evalSet[baseOrder-1], expResults[expIdx], baseResults[baseIdx]); err != nil {
 				return 0, err
 			} else if len(diff.HitsDiffs) != 0 || diff.ErrorStr != "" {
 				diffCount++
@@ -1643,7 +1739,10 @@ func EvalQuerySetDiff(evalSet []EvalQuery, baseServerUrl, expServerUrl string, d
 		errStr := "Both baseServerUrl and expServerUrl must not be empty."
 		return ResultsDiffs{ErrorStr: errStr}, errors.New(errStr)
 	}
+	return EvalQuerySetDiffWithSearchers(evalSet, ServerEvalSearcher(baseServerUrl), ServerEvalSearcher(expServerUrl), diffsLimit)
+}
 
+func EvalQuerySetDiffWithSearchers(evalSet []EvalQuery, baseSearcher, expSearcher EvalSearcher, diffsLimit int32) (ResultsDiffs, error) {
 	baseIn := make(chan EvalQuery)
 	expIn := make(chan EvalQuery)
 	diffCount := int32(0)
@@ -1654,34 +1753,41 @@ func EvalQuerySetDiff(evalSet []EvalQuery, baseServerUrl, expServerUrl string, d
 		totalWeight += evalSet[i].Weight
 	}
 
+	// |evalSet| is reordered and |evalSetQueriesUsed| updated by the goroutine adding scrapes.
+	var evalSetMutex sync.Mutex
 	go func() {
-		for ; evalSetQueriesUsed <= len(evalSet); evalSetQueriesUsed++ {
+		for {
+			evalSetMutex.Lock()
 			diff := atomic.LoadInt32(&diffCount)
 			if (diffsLimit > 0 && diff >= diffsLimit) || evalSetQueriesUsed == len(evalSet) {
 				log.Infof("Closing input stream: (diffs) %d >= %d || (len) %d == %d ", diff, diffsLimit, evalSetQueriesUsed, len(evalSet))
+				evalSetMutex.Unlock()
 				close(baseIn)
 				close(expIn)
 				break
 			}
 			randomSelect(evalSet, evalSetQueriesUsed, totalWeight)
 			totalWeight -= evalSet[evalSetQueriesUsed].Weight
+			q := evalSet[evalSetQueriesUsed]
+			evalSetQueriesUsed++
+			evalSetMutex.Unlock()
 			// Following will sync exp and base stack to scrape in one query at a time.
-			expIn <- evalSet[evalSetQueriesUsed]
-			baseIn <- evalSet[evalSetQueriesUsed]
+			expIn <- q
+			baseIn <- q
 		}
 	}()
 
 	baseOut := make(chan EvalResult)
 	expOut := make(chan EvalResult)
 
-	var baseErr error
-	var expErr error
+	baseErrChan := make(chan error, 1)
+	expErrChan := make(chan error, 1)
 
 	go func() {
-		baseErr = EvalScrapeStreaming(baseIn, baseOut, baseServerUrl, true /*skipExpectations*/)
+		baseErrChan <- EvalScrapeStreaming(baseIn, baseOut, baseSearcher, true /*skipExpectations*/)
 	}()
 	go func() {
-		expErr = EvalScrapeStreaming(expIn, expOut, expServerUrl, true /*skipExpectations*/)
+		expErrChan <- EvalScrapeStreaming(expIn, expOut, expSearcher, true /*skipExpectations*/)
 	}()
 
 	baseEvalResults := []EvalResult(nil)
@@ -1705,7 +1811,10 @@ func EvalQuerySetDiff(evalSet []EvalQuery, baseServerUrl, expServerUrl string, d
 			})
 
 			// |diffCount| is shared with the goroutine adding scrapes.
-			if diff, err := EvalResultsDiffsCount(evalSet, expEvalResults, baseEvalResults); err != nil {
+			evalSetMutex.Lock()
+			diff, err := EvalResultsDiffsCount(evalSet, expEvalResults, baseEvalResults)
+			evalSetMutex.Unlock()
+			if err != nil {
 				return ResultsDiffs{ErrorStr: err.Error()}, err
 			} else {
 				log.Infof("Update diff count to: %d %d %d", diff, len(expEvalResults), len(baseEvalResults))
@@ -1714,14 +1823,16 @@ func EvalQuerySetDiff(evalSet []EvalQuery, baseServerUrl, expServerUrl string, d
 		}
 	}
 
-	if baseErr != nil {
+	if baseErr := <-baseErrChan; baseErr != nil {
 		return ResultsDiffs{ErrorStr: baseErr.Error()}, baseErr
 	}
-	if expErr != nil {
+	if expErr := <-expErrChan; expErr != nil {
 		return ResultsDiffs{ErrorStr: expErr.Error()}, expErr
 	}
 
 	// Generate eval diff.
+	evalSetMutex.Lock()
+	defer evalSetMutex.Unlock()
 	return EvalResultsDiffs(evalSet[:evalSetQueriesUsed], expEvalResults, baseEvalResults)
 }
 
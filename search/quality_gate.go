@@ -0,0 +1,215 @@
+package search
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/Bnei-Baruch/archive-backend/utils"
+)
+
+// Tolerated drop vs golden in percentage points, of weighted Good expectations and of nDCG@10 (x100).
+type EvalGateTolerance struct {
+	MaxGoodDrop float64 `json:"max_good_drop"`
+	MaxNDCGDrop float64 `json:"max_ndcg_drop"`
+}
+
+// Tolerances keyed by language (e.g. "he") or by language and bucket (e.g. "he/אגרות"),
+// EVAL_GATE_DEFAULT_TOLERANCE key for all others.
+type EvalGateThresholds map[string]EvalGateTolerance
+
+const EVAL_GATE_DEFAULT_TOLERANCE = "*"
+
+// Bucket tolerance, or language tolerance, or the default one.
+func (t EvalGateThresholds) Tolerance(language string, bucket string) EvalGateTolerance {
+	if bucket != "" {
+		if tolerance, ok := t[language+"/"+bucket]; ok {
+			return tolerance
+		}
+	}
+	if tolerance, ok := t[language]; ok {
+		return tolerance
+	}
+	return t[EVAL_GATE_DEFAULT_TOLERANCE]
+}
+
+// Reads thresholds json, e.g.: {"*": {"max_good_drop": 1, "max_ndcg_drop": 1}, "he/אגרות": {"max_good_drop": 5}}.
+// When |path| is empty or has no default tolerance |defaultTolerance| is used.
+func ReadEvalGateThresholds(path string, defaultTolerance EvalGateTolerance) (EvalGateThresholds, error) {
+	thresholds := EvalGateThresholds{}
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Read eval gate thresholds %s", path)
+		}
+		if err := json.Unmarshal(data, &thresholds); err != nil {
+			return nil, errors.Wrapf(err, "Unmarshal eval gate thresholds %s", path)
+		}
+	}
+	if _, ok := thresholds[EVAL_GATE_DEFAULT_TOLERANCE]; !ok {
+		thresholds[EVAL_GATE_DEFAULT_TOLERANCE] = defaultTolerance
+	}
+	return thresholds, nil
+}
+
+// Metrics of language (empty bucket) or bucket of language vs golden.
+type EvalGateGroup struct {
+	Language   string            `json:"language"`
+	Bucket     string            `json:"bucket,omitempty"`
+	Queries    int               `json:"queries"`
+	Good       float64           `json:"good"`
+	GoldenGood float64           `json:"golden_good"`
+	NDCG       float64           `json:"ndcg"`
+	GoldenNDCG float64           `json:"golden_ndcg"`
+	Tolerance  EvalGateTolerance `json:"tolerance"`
+	Passed     bool              `json:"passed"`
+}
+
+type EvalGateOutcome struct {
+	Quality string `json:"quality"`
+	Rank    int    `json:"rank"`
+}
+
+// Expectation with lower quality, or same quality and lower rank, than golden.
+type EvalGateRegression struct {
+	Language    string          `json:"language"`
+	Bucket      string          `json:"bucket,omitempty"`
+	Query       string          `json:"query"`
+	Weight      float64         `json:"weight"`
+	Expectation string          `json:"expectation"`
+	Expected    EvalGateOutcome `json:"expected"`
+	Got         EvalGateOutcome `json:"got"`
+}
+
+type EvalGateSummary struct {
+	Passed      bool                 `json:"passed"`
+	Failed      []EvalGateGroup      `json:"failed"`
+	Groups      []EvalGateGroup      `json:"groups"`
+	Regressions []EvalGateRegression `json:"regressions"`
+}
+
+// Weighted percentage of Good expectations by language and by bucket of language, language totals keyed by empty bucket.
+func flatRecordsGoodPercentage(records [][]string) (map[string]map[string]float64, error) {
+	good := make(map[string]map[string]float64)
+	total := make(map[string]map[string]float64)
+	for _, record := range records {
+		weight, err := strconv.ParseFloat(record[FLAT_REPORT_WEIGHT_COLUMN], 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Weight of query [%s]", record[FLAT_REPORT_QUERY_COLUMN])
+		}
+		language := record[FLAT_REPORT_LANGUAGE_COLUMN]
+		if _, ok := total[language]; !ok {
+			good[language] = make(map[string]float64)
+			total[language] = make(map[string]float64)
+		}
+		buckets := []string{""}
+		if record[FLAT_REPORT_BUCKET_COLUMN] != "" {
+			buckets = append(buckets, record[FLAT_REPORT_BUCKET_COLUMN])
+		}
+		for _, bucket := range buckets {
+			total[language][bucket] += weight
+			if record[FLAT_REPORT_QUALITY_COLUMN] == SEARCH_QUALITY_NAME[SQ_GOOD] {
+				good[language][bucket] += weight
+			}
+		}
+	}
+	for language, byBucket := range total {
+		for bucket, weight := range byBucket {
+			if weight > 0 {
+				good[language][bucket] = 100 * good[language][bucket] / weight
+			}
+		}
+	}
+	return good, nil
+}
+
+// Compares flat report records (without headers) to golden records per language and bucket of the
+// evaluated languages. Gate fails when metrics of any group dropped more than tolerated.
+// Expectations missing in golden records (e.g., eval set was changed) are not regressions.
+func EvalGate(records [][]string, goldenRecords [][]string, thresholds EvalGateThresholds) (EvalGateSummary, error) {
+	records = normalizeFlatRecords(records)
+	goldenRecords = normalizeFlatRecords(goldenRecords)
+	summary := EvalGateSummary{Passed: true, Failed: []EvalGateGroup{}, Groups: []EvalGateGroup{}, Regressions: []EvalGateRegression{}}
+	good, err := flatRecordsGoodPercentage(records)
+	if err != nil {
+		return summary, err
+	}
+	goldenGood, err := flatRecordsGoodPercentage(goldenRecords)
+	if err != nil {
+		return summary, err
+	}
+	metrics := FlatRecordsIRMetrics(records)
+	goldenMetrics := FlatRecordsIRMetrics(goldenRecords)
+	for _, language := range utils.StringMapOrderedKeys(good) {
+		if _, ok := goldenGood[language]; !ok {
+			continue
+		}
+		for _, bucket := range utils.StringMapOrderedKeys(good[language]) {
+			if _, ok := goldenGood[language][bucket]; !ok {
+				continue
+			}
+			group := EvalGateGroup{
+				Language:   language,
+				Bucket:     bucket,
+				Queries:    metrics[language][bucket].Queries,
+				Good:       good[language][bucket],
+				GoldenGood: goldenGood[language][bucket],
+				NDCG:       100 * metrics[language][bucket].NDCG,
+				GoldenNDCG: 100 * goldenMetrics[language][bucket].NDCG,
+				Tolerance:  thresholds.Tolerance(language, bucket),
+			}
+			// Epsilon for percentages rounding.
+			group.Passed = group.GoldenGood-group.Good <= group.Tolerance.MaxGoodDrop+1e-9 &&
+				group.GoldenNDCG-group.NDCG <= group.Tolerance.MaxNDCGDrop+1e-9
+			summary.Groups = append(summary.Groups, group)
+			if !group.Passed {
+				summary.Passed = false
+				summary.Failed = append(summary.Failed, group)
+			}
+		}
+	}
+
+	expectationKey := func(record []string) string {
+		return strings.Join([]string{record[FLAT_REPORT_LANGUAGE_COLUMN], record[FLAT_REPORT_BUCKET_COLUMN], record[FLAT_REPORT_QUERY_COLUMN], record[FLAT_REPORT_EXPECTATION_COLUMN]}, "\t")
+	}
+	goldenByExpectation := make(map[string][]string)
+	for _, goldenRecord := range goldenRecords {
+		goldenByExpectation[expectationKey(goldenRecord)] = goldenRecord
+	}
+	for _, record := range records {
+		goldenRecord, ok := goldenByExpectation[expectationKey(record)]
+		if !ok {
+			continue
+		}
+		quality := SEARCH_QUALITY_BY_NAME[record[FLAT_REPORT_QUALITY_COLUMN]]
+		goldenQuality := SEARCH_QUALITY_BY_NAME[goldenRecord[FLAT_REPORT_QUALITY_COLUMN]]
+		rank := rankValue(record[FLAT_REPORT_RANK_COLUMN])
+		goldenRank := rankValue(goldenRecord[FLAT_REPORT_RANK_COLUMN])
+		if quality < goldenQuality || (quality == goldenQuality && rank > goldenRank) {
+			weight, _ := strconv.ParseFloat(record[FLAT_REPORT_WEIGHT_COLUMN], 64)
+			expectedRank, _ := strconv.Atoi(goldenRecord[FLAT_REPORT_RANK_COLUMN])
+			gotRank, _ := strconv.Atoi(record[FLAT_REPORT_RANK_COLUMN])
+			summary.Regressions = append(summary.Regressions, EvalGateRegression{
+				Language:    record[FLAT_REPORT_LANGUAGE_COLUMN],
+				Bucket:      record[FLAT_REPORT_BUCKET_COLUMN],
+				Query:       record[FLAT_REPORT_QUERY_COLUMN],
+				Weight:      weight,
+				Expectation: record[FLAT_REPORT_EXPECTATION_COLUMN],
+				Expected:    EvalGateOutcome{goldenRecord[FLAT_REPORT_QUALITY_COLUMN], expectedRank},
+				Got:         EvalGateOutcome{record[FLAT_REPORT_QUALITY_COLUMN], gotRank},
+			})
+		}
+	}
+	// Most frequent queries first.
+	sort.SliceStable(summary.Regressions, func(i, j int) bool {
+		if summary.Regressions[i].Language != summary.Regressions[j].Language {
+			return summary.Regressions[i].Language < summary.Regressions[j].Language
+		}
+		return summary.Regressions[i].Weight > summary.Regressions[j].Weight
+	})
+	return summary, nil
+}
@@ -0,0 +1,138 @@
+package search
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type QualityGateSuite struct {
+	suite.Suite
+}
+
+func TestQualityGate(t *testing.T) {
+	suite.Run(t, new(QualityGateSuite))
+}
+
+func gateRecord(lang, query, bucket, expectation, quality, rank string) []string {
+	return []string{lang, query, "2.00", bucket, "", expectation, "et_content_units|" + expectation + "|", quality, rank}
+}
+
+func (suite *QualityGateSuite) golden() [][]string {
+	return [][]string{
+		gateRecord("en", "zohar", "sources", "aaaaaaaa", "Good", "1"),
+		gateRecord("en", "shamati", "sources", "bbbbbbbb", "Good", "2"),
+		gateRecord("en", "new life", "", "cccccccc", "Regular", "-1"),
+		gateRecord("he", "zohar", "sources", "aaaaaaaa", "Good", "1"),
+	}
+}
+
+func (suite *QualityGateSuite) TestSame() {
+	r := suite.Require()
+	summary, err := EvalGate(suite.golden(), suite.golden(), EvalGateThresholds{EVAL_GATE_DEFAULT_TOLERANCE: {}})
+	r.Nil(err)
+	r.True(summary.Passed)
+	r.Equal(0, len(summary.Failed))
+	r.Equal(0, len(summary.Regressions))
+	// en, en/sources, he, he/sources.
+	r.Equal(4, len(summary.Groups))
+	r.Equal("en", summary.Groups[0].Language)
+	r.Equal("", summary.Groups[0].Bucket)
+	r.Equal(3, summary.Groups[0].Queries)
+	r.InDelta(100*2.0/3, summary.Groups[0].Good, 1e-9)
+}
+
+func (suite *QualityGateSuite) TestRegressions() {
+	r := suite.Require()
+	records := suite.golden()
+	// Rank drop, within Good tolerance.
+	records[1][FLAT_REPORT_RANK_COLUMN] = "5"
+	// Not in golden, not a regression.
+	records = append(records, gateRecord("en", "kabbalah", "", "dddddddd", "Unknown", "-1"))
+
+	summary, err := EvalGate(records, suite.golden(), EvalGateThresholds{EVAL_GATE_DEFAULT_TOLERANCE: {MaxGoodDrop: 100, MaxNDCGDrop: 100}})
+	r.Nil(err)
+	r.True(summary.Passed)
+	r.Equal([]EvalGateRegression{{
+		Language:    "en",
+		Bucket:      "sources",
+		Query:       "shamati",
+		Weight:      2,
+		Expectation: "bbbbbbbb",
+		Expected:    EvalGateOutcome{"Good", 2},
+		Got:         EvalGateOutcome{"Good", 5},
+	}}, summary.Regressions)
+
+	// Quality drop, fails language and bucket unless bucket is tolerated.
+	records[0][FLAT_REPORT_QUALITY_COLUMN] = "Unknown"
+	records[0][FLAT_REPORT_RANK_COLUMN] = "-1"
+	thresholds := EvalGateThresholds{
+		EVAL_GATE_DEFAULT_TOLERANCE: {MaxGoodDrop: 1, MaxNDCGDrop: 100},
+		"en/sources":                {MaxGoodDrop: 60, MaxNDCGDrop: 100},
+	}
+	summary, err = EvalGate(records, suite.golden(), thresholds)
+	r.Nil(err)
+	r.False(summary.Passed)
+	r.Equal(1, len(summary.Failed))
+	r.Equal("en", summary.Failed[0].Language)
+	r.Equal("", summary.Failed[0].Bucket)
+	r.Equal(2, len(summary.Regressions))
+	r.Equal("zohar", summary.Regressions[0].Query)
+	r.Equal(EvalGateOutcome{"Unknown", -1}, summary.Regressions[0].Got)
+
+	// nDCG drop.
+	summary, err = EvalGate(records, suite.golden(), EvalGateThresholds{EVAL_GATE_DEFAULT_TOLERANCE: {MaxGoodDrop: 100, MaxNDCGDrop: 1}})
+	r.Nil(err)
+	r.False(summary.Passed)
+	r.Equal(2, len(summary.Failed))
+}
+
+func (suite *QualityGateSuite) TestSameExpectationInBuckets() {
+	r := suite.Require()
+	golden := [][]string{
+		gateRecord("en", "zohar", "sources", "aaaaaaaa", "Good", "1"),
+		gateRecord("en", "zohar", "lessons", "aaaaaaaa", "Good", "3"),
+	}
+	records := [][]string{
+		gateRecord("en", "zohar", "sources", "aaaaaaaa", "Good", "2"),
+		gateRecord("en", "zohar", "lessons", "aaaaaaaa", "Good", "3"),
+	}
+	summary, err := EvalGate(records, golden, EvalGateThresholds{EVAL_GATE_DEFAULT_TOLERANCE: {MaxGoodDrop: 100, MaxNDCGDrop: 100}})
+	r.Nil(err)
+	// Each record is compared to golden record of its bucket.
+	r.Equal([]EvalGateRegression{{
+		Language:    "en",
+		Bucket:      "sources",
+		Query:       "zohar",
+		Weight:      2,
+		Expectation: "aaaaaaaa",
+		Expected:    EvalGateOutcome{"Good", 1},
+		Got:         EvalGateOutcome{"Good", 2},
+	}}, summary.Regressions)
+}
+
+func (suite *QualityGateSuite) TestThresholds() {
+	r := suite.Require()
+	dir, err := ioutil.TempDir("", "quality_gate")
+	r.Nil(err)
+	defer os.RemoveAll(dir)
+
+	defaultTolerance := EvalGateTolerance{MaxGoodDrop: 1, MaxNDCGDrop: 2}
+	thresholds, err := ReadEvalGateThresholds("", defaultTolerance)
+	r.Nil(err)
+	r.Equal(defaultTolerance, thresholds.Tolerance("he", "sources"))
+
+	path := filepath.Join(dir, "thresholds.json")
+	r.Nil(ioutil.WriteFile(path, []byte(`{"he": {"max_good_drop": 3}, "he/sources": {"max_good_drop": 5, "max_ndcg_drop": 6}}`), 0644))
+	thresholds, err = ReadEvalGateThresholds(path, defaultTolerance)
+	r.Nil(err)
+	r.Equal(EvalGateTolerance{MaxGoodDrop: 5, MaxNDCGDrop: 6}, thresholds.Tolerance("he", "sources"))
+	r.Equal(EvalGateTolerance{MaxGoodDrop: 3}, thresholds.Tolerance("he", "lessons"))
+	r.Equal(defaultTolerance, thresholds.Tolerance("en", "sources"))
+
+	_, err = ReadEvalGateThresholds(filepath.Join(dir, "missing.json"), defaultTolerance)
+	r.NotNil(err)
+}
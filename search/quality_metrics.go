@@ -0,0 +1,263 @@
+package search
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Cutoff of information retrieval metrics, evaluated queries fetch 10 results.
+const EVAL_METRICS_K = 10
+
+// Graded relevance of eval set expectation, e.g.: [3]https://kabbalahmedia.info/he/sources/kB3eD83I
+// Expectations without grade have the default grade of 1, i.e., binary relevance.
+const DEFAULT_RELEVANCE_GRADE = 1
+
+var expectationGradeRe = regexp.MustCompile(`^\[([1-9])\]`)
+
+// Flat report columns.
+const (
+	FLAT_REPORT_LANGUAGE_COLUMN    = 0
+	FLAT_REPORT_QUERY_COLUMN       = 1
+	FLAT_REPORT_WEIGHT_COLUMN      = 2
+	FLAT_REPORT_BUCKET_COLUMN      = 3
+	FLAT_REPORT_EXPECTATION_COLUMN = 5
+	FLAT_REPORT_PARSED_COLUMN      = 6
+	FLAT_REPORT_QUALITY_COLUMN     = 7
+	FLAT_REPORT_RANK_COLUMN        = 8
+	FLAT_REPORT_GRADE_COLUMN       = 9
+	// Per query metrics follow, same for all expectations of the query.
+	FLAT_REPORT_METRICS_COLUMN = 10
+)
+
+var IR_METRICS_NAMES = []string{
+	fmt.Sprintf("nDCG@%d", EVAL_METRICS_K),
+	"MRR",
+	fmt.Sprintf("P@%d", EVAL_METRICS_K),
+	fmt.Sprintf("R@%d", EVAL_METRICS_K),
+}
+
+// Parses expectation with optional relevance grade prefix, returns the expectation and its grade.
+func ParseGradedExpectation(e string, db *sql.DB) (Expectation, int) {
+	grade := DEFAULT_RELEVANCE_GRADE
+	if match := expectationGradeRe.FindStringSubmatch(e); match != nil {
+		grade, _ = strconv.Atoi(match[1])
+		e = e[len(match[0]):]
+	}
+	return ParseExpectation(e, db), grade
+}
+
+// Relevance grade of |i|-th expectation, default grade if not set.
+func (q EvalQuery) RelevanceGrade(i int) int {
+	if i >= len(q.Grades) || q.Grades[i] <= 0 {
+		return DEFAULT_RELEVANCE_GRADE
+	}
+	return q.Grades[i]
+}
+
+// Information retrieval metrics of a query, or mean of metrics of queries.
+type IRMetrics struct {
+	Queries   int     `json:"queries"`
+	NDCG      float64 `json:"ndcg"`
+	MRR       float64 `json:"mrr"`
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+}
+
+func (m IRMetrics) Values() []float64 {
+	return []float64{m.NDCG, m.MRR, m.Precision, m.Recall}
+}
+
+func (m IRMetrics) Strings() []string {
+	ret := []string(nil)
+	for _, value := range m.Values() {
+		ret = append(ret, fmt.Sprintf("%.4f", value))
+	}
+	return ret
+}
+
+func (m *IRMetrics) add(other IRMetrics) {
+	m.Queries += other.Queries
+	m.NDCG += other.NDCG
+	m.MRR += other.MRR
+	m.Precision += other.Precision
+	m.Recall += other.Recall
+}
+
+func (m IRMetrics) mean() IRMetrics {
+	if m.Queries == 0 {
+		return m
+	}
+	n := float64(m.Queries)
+	return IRMetrics{m.Queries, m.NDCG / n, m.MRR / n, m.Precision / n, m.Recall / n}
+}
+
+// Relevant expectation with rank (-1 when not found) and grade.
+type judgedRank struct {
+	rank        int
+	grade       int
+	expectation string
+}
+
+// Computes metrics at cutoff |k| of query with relevant expectations |judged|.
+// The ranking is known only for expected results, other results are considered not relevant.
+// Returns false when query has no relevant expectations.
+func queryIRMetrics(judged []judgedRank, k int) (IRMetrics, bool) {
+	if len(judged) == 0 {
+		return IRMetrics{}, false
+	}
+	gain := func(grade int) float64 {
+		return math.Pow(2, float64(grade)) - 1
+	}
+	// Duplicate expectations (e.g., same expectation listed twice) are judged once with max grade.
+	byExpectation := make(map[string]judgedRank)
+	for _, j := range judged {
+		if e, ok := byExpectation[j.expectation]; !ok || j.grade > e.grade {
+			byExpectation[j.expectation] = j
+		}
+	}
+	// Few expectations may match same hit, e.g., unit and its collection, the hit is counted once with max grade.
+	gradeByRank := make(map[int]int)
+	grades := []int(nil)
+	foundExpectations := 0
+	for _, j := range byExpectation {
+		grades = append(grades, j.grade)
+		if j.rank > 0 && j.grade > gradeByRank[j.rank] {
+			gradeByRank[j.rank] = j.grade
+		}
+		if j.rank > 0 && j.rank <= k {
+			foundExpectations++
+		}
+	}
+	dcg := float64(0)
+	found := 0
+	firstRank := 0
+	for rank, grade := range gradeByRank {
+		if rank <= k {
+			dcg += gain(grade) / math.Log2(float64(rank+1))
+			found++
+		}
+		if firstRank == 0 || rank < firstRank {
+			firstRank = rank
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(grades)))
+	idcg := float64(0)
+	for i := 0; i < len(grades) && i < k; i++ {
+		idcg += gain(grades[i]) / math.Log2(float64(i+2))
+	}
+	ret := IRMetrics{Queries: 1, NDCG: dcg / idcg, Precision: float64(found) / float64(k), Recall: float64(foundExpectations) / float64(len(byExpectation))}
+	if firstRank > 0 {
+		ret.MRR = 1 / float64(firstRank)
+	}
+	return ret, true
+}
+
+// Records of same query.
+func flatRecordQueryKey(record []string) string {
+	return strings.Join([]string{record[FLAT_REPORT_LANGUAGE_COLUMN], record[FLAT_REPORT_BUCKET_COLUMN], record[FLAT_REPORT_QUERY_COLUMN]}, "\t")
+}
+
+// Computes metrics of queries of flat report records (without headers), by query key.
+// Records of reports without grade column have the default grade.
+func flatRecordsQueriesIRMetrics(records [][]string) map[string]IRMetrics {
+	judgedByQuery := make(map[string][]judgedRank)
+	for _, record := range records {
+		record = padFlatRecord(record)
+		key := flatRecordQueryKey(record)
+		if strings.HasPrefix(record[FLAT_REPORT_PARSED_COLUMN], EXPECTATION_TO_NAME[ET_BAD_STRUCTURE]) {
+			// Not a result that can be found.
+			continue
+		}
+		rank, err := strconv.Atoi(record[FLAT_REPORT_RANK_COLUMN])
+		if err != nil {
+			rank = -1
+		}
+		grade := DEFAULT_RELEVANCE_GRADE
+		if parsed, err := strconv.Atoi(record[FLAT_REPORT_GRADE_COLUMN]); err == nil && parsed > 0 {
+			grade = parsed
+		}
+		judgedByQuery[key] = append(judgedByQuery[key], judgedRank{rank, grade, record[FLAT_REPORT_EXPECTATION_COLUMN]})
+	}
+	ret := make(map[string]IRMetrics)
+	for key, judged := range judgedByQuery {
+		if metrics, ok := queryIRMetrics(judged, EVAL_METRICS_K); ok {
+			ret[key] = metrics
+		}
+	}
+	return ret
+}
+
+// Mean metrics of flat report records (without headers) by language and by bucket of language.
+// Language totals are keyed by empty bucket.
+func FlatRecordsIRMetrics(records [][]string) map[string]map[string]IRMetrics {
+	sums := make(map[string]map[string]IRMetrics)
+	for key, metrics := range flatRecordsQueriesIRMetrics(records) {
+		parts := strings.SplitN(key, "\t", 3)
+		language, bucket := parts[0], parts[1]
+		if _, ok := sums[language]; !ok {
+			sums[language] = make(map[string]IRMetrics)
+		}
+		buckets := []string{""}
+		if bucket != "" {
+			buckets = append(buckets, bucket)
+		}
+		for _, b := range buckets {
+			sum := sums[language][b]
+			sum.add(metrics)
+			sums[language][b] = sum
+		}
+	}
+	ret := make(map[string]map[string]IRMetrics)
+	for language, byBucket := range sums {
+		ret[language] = make(map[string]IRMetrics)
+		for bucket, sum := range byBucket {
+			ret[language][bucket] = sum.mean()
+		}
+	}
+	return ret
+}
+
+// Adds per query metrics columns to flat report records (without headers).
+func addFlatRecordsIRMetrics(records [][]string) [][]string {
+	for i := range records {
+		records[i] = padFlatRecord(records[i])
+	}
+	metricsByQuery := flatRecordsQueriesIRMetrics(records)
+	for i := range records {
+		values := make([]string, len(IR_METRICS_NAMES))
+		if metrics, ok := metricsByQuery[flatRecordQueryKey(records[i])]; ok {
+			values = metrics.Strings()
+		}
+		records[i] = append(records[i][:FLAT_REPORT_METRICS_COLUMN], values...)
+	}
+	return records
+}
+
+// Pads records of flat reports written before grade and metrics columns were added.
+func normalizeFlatRecords(records [][]string) [][]string {
+	padded := false
+	for i := range records {
+		if len(records[i]) <= FLAT_REPORT_GRADE_COLUMN {
+			records[i] = padFlatRecord(records[i])
+			records[i][FLAT_REPORT_GRADE_COLUMN] = strconv.Itoa(DEFAULT_RELEVANCE_GRADE)
+			padded = true
+		}
+	}
+	if padded {
+		return addFlatRecordsIRMetrics(records)
+	}
+	return records
+}
+
+// Pads short records (e.g., hand edited reports) with empty columns up to metrics columns.
+func padFlatRecord(record []string) []string {
+	for len(record) < FLAT_REPORT_METRICS_COLUMN {
+		record = append(record, "")
+	}
+	return record
+}
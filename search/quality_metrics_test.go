@@ -0,0 +1,164 @@
+package search
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type QualityMetricsSuite struct {
+	suite.Suite
+}
+
+func TestQualityMetrics(t *testing.T) {
+	suite.Run(t, new(QualityMetricsSuite))
+}
+
+func (suite *QualityMetricsSuite) TestQueryIRMetrics() {
+	r := suite.Require()
+
+	_, ok := queryIRMetrics(nil, EVAL_METRICS_K)
+	r.False(ok)
+
+	// Ideal ranking.
+	m, ok := queryIRMetrics([]judgedRank{{1, 3, "a"}, {2, 1, "b"}}, EVAL_METRICS_K)
+	r.True(ok)
+	r.Equal(1, m.Queries)
+	r.InDelta(1.0, m.NDCG, 1e-9)
+	r.InDelta(1.0, m.MRR, 1e-9)
+	r.InDelta(0.2, m.Precision, 1e-9)
+	r.InDelta(1.0, m.Recall, 1e-9)
+
+	// Swapped ranking: dcg = 1 + 7/log2(3), idcg = 7 + 1/log2(3).
+	m, _ = queryIRMetrics([]judgedRank{{2, 3, "a"}, {1, 1, "b"}}, EVAL_METRICS_K)
+	r.InDelta((1+7/math.Log2(3))/(7+1/math.Log2(3)), m.NDCG, 1e-9)
+	r.InDelta(1.0, m.MRR, 1e-9)
+
+	// One not found, other beyond cutoff.
+	m, _ = queryIRMetrics([]judgedRank{{-1, 1, "a"}, {12, 1, "b"}, {3, 1, "c"}}, EVAL_METRICS_K)
+	r.InDelta(1.0/3, m.MRR, 1e-9)
+	r.InDelta(0.1, m.Precision, 1e-9)
+	r.InDelta(1.0/3, m.Recall, 1e-9)
+	r.InDelta((1/math.Log2(4))/(1+1/math.Log2(3)+1/math.Log2(4)), m.NDCG, 1e-9)
+
+	// Same hit matched by two expectations counts once with max grade, both expectations are recalled.
+	m, _ = queryIRMetrics([]judgedRank{{1, 1, "a"}, {1, 2, "b"}}, EVAL_METRICS_K)
+	r.InDelta(3/(3+1/math.Log2(3)), m.NDCG, 1e-9)
+	r.InDelta(0.1, m.Precision, 1e-9)
+	r.InDelta(1.0, m.Recall, 1e-9)
+
+	// Duplicate expectation is judged once.
+	m, _ = queryIRMetrics([]judgedRank{{1, 1, "a"}, {1, 1, "a"}, {-1, 1, "b"}}, EVAL_METRICS_K)
+	r.InDelta(0.5, m.Recall, 1e-9)
+	r.InDelta(1/(1+1/math.Log2(3)), m.NDCG, 1e-9)
+
+	// Nothing found.
+	m, _ = queryIRMetrics([]judgedRank{{-1, 2, "a"}}, EVAL_METRICS_K)
+	r.Equal(IRMetrics{Queries: 1}, m)
+}
+
+func (suite *QualityMetricsSuite) TestReadGradedEvalSet() {
+	r := suite.Require()
+	evalSet := strings.Join([]string{
+		"Language,Query,Weight,Bucket,#1,#2,#3,#4,#5,Comment",
+		"en,zohar,10,sources,[3]https://kabbalahmedia.info/en/lessons/cu/aaaaaaaa,https://kabbalahmedia.info/en/lessons/cu/bbbbbbbb,,,,",
+	}, "\n")
+	queries, err := ReadEvalSet(strings.NewReader(evalSet), nil)
+	r.Nil(err)
+	r.Equal(1, len(queries))
+	q := queries[0]
+	r.Equal(ET_CONTENT_UNITS, q.Expectations[0].Type)
+	r.Equal("aaaaaaaa", q.Expectations[0].Uid)
+	r.Equal(3, q.RelevanceGrade(0))
+	r.Equal(DEFAULT_RELEVANCE_GRADE, q.RelevanceGrade(1))
+	// Queries without grades, e.g., from API.
+	r.Equal(DEFAULT_RELEVANCE_GRADE, EvalQuery{}.RelevanceGrade(0))
+
+	results := EvalResults{Results: []EvalResult{{
+		SearchQuality: []int{SQ_GOOD, SQ_REGULAR, SQ_NO_EXPECTATION, SQ_NO_EXPECTATION, SQ_NO_EXPECTATION},
+		Rank:          []int{2, 7, -1, -1, -1},
+	}}}
+	records := ResultsByExpectation(queries, results)
+	r.Equal(FLAT_REPORT_HEADERS, records[0])
+	r.Equal(3, len(records))
+	for _, record := range records[1:] {
+		r.Equal(len(FLAT_REPORT_HEADERS), len(record))
+	}
+	r.Equal("3", records[1][FLAT_REPORT_GRADE_COLUMN])
+	r.Equal("1", records[2][FLAT_REPORT_GRADE_COLUMN])
+	// Per query metrics are same for all expectations.
+	r.Equal(records[1][FLAT_REPORT_METRICS_COLUMN:], records[2][FLAT_REPORT_METRICS_COLUMN:])
+	r.Equal("0.5000", records[1][FLAT_REPORT_METRICS_COLUMN+1])
+}
+
+func flatRecord(lang, query, bucket, expectation, rank, grade string) []string {
+	return []string{lang, query, "1.00", bucket, "", expectation, "", "", rank, grade}
+}
+
+func (suite *QualityMetricsSuite) TestFlatRecordsIRMetrics() {
+	r := suite.Require()
+	records := [][]string{
+		flatRecord("en", "zohar", "sources", "aaaaaaaa", "1", "1"),
+		flatRecord("en", "shamati", "sources", "bbbbbbbb", "-1", "1"),
+		flatRecord("en", "new life", "", "cccccccc", "2", "1"),
+		flatRecord("he", "zohar", "sources", "aaaaaaaa", "1", "2"),
+	}
+	metrics := FlatRecordsIRMetrics(records)
+	r.Equal(2, len(metrics))
+	r.Equal(3, metrics["en"][""].Queries)
+	r.InDelta((1.0+0+0.5)/3, metrics["en"][""].MRR, 1e-9)
+	r.Equal(2, metrics["en"]["sources"].Queries)
+	r.InDelta(0.5, metrics["en"]["sources"].MRR, 1e-9)
+	r.InDelta(0.5, metrics["en"]["sources"].Recall, 1e-9)
+	r.Equal(2, len(metrics["he"]))
+	r.InDelta(1.0, metrics["he"]["sources"].NDCG, 1e-9)
+
+	// Bad structure expectations are not judged.
+	bad := flatRecord("ru", "zohar", "", "aaaaaaaa", "-1", "1")
+	bad[FLAT_REPORT_PARSED_COLUMN] = EXPECTATION_TO_NAME[ET_BAD_STRUCTURE]
+	r.Equal(0, len(FlatRecordsIRMetrics([][]string{bad})))
+}
+
+func (suite *QualityMetricsSuite) TestNormalizeFlatRecords() {
+	r := suite.Require()
+	// Reports written before grade and metrics columns.
+	old := [][]string{
+		flatRecord("en", "zohar", "", "aaaaaaaa", "1", "")[:FLAT_REPORT_GRADE_COLUMN],
+		flatRecord("en", "zohar", "", "bbbbbbbb", "-1", "")[:FLAT_REPORT_GRADE_COLUMN],
+	}
+	normalized := normalizeFlatRecords(old)
+	for _, record := range normalized {
+		r.Equal(len(FLAT_REPORT_HEADERS), len(record))
+		r.Equal("1", record[FLAT_REPORT_GRADE_COLUMN])
+	}
+	r.Equal([]string{"0.6131", "1.0000", "0.1000", "0.5000"}, normalized[0][FLAT_REPORT_METRICS_COLUMN:])
+
+	// Short records, e.g., hand edited, are padded.
+	short := normalizeFlatRecords([][]string{flatRecord("en", "zohar", "", "aaaaaaaa", "1", "")[:FLAT_REPORT_RANK_COLUMN]})
+	r.Equal(len(FLAT_REPORT_HEADERS), len(short[0]))
+	r.Equal("", short[0][FLAT_REPORT_RANK_COLUMN])
+	r.Equal("1", short[0][FLAT_REPORT_GRADE_COLUMN])
+	r.Equal([]string{"0.0000", "0.0000", "0.0000", "0.0000"}, short[0][FLAT_REPORT_METRICS_COLUMN:])
+	r.NotPanics(func() { addFlatRecordsIRMetrics([][]string{{"en", "zohar"}}) })
+
+	// Vs golden html with old golden report.
+	dir, err := ioutil.TempDir("", "quality_metrics")
+	r.Nil(err)
+	defer os.RemoveAll(dir)
+	records := ResultsByExpectation([]EvalQuery{{Language: "en", Query: "zohar", Weight: 1,
+		Expectations: []Expectation{ParseExpectation("https://kabbalahmedia.info/en/lessons/cu/aaaaaaaa", nil)}}},
+		EvalResults{Results: []EvalResult{{SearchQuality: []int{SQ_GOOD}, Rank: []int{1}}}})
+	golden := [][]string{append([]string(nil), records[1][:FLAT_REPORT_GRADE_COLUMN]...)}
+	golden[0][FLAT_REPORT_RANK_COLUMN] = "2"
+	path := filepath.Join(dir, "vs_golden.html")
+	r.Nil(WriteVsGoldenHTML(path, records[1:], golden, ""))
+	html, err := ioutil.ReadFile(path)
+	r.Nil(err)
+	r.Contains(string(html), "<th>nDCG@10</th>")
+	r.Contains(string(html), "2 => 1")
+}
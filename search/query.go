@@ -33,6 +33,9 @@ const (
 
 	SPAN_NEAR_BOOST = 0.01
 
+	// Boost of the term forms in other scripts, relative to the term.
+	TRANSLITERATION_BOOST = 0.3
+
 	MIN_SCORE_FOR_RESULTS = 0.01
 
 	NUM_SUGGESTS = 30
@@ -46,6 +49,10 @@ type Query struct {
 	LanguageOrder []string            `json:"language_order,omitempty"`
 	Deb           bool                `json:"deb,omitempty"`
 	Intents       []Intent            `json:"intents,omitempty"`
+	// Forms of Term in other scripts, searched as lower boosted alternatives.
+	Transliterations []string `json:"transliterations,omitempty"`
+	// Optional grouping of results, e.g., SEARCH_COLLAPSE_COLLECTION.
+	Collapse string `json:"collapse,omitempty"`
 }
 
 func isTokenStart(i int, runes []rune, lastQuote rune) bool {
@@ -426,6 +433,13 @@ func createResultsQuery(resultTypes []string, q Query, docIds []string, filterOu
 			disMaxQueries = append(disMaxQueries, snq)
 		}
 
+		transliterationDisMaxQueries := []elastic.Query{}
+		for _, transliteration := range q.Transliterations {
+			tConstantScoreQueries, tDisMaxQueries := transliterationQueries(transliteration, appendDecription, titlesOnly)
+			constantScoreQueries = append(constantScoreQueries, tConstantScoreQueries...)
+			transliterationDisMaxQueries = append(transliterationDisMaxQueries, tDisMaxQueries...)
+		}
+
 		boolQuery = boolQuery.Must(
 			// Don't calculate score here, as we use sloped score below.
 			elastic.NewConstantScoreQuery(
@@ -434,6 +448,12 @@ func createResultsQuery(resultTypes []string, q Query, docIds []string, filterOu
 		).Should(
 			elastic.NewDisMaxQuery().Query(disMaxQueries...),
 		)
+		if len(transliterationDisMaxQueries) > 0 {
+			// Separate low boosted clause, so term forms in other scripts do not compete with the term itself.
+			boolQuery = boolQuery.Should(
+				elastic.NewDisMaxQuery().Query(transliterationDisMaxQueries...).Boost(TRANSLITERATION_BOOST),
+			)
+		}
 	}
 	for _, exactTerm := range q.ExactTerms {
 		constantScoreQueries := []elastic.Query{
@@ -495,6 +515,16 @@ func createResultsQuery(resultTypes []string, q Query, docIds []string, filterOu
 			boolQuery.Filter(elastic.NewRangeQuery("effective_date").Gte(values[0]).Format("yyyy-MM-dd"))
 		case consts.FILTER_END_DATE:
 			boolQuery.Filter(elastic.NewRangeQuery("effective_date").Lte(values[0]).Format("yyyy-MM-dd"))
+		case consts.FILTER_MIN_DURATION, consts.FILTER_MAX_DURATION:
+			minutes, err := strconv.Atoi(values[0])
+			if err != nil {
+				return nil, errors.Wrapf(err, "Bad %s filter value: %s", filter, values[0])
+			}
+			if filter == consts.FILTER_MIN_DURATION {
+				boolQuery.Filter(elastic.NewRangeQuery("duration").Gte(minutes * 60))
+			} else {
+				boolQuery.Filter(elastic.NewRangeQuery("duration").Lte(minutes * 60))
+			}
 		case consts.FILTER_CONTENT_TYPE:
 			contentTypeQuery := elastic.NewBoolQuery().MinimumNumberShouldMatch(1)
 			collectionContentTypes := utils.FilterStringSlice(s, func(ct string) bool { return utils.StringInSlice(ct, consts.COLLECTIONS_CONTENT_TYPES) })
@@ -546,6 +576,36 @@ func createResultsQuery(resultTypes []string, q Query, docIds []string, filterOu
 		AddScoreFunc(elastic.NewGaussDecayFunction().FieldName("effective_date").Decay(0.6).Scale("2000d")), nil
 }
 
+// Matching and scoring queries of a transliterated term, standard analyzed only (the language analyzer
+// may stem a foreign word differently). Scoring queries are boosted by TRANSLITERATION_BOOST as a whole.
+func transliterationQueries(term string, appendDecription bool, titlesOnly bool) ([]elastic.Query, []elastic.Query) {
+	constantScoreQueries := []elastic.Query{
+		elastic.NewMatchQuery("title", term).Operator("and"),
+		elastic.NewMatchQuery("full_title", term).Operator("and"),
+	}
+	disMaxQueries := []elastic.Query{
+		elastic.NewMatchPhraseQuery("title", term).Slop(SLOP).Boost(TITLE_BOOST),
+		elastic.NewMatchPhraseQuery("full_title", term).Slop(SLOP).Boost(FULL_TITLE_BOOST),
+		elastic.NewMatchPhraseQuery("title", term).Boost(EXACT_BOOST * TITLE_BOOST),
+		elastic.NewMatchPhraseQuery("full_title", term).Boost(EXACT_BOOST * FULL_TITLE_BOOST),
+	}
+	if appendDecription {
+		constantScoreQueries = append(constantScoreQueries, elastic.NewMatchQuery("description", term).Operator("and"))
+		disMaxQueries = append(disMaxQueries,
+			elastic.NewMatchPhraseQuery("description", term).Slop(SLOP).Boost(DESCRIPTION_BOOST),
+			elastic.NewMatchPhraseQuery("description", term).Boost(EXACT_BOOST*DESCRIPTION_BOOST),
+		)
+	}
+	if !titlesOnly {
+		constantScoreQueries = append(constantScoreQueries, elastic.NewMatchQuery("content", term).Operator("and"))
+		disMaxQueries = append(disMaxQueries,
+			elastic.NewMatchPhraseQuery("content", term).Slop(SLOP),
+			elastic.NewMatchPhraseQuery("content", term).Boost(EXACT_BOOST),
+		)
+	}
+	return constantScoreQueries, disMaxQueries
+}
+
 func NewResultsSearchRequest(options SearchRequestOptions) (*elastic.SearchRequest, error) {
 	fetchSourceContext := elastic.NewFetchSourceContext(true).Include("mdb_uid", "result_type", "effective_date", "typed_uids")
 
@@ -605,11 +665,18 @@ func NewResultsSearchRequest(options SearchRequestOptions) (*elastic.SearchReque
 		source = source.Highlight(highlightQuery)
 	}
 
-	switch options.sortBy {
-	case consts.SORT_BY_OLDER_TO_NEWER:
-		source = source.Sort("effective_date", true)
-	case consts.SORT_BY_NEWER_TO_OLDER:
-		source = source.Sort("effective_date", false)
+	if options.cursorSort {
+		source = source.SortBy(cursorSorters(options.sortBy)...)
+		if len(options.searchAfter) > 0 {
+			source = source.SearchAfter(options.searchAfter...)
+		}
+	} else {
+		switch options.sortBy {
+		case consts.SORT_BY_OLDER_TO_NEWER:
+			source = source.Sort("effective_date", true)
+		case consts.SORT_BY_NEWER_TO_OLDER:
+			source = source.Sort("effective_date", false)
+		}
 	}
 	return elastic.NewSearchRequest().
 		SearchSource(source).
@@ -646,8 +713,9 @@ func NewResultsSearchRequests(options SearchRequestOptions) ([]*elastic.SearchRe
 	for i := range options.query.LanguageOrder {
 		indices[i] = es.IndexNameForServing("prod", consts.ES_RESULTS_INDEX, options.query.LanguageOrder[i])
 	}
-	for _, index := range indices {
+	for i, index := range indices {
 		options.index = index
+		options.searchAfter = options.searchAfterByLang[options.query.LanguageOrder[i]]
 		request, err := NewResultsSearchRequest(options)
 		if err != nil {
 			return nil, err
@@ -0,0 +1,143 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+	"github.com/Bnei-Baruch/archive-backend/utils"
+)
+
+// Fields used to compare content units with "more like this" query.
+var relatedContentFields = []string{
+	"title.language",
+	"description.language",
+	"content.language",
+}
+
+// Loads the indexed document of the content unit from the results index.
+// Returns nil hit if the unit is not indexed in this language.
+func (e *ESEngine) relatedContentUnitDoc(ctx context.Context, index string, uid string) (*elastic.SearchHit, *es.Result, error) {
+	query := elastic.NewBoolQuery().Filter(
+		elastic.NewTermQuery("mdb_uid", uid),
+		elastic.NewTermQuery("result_type", consts.ES_RESULT_TYPE_UNITS),
+	)
+	res, err := e.esc.Search().
+		Index(index).
+		Query(query).
+		FetchSourceContext(elastic.NewFetchSourceContext(true).Include("mdb_uid", "typed_uids", "filter_values")).
+		Size(1).
+		Do(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "ESEngine.relatedContentUnitDoc - Error fetching content unit document.")
+	}
+	if !haveHits(res) {
+		return nil, nil, nil
+	}
+	hit := res.Hits.Hits[0]
+	var src es.Result
+	if err := json.Unmarshal(*hit.Source, &src); err != nil {
+		return nil, nil, errors.Wrap(err, "ESEngine.relatedContentUnitDoc - Error unmarshal content unit document.")
+	}
+	return hit, &src, nil
+}
+
+// Creates "more like this" query for the given content unit document.
+// Results sharing sources or tags with the unit are boosted, the unit itself and units from
+// the same collection (siblings) are excluded.
+func NewRelatedContentQuery(index string, docId string, src *es.Result, resultTypes []string) (elastic.Query, error) {
+	// Item type is required by ES 6, typeless backends transport removes it.
+	mlt := elastic.NewMoreLikeThisQuery().
+		Field(relatedContentFields...).
+		LikeItems(elastic.NewMoreLikeThisQueryItem().Index(index).Type(consts.ES_RESULTS_DOC_TYPE).Id(docId)).
+		MinTermFreq(1).
+		MinDocFreq(2).
+		MaxQueryTerms(25).
+		MinimumShouldMatch("30%")
+
+	query := elastic.NewBoolQuery().
+		Must(mlt).
+		Filter(elastic.NewTermsQuery("result_type", utils.ConvertArgsString(resultTypes)...)).
+		MustNot(elastic.NewTermQuery("mdb_uid", src.MDB_UID))
+
+	sources := []string{}
+	tags := []string{}
+	for _, fv := range src.FilterValues {
+		if strings.HasPrefix(fv, es.KeyValue(consts.FILTER_SOURCE, "")) {
+			sources = append(sources, fv)
+		} else if strings.HasPrefix(fv, es.KeyValue(consts.FILTER_TAG, "")) {
+			tags = append(tags, fv)
+		}
+	}
+	if len(sources) > 0 {
+		query.Should(elastic.NewTermsQuery("filter_values", utils.ConvertArgsString(sources)...).Boost(consts.RELATED_SHARED_SOURCE_BOOST))
+	}
+	if len(tags) > 0 {
+		query.Should(elastic.NewTermsQuery("filter_values", utils.ConvertArgsString(tags)...).Boost(consts.RELATED_SHARED_TAG_BOOST))
+	}
+
+	collections, err := es.KeyValuesToValues(consts.ES_UID_TYPE_COLLECTION, src.TypedUids)
+	if err != nil {
+		return nil, errors.Wrap(err, "NewRelatedContentQuery - Error parsing typed uids.")
+	}
+	if len(collections) > 0 {
+		query.MustNot(
+			elastic.NewTermsQuery("typed_uids", utils.ConvertArgsString(es.KeyValues(consts.ES_UID_TYPE_COLLECTION, collections))...),
+			elastic.NewTermsQuery("mdb_uid", utils.ConvertArgsString(collections)...),
+		)
+	}
+	return query, nil
+}
+
+// Returns content similar to the content unit with the given uid in the given language.
+// Returns nil result when the content unit is not indexed in this language.
+func (e *ESEngine) RelatedContent(ctx context.Context, uid string, language string, resultTypes []string, size int, preference string) (*elastic.SearchResult, error) {
+	defer e.timeTrack(time.Now(), consts.LAT_RELATED_CONTENT)
+
+	index := es.IndexNameForServing("prod", consts.ES_RESULTS_INDEX, language)
+	hit, src, err := e.relatedContentUnitDoc(ctx, index, uid)
+	if err != nil {
+		return nil, err
+	}
+	if hit == nil {
+		return nil, nil
+	}
+
+	query, err := NewRelatedContentQuery(index, hit.Id, src, resultTypes)
+	if err != nil {
+		return nil, err
+	}
+	res, err := e.esc.Search().
+		Index(index).
+		Query(query).
+		FetchSourceContext(elastic.NewFetchSourceContext(true).Exclude("content", "title_suggest")).
+		Size(size).
+		Preference(preference).
+		Do(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("ESEngine.RelatedContent - Error searching related content for %s.", uid))
+	}
+
+	if res.Hits != nil {
+		for _, h := range res.Hits.Hits {
+			var hsrc es.Result
+			if err := json.Unmarshal(*h.Source, &hsrc); err != nil {
+				return nil, errors.Wrap(err, "ESEngine.RelatedContent - Error unmarshal result source.")
+			}
+			hsrc.TypedUids = nil // Client has no need for TypedUids list
+			nsrc, err := json.Marshal(hsrc)
+			if err != nil {
+				return nil, errors.Wrap(err, "ESEngine.RelatedContent - Error marshal result source.")
+			}
+			h.Source = (*json.RawMessage)(&nsrc)
+		}
+	}
+	return res, nil
+}
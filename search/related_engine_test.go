@@ -0,0 +1,48 @@
+package search
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+)
+
+type RelatedSuite struct {
+	suite.Suite
+}
+
+func TestRelated(t *testing.T) {
+	suite.Run(t, new(RelatedSuite))
+}
+
+func (suite *RelatedSuite) TestNewRelatedContentQuery() {
+	r := require.New(suite.T())
+	src := &es.Result{
+		MDB_UID:      "unit1",
+		TypedUids:    []string{"content_unit:unit1", "collection:coll1", "source:src1"},
+		FilterValues: []string{"content_type:LESSON_PART", "source:src1", "tag:tag1", "media_language:en"},
+	}
+	query, err := NewRelatedContentQuery("prod_results_en", "docid", src, []string{consts.ES_RESULT_TYPE_UNITS})
+	r.Nil(err)
+	qs, err := query.Source()
+	r.Nil(err)
+	b, err := json.Marshal(qs)
+	r.Nil(err)
+	r.JSONEq(`{"bool":{
+		"filter":{"terms":{"result_type":["units"]}},
+		"must":{"more_like_this":{
+			"fields":["title.language","description.language","content.language"],
+			"like":[{"_id":"docid","_index":"prod_results_en","_type":"result"}],
+			"max_query_terms":25,"min_doc_freq":2,"min_term_freq":1,"minimum_should_match":"30%"}},
+		"must_not":[
+			{"term":{"mdb_uid":"unit1"}},
+			{"terms":{"typed_uids":["collection:coll1"]}},
+			{"terms":{"mdb_uid":["coll1"]}}],
+		"should":[
+			{"terms":{"boost":3,"filter_values":["source:src1"]}},
+			{"terms":{"boost":1.5,"filter_values":["tag:tag1"]}}]}}`, string(b))
+}
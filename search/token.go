@@ -14,11 +14,21 @@ import (
 
 var debugSpan = 0
 
+// LRU cache of phrases tokens by language, see MakeTokensFromPhrase.
+// Entries tokenized by MakeTokensFromPhrase keep the analyzed tokens to be saved in snapshot, see tokens_cache.go.
 type TokensCache struct {
 	entries map[string]map[string]*list.Element
 	order   *list.List
 	mux     *sync.Mutex
 	limit   int
+
+	hits      int64
+	misses    int64
+	evictions int64
+
+	snapshotPath   string
+	snapshotTicker *time.Ticker
+	done           chan bool
 }
 
 func MakeTokensCache(size int) *TokensCache {
@@ -31,9 +41,10 @@ func MakeTokensCache(size int) *TokensCache {
 }
 
 type TokensCacheElement struct {
-	Phrase string
-	Lang   string
-	Tokens []*TokenNode
+	Phrase   string
+	Lang     string
+	Tokens   []*TokenNode
+	Analyzed []Token
 }
 
 func (tc *TokensCache) Has(phrase string, lang string) bool {
@@ -47,44 +58,57 @@ func (tc *TokensCache) Has(phrase string, lang string) bool {
 }
 
 func (tc *TokensCache) Get(phrase string, lang string) []*TokenNode {
+	tokens, _ := tc.Lookup(phrase, lang)
+	return tokens
+}
+
+// Same as Get, also tells whether the phrase was found. Counted in hits and misses stats.
+func (tc *TokensCache) Lookup(phrase string, lang string) ([]*TokenNode, bool) {
 	tc.mux.Lock()
 	defer tc.mux.Unlock()
 	if _, ok := tc.entries[phrase]; ok {
 		if element, okLang := tc.entries[phrase][lang]; okLang {
 			tc.order.MoveToFront(element)
-			return element.Value.(*TokensCacheElement).Tokens
+			tc.hits++
+			return element.Value.(*TokensCacheElement).Tokens, true
 		}
 	}
-	return nil
+	tc.misses++
+	return nil, false
 }
 
 func (tc *TokensCache) Set(phrase string, lang string, tokens []*TokenNode) {
+	tc.set(&TokensCacheElement{phrase, lang, tokens, nil})
+}
+
+func (tc *TokensCache) set(value *TokensCacheElement) {
 	tc.mux.Lock()
 	defer tc.mux.Unlock()
+	phrase, lang := value.Phrase, value.Lang
 	exist := false
 	if _, exist = tc.entries[phrase]; exist {
 		if element, exist := tc.entries[phrase][lang]; exist {
 			// If keys exist, just make the emement fresh
 			tc.order.MoveToFront(element)
-			element.Value = &TokensCacheElement{phrase, lang, tokens}
+			element.Value = value
+			return
 		}
 	}
-	if !exist {
-		if len(tc.entries) >= tc.limit {
-			// Throw last used element.
-			element := tc.order.Remove(tc.order.Back()).(*TokensCacheElement)
-			phraseEntries := tc.entries[element.Phrase]
-			delete(phraseEntries, element.Lang)
-			if len(phraseEntries) == 0 {
-				delete(tc.entries, element.Phrase)
-			}
+	if tc.order.Len() >= tc.limit {
+		// Throw last used element.
+		element := tc.order.Remove(tc.order.Back()).(*TokensCacheElement)
+		phraseEntries := tc.entries[element.Phrase]
+		delete(phraseEntries, element.Lang)
+		if len(phraseEntries) == 0 {
+			delete(tc.entries, element.Phrase)
 		}
-		// Add new element.
-		if _, ok := tc.entries[phrase]; !ok {
-			tc.entries[phrase] = make(map[string]*list.Element)
-		}
-		tc.entries[phrase][lang] = tc.order.PushFront(&TokensCacheElement{phrase, lang, tokens})
+		tc.evictions++
+	}
+	// Add new element.
+	if _, ok := tc.entries[phrase]; !ok {
+		tc.entries[phrase] = make(map[string]*list.Element)
 	}
+	tc.entries[phrase][lang] = tc.order.PushFront(value)
 }
 
 func TokenNodesToString(root []*TokenNode, variables map[string]*Variable) string {
@@ -8,7 +8,9 @@ import (
 	"sort"
 	"strings"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
+	"github.com/spf13/viper"
 	"gopkg.in/olivere/elastic.v6"
 
 	"github.com/Bnei-Baruch/archive-backend/consts"
@@ -115,21 +117,47 @@ func (otn *OriginalTokenNode) OriginalVariablePrefixToString() string {
 }
 
 func MakeTokensFromPhrase(phrase string, lang string, esc *elastic.Client, tc *TokensCache) ([]*TokenNode, error) {
-	if tc != nil && tc.Has(phrase, lang) {
-		return tc.Get(phrase, lang), nil
+	if tc != nil {
+		if tokens, ok := tc.Lookup(phrase, lang); ok {
+			return tokens, nil
+		}
 	}
-	index := es.IndexNameForServing("prod", consts.ES_RESULTS_INDEX, lang)
-	tokens, err := MakeTokensFromPhraseIndex(phrase, lang, esc, index, context.TODO())
+	analyzed, err := analyzePhrase(phrase, lang, esc)
 	if err != nil {
 		return nil, err
 	}
+	tokens := makeTokenForest(analyzed, phrase)
 	if tc != nil {
-		tc.Set(phrase, lang, tokens)
+		tc.set(&TokensCacheElement{phrase, lang, tokens, analyzed})
 	}
 	return tokens, nil
 }
 
+func analyzePhrase(phrase string, lang string, esc *elastic.Client) ([]Token, error) {
+	analyzer, err := GetLocalAnalyzer(lang)
+	if err != nil {
+		log.Errorf("Local analyzer of %s failed, analyzing with Elastic: %+v", lang, err)
+	}
+	if analyzer != nil && !viper.GetBool("elasticsearch.analyze-with-es") {
+		// Main languages are analyzed locally, see LocalAnalyzer.
+		return analyzer.Analyze(phrase), nil
+	}
+	if esc == nil {
+		return nil, errors.Errorf("No elastic client to analyze [%s] in %s.", phrase, lang)
+	}
+	index := es.IndexNameForServing("prod", consts.ES_RESULTS_INDEX, lang)
+	return analyzePhraseIndex(phrase, lang, esc, index, context.TODO())
+}
+
 func MakeTokensFromPhraseIndex(phrase string, lang string, esc *elastic.Client, index string, ctx context.Context) ([]*TokenNode, error) {
+	tokens, err := analyzePhraseIndex(phrase, lang, esc, index, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return makeTokenForest(tokens, phrase), nil
+}
+
+func analyzePhraseIndex(phrase string, lang string, esc *elastic.Client, index string, ctx context.Context) ([]Token, error) {
 	// TODO: Skip Variables, don't analyze them.
 	encodedIndex := url.QueryEscape(index)
 	res, err := esc.PerformRequest(ctx, elastic.PerformRequestOptions{
@@ -154,8 +182,7 @@ func MakeTokensFromPhraseIndex(phrase string, lang string, esc *elastic.Client,
 		return nil, errors.Wrapf(err, "Error unmarshling analyze body while analyzing [%s] in %s with analyzer %s, index [%s]",
 			phrase, lang, consts.ANALYZERS[lang], index)
 	}
-	tokenNodes := makeTokenForest(tokens.Tokens, phrase)
-	return tokenNodes, nil
+	return tokens.Tokens, nil
 }
 
 func makeTokenForest(tokens []Token, phrase string) []*TokenNode {
@@ -0,0 +1,182 @@
+package search
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/utils"
+)
+
+// Returned in search debug output (deb=true) and logged on shutdown.
+type TokensCacheStats struct {
+	Size      int     `json:"size"`
+	Limit     int     `json:"limit"`
+	Hits      int64   `json:"hits"`
+	Misses    int64   `json:"misses"`
+	Evictions int64   `json:"evictions"`
+	HitRate   float64 `json:"hit_rate"`
+}
+
+func (tc *TokensCache) Stats() TokensCacheStats {
+	tc.mux.Lock()
+	defer tc.mux.Unlock()
+	stats := TokensCacheStats{
+		Size:      tc.order.Len(),
+		Limit:     tc.limit,
+		Hits:      tc.hits,
+		Misses:    tc.misses,
+		Evictions: tc.evictions,
+	}
+	if stats.Hits+stats.Misses > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(stats.Hits+stats.Misses)
+	}
+	return stats
+}
+
+type tokensCacheSnapshotEntry struct {
+	Phrase string  `json:"phrase"`
+	Lang   string  `json:"lang"`
+	Tokens []Token `json:"tokens"`
+}
+
+// Analyzed tokens are saved and not the token nodes, the nodes are rebuilt on load.
+type tokensCacheSnapshot struct {
+	Saved   time.Time                  `json:"saved"`
+	Entries []tokensCacheSnapshotEntry `json:"entries"`
+}
+
+// Saves entries tokenized by MakeTokensFromPhrase, least recently used first.
+func (tc *TokensCache) SaveSnapshot(path string) error {
+	snapshot := tokensCacheSnapshot{Saved: time.Now(), Entries: []tokensCacheSnapshotEntry{}}
+	tc.mux.Lock()
+	for element := tc.order.Back(); element != nil; element = element.Prev() {
+		value := element.Value.(*TokensCacheElement)
+		if value.Analyzed != nil {
+			snapshot.Entries = append(snapshot.Entries, tokensCacheSnapshotEntry{value.Phrase, value.Lang, value.Analyzed})
+		}
+	}
+	tc.mux.Unlock()
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return errors.Wrap(err, "Marshal tokens cache snapshot")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrapf(err, "Create tokens cache snapshot folder %s", path)
+	}
+	// Write and rename, not to leave partial snapshot when interrupted.
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrapf(err, "Write tokens cache snapshot %s", tmp)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return errors.Wrapf(err, "Rename tokens cache snapshot %s", path)
+	}
+	log.Infof("Tokens cache: %d entries saved to %s.", len(snapshot.Entries), path)
+	return nil
+}
+
+// Loads entries saved by SaveSnapshot. Missing snapshot or snapshot older than |maxAge| (when positive)
+// are skipped, as analyzers and synonyms may have changed since. Returns number of loaded entries.
+func (tc *TokensCache) LoadSnapshot(path string, maxAge time.Duration) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.Wrapf(err, "Read tokens cache snapshot %s", path)
+	}
+	snapshot := tokensCacheSnapshot{}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return 0, errors.Wrapf(err, "Unmarshal tokens cache snapshot %s", path)
+	}
+	if maxAge > 0 && time.Since(snapshot.Saved) > maxAge {
+		log.Infof("Tokens cache: skipping snapshot %s saved at %s.", path, snapshot.Saved)
+		return 0, nil
+	}
+	for _, entry := range snapshot.Entries {
+		tc.set(&TokensCacheElement{entry.Phrase, entry.Lang, makeTokenForest(entry.Tokens, entry.Phrase), entry.Tokens})
+	}
+	log.Infof("Tokens cache: %d entries loaded from %s.", len(snapshot.Entries), path)
+	return len(snapshot.Entries), nil
+}
+
+// Tokenizes the most frequent queries of weighted queries files (Query,Language,Weight csv) matching |glob|,
+// up to the cache limit. Queries already in cache are skipped, warm up does not count in stats.
+// Queries failing to tokenize are logged and skipped.
+// Returns number of tokenized queries.
+func (tc *TokensCache) WarmUp(glob string, esc *elastic.Client) (int, error) {
+	querySets, err := ReadEvalSets(glob)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Read warm up queries %s", glob)
+	}
+	queries := []EvalQuery(nil)
+	for _, querySet := range querySets {
+		queries = append(queries, querySet...)
+	}
+	sort.SliceStable(queries, func(i, j int) bool {
+		return queries[i].Weight > queries[j].Weight
+	})
+	if len(queries) > tc.limit {
+		queries = queries[:tc.limit]
+	}
+	count := 0
+	for _, q := range queries {
+		if q.Query == "" || tc.Has(q.Query, q.Language) {
+			continue
+		}
+		analyzed, err := analyzePhrase(q.Query, q.Language, esc)
+		if err != nil {
+			log.Warnf("TokensCache.WarmUp - Skipping query [%s] in %s: %+v", q.Query, q.Language, err)
+			continue
+		}
+		tc.set(&TokensCacheElement{q.Query, q.Language, makeTokenForest(analyzed, q.Query), analyzed})
+		count++
+	}
+	return count, nil
+}
+
+// Saves snapshot to |path| every |interval| (when positive) and on Close.
+func (tc *TokensCache) Persist(path string, interval time.Duration) {
+	tc.snapshotPath = path
+	if interval <= 0 {
+		return
+	}
+	tc.snapshotTicker = time.NewTicker(interval)
+	tc.done = make(chan bool)
+	go func() {
+		for {
+			select {
+			case <-tc.done:
+				return
+			case <-tc.snapshotTicker.C:
+				if err := tc.SaveSnapshot(tc.snapshotPath); err != nil {
+					log.Errorf("Tokens cache snapshot: %s", err.Error())
+					utils.LogError(err)
+				}
+			}
+		}
+	}()
+}
+
+func (tc *TokensCache) Close() {
+	if tc == nil {
+		return
+	}
+	if tc.snapshotTicker != nil {
+		tc.snapshotTicker.Stop()
+		close(tc.done)
+	}
+	log.Infof("Tokens cache stats: %+v", tc.Stats())
+	if tc.snapshotPath != "" {
+		if err := tc.SaveSnapshot(tc.snapshotPath); err != nil {
+			log.Errorf("Tokens cache snapshot: %s", err.Error())
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package search
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+)
+
+type TokensCacheSuite struct {
+	suite.Suite
+	dir string
+}
+
+func TestTokensCache(t *testing.T) {
+	suite.Run(t, new(TokensCacheSuite))
+}
+
+func (suite *TokensCacheSuite) SetupSuite() {
+	r := suite.Require()
+	analyzer, err := makeLocalAnalyzer(consts.LANG_ENGLISH, "../data/es/synonyms", nil)
+	r.Nil(err)
+	localAnalyzersMutex.Lock()
+	localAnalyzers[consts.LANG_ENGLISH] = analyzer
+	localAnalyzersMutex.Unlock()
+}
+
+func (suite *TokensCacheSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "tokens_cache")
+	suite.Require().Nil(err)
+	suite.dir = dir
+}
+
+func (suite *TokensCacheSuite) TearDownTest() {
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *TokensCacheSuite) tokenize(tc *TokensCache, phrase string) {
+	_, err := MakeTokensFromPhrase(phrase, consts.LANG_ENGLISH, nil, tc)
+	suite.Require().Nil(err)
+}
+
+func (suite *TokensCacheSuite) TestStats() {
+	r := suite.Require()
+	tc := MakeTokensCache(2)
+	suite.tokenize(tc, "zohar")
+	suite.tokenize(tc, "zohar")
+	suite.tokenize(tc, "new life")
+	r.Equal(TokensCacheStats{Size: 2, Limit: 2, Hits: 1, Misses: 2, HitRate: 1.0 / 3}, tc.Stats())
+	suite.tokenize(tc, "shamati")
+	r.False(tc.Has("zohar", consts.LANG_ENGLISH))
+	r.Equal(int64(1), tc.Stats().Evictions)
+	// Same phrase in another language is a separate entry.
+	tc.Set("shamati", consts.LANG_HEBREW, nil)
+	r.True(tc.Has("shamati", consts.LANG_ENGLISH))
+	r.True(tc.Has("shamati", consts.LANG_HEBREW))
+	r.Equal(2, tc.Stats().Size)
+}
+
+func (suite *TokensCacheSuite) TestSnapshot() {
+	r := suite.Require()
+	path := filepath.Join(suite.dir, "cache", "tokens.json")
+	tc := MakeTokensCache(10)
+	suite.tokenize(tc, "zohar")
+	suite.tokenize(tc, "new life")
+	// Set directly, without analyzed tokens, is not saved.
+	tc.Set("shamati", consts.LANG_ENGLISH, nil)
+	r.Nil(tc.SaveSnapshot(path))
+
+	loaded := MakeTokensCache(10)
+	count, err := loaded.LoadSnapshot(path, time.Hour)
+	r.Nil(err)
+	r.Equal(2, count)
+	r.False(loaded.Has("shamati", consts.LANG_ENGLISH))
+	expected, _ := tc.Lookup("new life", consts.LANG_ENGLISH)
+	tokens, ok := loaded.Lookup("new life", consts.LANG_ENGLISH)
+	r.True(ok)
+	r.Equal(TokenNodesToString(expected, nil), TokenNodesToString(tokens, nil))
+
+	// Recently used entries are kept.
+	small := MakeTokensCache(1)
+	count, err = small.LoadSnapshot(path, 0)
+	r.Nil(err)
+	r.Equal(2, count)
+	r.True(small.Has("new life", consts.LANG_ENGLISH))
+
+	// Old and missing snapshots are skipped.
+	count, err = MakeTokensCache(10).LoadSnapshot(path, time.Nanosecond)
+	r.Nil(err)
+	r.Equal(0, count)
+	count, err = MakeTokensCache(10).LoadSnapshot(filepath.Join(suite.dir, "missing.json"), 0)
+	r.Nil(err)
+	r.Equal(0, count)
+}
+
+func (suite *TokensCacheSuite) TestWarmUp() {
+	r := suite.Require()
+	queries := "Query,Language,Weight\nzohar,en,199\nnew life,en,172\nshamati,en,145\n"
+	r.Nil(ioutil.WriteFile(filepath.Join(suite.dir, "en.weighted_queries.csv"), []byte(queries), 0644))
+	tc := MakeTokensCache(2)
+	count, err := tc.WarmUp(filepath.Join(suite.dir, "*.weighted_queries.csv"), nil)
+	r.Nil(err)
+	r.Equal(2, count)
+	r.True(tc.Has("zohar", consts.LANG_ENGLISH))
+	r.True(tc.Has("new life", consts.LANG_ENGLISH))
+	r.False(tc.Has("shamati", consts.LANG_ENGLISH))
+	r.Equal(TokensCacheStats{Size: 2, Limit: 2}, tc.Stats())
+
+	// Queries failing to tokenize are skipped, without elastic German is not analyzed.
+	queries = "Query,Language,Weight\nzohar,de,199\nnew life,en,172\n"
+	r.Nil(ioutil.WriteFile(filepath.Join(suite.dir, "en.weighted_queries.csv"), []byte(queries), 0644))
+	tc = MakeTokensCache(2)
+	count, err = tc.WarmUp(filepath.Join(suite.dir, "*.weighted_queries.csv"), nil)
+	r.Nil(err)
+	r.Equal(1, count)
+	r.False(tc.Has("zohar", consts.LANG_GERMAN))
+	r.True(tc.Has("new life", consts.LANG_ENGLISH))
+}
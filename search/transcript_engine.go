@@ -0,0 +1,322 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+)
+
+const (
+	TRANSCRIPT_HIGHLIGHT_PRE_TAG  = "<em>"
+	TRANSCRIPT_HIGHLIGHT_POST_TAG = "</em>"
+)
+
+// Span of runes inside a paragraph.
+type TranscriptSpan struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+type TranscriptParagraph struct {
+	// Index of the paragraph in the transcript (empty lines are not counted).
+	Index     int              `json:"index"`
+	Text      string           `json:"text"`
+	Highlight string           `json:"highlight"`
+	Spans     []TranscriptSpan `json:"spans"`
+}
+
+type TranscriptSearchResult struct {
+	Language   string                 `json:"language"`
+	Paragraphs []*TranscriptParagraph `json:"paragraphs"`
+}
+
+// Returns the language tokens (stems) of each of the words.
+// Words without tokens (e.g., stopwords) may be missing from the result.
+type wordsAnalyzer func(words []string) (map[string][]string, error)
+
+type transcriptWord struct {
+	word  string // Lower case.
+	start int
+	end   int
+}
+
+func isTranscriptWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+func splitParagraphs(text string) []string {
+	paragraphs := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			paragraphs = append(paragraphs, line)
+		}
+	}
+	return paragraphs
+}
+
+// Splits lower cased runes into words with their rune offsets.
+func splitWords(lower []rune) []transcriptWord {
+	words := []transcriptWord{}
+	start := -1
+	for i := 0; i <= len(lower); i++ {
+		if i < len(lower) && isTranscriptWordRune(lower[i]) {
+			if start == -1 {
+				start = i
+			}
+		} else if start != -1 {
+			words = append(words, transcriptWord{string(lower[start:i]), start, i})
+			start = -1
+		}
+	}
+	return words
+}
+
+func toLowerRunes(s string) []rune {
+	runes := []rune(s)
+	for i := range runes {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return runes
+}
+
+// Returns all occurrences of phrase (lower cased) in text (lower cased), on words boundaries.
+func findPhrase(lower []rune, phrase []rune) []TranscriptSpan {
+	spans := []TranscriptSpan{}
+	if len(phrase) == 0 {
+		return spans
+	}
+	for i := 0; i+len(phrase) <= len(lower); i++ {
+		if string(lower[i:i+len(phrase)]) != string(phrase) {
+			continue
+		}
+		end := i + len(phrase)
+		if (i > 0 && isTranscriptWordRune(lower[i-1]) && isTranscriptWordRune(phrase[0])) ||
+			(end < len(lower) && isTranscriptWordRune(lower[end]) && isTranscriptWordRune(phrase[len(phrase)-1])) {
+			continue
+		}
+		spans = append(spans, TranscriptSpan{i, end})
+	}
+	return spans
+}
+
+func mergeSpans(spans []TranscriptSpan) []TranscriptSpan {
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].Start < spans[j].Start || (spans[i].Start == spans[j].Start && spans[i].End < spans[j].End)
+	})
+	merged := []TranscriptSpan{}
+	for _, span := range spans {
+		if len(merged) > 0 && span.Start <= merged[len(merged)-1].End {
+			if span.End > merged[len(merged)-1].End {
+				merged[len(merged)-1].End = span.End
+			}
+		} else {
+			merged = append(merged, span)
+		}
+	}
+	return merged
+}
+
+// Transcript text is escaped, only highlight tags are markup.
+func highlightSpans(runes []rune, spans []TranscriptSpan) string {
+	var b strings.Builder
+	last := 0
+	for _, span := range spans {
+		b.WriteString(html.EscapeString(string(runes[last:span.Start])))
+		b.WriteString(TRANSCRIPT_HIGHLIGHT_PRE_TAG)
+		b.WriteString(html.EscapeString(string(runes[span.Start:span.End])))
+		b.WriteString(TRANSCRIPT_HIGHLIGHT_POST_TAG)
+		last = span.End
+	}
+	b.WriteString(html.EscapeString(string(runes[last:])))
+	return b.String()
+}
+
+// Returns the paragraphs of the text matching the query.
+// A paragraph matches when it contains all the exact terms of the query and all
+// the words of the query term (compared by their analyzed tokens, i.e., stemmed).
+func searchTranscript(text string, query Query, analyze wordsAnalyzer) ([]*TranscriptParagraph, error) {
+	paragraphs := splitParagraphs(text)
+
+	phrases := [][]rune{}
+	for _, exactTerm := range query.ExactTerms {
+		if phrase := toLowerRunes(strings.TrimSpace(exactTerm)); len(phrase) > 0 {
+			phrases = append(phrases, phrase)
+		}
+	}
+	queryWords := splitWords(toLowerRunes(query.Term))
+
+	paragraphsLower := make([][]rune, len(paragraphs))
+	paragraphsWords := make([][]transcriptWord, len(paragraphs))
+	var stems map[string][]string
+	if len(queryWords) > 0 {
+		unique := make(map[string]bool)
+		words := []string{}
+		addWord := func(w string) {
+			if !unique[w] {
+				unique[w] = true
+				words = append(words, w)
+			}
+		}
+		for _, w := range queryWords {
+			addWord(w.word)
+		}
+		for i, p := range paragraphs {
+			paragraphsLower[i] = toLowerRunes(p)
+			paragraphsWords[i] = splitWords(paragraphsLower[i])
+			for _, w := range paragraphsWords[i] {
+				addWord(w.word)
+			}
+		}
+		var err error
+		if stems, err = analyze(words); err != nil {
+			return nil, err
+		}
+	} else {
+		for i, p := range paragraphs {
+			paragraphsLower[i] = toLowerRunes(p)
+		}
+	}
+
+	// Query words without tokens (stopwords) are ignored.
+	queryStems := []map[string]bool{}
+	for _, w := range queryWords {
+		if tokens := stems[w.word]; len(tokens) > 0 {
+			set := make(map[string]bool)
+			for _, t := range tokens {
+				set[t] = true
+			}
+			queryStems = append(queryStems, set)
+		}
+	}
+	if len(phrases) == 0 && len(queryStems) == 0 {
+		return []*TranscriptParagraph{}, nil
+	}
+
+	ret := []*TranscriptParagraph{}
+	for i, p := range paragraphs {
+		spans := []TranscriptSpan{}
+		matched := true
+		for _, phrase := range phrases {
+			phraseSpans := findPhrase(paragraphsLower[i], phrase)
+			if len(phraseSpans) == 0 {
+				matched = false
+				break
+			}
+			spans = append(spans, phraseSpans...)
+		}
+		for j := 0; matched && j < len(queryStems); j++ {
+			found := false
+			for _, w := range paragraphsWords[i] {
+				for _, t := range stems[w.word] {
+					if queryStems[j][t] {
+						found = true
+						spans = append(spans, TranscriptSpan{w.start, w.end})
+						break
+					}
+				}
+			}
+			matched = found
+		}
+		if !matched {
+			continue
+		}
+		spans = mergeSpans(spans)
+		ret = append(ret, &TranscriptParagraph{
+			Index:     i,
+			Text:      p,
+			Highlight: highlightSpans([]rune(p), spans),
+			Spans:     spans,
+		})
+	}
+	return ret, nil
+}
+
+// Splits words to batches bounded by number of words and by text length (UTF-16 code units, new line separated).
+func analyzeBatches(words []string, maxWords int, maxLength int) [][]string {
+	batches := [][]string{}
+	start := 0
+	length := 0
+	for i, w := range words {
+		wordLength := len(utf16.Encode([]rune(w))) + 1
+		if i > start && (i-start == maxWords || length+wordLength > maxLength) {
+			batches = append(batches, words[start:i])
+			start = i
+			length = 0
+		}
+		length += wordLength
+	}
+	if start < len(words) {
+		batches = append(batches, words[start:])
+	}
+	return batches
+}
+
+// Analyzes words with the language analyzer of the results index.
+// Words are analyzed in batches, each batch with single request.
+func (e *ESEngine) analyzeWords(ctx context.Context, language string) wordsAnalyzer {
+	return func(words []string) (map[string][]string, error) {
+		index := es.IndexNameForServing("prod", consts.ES_RESULTS_INDEX, language)
+		ret := make(map[string][]string)
+		for _, batch := range analyzeBatches(words, consts.TRANSCRIPT_ANALYZE_WORDS_BATCH, consts.TRANSCRIPT_ANALYZE_TEXT_BATCH) {
+			// Elastic offsets are in UTF-16 code units.
+			starts := make([]int, len(batch))
+			offset := 0
+			for i, w := range batch {
+				starts[i] = offset
+				offset += len(utf16.Encode([]rune(w))) + 1
+			}
+			res, err := e.esc.PerformRequest(ctx, elastic.PerformRequestOptions{
+				Method: "GET",
+				Path:   fmt.Sprintf("/%s/_analyze", url.QueryEscape(index)),
+				Body: struct {
+					Text     string `json:"text"`
+					Analyzer string `json:"analyzer"`
+				}{
+					Text:     strings.Join(batch, "\n"),
+					Analyzer: consts.ANALYZERS[language],
+				},
+			})
+			if err != nil {
+				return nil, errors.Wrapf(err, "ESEngine.analyzeWords - Error analyzing words in %s with analyzer %s.", language, consts.ANALYZERS[language])
+			}
+			tokens := struct {
+				Tokens []Token `json:"tokens"`
+			}{Tokens: []Token{}}
+			if err = json.Unmarshal(res.Body, &tokens); err != nil {
+				return nil, errors.Wrap(err, "ESEngine.analyzeWords - Error unmarshling analyze body.")
+			}
+			for _, t := range tokens.Tokens {
+				// Index of the last word starting before the token.
+				i := sort.Search(len(starts), func(i int) bool { return starts[i] > t.StartOffset }) - 1
+				if i >= 0 {
+					ret[batch[i]] = append(ret[batch[i]], t.Token)
+				}
+			}
+		}
+		return ret, nil
+	}
+}
+
+// Searches the query in the given transcript text.
+func (e *ESEngine) SearchTranscript(ctx context.Context, text string, query Query, language string) (*TranscriptSearchResult, error) {
+	defer e.timeTrack(time.Now(), consts.LAT_SEARCH_TRANSCRIPT)
+
+	paragraphs, err := searchTranscript(text, query, e.analyzeWords(ctx, language))
+	if err != nil {
+		return nil, err
+	}
+	return &TranscriptSearchResult{Language: language, Paragraphs: paragraphs}, nil
+}
@@ -0,0 +1,75 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type TranscriptSuite struct {
+	suite.Suite
+}
+
+func TestTranscript(t *testing.T) {
+	suite.Run(t, new(TranscriptSuite))
+}
+
+// Simple analyzer that removes the "s" suffix and drops "the" as a stopword.
+func fakeWordsAnalyzer(words []string) (map[string][]string, error) {
+	ret := make(map[string][]string)
+	for _, w := range words {
+		if w != "the" {
+			ret[w] = []string{strings.TrimSuffix(w, "s")}
+		}
+	}
+	return ret, nil
+}
+
+func (suite *TranscriptSuite) TestSearchTranscript() {
+	r := require.New(suite.T())
+	text := "First paragraph about the Light.\n\n  Lights and vessels.\nThe vessel of light is here.\nNothing here.\n"
+
+	paragraphs, err := searchTranscript(text, ParseQuery("the light"), fakeWordsAnalyzer)
+	r.Nil(err)
+	r.Equal(3, len(paragraphs))
+	r.Equal(0, paragraphs[0].Index)
+	r.Equal("First paragraph about the <em>Light</em>.", paragraphs[0].Highlight)
+	r.Equal(1, paragraphs[1].Index)
+	r.Equal("<em>Lights</em> and vessels.", paragraphs[1].Highlight)
+	r.Equal([]TranscriptSpan{{0, 6}}, paragraphs[1].Spans)
+	r.Equal(2, paragraphs[2].Index)
+
+	paragraphs, err = searchTranscript(text, ParseQuery("\"vessel of light\""), fakeWordsAnalyzer)
+	r.Nil(err)
+	r.Equal(1, len(paragraphs))
+	r.Equal(2, paragraphs[0].Index)
+	r.Equal("The <em>vessel of light</em> is here.", paragraphs[0].Highlight)
+
+	paragraphs, err = searchTranscript(text, ParseQuery("vessels \"here\""), fakeWordsAnalyzer)
+	r.Nil(err)
+	r.Equal(1, len(paragraphs))
+	r.Equal("The <em>vessel</em> of light is <em>here</em>.", paragraphs[0].Highlight)
+
+	paragraphs, err = searchTranscript(text, ParseQuery("the"), fakeWordsAnalyzer)
+	r.Nil(err)
+	r.Equal(0, len(paragraphs))
+
+	// Text is escaped, only highlight is markup.
+	paragraphs, err = searchTranscript("<b>Light</b> & vessels", ParseQuery("light"), fakeWordsAnalyzer)
+	r.Nil(err)
+	r.Equal(1, len(paragraphs))
+	r.Equal("&lt;b&gt;<em>Light</em>&lt;/b&gt; &amp; vessels", paragraphs[0].Highlight)
+}
+
+func (suite *TranscriptSuite) TestAnalyzeBatches() {
+	r := require.New(suite.T())
+	r.Equal([][]string{}, analyzeBatches(nil, 2, 100))
+	words := []string{"a", "bb", "ccc", "dddd", "אור"}
+	r.Equal([][]string{{"a", "bb"}, {"ccc", "dddd"}, {"אור"}}, analyzeBatches(words, 2, 100))
+	// Length includes new line separator: a (2) + bb (3) + ccc (4) > 6.
+	r.Equal([][]string{{"a", "bb"}, {"ccc"}, {"dddd"}, {"אור"}}, analyzeBatches(words, 10, 6))
+	// Word longer than the limit gets its own batch.
+	r.Equal([][]string{{"a"}, {"dddd"}, {"bb"}}, analyzeBatches([]string{"a", "dddd", "bb"}, 10, 3))
+}
@@ -0,0 +1,346 @@
+package search
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/utils"
+)
+
+const (
+	TRANSLITERATION_FILE_SUFFIX = "terms"
+
+	SCRIPT_LATIN    = "latin"
+	SCRIPT_HEBREW   = "hebrew"
+	SCRIPT_CYRILLIC = "cyrillic"
+)
+
+// Languages written in Cyrillic, Hebrew is the only language written in Hebrew script.
+var CYRILLIC_LANGS = []string{consts.LANG_RUSSIAN, consts.LANG_UKRAINIAN, consts.LANG_BULGARIAN, consts.LANG_MACEDONIAN}
+
+// Languages written in neither of the supported scripts.
+var NON_TRANSLITERATED_LANGS = []string{
+	consts.LANG_ARABIC, consts.LANG_PERSIAN, consts.LANG_HINDI, consts.LANG_GEORGIAN, consts.LANG_ARMENIAN,
+	consts.LANG_AMHARIC, consts.LANG_GREEK, consts.LANG_JAPANESE, consts.LANG_CHINESE,
+}
+
+// Ordered by length, longer sequences are matched first.
+var LATIN_TO_CYRILLIC = [][2]string{
+	{"shch", "щ"}, {"tch", "ч"},
+	{"sh", "ш"}, {"ch", "х"}, {"kh", "х"}, {"tz", "ц"}, {"ts", "ц"}, {"zh", "ж"},
+	{"ya", "я"}, {"yu", "ю"}, {"ye", "е"}, {"yo", "йо"},
+	{"a", "а"}, {"b", "б"}, {"c", "к"}, {"d", "д"}, {"e", "е"}, {"f", "ф"}, {"g", "г"}, {"h", "х"},
+	{"i", "и"}, {"j", "дж"}, {"k", "к"}, {"l", "л"}, {"m", "м"}, {"n", "н"}, {"o", "о"}, {"p", "п"},
+	{"q", "к"}, {"r", "р"}, {"s", "с"}, {"t", "т"}, {"u", "у"}, {"v", "в"}, {"w", "в"}, {"x", "кс"},
+	{"y", "й"}, {"z", "з"},
+}
+
+var CYRILLIC_TO_LATIN = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh", 'з': "z", 'и': "i",
+	'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+	'у': "u", 'ф': "f", 'х': "ch", 'ц': "tz", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "",
+	'э': "e", 'ю': "yu", 'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g",
+}
+
+// Consonants, vowels are handled separately as Hebrew spelling omits most of them.
+var LATIN_TO_HEBREW = [][2]string{
+	{"sh", "ש"}, {"ch", "ח"}, {"kh", "כ"}, {"tz", "צ"}, {"ts", "צ"}, {"th", "ת"}, {"ph", "פ"},
+	{"b", "ב"}, {"c", "ק"}, {"d", "ד"}, {"f", "פ"}, {"g", "ג"}, {"h", "ה"}, {"j", "ג"}, {"k", "ק"},
+	{"l", "ל"}, {"m", "מ"}, {"n", "נ"}, {"p", "פ"}, {"q", "ק"}, {"r", "ר"}, {"s", "ס"}, {"t", "ת"},
+	{"v", "ב"}, {"w", "ו"}, {"x", "קס"}, {"y", "י"}, {"z", "ז"},
+}
+
+var HEBREW_FINAL_LETTERS = map[rune]rune{'כ': 'ך', 'מ': 'ם', 'נ': 'ן', 'פ': 'ף', 'צ': 'ץ'}
+
+// Generates forms of the query in other scripts (Hebrew, Latin, Cyrillic), for queries with terms from a
+// curated list, the rest of the tokens of such queries are transliterated by rules.
+// Hebrew is not transliterated by rules (no vowels), only by the curated terms.
+type Transliterator struct {
+	// Normalized form => forms by script.
+	terms map[string]map[string]string
+	// Longest term, in tokens.
+	maxTokens int
+}
+
+// Loads curated terms from *.terms files, see data/search/transliteration.
+func MakeTransliterator(dir string) (*Transliterator, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, fmt.Sprintf("*.%s", TRANSLITERATION_FILE_SUFFIX)))
+	if err != nil {
+		return nil, errors.Wrap(err, "MakeTransliterator")
+	}
+	t := &Transliterator{terms: make(map[string]map[string]string)}
+	for _, path := range matches {
+		if err := t.loadTerms(path); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *Transliterator) loadTerms(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "Transliterator.loadTerms - Error opening %s.", path)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := t.AddTerm(strings.Split(line, ",")...); err != nil {
+			return errors.Wrapf(err, "Transliterator.loadTerms - %s:%d.", path, lineNum)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrapf(err, "Transliterator.loadTerms - Error reading %s.", path)
+	}
+	return nil
+}
+
+// Adds group of equivalent forms, the first form of each script is the preferred one.
+func (t *Transliterator) AddTerm(forms ...string) error {
+	byScript := make(map[string]string)
+	normalized := []string{}
+	for _, form := range forms {
+		n := normalizeTransliterationText(form)
+		if n == "" {
+			continue
+		}
+		script := textScript(n)
+		if script == "" {
+			return errors.Errorf("Unsupported script of [%s].", form)
+		}
+		if _, ok := byScript[script]; !ok {
+			byScript[script] = n
+		}
+		normalized = append(normalized, n)
+	}
+	if len(byScript) < 2 {
+		return errors.Errorf("Expected forms in at least two scripts, got: %v.", forms)
+	}
+	for _, n := range normalized {
+		t.terms[n] = byScript
+		t.maxTokens = utils.MaxInt(t.maxTokens, len(strings.Fields(n)))
+	}
+	return nil
+}
+
+// Forms of the term in scripts of the languages (in order of preference), different from the term itself.
+// Only terms with at least one curated term are transliterated, rules alone add too many noisy matches.
+func (t *Transliterator) Transliterate(term string, langs []string) []string {
+	tokens := strings.Fields(normalizeTransliterationText(term))
+	if len(tokens) == 0 {
+		return nil
+	}
+	var ret []string
+	original := strings.Join(tokens, " ")
+	for _, script := range langsScripts(langs) {
+		alternative, curated := t.transliterateTokens(tokens, script)
+		if curated && alternative != original && !utils.StringInSlice(alternative, ret) {
+			ret = append(ret, alternative)
+		}
+	}
+	return ret
+}
+
+// Tokens in the script, curated terms first and the rest by rules. Returns whether any curated term was found.
+func (t *Transliterator) transliterateTokens(tokens []string, script string) (string, bool) {
+	parts := []string{}
+	curated := false
+	for i := 0; i < len(tokens); {
+		matched := false
+		// Longest curated term first.
+		for n := utils.MinInt(t.maxTokens, len(tokens)-i); n > 0; n-- {
+			phrase := strings.Join(tokens[i:i+n], " ")
+			if forms, ok := t.terms[phrase]; ok && textScript(phrase) != script {
+				if form, ok := forms[script]; ok {
+					parts = append(parts, form)
+					i += n
+					matched = true
+					curated = true
+					break
+				}
+			}
+		}
+		if !matched {
+			parts = append(parts, transliterateToken(tokens[i], script))
+			i++
+		}
+	}
+	return strings.Join(parts, " "), curated
+}
+
+func langsScripts(langs []string) []string {
+	ret := []string{}
+	for _, lang := range langs {
+		script := SCRIPT_LATIN
+		if lang == consts.LANG_HEBREW {
+			script = SCRIPT_HEBREW
+		} else if utils.StringInSlice(lang, CYRILLIC_LANGS) {
+			script = SCRIPT_CYRILLIC
+		} else if utils.StringInSlice(lang, NON_TRANSLITERATED_LANGS) {
+			continue
+		}
+		if !utils.StringInSlice(script, ret) {
+			ret = append(ret, script)
+		}
+	}
+	return ret
+}
+
+// Token transliterated by rules, as is when there are no rules from its script to the requested one.
+func transliterateToken(token string, script string) string {
+	from := textScript(token)
+	switch {
+	case from == script || from == "":
+		return token
+	case from == SCRIPT_LATIN && script == SCRIPT_CYRILLIC:
+		return replaceSequences(token, LATIN_TO_CYRILLIC)
+	case from == SCRIPT_LATIN && script == SCRIPT_HEBREW:
+		return latinToHebrew(token)
+	case from == SCRIPT_CYRILLIC && script == SCRIPT_LATIN:
+		return cyrillicToLatin(token)
+	case from == SCRIPT_CYRILLIC && script == SCRIPT_HEBREW:
+		return latinToHebrew(cyrillicToLatin(token))
+	}
+	return token
+}
+
+func replaceSequences(token string, table [][2]string) string {
+	var ret strings.Builder
+	for rest := token; rest != ""; {
+		matched := false
+		for _, r := range table {
+			if strings.HasPrefix(rest, r[0]) {
+				ret.WriteString(r[1])
+				rest = rest[len(r[0]):]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			_, size := utf8.DecodeRuneInString(rest)
+			ret.WriteString(rest[:size])
+			rest = rest[size:]
+		}
+	}
+	return ret.String()
+}
+
+func cyrillicToLatin(token string) string {
+	var ret strings.Builder
+	for _, r := range token {
+		if l, ok := CYRILLIC_TO_LATIN[r]; ok {
+			ret.WriteString(l)
+		} else {
+			ret.WriteRune(r)
+		}
+	}
+	return ret.String()
+}
+
+// Consonants by LATIN_TO_HEBREW, word initial vowel as א (with ו or י for o, u, i),
+// o, u as ו and i as י inside the word, final a (or ah, e) as ה, other vowels omitted.
+// Doubled consonants are written once and final letters are used at the end of the word.
+func latinToHebrew(token string) string {
+	var ret []rune
+	last := ""
+	for i := 0; i < len(token); {
+		rest := token[i:]
+		if isLatinVowel(rest[0]) {
+			v := rest[0]
+			end := i+1 == len(token) || (i+2 == len(token) && token[i+1] == 'h')
+			switch {
+			case i == 0:
+				ret = append(ret, 'א')
+				if v == 'o' || v == 'u' {
+					ret = append(ret, 'ו')
+				} else if v == 'i' {
+					ret = append(ret, 'י')
+				}
+			case end && (v == 'a' || v == 'e'):
+				ret = append(ret, 'ה')
+				i = len(token)
+				continue
+			case v == 'o' || v == 'u':
+				ret = append(ret, 'ו')
+			case v == 'i':
+				ret = append(ret, 'י')
+			}
+			last = ""
+			i++
+			continue
+		}
+		matched := false
+		for _, r := range LATIN_TO_HEBREW {
+			if strings.HasPrefix(rest, r[0]) {
+				if r[0] != last {
+					ret = append(ret, []rune(r[1])...)
+				}
+				last = r[0]
+				i += len(r[0])
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			r, size := utf8.DecodeRuneInString(rest)
+			ret = append(ret, r)
+			last = ""
+			i += size
+		}
+	}
+	if len(ret) > 0 {
+		if final, ok := HEBREW_FINAL_LETTERS[ret[len(ret)-1]]; ok {
+			ret[len(ret)-1] = final
+		}
+	}
+	return string(ret)
+}
+
+func isLatinVowel(b byte) bool {
+	return strings.IndexByte("aeiou", b) >= 0
+}
+
+// Script of the first letter of the text, empty for unsupported scripts.
+func textScript(text string) string {
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Hebrew, r):
+			return SCRIPT_HEBREW
+		case unicode.Is(unicode.Cyrillic, r):
+			return SCRIPT_CYRILLIC
+		case unicode.Is(unicode.Latin, r):
+			return SCRIPT_LATIN
+		case unicode.IsLetter(r):
+			return ""
+		}
+	}
+	return ""
+}
+
+// Lower case, without apostrophes (including Hebrew geresh and gershayim) and diacritics, other punctuation as spaces.
+func normalizeTransliterationText(text string) string {
+	mapped := strings.Map(func(r rune) rune {
+		switch {
+		case r == '\'' || r == '"' || r == '`' || r == '’' || r == '‘' || r == '׳' || r == '״' || unicode.Is(unicode.Mn, r):
+			return -1
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, text)
+	return strings.Join(strings.Fields(mapped), " ")
+}
@@ -0,0 +1,88 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+)
+
+type TransliterationSuite struct {
+	suite.Suite
+	transliterator *Transliterator
+}
+
+func TestTransliteration(t *testing.T) {
+	suite.Run(t, new(TransliterationSuite))
+}
+
+func (suite *TransliterationSuite) SetupTest() {
+	var err error
+	suite.transliterator, err = MakeTransliterator("../data/search/transliteration")
+	suite.Require().Nil(err)
+}
+
+func (suite *TransliterationSuite) TestCuratedTerms() {
+	r := suite.Require()
+	all := []string{consts.LANG_ENGLISH, consts.LANG_HEBREW, consts.LANG_RUSSIAN}
+	cases := []struct {
+		term     string
+		langs    []string
+		expected []string
+	}{
+		{"arvut", all, []string{"ערבות", "арвут"}},
+		{"Ohr Makif", all, []string{"אור מקיף", "ор макиф"}},
+		{"masach", all, []string{"מסך", "масах"}},
+		{"zohar la'am", all, []string{"זוהר לעם", "зоар ла ам"}},
+		{"шамати", all, []string{"shamati", "שמעתי"}},
+		{"מסך", all, []string{"masach", "масах"}},
+		// Only scripts of the requested languages.
+		{"arvut", []string{consts.LANG_HEBREW}, []string{"ערבות"}},
+		{"arvut", []string{consts.LANG_ENGLISH}, nil},
+		{"арвут", []string{consts.LANG_RUSSIAN, consts.LANG_ENGLISH}, []string{"arvut"}},
+	}
+	for _, c := range cases {
+		r.Equal(c.expected, suite.transliterator.Transliterate(c.term, c.langs), c.term)
+	}
+}
+
+func (suite *TransliterationSuite) TestRules() {
+	r := suite.Require()
+	all := []string{consts.LANG_ENGLISH, consts.LANG_HEBREW, consts.LANG_RUSSIAN}
+	// Curated and rule based tokens are mixed.
+	r.Equal([]string{"שמעתי גמר", "шамати гмар"}, suite.transliterator.Transliterate("shamati gmar", all))
+	r.Equal([]string{"shamati urok", "שמעתי אורוק"}, suite.transliterator.Transliterate("шамати урок", all))
+	// Terms without curated terms are not transliterated.
+	r.Empty(suite.transliterator.Transliterate("gmar", all))
+	r.Empty(suite.transliterator.Transliterate("урок", all))
+	r.Empty(suite.transliterator.Transliterate("daily lesson", all))
+	r.Empty(suite.transliterator.Transliterate("", all))
+}
+
+func (suite *TransliterationSuite) TestAddTerm() {
+	r := suite.Require()
+	r.NotNil(suite.transliterator.AddTerm("arvut", "arvus"))
+	r.Nil(suite.transliterator.AddTerm("צמצום", "tzimtzum", "цимцум"))
+	r.Equal([]string{"צמצום"}, suite.transliterator.Transliterate("tzimtzum", []string{consts.LANG_HEBREW}))
+}
+
+func (suite *TransliterationSuite) TestResultsQuery() {
+	r := suite.Require()
+	query := Query{
+		Term:             "arvut",
+		LanguageOrder:    []string{consts.LANG_HEBREW},
+		Transliterations: suite.transliterator.Transliterate("arvut", []string{consts.LANG_HEBREW}),
+	}
+	q, err := createResultsQuery([]string{consts.ES_RESULT_TYPE_UNITS}, query, nil, nil, false)
+	r.Nil(err)
+	source, err := q.Source()
+	r.Nil(err)
+	b, err := json.Marshal(source)
+	r.Nil(err)
+	r.Contains(string(b), `"query":"ערבות"`)
+	// Scored by a separate low boosted clause.
+	r.Contains(string(b), fmt.Sprintf(`"boost":%g`, TRANSLITERATION_BOOST))
+}
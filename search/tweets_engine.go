@@ -12,10 +12,26 @@ import (
 	"github.com/pkg/errors"
 )
 
-func (e *ESEngine) SearchTweets(query Query, sortBy string, from int, size int, preference string) (map[string]*elastic.SearchResult, error) {
-	tweetsByLang := make(map[string]*elastic.SearchResult)
+func (e *ESEngine) SearchTweets(ctx context.Context, query Query, sortBy string, from int, size int, preference string) (map[string]*elastic.SearchResult, error) {
+	requests, err := e.tweetsRequests(query, preference)
+	if err != nil {
+		return nil, err
+	}
 	mssTweets := e.esc.MultiSearch()
-	requests, err := NewResultsSearchRequests(
+	mssTweets.Add(requests...)
+
+	beforeTweetsSearch := time.Now()
+	mr, err := mssTweets.Do(ctx)
+	e.timeTrack(beforeTweetsSearch, consts.LAT_DOSEARCH_MULTISEARCHTWEETSDO)
+	if err != nil {
+		return nil, err
+	}
+	return e.tweetsFromResponses(query, mr.Responses)
+}
+
+// Tweets search requests, one for each language of the query.
+func (e *ESEngine) tweetsRequests(query Query, preference string) ([]*elastic.SearchRequest, error) {
+	return NewResultsSearchRequests(
 		// Inside the carousel, the tweets are always sorted by relevance.
 		//The EffectiveDate of the carousel itself will be equal to the EffectiveDate of the most relevant tweet.
 		SearchRequestOptions{
@@ -28,25 +44,17 @@ func (e *ESEngine) SearchTweets(query Query, sortBy string, from int, size int,
 			preference:       preference,
 			useHighlight:     false,
 			partialHighlight: false})
-	if err != nil {
-		return nil, err
-	}
-	mssTweets.Add(requests...)
-
-	beforeTweetsSearch := time.Now()
-	mr, err := mssTweets.Do(context.TODO())
-	e.timeTrack(beforeTweetsSearch, consts.LAT_DOSEARCH_MULTISEARCHTWEETSDO)
-	if err != nil {
-		return nil, err
-	}
+}
 
-	if len(mr.Responses) != len(query.LanguageOrder) {
+func (e *ESEngine) tweetsFromResponses(query Query, responses []*elastic.SearchResult) (map[string]*elastic.SearchResult, error) {
+	tweetsByLang := make(map[string]*elastic.SearchResult)
+	if len(responses) != len(query.LanguageOrder) {
 		err := errors.New(fmt.Sprintf("Unexpected number of tweet results %d, expected %d",
-			len(mr.Responses), len(query.LanguageOrder)))
+			len(responses), len(query.LanguageOrder)))
 		return nil, err
 	}
 
-	for i, currentResults := range mr.Responses {
+	for i, currentResults := range responses {
 		if currentResults.Error != nil {
 			err := errors.New(fmt.Sprintf("Failed tweets multi get: %+v", currentResults.Error))
 			return nil, err
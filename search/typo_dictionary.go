@@ -0,0 +1,462 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"gopkg.in/olivere/elastic.v6"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+	"github.com/Bnei-Baruch/archive-backend/es"
+	"github.com/Bnei-Baruch/archive-backend/utils"
+)
+
+const (
+	TYPO_DICTIONARY_FILE_SUFFIX = "dictionary"
+	// Maximal edit distance (Damerau-Levenshtein) between a word and its correction.
+	TYPO_MAX_EDITS = 2
+	// Deletes are generated over word prefix only, keeps the index small for long words.
+	TYPO_PREFIX_LENGTH = 7
+	// Shorter words are not corrected, too many candidates for them.
+	TYPO_MIN_WORD_LENGTH = 4
+	// Words of the vocabulary seen less times are not suggested as correction.
+	TYPO_MIN_CANDIDATE_FREQUENCY = 2
+	// Hebrew one letter prefixes (and, the, in, to, from, that, as).
+	TYPO_HEBREW_PREFIXES = "והבלמשכ"
+)
+
+// Spelling correction of a single language by symmetric delete: each vocabulary word is indexed
+// by all strings received by deleting up to TYPO_MAX_EDITS letters of its prefix. Candidates of
+// a misspelled word are found by looking up the deletes of the misspelled word.
+type TypoDictionary struct {
+	frequency map[string]int
+	words     []string
+	deletes   map[string][]int32
+}
+
+func MakeTypoDictionary(frequency map[string]int) *TypoDictionary {
+	d := &TypoDictionary{frequency: frequency, deletes: make(map[string][]int32)}
+	for word, count := range frequency {
+		if count < TYPO_MIN_CANDIDATE_FREQUENCY || len([]rune(word)) < TYPO_MIN_WORD_LENGTH-TYPO_MAX_EDITS {
+			continue
+		}
+		id := int32(len(d.words))
+		d.words = append(d.words, word)
+		for del := range typoDeletes(typoPrefix(word), TYPO_MAX_EDITS) {
+			d.deletes[del] = append(d.deletes[del], id)
+		}
+	}
+	return d
+}
+
+func (d *TypoDictionary) Known(word string) bool {
+	return d.frequency[word] > 0
+}
+
+// Closest vocabulary word for a misspelled word, more frequent one on equal distance.
+func (d *TypoDictionary) Correct(word string) (string, int, bool) {
+	maxEdits := typoMaxEdits(word)
+	if maxEdits == 0 {
+		return "", 0, false
+	}
+	best, bestDistance, bestFrequency := "", maxEdits+1, 0
+	checked := make(map[int32]bool)
+	for del := range typoDeletes(typoPrefix(word), maxEdits) {
+		for _, id := range d.deletes[del] {
+			if checked[id] {
+				continue
+			}
+			checked[id] = true
+			candidate := d.words[id]
+			distance := damerauLevenshtein(word, candidate, maxEdits)
+			frequency := d.frequency[candidate]
+			if distance < bestDistance || (distance == bestDistance && (frequency > bestFrequency || (frequency == bestFrequency && candidate < best))) {
+				best, bestDistance, bestFrequency = candidate, distance, frequency
+			}
+		}
+	}
+	return best, bestDistance, best != ""
+}
+
+// Local typo dictionaries by language, loaded from <lang>.dictionary files.
+// Each line of a file is a word and the number of times it was seen, separated by tab.
+type TypoDictionaries struct {
+	dictionaries map[string]*TypoDictionary
+}
+
+func MakeTypoDictionaries(vocabularies map[string]map[string]int) *TypoDictionaries {
+	ds := &TypoDictionaries{dictionaries: make(map[string]*TypoDictionary)}
+	for lang, frequency := range vocabularies {
+		if len(frequency) > 0 {
+			ds.dictionaries[lang] = MakeTypoDictionary(frequency)
+		}
+	}
+	return ds
+}
+
+func LoadTypoDictionaries(dir string) (*TypoDictionaries, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, fmt.Sprintf("*.%s", TYPO_DICTIONARY_FILE_SUFFIX)))
+	if err != nil {
+		return nil, errors.Wrap(err, "LoadTypoDictionaries")
+	}
+	vocabularies := make(map[string]map[string]int)
+	for _, path := range matches {
+		basename := filepath.Base(path)
+		lang := basename[:len(basename)-len(TYPO_DICTIONARY_FILE_SUFFIX)-1]
+		if vocabularies[lang], err = loadTypoVocabulary(path); err != nil {
+			return nil, err
+		}
+	}
+	return MakeTypoDictionaries(vocabularies), nil
+}
+
+func loadTypoVocabulary(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "loadTypoVocabulary - Error opening %s.", path)
+	}
+	defer f.Close()
+	frequency := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, "\t")
+		if len(parts) != 2 {
+			return nil, errors.Errorf("loadTypoVocabulary - Expected '<word>\\t<count>' at %s:%d, got: [%s].", path, lineNum, line)
+		}
+		count, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "loadTypoVocabulary - Bad count at %s:%d.", path, lineNum)
+		}
+		frequency[parts[0]] += count
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "loadTypoVocabulary - Error reading %s.", path)
+	}
+	return frequency, nil
+}
+
+// Writes <lang>.dictionary files, most frequent words first.
+func (ds *TypoDictionaries) Save(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "TypoDictionaries.Save - Error creating %s.", dir)
+	}
+	for lang, d := range ds.dictionaries {
+		path := filepath.Join(dir, fmt.Sprintf("%s.%s", lang, TYPO_DICTIONARY_FILE_SUFFIX))
+		f, err := os.Create(path)
+		if err != nil {
+			return errors.Wrapf(err, "TypoDictionaries.Save - Error creating %s.", path)
+		}
+		err = writeTypoVocabulary(f, d.frequency)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return errors.Wrapf(err, "TypoDictionaries.Save - Error writing %s.", path)
+		}
+	}
+	return nil
+}
+
+func writeTypoVocabulary(w io.Writer, frequency map[string]int) error {
+	words := make([]string, 0, len(frequency))
+	for word := range frequency {
+		words = append(words, word)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if frequency[words[i]] != frequency[words[j]] {
+			return frequency[words[i]] > frequency[words[j]]
+		}
+		return words[i] < words[j]
+	})
+	bw := bufio.NewWriter(w)
+	for _, word := range words {
+		if _, err := fmt.Fprintf(bw, "%s\t%d\n", word, frequency[word]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// True if there is a dictionary for the language.
+func (ds *TypoDictionaries) Has(lang string) bool {
+	if ds == nil {
+		return false
+	}
+	_, ok := ds.dictionaries[lang]
+	return ok
+}
+
+// Corrects each unknown word of the text by the dictionaries of the languages (in order of preference).
+// Words with digits or shorter than TYPO_MIN_WORD_LENGTH are kept as is, as well as everything between the words.
+// Returns false when no word was corrected.
+func (ds *TypoDictionaries) Suggest(text string, langs []string) (string, bool) {
+	dictionaries := []*TypoDictionary{}
+	hebrew := false
+	for _, lang := range langs {
+		if d, ok := ds.dictionaries[lang]; ok {
+			dictionaries = append(dictionaries, d)
+			hebrew = hebrew || lang == consts.LANG_HEBREW
+		}
+	}
+	if len(dictionaries) == 0 {
+		return "", false
+	}
+	var ret strings.Builder
+	corrected := false
+	for _, part := range splitTypoWords(text) {
+		if !part.word {
+			ret.WriteString(part.text)
+			continue
+		}
+		word := normalizeTypoWord(part.text)
+		if typoKnown(dictionaries, word, hebrew) {
+			ret.WriteString(part.text)
+			continue
+		}
+		best, bestDistance := "", TYPO_MAX_EDITS+1
+		for _, d := range dictionaries {
+			if candidate, distance, ok := d.Correct(word); ok && distance < bestDistance {
+				best, bestDistance = candidate, distance
+			}
+		}
+		if best == "" {
+			ret.WriteString(part.text)
+			continue
+		}
+		ret.WriteString(matchTypoCase(part.text, best))
+		corrected = true
+	}
+	return ret.String(), corrected
+}
+
+func typoKnown(dictionaries []*TypoDictionary, word string, hebrew bool) bool {
+	for _, d := range dictionaries {
+		if d.Known(word) {
+			return true
+		}
+	}
+	if !hebrew {
+		return false
+	}
+	// Up to two prefix letters, e.g., ו+ה+אור.
+	runes := []rune(word)
+	for i := 0; i < 2 && i < len(runes)-2 && strings.ContainsRune(TYPO_HEBREW_PREFIXES, runes[i]); i++ {
+		if typoKnown(dictionaries, string(runes[i+1:]), false) {
+			return true
+		}
+	}
+	return false
+}
+
+// Vocabulary of result titles from the index (tweets excluded) and variables translations, by language.
+func BuildTypoVocabularies(ctx context.Context, esc *elastic.Client, variables VariablesV2, langs []string) (map[string]map[string]int, error) {
+	vocabularies := make(map[string]map[string]int)
+	for _, lang := range langs {
+		frequency := make(map[string]int)
+		indexName := es.IndexNameForServing("prod", consts.ES_RESULTS_INDEX, lang)
+		query := elastic.NewBoolQuery().MustNot(elastic.NewTermQuery(consts.ES_RESULT_TYPE, consts.ES_RESULT_TYPE_TWEETS))
+		scroll := esc.Scroll(indexName).
+			Query(query).
+			FetchSourceContext(elastic.NewFetchSourceContext(true).Include("title", "full_title")).
+			Size(1000)
+		for {
+			res, err := scroll.Do(ctx)
+			if err == io.EOF {
+				break
+			}
+			if elastic.IsNotFound(err) {
+				log.Warnf("BuildTypoVocabularies - No index %s, vocabulary for %s built from variables only.", indexName, lang)
+				break
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "BuildTypoVocabularies - Scroll %s.", indexName)
+			}
+			for _, hit := range res.Hits.Hits {
+				var titles struct {
+					Title     string `json:"title"`
+					FullTitle string `json:"full_title"`
+				}
+				if err := json.Unmarshal(*hit.Source, &titles); err != nil {
+					return nil, errors.Wrapf(err, "BuildTypoVocabularies - Unmarshal %s.", hit.Id)
+				}
+				addTypoWords(frequency, titles.Title)
+				if titles.FullTitle != titles.Title {
+					addTypoWords(frequency, titles.FullTitle)
+				}
+			}
+		}
+		if err := scroll.Clear(ctx); err != nil {
+			log.Warnf("BuildTypoVocabularies - Failed clearing scroll of %s: %+v", indexName, err)
+		}
+		for _, translations := range variables {
+			for _, phrases := range translations[lang] {
+				for _, phrase := range phrases {
+					addTypoWords(frequency, phrase)
+				}
+			}
+		}
+		vocabularies[lang] = frequency
+	}
+	return vocabularies, nil
+}
+
+func addTypoWords(frequency map[string]int, text string) {
+	for _, part := range splitTypoWords(text) {
+		if part.word {
+			frequency[normalizeTypoWord(part.text)]++
+		}
+	}
+}
+
+type typoPart struct {
+	text string
+	word bool
+}
+
+// Splits text to words (letters only) and everything else. Letters adjacent to digits are not a word.
+func splitTypoWords(text string) []typoPart {
+	parts := []typoPart{}
+	runes := []rune(text)
+	start := 0
+	for start < len(runes) {
+		end := start
+		if isTypoLetter(runes[start]) {
+			for end < len(runes) && isTypoLetter(runes[end]) {
+				end++
+			}
+			word := !(start > 0 && unicode.IsDigit(runes[start-1])) && !(end < len(runes) && unicode.IsDigit(runes[end]))
+			parts = append(parts, typoPart{text: string(runes[start:end]), word: word})
+		} else {
+			for end < len(runes) && !isTypoLetter(runes[end]) {
+				end++
+			}
+			parts = append(parts, typoPart{text: string(runes[start:end])})
+		}
+		start = end
+	}
+	return parts
+}
+
+func isTypoLetter(r rune) bool {
+	return unicode.IsLetter(r) || unicode.Is(unicode.Mn, r)
+}
+
+// Lower case without diacritics (e.g., niqqud).
+func normalizeTypoWord(word string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, word)
+}
+
+// Upper case or capitalized original keeps its case in the correction.
+func matchTypoCase(original string, correction string) string {
+	runes := []rune(original)
+	if strings.ToUpper(original) == original && strings.ToLower(original) != original && len(runes) > 1 {
+		return strings.ToUpper(correction)
+	}
+	if unicode.IsUpper(runes[0]) {
+		c := []rune(correction)
+		c[0] = unicode.ToUpper(c[0])
+		return string(c)
+	}
+	return correction
+}
+
+func typoMaxEdits(word string) int {
+	switch n := len([]rune(word)); {
+	case n < TYPO_MIN_WORD_LENGTH:
+		return 0
+	case n <= 6:
+		return 1
+	}
+	return TYPO_MAX_EDITS
+}
+
+func typoPrefix(word string) string {
+	runes := []rune(word)
+	if len(runes) > TYPO_PREFIX_LENGTH {
+		return string(runes[:TYPO_PREFIX_LENGTH])
+	}
+	return word
+}
+
+// All strings received by deleting up to maxEdits runes, including the word itself.
+func typoDeletes(word string, maxEdits int) map[string]bool {
+	ret := map[string]bool{word: true}
+	current := []string{word}
+	for edit := 0; edit < maxEdits; edit++ {
+		next := []string{}
+		for _, w := range current {
+			runes := []rune(w)
+			if len(runes) <= 1 {
+				continue
+			}
+			for i := range runes {
+				del := string(runes[:i]) + string(runes[i+1:])
+				if !ret[del] {
+					ret[del] = true
+					next = append(next, del)
+				}
+			}
+		}
+		current = next
+	}
+	return ret
+}
+
+// Optimal string alignment distance, max+1 when above max.
+func damerauLevenshtein(a string, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > max || -d > max {
+		return max + 1
+	}
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = utils.MinInt(utils.MinInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = utils.MinInt(cur[j], prev2[j-2]+1)
+			}
+			rowMin = utils.MinInt(rowMin, cur[j])
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	if prev[len(rb)] > max {
+		return max + 1
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,105 @@
+package search
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+)
+
+type TypoDictionarySuite struct {
+	suite.Suite
+	dictionaries *TypoDictionaries
+}
+
+func TestTypoDictionary(t *testing.T) {
+	suite.Run(t, new(TypoDictionarySuite))
+}
+
+func (suite *TypoDictionarySuite) SetupTest() {
+	suite.dictionaries = MakeTypoDictionaries(map[string]map[string]int{
+		consts.LANG_ENGLISH: {"kabbalah": 120, "lessons": 80, "lesson": 90, "congress": 30, "shamati": 12, "wisdom": 40, "rare": 1, "unity": 1},
+		consts.LANG_HEBREW:  {"אור": 50, "שמעתי": 20, "קבלה": 70},
+		consts.LANG_RUSSIAN: {"урок": 60, "каббала": 50, "конгресс": 25},
+	})
+}
+
+func (suite *TypoDictionarySuite) TestSuggest() {
+	r := suite.Require()
+	cases := []struct {
+		text      string
+		langs     []string
+		suggested string
+		ok        bool
+	}{
+		{"kabalah lesons", []string{consts.LANG_ENGLISH}, "kabbalah lessons", true},
+		{"Kabalah", []string{consts.LANG_ENGLISH}, "Kabbalah", true},
+		{"SHAMAIT", []string{consts.LANG_ENGLISH}, "SHAMATI", true},
+		{"kabbalah lessons", []string{consts.LANG_ENGLISH}, "", false},
+		// Known words (even rare) and short words are not corrected, candidates should not be rare.
+		{"unity rare xyz", []string{consts.LANG_ENGLISH}, "", false},
+		{"unitty", []string{consts.LANG_ENGLISH}, "", false},
+		// Digits and words adjacent to them are kept as is.
+		{"lesons 2019, (12)", []string{consts.LANG_ENGLISH}, "lessons 2019, (12)", true},
+		{"lesons12", []string{consts.LANG_ENGLISH}, "", false},
+		// Languages in order of preference.
+		{"конгрес kongress", []string{consts.LANG_RUSSIAN, consts.LANG_ENGLISH}, "конгресс congress", true},
+		{"kabalah", []string{consts.LANG_SPANISH}, "", false},
+		// Hebrew prefixes.
+		{"והאור", []string{consts.LANG_HEBREW}, "", false},
+		{"שמאתי", []string{consts.LANG_HEBREW}, "שמעתי", true},
+	}
+	for _, c := range cases {
+		suggested, ok := suite.dictionaries.Suggest(c.text, c.langs)
+		r.Equal(c.ok, ok, c.text)
+		if c.ok {
+			r.Equal(c.suggested, suggested, c.text)
+		}
+	}
+}
+
+func (suite *TypoDictionarySuite) TestGetTypoSuggest() {
+	r := suite.Require()
+	engine := NewESEngine(nil, nil, nil, nil, nil, nil)
+	engine.TypoDictionaries = suite.dictionaries
+
+	res, err := engine.GetTypoSuggest(Query{Term: "kabalah lesons 5", LanguageOrder: []string{consts.LANG_ENGLISH}}, nil)
+	r.Nil(err)
+	r.True(res.Valid)
+	r.Equal("kabbalah lessons 5", res.String)
+
+	// Only the free text value of the grammar intent is checked.
+	filterIntents := []Intent{{Value: GrammarIntent{FilterValues: []FilterValue{{Name: consts.VARIABLE_TO_FILTER[consts.VAR_TEXT], Value: "kabalah"}}}}}
+	res, err = engine.GetTypoSuggest(Query{Term: "lesons about kabalah", LanguageOrder: []string{consts.LANG_ENGLISH}}, filterIntents)
+	r.Nil(err)
+	r.True(res.Valid)
+	r.Equal("lesons about kabbalah", res.String)
+
+	res, err = engine.GetTypoSuggest(Query{Term: "2019", LanguageOrder: []string{consts.LANG_ENGLISH}}, nil)
+	r.Nil(err)
+	r.False(res.Valid)
+}
+
+func (suite *TypoDictionarySuite) TestSaveAndLoad() {
+	r := suite.Require()
+	dir, err := ioutil.TempDir("", "typo_dictionaries")
+	r.Nil(err)
+	defer os.RemoveAll(dir)
+
+	r.Nil(suite.dictionaries.Save(dir))
+	loaded, err := LoadTypoDictionaries(dir)
+	r.Nil(err)
+	r.True(loaded.Has(consts.LANG_HEBREW))
+	r.False(loaded.Has(consts.LANG_SPANISH))
+	r.Equal(suite.dictionaries.dictionaries[consts.LANG_ENGLISH].frequency, loaded.dictionaries[consts.LANG_ENGLISH].frequency)
+	suggested, ok := loaded.Suggest("kongres", []string{consts.LANG_ENGLISH})
+	r.True(ok)
+	r.Equal("congress", suggested)
+
+	r.Nil(ioutil.WriteFile(dir+"/es.dictionary", []byte("palabra\n"), 0644))
+	_, err = LoadTypoDictionaries(dir)
+	r.NotNil(err)
+}
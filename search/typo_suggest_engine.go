@@ -52,13 +52,50 @@ func (c *ConstantTerms) ReplaceTerms(s string) string {
 }
 
 func (e *ESEngine) GetTypoSuggest(query Query, filterIntents []Intent) (null.String, error) {
-	srv := e.esc.Search()
-	suggestText := null.String{"", false}
+	return e.getTypoSuggest(context.TODO(), query, filterIntents, nil)
+}
+
+// Typo suggest request with the state needed to build the suggestion from the response.
+type typoSuggestSearch struct {
+	indices                  []string
+	source                   *elastic.SearchSource
+	constantTerms            ConstantTerms
+	checkTerm                string
+	considerGrammarTextValue bool
+	// Suggested by local typo dictionaries, no Elastic request.
+	local bool
+}
+
+func (ts *typoSuggestSearch) request() *elastic.SearchRequest {
+	return elastic.NewSearchRequest().Index(ts.indices...).SearchSource(ts.source)
+}
+
+// Same as GetTypoSuggest, records the decisions taken to typoDebug (may be nil).
+func (e *ESEngine) getTypoSuggest(ctx context.Context, query Query, filterIntents []Intent, typoDebug *TypoSuggestDebug) (null.String, error) {
+	ts, err := e.typoSuggestSearch(query, filterIntents, typoDebug)
+	if err != nil || ts == nil {
+		return null.String{"", false}, err
+	}
+	if ts.local {
+		return e.typoSuggestFromDictionaries(query, ts, typoDebug), nil
+	}
+	beforeDoSearch := time.Now()
+	r, err := e.esc.Search(ts.indices...).SearchSource(ts.source).Do(ctx)
+	e.timeTrack(beforeDoSearch, consts.LAT_DOSEARCH_TYPOSUGGESTDO)
+	if err != nil {
+		return null.String{"", false}, errors.Wrap(err, "ESEngine.DoSearch - Error TypoSuggestDo Do.")
+	}
+	return typoSuggestFromResult(query, ts, r, typoDebug), nil
+}
+
+// Prepares the typo suggest request, returns nil when typo should not be checked for the query.
+func (e *ESEngine) typoSuggestSearch(query Query, filterIntents []Intent, typoDebug *TypoSuggestDebug) (*typoSuggestSearch, error) {
 	constantTerms := ConstantTerms{pattern: consts.TERMS_PATTERN_DIGITS}
 
 	if _, err := strconv.Atoi(query.Term); err == nil {
 		//  ignore numbers
-		return suggestText, nil
+		typoDebug.step("Term [%s] is a number, ignored.", query.Term)
+		return nil, nil
 	}
 
 	checkTerm := query.Term
@@ -79,11 +116,29 @@ func (e *ESEngine) GetTypoSuggest(query Query, filterIntents []Intent) (null.Str
 					break
 				}
 			} else {
-				return suggestText, errors.Errorf("ESEngine.DoSearch - Intent is not GrammarIntent. Intent: %+v", filterIntent)
+				return nil, errors.Errorf("ESEngine.DoSearch - Intent is not GrammarIntent. Intent: %+v", filterIntent)
 			}
 		}
 	}
 
+	if considerGrammarTextValue {
+		typoDebug.step("Checking free text value [%s] of grammar filter intent.", checkTerm)
+	} else {
+		typoDebug.step("Checking term [%s].", checkTerm)
+	}
+
+	constantTerms.RememberTerms(checkTerm)
+
+	if len(query.LanguageOrder) > 0 && e.TypoDictionaries.Has(query.LanguageOrder[0]) {
+		typoDebug.step("Local typo dictionaries for languages %v.", query.LanguageOrder)
+		return &typoSuggestSearch{
+			constantTerms:            constantTerms,
+			checkTerm:                checkTerm,
+			considerGrammarTextValue: considerGrammarTextValue,
+			local:                    true,
+		}, nil
+	}
+
 	var hasHebrew bool
 	var hasRussian bool
 	var hasEnglish bool
@@ -99,7 +154,6 @@ func (e *ESEngine) GetTypoSuggest(query Query, filterIntents []Intent) (null.Str
 		}
 		indices[i] = es.IndexNameForServing("prod", consts.ES_RESULTS_INDEX, query.LanguageOrder[i])
 	}
-	srv.Index(indices...)
 
 	var suggestorField string
 	var candidateField1 null.String
@@ -129,8 +183,6 @@ func (e *ESEngine) GetTypoSuggest(query Query, filterIntents []Intent) (null.Str
 		addMaxEdits = true
 	}
 
-	constantTerms.RememberTerms(checkTerm)
-
 	suggester := elastic.NewPhraseSuggester("pharse-suggest").
 		Text(checkTerm).
 		Field(suggestorField).
@@ -154,24 +206,40 @@ func (e *ESEngine) GetTypoSuggest(query Query, filterIntents []Intent) (null.Str
 		suggester.CandidateGenerator(can2)
 	}
 
-	srv.Suggester(suggester)
-	beforeDoSearch := time.Now()
-	r, err := srv.Do(context.TODO())
-	e.timeTrack(beforeDoSearch, "DoSearch.TypoSuggestDo")
-	if err != nil {
-		return suggestText, errors.Wrap(err, "ESEngine.DoSearch - Error TypoSuggestDo Do.")
-	}
+	typoDebug.step("Phrase suggester on field [%s] for languages %v.", suggestorField, query.LanguageOrder)
+	return &typoSuggestSearch{
+		indices:                  indices,
+		source:                   elastic.NewSearchSource().Suggester(suggester),
+		constantTerms:            constantTerms,
+		checkTerm:                checkTerm,
+		considerGrammarTextValue: considerGrammarTextValue,
+	}, nil
+}
 
+func typoSuggestFromResult(query Query, ts *typoSuggestSearch, r *elastic.SearchResult, typoDebug *TypoSuggestDebug) null.String {
 	if sp, ok := r.Suggest["pharse-suggest"]; ok {
 		if len(sp) > 0 && sp[0].Options != nil && len(sp[0].Options) > 0 {
-			suggested := sp[0].Options[0].Text
-			suggested = constantTerms.ReplaceTerms(suggested)
-			if considerGrammarTextValue {
-				suggested = strings.Replace(query.Term, checkTerm, suggested, -1)
-			}
-			suggestText = null.String{suggested, true}
+			return typoSuggestText(query, ts, sp[0].Options[0].Text, typoDebug)
 		}
 	}
+	typoDebug.step("No suggestion found.")
+	return null.String{"", false}
+}
+
+func (e *ESEngine) typoSuggestFromDictionaries(query Query, ts *typoSuggestSearch, typoDebug *TypoSuggestDebug) null.String {
+	if suggested, ok := e.TypoDictionaries.Suggest(ts.checkTerm, query.LanguageOrder); ok {
+		return typoSuggestText(query, ts, suggested, typoDebug)
+	}
+	typoDebug.step("No suggestion found.")
+	return null.String{"", false}
+}
 
-	return suggestText, nil
+// Restores constant terms and the grammar text around the checked term.
+func typoSuggestText(query Query, ts *typoSuggestSearch, suggested string, typoDebug *TypoSuggestDebug) null.String {
+	suggested = ts.constantTerms.ReplaceTerms(suggested)
+	if ts.considerGrammarTextValue {
+		suggested = strings.Replace(query.Term, ts.checkTerm, suggested, -1)
+	}
+	typoDebug.step("Found suggestion [%s].", suggested)
+	return null.String{suggested, true}
 }
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +17,7 @@ import (
 	"github.com/spf13/viper"
 	"github.com/volatiletech/sqlboiler/v4/queries"
 
+	"github.com/Bnei-Baruch/archive-backend/cache"
 	"github.com/Bnei-Baruch/archive-backend/consts"
 	"github.com/Bnei-Baruch/archive-backend/mdb"
 	"github.com/Bnei-Baruch/archive-backend/utils"
@@ -68,7 +70,32 @@ func MakeVariablesV2(variablesDir string) (VariablesV2, error) {
 	if err != nil {
 		return nil, err
 	}
+	addGeneratedVariablesV2(variables)
+	return variables, nil
+}
+
+// Variables with values (also) loaded from MDB, see LoadVariablesTranslationsV2 and AddDBVariables.
+var MDB_VARIABLES = map[string]bool{
+	consts.VAR_HOLIDAYS:   true,
+	consts.VAR_POSITION:   true,
+	consts.VAR_SOURCE:     true,
+	consts.VAR_PROGRAM:    true,
+	consts.VAR_TAG:        true,
+	consts.VAR_PERSON:     true,
+	consts.VAR_COLLECTION: true,
+}
+
+// Variables without MDB_VARIABLES values loaded from MDB, e.g., for grammar lint.
+func MakeFileVariablesV2(variablesDir string) (VariablesV2, error) {
+	variables, err := LoadFileVariablesTranslationsV2(variablesDir)
+	if err != nil {
+		return nil, err
+	}
+	addGeneratedVariablesV2(variables)
+	return variables, nil
+}
 
+func addGeneratedVariablesV2(variables VariablesV2) {
 	years := MakeYearVariablesV2()
 	variables[consts.VAR_YEAR] = make(TranslationsV2)
 	variables[consts.VAR_TEXT] = make(TranslationsV2)
@@ -78,11 +105,9 @@ func MakeVariablesV2(variablesDir string) (VariablesV2, error) {
 		// Special free text variable. Proceeded with percolator search.
 		variables[consts.VAR_TEXT][lang] = map[string][]string{consts.VAR_TEXT: []string{consts.VAR_TEXT}}
 	}
-
-	return variables, nil
 }
 
-func LoadVariablesTranslationsV2(variablesDir string) (VariablesV2, error) {
+func LoadFileVariablesTranslationsV2(variablesDir string) (VariablesV2, error) {
 	variables := make(VariablesV2)
 
 	// Load variables from files
@@ -101,12 +126,21 @@ func LoadVariablesTranslationsV2(variablesDir string) (VariablesV2, error) {
 		}
 		variables[variable] = variableTranslations
 	}
+	return variables, nil
+}
+
+func LoadVariablesTranslationsV2(variablesDir string) (VariablesV2, error) {
+	variables, err := LoadFileVariablesTranslationsV2(variablesDir)
+	if err != nil {
+		return nil, err
+	}
 
 	// Load holiday variables from DB
 	db, err := sql.Open("postgres", viper.GetString("mdb.url"))
 	if err != nil {
 		return nil, errors.Wrap(err, "Unable to connect to DB.")
 	}
+	defer db.Close()
 	holidayTranslations, err := LoadHolidayTranslationsFromDB(db)
 	if err != nil {
 		return nil, err
@@ -124,49 +158,32 @@ func LoadVariablesTranslationsV2(variablesDir string) (VariablesV2, error) {
 		return nil, err
 	}
 	// Combine source name variables from DB with source name variables from file
-	if _, ok := variables[consts.VAR_SOURCE]; !ok {
-		variables[consts.VAR_SOURCE] = make(TranslationsV2)
-	}
-	for lang, translations := range sourceNamesTranslationsFromDB {
-		if _, ok := variables[consts.VAR_SOURCE][lang]; !ok {
-			variables[consts.VAR_SOURCE][lang] = make(map[string][]string)
-		}
-		for sourceUID, phrasesFromDB := range translations {
-			uniquePhrases := map[string]bool{}
-			for _, phrase := range phrasesFromDB {
-				uniquePhrases[phrase] = true
-			}
-			if phrasesFromFile, ok := variables[consts.VAR_SOURCE][lang][sourceUID]; ok {
-				for _, phrase := range phrasesFromFile {
-					uniquePhrases[phrase] = true
-				}
-			}
-			finalPhrases := []string{}
-			for uniquePhrase := range uniquePhrases {
-				finalPhrases = append(finalPhrases, uniquePhrase)
-			}
-			variables[consts.VAR_SOURCE][lang][sourceUID] = finalPhrases
-		}
-	}
+	mergeVariableTranslations(variables, consts.VAR_SOURCE, sourceNamesTranslationsFromDB)
 	// Load program name variables from DB
 	programNamesTranslationsFromDB, err := LoadProgramNameTranslationsFromDB(db)
 	if err != nil {
 		return nil, err
 	}
 	// Combine program name variables from DB with program name variables from file
-	if _, ok := variables[consts.VAR_PROGRAM]; !ok {
-		variables[consts.VAR_PROGRAM] = make(TranslationsV2)
+	mergeVariableTranslations(variables, consts.VAR_PROGRAM, programNamesTranslationsFromDB)
+	return variables, nil
+}
+
+// Adds phrases of |translations| to phrases of |variable| values, e.g., loaded from file.
+func mergeVariableTranslations(variables VariablesV2, variable string, translations TranslationsV2) {
+	if _, ok := variables[variable]; !ok {
+		variables[variable] = make(TranslationsV2)
 	}
-	for lang, translations := range programNamesTranslationsFromDB {
-		if _, ok := variables[consts.VAR_PROGRAM][lang]; !ok {
-			variables[consts.VAR_PROGRAM][lang] = make(map[string][]string)
+	for lang, valuesPhrases := range translations {
+		if _, ok := variables[variable][lang]; !ok {
+			variables[variable][lang] = make(map[string][]string)
 		}
-		for collectionUID, phrasesFromDB := range translations {
+		for value, phrasesFromDB := range valuesPhrases {
 			uniquePhrases := map[string]bool{}
 			for _, phrase := range phrasesFromDB {
 				uniquePhrases[phrase] = true
 			}
-			if phrasesFromFile, ok := variables[consts.VAR_PROGRAM][lang][collectionUID]; ok {
+			if phrasesFromFile, ok := variables[variable][lang][value]; ok {
 				for _, phrase := range phrasesFromFile {
 					uniquePhrases[phrase] = true
 				}
@@ -175,10 +192,11 @@ func LoadVariablesTranslationsV2(variablesDir string) (VariablesV2, error) {
 			for uniquePhrase := range uniquePhrases {
 				finalPhrases = append(finalPhrases, uniquePhrase)
 			}
-			variables[consts.VAR_PROGRAM][lang][collectionUID] = finalPhrases
+			// Stable order, not of map iteration. Reloaded variables are compared when grammar index is updated.
+			sort.Strings(finalPhrases)
+			variables[variable][lang][value] = finalPhrases
 		}
 	}
-	return variables, nil
 }
 
 func LoadSourceNameTranslationsFromDB(db *sql.DB) (TranslationsV2, error) {
@@ -191,7 +209,8 @@ func LoadSourceNameTranslationsFromDB(db *sql.DB) (TranslationsV2, error) {
 	queryMask := `select sn.language, s.uid, sn.name
 	from sources s join source_i18n sn on s.id=sn.source_id
 	left join sources sp on s.parent_id=sp.id
-	where (sp.uid is null or sp.uid not in (%s))`
+	where (sp.uid is null or sp.uid not in (%s))
+	order by sn.language, s.uid, sn.name`
 	query := fmt.Sprintf(queryMask, strings.Join(notToInclude, ","))
 
 	rows, err := queries.Raw(query).Query(db)
@@ -226,7 +245,8 @@ func LoadProgramNameTranslationsFromDB(db *sql.DB) (TranslationsV2, error) {
 	from collections c join collection_i18n cn on c.id=cn.collection_id
 	left join tag_i18n tn on cn.language = tn.language and cn.name like ('%%' || tn.label || '%%')
 	where tn.tag_id is null
-	and c.published = true and c.secure = 0 and c.type_id = %d`
+	and c.published = true and c.secure = 0 and c.type_id = %d
+	order by cn.language, c.uid, cn.name`
 	query := fmt.Sprintf(queryMask, mdb.CONTENT_TYPE_REGISTRY.ByName[consts.CT_VIDEO_PROGRAM].ID)
 
 	rows, err := queries.Raw(query).Query(db)
@@ -256,11 +276,11 @@ func LoadProgramNameTranslationsFromDB(db *sql.DB) (TranslationsV2, error) {
 func LoadHolidayTranslationsFromDB(db *sql.DB) (TranslationsV2, error) {
 
 	translations := make(TranslationsV2)
-	query := `select tn.language, t.uid, tn.label 
+	query := fmt.Sprintf(`select tn.language, t.uid, tn.label 
 	from tags t join tags tp on t.parent_id = tp.id
 	join tag_i18n tn on t.id=tn.tag_id
-	where tp.uid = '1nyptSIo'`
-	//  '1nyptSIo' is a const. uid for 'holidays' parent tag
+	where tp.uid = '%s'
+	order by tn.language, t.uid, tn.label`, consts.TAG_HOLIDAYS_UID)
 
 	rows, err := queries.Raw(query).Query(db)
 	if err != nil {
@@ -286,6 +306,126 @@ func LoadHolidayTranslationsFromDB(db *sql.DB) (TranslationsV2, error) {
 	return translations, nil
 }
 
+// Adds variables of topics ($Tag), persons ($Person) and congresses ($Collection) loaded from DB.
+// Values without enough published content, see SearchStatsCache, are skipped. Without cache all values are added.
+// Phrases from variable files, e.g., tag.variable, are kept as aliases.
+func AddDBVariables(variables VariablesV2, db *sql.DB, cm cache.CacheManager) error {
+	tagTranslations, err := LoadTagTranslationsFromDB(db, cm)
+	if err != nil {
+		return err
+	}
+	mergeVariableTranslations(variables, consts.VAR_TAG, tagTranslations)
+	personTranslations, err := LoadPersonTranslationsFromDB(db, cm)
+	if err != nil {
+		return err
+	}
+	mergeVariableTranslations(variables, consts.VAR_PERSON, personTranslations)
+	collectionTranslations, err := LoadCollectionTranslationsFromDB(db, cm)
+	if err != nil {
+		return err
+	}
+	mergeVariableTranslations(variables, consts.VAR_COLLECTION, collectionTranslations)
+	return nil
+}
+
+func LoadTagTranslationsFromDB(db *sql.DB, cm cache.CacheManager) (TranslationsV2, error) {
+	// Holidays are loaded as $Holidays, see LoadHolidayTranslationsFromDB.
+	query := fmt.Sprintf(`select tn.language, t.uid, tn.label
+	from tags t join tag_i18n tn on t.id=tn.tag_id
+	left join tags tp on t.parent_id = tp.id
+	where tn.label is not null and (tp.uid is null or tp.uid <> '%s')`, consts.TAG_HOLIDAYS_UID)
+	cts := utils.StringMapOrderedKeys(consts.ES_INTENT_SUPPORTED_CONTENT_TYPES)
+	return loadTranslationsFromDB(db, query, "tag", func(uid string) bool {
+		return cm == nil || cm.SearchStats().IsTagWithEnoughUnits(uid, consts.GRAMMAR_VARIABLE_MIN_TAG_UNITS, cts...)
+	})
+}
+
+func LoadPersonTranslationsFromDB(db *sql.DB, cm cache.CacheManager) (TranslationsV2, error) {
+	query := `select pn.language, p.uid, pn.name
+	from persons p join person_i18n pn on p.id=pn.person_id
+	where pn.name is not null`
+	return loadTranslationsFromDB(db, query, "person", func(uid string) bool {
+		return cm == nil || cm.SearchStats().IsPersonWithEnoughUnits(uid, consts.GRAMMAR_VARIABLE_MIN_PERSON_UNITS)
+	})
+}
+
+func LoadCollectionTranslationsFromDB(db *sql.DB, cm cache.CacheManager) (TranslationsV2, error) {
+	queryMask := `select cn.language, c.uid, cn.name
+	from collections c join collection_i18n cn on c.id=cn.collection_id
+	where cn.name is not null
+	and c.published = true and c.secure = 0 and c.type_id = %d`
+	query := fmt.Sprintf(queryMask, mdb.CONTENT_TYPE_REGISTRY.ByName[consts.CT_CONGRESS].ID)
+	return loadTranslationsFromDB(db, query, "collection", func(uid string) bool {
+		return cm == nil || cm.SearchStats().IsCollectionWithEnoughUnits(uid, consts.GRAMMAR_VARIABLE_MIN_COLLECTION_UNITS)
+	})
+}
+
+// Loads translations from query selecting language, uid and name. Names are normalized, see normalizeVariablePhrases.
+func loadTranslationsFromDB(db *sql.DB, query string, name string, include func(uid string) bool) (TranslationsV2, error) {
+	translations := make(TranslationsV2)
+	rows, err := queries.Raw(query).Query(db)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to retrieve %s name translations from DB.", name)
+	}
+	defer rows.Close()
+	skipped := map[string]bool{}
+	for rows.Next() {
+		var lang string
+		var uid string
+		var phrase string
+		err := rows.Scan(&lang, &uid, &phrase)
+		if err != nil {
+			return nil, errors.Wrap(err, "rows.Scan")
+		}
+		if !include(uid) {
+			skipped[uid] = true
+			continue
+		}
+		if _, ok := translations[lang]; !ok {
+			translations[lang] = make(map[string][]string)
+		}
+		for _, normalized := range normalizeVariablePhrases(phrase) {
+			if !utils.StringInSlice(normalized, translations[lang][uid]) {
+				translations[lang][uid] = append(translations[lang][uid], normalized)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows.Err()")
+	}
+	// Stable order, rows are not ordered.
+	for _, valuesPhrases := range translations {
+		for _, phrases := range valuesPhrases {
+			sort.Strings(phrases)
+		}
+	}
+	log.Infof("Skipped %d %s variable values without enough content.", len(skipped), name)
+	return translations, nil
+}
+
+var variablePhraseQuotesReplacer = strings.NewReplacer("\"", "", "״", "", "«", "", "»", "", "“", "", "”", "", "„", "")
+var variablePhraseParenthesesRegexp = regexp.MustCompile(`\(([^)]*)\)`)
+
+// Normalizes DB name into variable phrases: quotes are removed, parentheses and slash separated
+// parts become aliases, e.g., "Baal HaSulam (Yehuda Ashlag)" => ["Baal HaSulam", "Yehuda Ashlag"].
+func normalizeVariablePhrases(name string) []string {
+	name = variablePhraseQuotesReplacer.Replace(name)
+	parts := []string{variablePhraseParenthesesRegexp.ReplaceAllString(name, " ")}
+	for _, match := range variablePhraseParenthesesRegexp.FindAllStringSubmatch(name, -1) {
+		parts = append(parts, match[1])
+	}
+	ret := []string(nil)
+	for _, part := range parts {
+		for _, alias := range strings.Split(part, "/") {
+			alias = strings.Join(strings.Fields(alias), " ")
+			if alias != "" && !utils.StringInSlice(alias, ret) {
+				ret = append(ret, alias)
+			}
+		}
+	}
+	return ret
+}
+
 func LoadVariableTranslationsFromFile(variableFile string, variableName string) (TranslationsV2, error) {
 	file, err := os.Open(variableFile)
 	if err != nil {
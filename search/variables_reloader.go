@@ -0,0 +1,258 @@
+package search
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+
+	"github.com/Bnei-Baruch/archive-backend/cache"
+	"github.com/Bnei-Baruch/archive-backend/utils"
+)
+
+// Grammar variables reloaded in the running server.
+// Variables are reloaded when files in watched folders (the variables folder and any added by Watch) change
+// and every refresh interval, for DB sourced translations. The new variables replace the previous ones at once,
+// requests already holding the previous variables are not affected. On error the previous variables are kept.
+type VariablesReloader struct {
+	dir      string
+	db       *sql.DB
+	cm       cache.CacheManager
+	glossary *Glossary
+
+	variables  VariablesV2
+	reloadedAt time.Time
+	mutex      sync.RWMutex
+
+	watchDirs   []string
+	stamp       string
+	onReload    []func(VariablesV2) error
+	reloadMutex sync.Mutex
+	load        func() (VariablesV2, error)
+
+	refreshTicker *time.Ticker
+	watchTicker   *time.Ticker
+	done          chan bool
+}
+
+func NewVariablesReloader(dir string, db *sql.DB, cm cache.CacheManager, glossary *Glossary) *VariablesReloader {
+	r := &VariablesReloader{dir: dir, db: db, cm: cm, glossary: glossary, variables: make(VariablesV2), watchDirs: []string{dir}}
+	r.load = r.loadVariables
+	return r
+}
+
+func (r *VariablesReloader) String() string {
+	return "VariablesReloader"
+}
+
+// Reload also when files in |dir| change, e.g., grammars of OnReload.
+func (r *VariablesReloader) Watch(dir string) {
+	r.watchDirs = append(r.watchDirs, dir)
+}
+
+// Called with new variables on each reload with changed variables or watched files, before they replace
+// the current ones. Reload fails and keeps the current variables when any of the listeners fails.
+func (r *VariablesReloader) OnReload(fn func(VariablesV2) error) {
+	r.onReload = append(r.onReload, fn)
+}
+
+// Starts periodic reload every |refreshInterval| and check of watched folders every |watchInterval|.
+// Zero interval disables the corresponding reload.
+func (r *VariablesReloader) Start(refreshInterval time.Duration, watchInterval time.Duration) {
+	var refreshC, watchC <-chan time.Time
+	if refreshInterval > 0 {
+		r.refreshTicker = time.NewTicker(refreshInterval)
+		refreshC = r.refreshTicker.C
+	}
+	if watchInterval > 0 {
+		r.watchTicker = time.NewTicker(watchInterval)
+		watchC = r.watchTicker.C
+	}
+	if refreshC == nil && watchC == nil {
+		return
+	}
+	r.done = make(chan bool)
+	go func() {
+		for {
+			var err error
+			select {
+			case <-r.done:
+				return
+			case <-refreshC:
+				err = r.Reload()
+			case <-watchC:
+				_, err = r.ReloadIfChanged()
+			}
+			if err != nil {
+				log.Errorf("Refresh %s: %s", r, err.Error())
+				utils.LogError(err)
+			}
+		}
+	}()
+}
+
+func (r *VariablesReloader) Close() {
+	if r == nil {
+		return
+	}
+	if r.refreshTicker != nil {
+		r.refreshTicker.Stop()
+	}
+	if r.watchTicker != nil {
+		r.watchTicker.Stop()
+	}
+	if r.done != nil {
+		close(r.done)
+	}
+}
+
+// Current variables, should not be modified.
+func (r *VariablesReloader) Variables() VariablesV2 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.variables
+}
+
+// See utils.Reloadable.
+func (r *VariablesReloader) Current() interface{} {
+	return r.Variables()
+}
+
+func (r *VariablesReloader) ReloadedAt() time.Time {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.reloadedAt
+}
+
+// Loads all variables and replaces the current ones.
+func (r *VariablesReloader) Reload() error {
+	r.reloadMutex.Lock()
+	defer r.reloadMutex.Unlock()
+	return r.reload()
+}
+
+// Reloads when files of watched folders changed since the last reload.
+func (r *VariablesReloader) ReloadIfChanged() (bool, error) {
+	r.reloadMutex.Lock()
+	defer r.reloadMutex.Unlock()
+	stamp, err := r.filesStamp()
+	if err != nil {
+		return false, err
+	}
+	if stamp == r.stamp {
+		return false, nil
+	}
+	log.Infof("%s: watched files changed, reloading.", r)
+	return true, r.reload()
+}
+
+func (r *VariablesReloader) reload() error {
+	clock := time.Now()
+	// Stamp before load, files changed while loading are reloaded next time.
+	stamp, err := r.filesStamp()
+	if err != nil {
+		return err
+	}
+	variables, err := r.load()
+	if err != nil {
+		return err
+	}
+	if stamp == r.stamp && variablesEqual(variables, r.Variables()) {
+		r.mutex.Lock()
+		r.reloadedAt = time.Now()
+		r.mutex.Unlock()
+		log.Infof("%s: variables not changed, checked in %s.", r, time.Now().Sub(clock).String())
+		return nil
+	}
+	// Listeners are called before the variables are replaced, on error the previous
+	// variables are kept and the reload is retried next time.
+	for _, fn := range r.onReload {
+		if err := fn(variables); err != nil {
+			return errors.Wrapf(err, "%s on reload", r)
+		}
+	}
+	r.mutex.Lock()
+	r.variables = variables
+	r.reloadedAt = time.Now()
+	r.mutex.Unlock()
+	r.stamp = stamp
+	log.Infof("%s: %d variables loaded in %s.", r, len(variables), time.Now().Sub(clock).String())
+	return nil
+}
+
+// Same variables, values and phrases of each value in any order.
+func variablesEqual(a VariablesV2, b VariablesV2) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for variable, translations := range a {
+		other, ok := b[variable]
+		if !ok || len(translations) != len(other) {
+			return false
+		}
+		for lang, valuesPhrases := range translations {
+			otherValuesPhrases, ok := other[lang]
+			if !ok || len(valuesPhrases) != len(otherValuesPhrases) {
+				return false
+			}
+			for value, phrases := range valuesPhrases {
+				otherPhrases, ok := otherValuesPhrases[value]
+				if !ok || len(phrases) != len(otherPhrases) {
+					return false
+				}
+				sorted := append([]string(nil), phrases...)
+				otherSorted := append([]string(nil), otherPhrases...)
+				sort.Strings(sorted)
+				sort.Strings(otherSorted)
+				if !reflect.DeepEqual(sorted, otherSorted) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+func (r *VariablesReloader) loadVariables() (VariablesV2, error) {
+	variables, err := MakeVariablesV2(r.dir)
+	if err != nil {
+		return nil, err
+	}
+	if r.glossary != nil {
+		AddGlossaryVariable(variables, r.glossary)
+	}
+	if r.db != nil {
+		if err := AddDBVariables(variables, r.db, r.cm); err != nil {
+			return nil, err
+		}
+	}
+	return variables, nil
+}
+
+// Names, sizes and modification times of files in watched folders.
+func (r *VariablesReloader) filesStamp() (string, error) {
+	stamps := []string(nil)
+	for _, dir := range r.watchDirs {
+		matches, err := filepath.Glob(filepath.Join(dir, "*"))
+		if err != nil {
+			return "", errors.Wrapf(err, "%s watching %s", r, dir)
+		}
+		for _, path := range matches {
+			info, err := os.Stat(path)
+			if err != nil {
+				return "", errors.Wrapf(err, "%s watching %s", r, dir)
+			}
+			stamps = append(stamps, fmt.Sprintf("%s:%d:%d", path, info.Size(), info.ModTime().UnixNano()))
+		}
+	}
+	sort.Strings(stamps)
+	return strings.Join(stamps, "\n"), nil
+}
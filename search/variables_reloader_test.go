@@ -0,0 +1,164 @@
+package search
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Bnei-Baruch/archive-backend/consts"
+)
+
+type VariablesReloaderSuite struct {
+	suite.Suite
+	dir string
+}
+
+func TestVariablesReloader(t *testing.T) {
+	suite.Run(t, new(VariablesReloaderSuite))
+}
+
+func (suite *VariablesReloaderSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "variables")
+	suite.Require().Nil(err)
+	suite.dir = dir
+}
+
+func (suite *VariablesReloaderSuite) TearDownTest() {
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *VariablesReloaderSuite) writeTags(content string) {
+	path := filepath.Join(suite.dir, "tag.variable")
+	suite.Require().Nil(ioutil.WriteFile(path, []byte(content), 0644))
+	// Make sure modification time changes.
+	modTime := time.Now().Add(time.Duration(len(content)) * time.Second)
+	suite.Require().Nil(os.Chtimes(path, modTime, modTime))
+}
+
+// Reloader loading tags from file only, without DB.
+func (suite *VariablesReloaderSuite) reloader() *VariablesReloader {
+	r := NewVariablesReloader(suite.dir, nil, nil, nil)
+	r.load = func() (VariablesV2, error) {
+		translations, err := LoadVariableTranslationsFromFile(filepath.Join(suite.dir, "tag.variable"), consts.VAR_TAG)
+		if err != nil {
+			return nil, err
+		}
+		return VariablesV2{consts.VAR_TAG: translations}, nil
+	}
+	return r
+}
+
+func (suite *VariablesReloaderSuite) TestReload() {
+	r := suite.Require()
+	suite.writeTags("en,love => love\nen,love => bestowal\n")
+	reloader := suite.reloader()
+	defer reloader.Close()
+	r.Empty(reloader.Variables())
+	r.Nil(reloader.Reload())
+	before := reloader.Variables()
+	r.Equal([]string{"love", "bestowal"}, before[consts.VAR_TAG][consts.LANG_ENGLISH]["love"])
+
+	reloaded := []VariablesV2(nil)
+	reloader.OnReload(func(variables VariablesV2) error {
+		reloaded = append(reloaded, variables)
+		return nil
+	})
+	changed, err := reloader.ReloadIfChanged()
+	r.Nil(err)
+	r.False(changed)
+	r.Empty(reloaded)
+
+	// Variables are replaced, previous variables are not modified.
+	suite.writeTags("en,love => love\nen,unity => unity\n")
+	changed, err = reloader.ReloadIfChanged()
+	r.Nil(err)
+	r.True(changed)
+	r.Len(reloaded, 1)
+	r.Equal(reloaded[0], reloader.Variables())
+	r.Len(reloader.Variables()[consts.VAR_TAG][consts.LANG_ENGLISH], 2)
+	r.Equal([]string{"love", "bestowal"}, before[consts.VAR_TAG][consts.LANG_ENGLISH]["love"])
+	r.Equal(reloader.Variables(), reloader.Current())
+
+	// Failed reload keeps the previous variables.
+	suite.writeTags("love => love\n")
+	current := reloader.Variables()
+	reloadedAt := reloader.ReloadedAt()
+	changed, err = reloader.ReloadIfChanged()
+	r.NotNil(err)
+	r.True(changed)
+	r.Equal(current, reloader.Variables())
+	r.Equal(reloadedAt, reloader.ReloadedAt())
+
+	// Errors of reload listeners are returned before the variables are replaced.
+	suite.writeTags("en,love => love\n")
+	failed := true
+	reloader.OnReload(func(variables VariablesV2) error {
+		if failed {
+			return errors.New("index failed")
+		}
+		return nil
+	})
+	r.NotNil(reloader.Reload())
+	r.Equal(current, reloader.Variables())
+	r.Equal(reloadedAt, reloader.ReloadedAt())
+
+	// Retried on next reload.
+	failed = false
+	reloaded = nil
+	r.Nil(reloader.Reload())
+	r.Len(reloaded, 1)
+	r.Len(reloader.Variables()[consts.VAR_TAG][consts.LANG_ENGLISH], 1)
+
+	// Listeners are not called when nothing changed.
+	r.Nil(reloader.Reload())
+	r.Len(reloaded, 1)
+	r.True(reloader.ReloadedAt().After(reloadedAt))
+}
+
+func (suite *VariablesReloaderSuite) TestReloadPhrasesOrder() {
+	r := suite.Require()
+	reloader := NewVariablesReloader(suite.dir, nil, nil, nil)
+	defer reloader.Close()
+	// Phrases in map iteration order, as of loaders merging phrases.
+	reloader.load = func() (VariablesV2, error) {
+		phrases := []string(nil)
+		for phrase := range map[string]bool{"love": true, "bestowal": true, "unity": true, "arvut": true} {
+			phrases = append(phrases, phrase)
+		}
+		return VariablesV2{consts.VAR_TAG: {consts.LANG_ENGLISH: {"love": phrases}}}, nil
+	}
+	r.Nil(reloader.Reload())
+	reloaded := 0
+	reloader.OnReload(func(variables VariablesV2) error {
+		reloaded++
+		return nil
+	})
+	for i := 0; i < 10; i++ {
+		r.Nil(reloader.Reload())
+	}
+	r.Equal(0, reloaded)
+
+	r.False(variablesEqual(VariablesV2{consts.VAR_TAG: {consts.LANG_ENGLISH: {"love": {"love", "unity"}}}},
+		VariablesV2{consts.VAR_TAG: {consts.LANG_ENGLISH: {"love": {"love", "arvut"}}}}))
+	r.False(variablesEqual(VariablesV2{consts.VAR_TAG: {consts.LANG_ENGLISH: {"love": {"love"}}}},
+		VariablesV2{consts.VAR_TAG: {consts.LANG_HEBREW: {"love": {"love"}}}}))
+}
+
+func (suite *VariablesReloaderSuite) TestWatch() {
+	r := suite.Require()
+	suite.writeTags("en,love => love\n")
+	reloader := suite.reloader()
+	r.Nil(reloader.Reload())
+	reloader.Start(0, 10*time.Millisecond)
+	defer reloader.Close()
+
+	suite.writeTags("en,love => love\nen,unity => unity\n")
+	r.Eventually(func() bool {
+		return len(reloader.Variables()[consts.VAR_TAG][consts.LANG_ENGLISH]) == 2
+	}, time.Second, 10*time.Millisecond)
+}
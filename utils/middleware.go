@@ -14,16 +14,47 @@ import (
 	"gopkg.in/go-playground/validator.v8"
 )
 
+// Data store replaced in the running server, e.g., reloaded variables.
+// Each request gets the current value.
+type Reloadable interface {
+	Current() interface{}
+}
+
+// Data stores set in each request context by DataStoresMiddleware.
+type DataStores struct {
+	DB        *sql.DB
+	ESManager interface{}
+	Cache     interface{}
+	//Grammars interface{}
+	TokensCache interface{}
+	CMS         interface{}
+	// Variables, or Reloadable variables.
+	Variables        interface{}
+	BestBets         interface{}
+	TypoDictionaries interface{}
+	Transliterator   interface{}
+	Glossary         interface{}
+}
+
 // Set MDB, ES & LOGGER etc. clients in context
-func DataStoresMiddleware(mbdDB *sql.DB, esManager, cm interface{} /*grammars interface{},*/, tc interface{}, cms interface{}, variables interface{}) gin.HandlerFunc {
+func DataStoresMiddleware(stores DataStores) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Set("MDB_DB", mbdDB)
-		c.Set("ES_MANAGER", esManager)
-		c.Set("CACHE", cm)
-		//c.Set("GRAMMARS", grammars)
-		c.Set("VARIABLES", variables)
-		c.Set("TOKENS_CACHE", tc)
-		c.Set("CMS", cms)
+		c.Set("MDB_DB", stores.DB)
+		c.Set("ES_MANAGER", stores.ESManager)
+		c.Set("CACHE", stores.Cache)
+		//c.Set("GRAMMARS", stores.Grammars)
+		if reloadable, ok := stores.Variables.(Reloadable); ok {
+			c.Set("VARIABLES", reloadable.Current())
+			c.Set("VARIABLES_RELOADER", reloadable)
+		} else {
+			c.Set("VARIABLES", stores.Variables)
+		}
+		c.Set("TOKENS_CACHE", stores.TokensCache)
+		c.Set("CMS", stores.CMS)
+		c.Set("BEST_BETS", stores.BestBets)
+		c.Set("TYPO_DICTIONARIES", stores.TypoDictionaries)
+		c.Set("TRANSLITERATOR", stores.Transliterator)
+		c.Set("GLOSSARY", stores.Glossary)
 		c.Next()
 	}
 }